@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+var cacheCmd = cli.Command{
+	Name:        "cache",
+	Usage:       "list and prune the daemon's download cache",
+	Description: CacheDescription,
+	Subcommands: []cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "show the cached files, most recently used first",
+			Action:  cacheListAction,
+			Flags:   globalFlags,
+		},
+		{
+			Name:   "prune",
+			Usage:  "evict the least recently used files",
+			Action: cachePruneAction,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "max-size",
+					Usage: "shrink the cache to this size, e.g. 5GB (default: the configured cap)",
+				},
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "empty the cache",
+				},
+			}, globalFlags...),
+		},
+	},
+	Action: cacheListAction,
+	Flags:  globalFlags,
+}
+
+func cacheListAction(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "cache", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.CacheList()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "cache", "list", err)
+		return nil
+	}
+	fmt.Printf("%s: %s of %s\n", resp.Dir, formatCacheSize(resp.Size), formatCacheSize(resp.MaxSize))
+	if len(resp.Entries) == 0 {
+		fmt.Println("No cached files.")
+		return nil
+	}
+	for _, e := range resp.Entries {
+		url := ""
+		if len(e.Sources) > 0 {
+			url = e.Sources[len(e.Sources)-1].URL
+		}
+		fmt.Printf("%s\t%s\t%d hits, used %s\t%s\n",
+			e.SHA256[:12], formatCacheSize(e.Size), e.Hits, e.LastUsed.Format(time.DateTime), url)
+	}
+	return nil
+}
+
+func cachePruneAction(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	var maxSize int64
+	if s := ctx.String("max-size"); s != "" {
+		n, err := warplib.ParseSpeedLimit(s)
+		if err != nil {
+			return common.PrintErrWithCmdHelp(ctx, fmt.Errorf("invalid max size %q", s))
+		}
+		if n == 0 {
+			return common.PrintErrWithCmdHelp(ctx, errors.New("use --all to empty the cache"))
+		}
+		maxSize = n
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "cache prune", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.CachePrune(maxSize, ctx.Bool("all"))
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "cache prune", "prune", err)
+		return nil
+	}
+	var freed int64
+	for _, e := range resp.Removed {
+		freed += e.Size
+	}
+	fmt.Printf("Removed %d files (%s), %s left.\n", len(resp.Removed), formatCacheSize(freed), formatCacheSize(resp.Size))
+	return nil
+}
+
+// formatCacheSize formats a size in bytes, down to single bytes.
+func formatCacheSize(n int64) string {
+	if n < warplib.KB {
+		return fmt.Sprintf("%d B", n)
+	}
+	return strings.TrimSpace(warplib.ContentLength(n).String())
+}
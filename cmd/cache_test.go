@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/common"
+)
+
+func TestCacheCommands(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	app := cli.NewApp()
+	out, _ := captureOutput(func() {
+		if err := cacheListAction(newContext(app, nil, "ls")); err != nil {
+			t.Fatalf("cacheListAction: %v", err)
+		}
+	})
+	if !strings.Contains(out, "abababababab\t2KB\t3 hits") || !strings.Contains(out, "https://example.com/a.iso") {
+		t.Errorf("unexpected listing:\n%s", out)
+	}
+
+	flags := []struct {
+		name string
+		val  any
+	}{{"max-size", ""}, {"all", false}}
+	out, _ = captureOutput(func() {
+		if err := cachePruneAction(newContextWithFlags(app, flags, []string{"--max-size", "1GB"}, nil, "prune")); err != nil {
+			t.Fatalf("cachePruneAction: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Removed 1 files (2KB), 0 B left.") {
+		t.Errorf("unexpected prune output: %q", out)
+	}
+	if err := cachePruneAction(newContextWithFlags(app, flags, []string{"--max-size", "lots"}, nil, "prune")); err == nil {
+		t.Error("cachePruneAction accepted an invalid size")
+	}
+}
+
+func TestCacheList_ServerError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath, map[common.UpdateType]string{
+		common.UPDATE_CACHE_LIST: "download cache not enabled",
+	})
+	defer srv.close()
+
+	if err := cacheListAction(newContext(cli.NewApp(), nil, "ls")); err != nil {
+		t.Fatalf("cacheListAction should report runtime errors without failing: %v", err)
+	}
+}
@@ -84,11 +84,47 @@ func compileComplete(dr *common.DownloadingResponse) error {
 
 func compileProgress(bar *mpb.Bar) func(dr *common.DownloadingResponse) error {
 	return func(dr *common.DownloadingResponse) error {
+		if dr.Hash == warplib.EXTRACT_HASH {
+			return nil
+		}
 		bar.IncrBy(int(dr.Value))
 		return nil
 	}
 }
 
+// extractBar shows the extraction of a downloaded archive, reported
+// through the compile events of warplib.EXTRACT_HASH. The bar is only
+// added once extraction starts, most downloads never extract.
+type extractBar struct {
+	p      *mpb.Progress
+	length int64
+	bar    *mpb.Bar
+}
+
+func (e *extractBar) start(dr *common.DownloadingResponse) error {
+	if dr.Hash != warplib.EXTRACT_HASH || e.bar != nil {
+		return nil
+	}
+	e.bar = cmdCommon.InitExtractBar(e.p, "", e.length)
+	return nil
+}
+
+func (e *extractBar) progress(dr *common.DownloadingResponse) error {
+	if dr.Hash != warplib.EXTRACT_HASH || e.bar == nil {
+		return nil
+	}
+	e.bar.IncrBy(int(dr.Value))
+	return nil
+}
+
+func (e *extractBar) complete(dr *common.DownloadingResponse) error {
+	if dr.Hash != warplib.EXTRACT_HASH || e.bar == nil || e.bar.Completed() {
+		return nil
+	}
+	e.bar.SetTotal(dr.Value, true)
+	return nil
+}
+
 // RegisterHandlersWithProgress registers all download event handlers with
 // initial progress for resume scenarios.
 func RegisterHandlersWithProgress(client *warpcli.Client, contentLength int64, initialProgress int64) {
@@ -126,6 +162,19 @@ func RegisterHandlersWithProgress(client *warpcli.Client, contentLength int64, i
 		common.UPDATE_DOWNLOADING,
 		warpcli.NewDownloadingHandler(common.CompileStart, compileStart),
 	)
+	xbar := &extractBar{p: p, length: contentLength}
+	client.AddHandler(
+		common.UPDATE_DOWNLOADING,
+		warpcli.NewDownloadingHandler(common.CompileStart, xbar.start),
+	)
+	client.AddHandler(
+		common.UPDATE_DOWNLOADING,
+		warpcli.NewDownloadingHandler(common.CompileProgress, xbar.progress),
+	)
+	client.AddHandler(
+		common.UPDATE_DOWNLOADING,
+		warpcli.NewDownloadingHandler(common.CompileComplete, xbar.complete),
+	)
 }
 
 // RegisterHandlers maintains backward compatibility for fresh downloads.
@@ -126,3 +126,39 @@ func TestDownloadComplete_BothBarsCompleted(t *testing.T) {
 		t.Error("expected compile bar to remain completed")
 	}
 }
+
+func TestExtractBar(t *testing.T) {
+	p := mpb.New()
+	cbar := p.AddBar(10)
+	xbar := &extractBar{p: p, length: 10}
+
+	// compile events of the download don't start the extraction bar
+	if err := xbar.start(&common.DownloadingResponse{Hash: warplib.MAIN_HASH}); err != nil || xbar.bar != nil {
+		t.Fatalf("start(main) = %v, bar %v", err, xbar.bar)
+	}
+	if err := xbar.progress(&common.DownloadingResponse{Hash: warplib.EXTRACT_HASH, Value: 1}); err != nil {
+		t.Fatalf("progress before start: %v", err)
+	}
+
+	if err := xbar.start(&common.DownloadingResponse{Hash: warplib.EXTRACT_HASH}); err != nil || xbar.bar == nil {
+		t.Fatalf("start(extract) = %v, bar %v", err, xbar.bar)
+	}
+	if err := compileProgress(cbar)(&common.DownloadingResponse{Hash: warplib.EXTRACT_HASH, Value: 4}); err != nil {
+		t.Fatalf("compileProgress(extract): %v", err)
+	}
+	if cbar.Current() != 0 {
+		t.Errorf("compile bar advanced by extraction to %d", cbar.Current())
+	}
+	if err := xbar.progress(&common.DownloadingResponse{Hash: warplib.EXTRACT_HASH, Value: 4}); err != nil {
+		t.Fatalf("progress: %v", err)
+	}
+	if xbar.bar.Current() != 4 {
+		t.Errorf("extract bar = %d, want 4", xbar.bar.Current())
+	}
+	if err := xbar.complete(&common.DownloadingResponse{Hash: warplib.EXTRACT_HASH, Value: 9}); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if !xbar.bar.Completed() {
+		t.Error("extract bar not completed")
+	}
+}
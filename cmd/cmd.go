@@ -113,6 +113,16 @@ func GetApp(bArgs BuildArgs) *cli.App {
 			Usage:  "stop a running download",
 			Flags:  globalFlags,
 		},
+		{
+			Name:                   "set",
+			Usage:                  "change the speed limit or connections of a running download",
+			Description:            SetDescription,
+			OnUsageError:           common.UsageErrorCallback,
+			CustomHelpTemplate:     CMD_HELP_TEMPL,
+			Action:                 set,
+			UseShortOptionHandling: true,
+			Flags:                  append(setFlags, globalFlags...),
+		},
 		{
 			Name:   "attach",
 			Action: attach,
@@ -163,7 +173,52 @@ func GetApp(bArgs BuildArgs) *cli.App {
 			UseShortOptionHandling: true,
 			Flags:                  append(flsFlags, globalFlags...),
 		},
+		{
+			Name:                   "repair",
+			Usage:                  "repair the corrupted pieces of a download",
+			Description:            RepairDescription,
+			OnUsageError:           common.UsageErrorCallback,
+			CustomHelpTemplate:     CMD_HELP_TEMPL,
+			Action:                 repair,
+			UseShortOptionHandling: true,
+			Flags:                  append(repairFlags, globalFlags...),
+		},
+		{
+			Name:                   "verify",
+			Usage:                  "verify the files of completed downloads",
+			Description:            VerifyDescription,
+			OnUsageError:           common.UsageErrorCallback,
+			CustomHelpTemplate:     CMD_HELP_TEMPL,
+			Action:                 verify,
+			UseShortOptionHandling: true,
+			Flags:                  append(verifyFlags, globalFlags...),
+		},
+		{
+			Name:                   "export",
+			Usage:                  "export the history of downloads",
+			Description:            ExportDescription,
+			OnUsageError:           common.UsageErrorCallback,
+			CustomHelpTemplate:     CMD_HELP_TEMPL,
+			Action:                 export,
+			UseShortOptionHandling: true,
+			Flags:                  append(exportFlags, globalFlags...),
+		},
+		{
+			Name:                   "import",
+			Usage:                  "import a history of downloads",
+			Description:            ImportDescription,
+			OnUsageError:           common.UsageErrorCallback,
+			CustomHelpTemplate:     CMD_HELP_TEMPL,
+			Action:                 importHistory,
+			UseShortOptionHandling: true,
+			Flags:                  append(importFlags, globalFlags...),
+		},
 		queueCmd,
+		policyCmd,
+		webhookCmd,
+		zipCmd,
+		cacheCmd,
+		keysCmd,
 		{
 			Name:    "help",
 			Aliases: []string{"h"},
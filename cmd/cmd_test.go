@@ -38,6 +38,13 @@ type fakeServer struct {
 }
 
 var listOverride []*warplib.Item
+
+// listParams records the parameters of the latest list request received by
+// the fake server.
+var listParams struct {
+	sync.Mutex
+	common.ListParams
+}
 var queueStatusOverride *common.QueueStatusResponse
 
 func (s *fakeServer) close() {
@@ -167,7 +174,23 @@ func startFakeServer(t *testing.T, socketPath string, fail ...map[common.UpdateT
 								Parts:      make(map[int64]*warplib.ItemPart),
 							}}
 						}
-						resp := common.ListResponse{Items: items}
+						var params common.ListParams
+						_ = json.Unmarshal(req.Message, &params)
+						listParams.Lock()
+						listParams.ListParams = params
+						listParams.Unlock()
+						// the daemon filters hidden items and categories
+						resp := common.ListResponse{Items: []*warplib.Item{}}
+						for _, item := range items {
+							if !params.ShowHidden && (item.Hidden || item.Children) {
+								continue
+							}
+							if params.Category != "" && !strings.EqualFold(item.Category, params.Category) {
+								continue
+							}
+							resp.Items = append(resp.Items, item)
+						}
+						resp.Total = len(resp.Items)
 						writeResponse(c, req.Method, resp)
 						return // One-shot command, exit loop
 					case common.UPDATE_QUEUE_STATUS:
@@ -177,6 +200,69 @@ func startFakeServer(t *testing.T, socketPath string, fail ...map[common.UpdateT
 						}
 						writeResponse(c, req.Method, qsResp)
 						return
+					case common.UPDATE_SET:
+						writeResponse(c, req.Method, common.SetResponse{DownloadId: "id", SpeedLimit: 1024, MaxConnections: 8})
+						return
+					case common.UPDATE_POLICY_STATUS, common.UPDATE_POLICY_OVERRIDE, common.UPDATE_POLICY_CLEAR:
+						writeResponse(c, req.Method, common.PolicyStatusResponse{Action: "full"})
+						return
+					case common.UPDATE_WEBHOOK_LIST:
+						writeResponse(c, req.Method, common.WebhookListResponse{Webhooks: []common.WebhookInfo{
+							{ID: "bot", URL: "http://localhost:9000/hook", Signed: true, Failures: 2},
+						}})
+						return
+					case common.UPDATE_WEBHOOK_TEST:
+						writeResponse(c, req.Method, common.WebhookTestResponse{Results: []common.WebhookTestResult{
+							{ID: "bot", URL: "http://localhost:9000/hook"},
+							{ID: "dash", URL: "https://dash.example.com", Error: "unexpected status 404 Not Found"},
+						}})
+						return
+					case common.UPDATE_CACHE_LIST:
+						writeResponse(c, req.Method, common.CacheListResponse{Dir: "/cache", MaxSize: 10 << 30, Size: 2048, Entries: []warplib.CacheEntry{
+							{SHA256: strings.Repeat("ab", 32), Size: 2048, Hits: 3, Sources: []warplib.CacheSource{{URL: "https://example.com/a.iso"}}},
+						}})
+						return
+					case common.UPDATE_KEYS_ADD:
+						writeResponse(c, req.Method, common.KeysAddResponse{Key: warplib.TrustedKey{Name: "release", Format: warplib.KeyOpenPGP, ID: "0123ABCD"}})
+						return
+					case common.UPDATE_KEYS_LIST:
+						writeResponse(c, req.Method, common.KeysListResponse{Dir: "/keys", Keys: []warplib.TrustedKey{
+							{Name: "release", Format: warplib.KeyMinisign, ID: "0123ABCD", Comment: "minisign public key"},
+						}})
+						return
+					case common.UPDATE_KEYS_REMOVE:
+						writeResponse(c, req.Method, nil)
+						return
+					case common.UPDATE_CACHE_PRUNE:
+						writeResponse(c, req.Method, common.CachePruneResponse{Removed: []warplib.CacheEntry{{SHA256: strings.Repeat("ab", 32), Size: 2048}}})
+						return
+					case common.UPDATE_REPAIR:
+						writeResponse(c, req.Method, common.RepairResponse{RepairResult: warplib.RepairResult{Pieces: 8, Corrupt: 2, Refetched: 2048, Verified: true}})
+						return
+					case common.UPDATE_VERIFY:
+						writeResponse(c, common.UPDATE_VERIFYING, common.VerifyingResponse{DownloadId: "id", Hashed: 512, Size: 1024})
+						results := []*warplib.VerifyResult{
+							{Hash: "id", Path: "/dl/a.iso", Status: warplib.VerifyOK},
+							{Hash: "id2", Path: "/archive/b.iso", MovedFrom: "/dl/b.iso", Status: warplib.VerifyMoved},
+							{Hash: "id3", Path: "/dl/c.iso", Status: warplib.VerifyModified},
+						}
+						for _, res := range results {
+							writeResponse(c, common.UPDATE_VERIFYING, common.VerifyingResponse{DownloadId: res.Hash, Result: res})
+						}
+						writeResponse(c, req.Method, common.VerifyResponse{Results: results})
+						return
+					case common.UPDATE_EXPORT:
+						writeResponse(c, req.Method, common.ExportResponse{History: &warplib.History{
+							Version: warplib.HistoryVersion,
+							Items: []*warplib.Item{
+								{Hash: "id", Name: "a.iso", Url: "https://example.com/a.iso", TotalSize: 10, Downloaded: 10},
+								{Hash: "id2", Name: "b.iso", Url: "https://example.com/b.iso", TotalSize: 10, AbsoluteLocation: "/dl"},
+							},
+						}})
+						return
+					case common.UPDATE_IMPORT:
+						writeResponse(c, req.Method, common.ImportResponse{ImportResult: warplib.ImportResult{Imported: 2, Skipped: 1, Resumable: 1}})
+						return
 					case common.UPDATE_STOP, common.UPDATE_FLUSH:
 						writeResponse(c, req.Method, nil)
 						return // One-shot command, exit loop
@@ -85,6 +85,29 @@ func InitBars(p *mpb.Progress, prefix string, cLength int64) (dbar *mpb.Bar, cba
 	return
 }
 
+// InitExtractBar creates the progress bar of an archive being extracted,
+// which advances with the compressed bytes read out of the archive of
+// cLength bytes. Extraction may not read the whole archive, so the bar is
+// completed by its caller rather than on reaching cLength.
+func InitExtractBar(p *mpb.Progress, prefix string, cLength int64) *mpb.Bar {
+	barStyle := mpb.BarStyle().Lbound("╢").Filler("█").Tip("█").Padding("░").Rbound("╟")
+	name := prefix + "Extracting"
+	xbar := p.New(0,
+		barStyle,
+		mpb.PrependDecorators(
+			decor.Name(name, decor.WC{W: len(name) + 1, C: decor.DindentRight}),
+			decor.OnComplete(
+				decor.AverageETA(decor.ET_STYLE_GO, decor.WC{W: 4}), "Complete",
+			),
+		),
+		mpb.AppendDecorators(
+			decor.AverageSpeed(decor.SizeB1024(0), "% .2f"),
+		),
+	)
+	xbar.SetTotal(cLength, false)
+	return xbar
+}
+
 // InitBarsWithProgress creates progress bars with an initial progress value.
 // This is used when resuming downloads where some bytes are already downloaded.
 // The initialProgress parameter sets the starting position of the download bar.
@@ -27,6 +27,13 @@ func TestInitBars(t *testing.T) {
 	}
 }
 
+func TestInitExtractBar(t *testing.T) {
+	p := mpb.New()
+	if xbar := InitExtractBar(p, "", 100); xbar == nil {
+		t.Fatal("expected bar")
+	}
+}
+
 // TestInitBarsWithProgress verifies that progress bars can be initialized
 // with a non-zero starting position for resume scenarios.
 // Note: mpb.Bar doesn't expose a public Current() getter, so we can only verify
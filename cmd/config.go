@@ -28,8 +28,16 @@ const (
 downloads along with their unique download hashes
 which can be used to resume pending downloads.
 
+The daemon filters, sorts and pages the listing, so
+it stays quick with thousands of downloads. A failed
+download is one whose latest attempt ended in error.
+
 Example:
         warpdl list
+        warpdl list --status failed,scheduled
+        warpdl list -a --search ubuntu --host example.com
+        warpdl list -a --since 2024-01-01 --min-size 1GB
+        warpdl list -a --sort size --limit 20 --offset 20
 
 `
 	InfoDescription = `The info command makes a GET request to the entered
@@ -71,6 +79,17 @@ using "warpdl list" command.
 Example:
         warpdl resume <unique download hash>
 
+`
+	SetDescription = `The set command changes the speed limit and the number
+of parallel connections of a running download without
+restarting it. Raising the connections splits the running
+parts, lowering them parks parts until a connection is free.
+Downloaded data is kept in both cases.
+
+Example:
+        warpdl set <unique download hash> --speed-limit 1MB --max-connection 8
+        warpdl set <unique download hash> -S 0
+
 `
 	FlushDescription = `The flush command deletes download history for the current
 user, it will also delete incomplete downloads and their date.
@@ -79,5 +98,155 @@ Example:
         warpdl flush
 		warpdl flush [HASH]
 
+`
+	RepairDescription = `The repair command checks a completed download against
+the hashes of its pieces, recorded while it was downloaded or published in
+a metalink file next to it, and downloads only the corrupted or missing
+pieces again.
+
+Example:
+        warpdl repair <unique download hash>
+        warpdl repair <unique download hash> -x 8
+
+`
+	VerifyDescription = `The verify command rehashes the files of completed downloads
+in the daemon and compares them with the checksums kept when they were
+downloaded. Each download is reported as ok, modified, missing, moved
+(found in a --search directory, the download then points to it) or
+unrecorded (no checksum was kept, the one computed is kept from now on).
+It exits with status 1 if any file is modified or missing.
+
+Example:
+        warpdl verify <unique download hash>
+        warpdl verify --all --search /mnt/archive
+        warpdl verify --all --redownload
+
+`
+	ExportDescription = `The export command writes the history of the downloads
+in the daemon and the order of its queue, as JSON to be imported again, as
+CSV for spreadsheets or as an aria2 input file of the incomplete
+downloads. Credentials (auth headers, cookies, passwords in urls) are left
+out unless --secrets is given.
+
+Example:
+        warpdl export -O history.json
+        warpdl export --format csv > downloads.csv
+        warpdl export --format aria2 --secrets -O session.txt
+
+`
+	ImportDescription = `The import command adds the downloads of a history written
+by export to the daemon, with their headers, schedules and priorities, and
+queues the ones which were waiting again. Downloads the daemon already
+has are skipped. Incomplete downloads resume where they stopped if the
+data of their parts was copied to the daemon's data directory, and start
+over otherwise.
+
+It also reads the download lists of other managers: aria2 session files
+(--save-session), JDownloader .crawljob files and uGet category files.
+Their downloads are added in order, with their file names, directories,
+headers, checksums and priorities. The format is told from the file
+unless --format is given.
+
+Example:
+        warpdl import history.json
+        warpdl import history.json -l ~/Downloads
+        warpdl import ~/.aria2/session.txt
+        warpdl import links.crawljob
+        warpdl import --format uget ~/.config/uGet/category/Home.json
+
+`
+	PolicyDescription = `The policy command shows and overrides the daemon's
+time-window policies. Policies are read at daemon start from
+policy.json in the warpdl config directory, for example:
+
+        {"windows": [
+          {"name": "night", "from": "01:00", "to": "07:00", "action": "full"},
+          {"name": "office", "days": "mon-fri", "from": "09:00", "to": "17:00",
+           "action": "limit", "speed_limit": "500KB"},
+          {"name": "calls", "days": "tue,thu", "from": "14:00", "to": "15:00",
+           "action": "pause"}
+        ]}
+
+Later windows take precedence when windows overlap. Outside of
+all windows downloads run at full speed.
+
+Example:
+        warpdl policy
+        warpdl policy override pause --for 1h
+        warpdl policy override limit --speed-limit 200KB --until 18:00
+        warpdl policy clear
+
+`
+	WebhookDescription = `The webhook command lists and tests the endpoints the daemon
+posts download events to. Webhooks are read at daemon start from
+webhooks.json in the warpdl config directory, or added through the
+JSON-RPC method webhook.add, for example:
+
+        {"webhooks": [
+          {"id": "dashboard", "url": "https://dash.example.com/warpdl",
+           "secret": "s3cr3t"},
+          {"id": "bot", "url": "http://localhost:9000/hook",
+           "events": ["download.complete", "download.error"]}
+        ]}
+
+Events are download.added, download.started, download.progress
+(every 25%), download.complete and download.error; all of them
+when "events" is left out. With a secret, the X-Warpdl-Signature
+header is "sha256=" followed by the HMAC-SHA256 of the body.
+
+Example:
+        warpdl webhook list
+        warpdl webhook test
+        warpdl webhook test dashboard
+
+`
+	ZipDescription = `The zip command reads a zip archive on a server supporting
+range requests without downloading all of it. "ls" fetches only the
+central directory at the end of the archive, "get" then fetches the
+bytes of the requested files alone, inflates them and verifies their
+CRC-32. Files are saved by their base name.
+
+Example:
+        warpdl zip ls https://domain.com/dataset.zip
+        warpdl zip get https://domain.com/dataset.zip data/2024/march.csv
+        warpdl zip get -O - https://domain.com/dataset.zip README.md | less
+
+`
+	CacheDescription = `The cache command lists and prunes the daemon's download cache.
+The cache is enabled by cache.json in the warpdl config directory:
+
+        {"dir": "~/.cache/warpdl", "max_size": 21474836480}
+
+"dir" defaults to the cache directory inside the config directory
+and "max_size", in bytes, to 10GB. Completed downloads are stored in
+it by their SHA-256. A download whose SHA-256 the server announces,
+or whose URL and strong ETag match a cached file, is hard-linked or
+copied out of the cache instead of downloaded. The least recently
+used files are evicted beyond the size cap.
+
+Example:
+        warpdl cache ls
+        warpdl cache prune --max-size 5GB
+        warpdl cache prune --all
+
+`
+	KeysDescription = `The keys command manages the keyring of public keys trusted to sign
+downloads, kept in the keys directory inside the warpdl config directory.
+OpenPGP (armored or binary), minisign, signify and SSH public keys are
+accepted.
+
+With --verify-sig, a download is verified against its detached signature
+once complete: .asc and .sig OpenPGP signatures, .minisig and signify
+signatures, and SSH signatures made with "ssh-keygen -Y sign -n file".
+The signer is kept with the download. A file without a valid signature by
+a trusted key fails the download like a checksum mismatch.
+
+Example:
+        warpdl keys add release-signing.asc
+        warpdl keys add --name openbsd openbsd-76-base.pub
+        warpdl keys ls
+        warpdl keys rm openbsd
+        warpdl download --verify-sig auto https://example.com/app.tar.gz
+
 `
 )
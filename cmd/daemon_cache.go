@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// loadCache opens the daemon's download cache if the config directory has a cache file.
+// An invalid file or cache directory is logged and leaves the cache disabled.
+func loadCache(log logger.Logger) *warplib.Cache {
+	cfg, err := warplib.LoadCacheConfig(filepath.Join(warplib.ConfigDir, warplib.CacheFileName))
+	if err != nil {
+		log.Error("Cache file ignored: %v", err)
+		return nil
+	}
+	if cfg == nil {
+		return nil
+	}
+	c, err := warplib.OpenCache(cfg)
+	if err != nil {
+		log.Error("Cache disabled: %v", err)
+		return nil
+	}
+	log.Info("Caching downloads in %s (%d files)", c.Dir(), len(c.Entries()))
+	return c
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestLoadCache(t *testing.T) {
+	newTestManager(t)
+	path := filepath.Join(warplib.ConfigDir, warplib.CacheFileName)
+
+	if c := loadCache(logger.NewNopLogger()); c != nil {
+		t.Fatalf("expected no cache without a file, got %s", c.Dir())
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(path, []byte(`{"dir":"`+filepath.ToSlash(dir)+`","max_size":1024}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := loadCache(logger.NewNopLogger())
+	if c == nil || c.Dir() != filepath.Clean(dir) || c.MaxSize() != 1024 {
+		t.Fatalf("unexpected cache: %+v", c)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"max_size":-1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c := loadCache(logger.NewNopLogger()); c != nil {
+		t.Fatalf("expected no cache for invalid file, got %s", c.Dir())
+	}
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// loadCategoryConfig reads the daemon's download categories from the config directory.
+// An invalid file is logged and ignored so the daemon still starts with the built-in categories.
+func loadCategoryConfig(log logger.Logger) *warplib.CategoryConfig {
+	cfg, err := warplib.LoadCategoryConfig(filepath.Join(warplib.ConfigDir, warplib.CategoriesFileName))
+	if err != nil {
+		log.Error("Categories file ignored: %v", err)
+		return &warplib.CategoryConfig{}
+	}
+	if len(cfg.Categories) > 0 {
+		log.Info("Loaded %d categories from %s", len(cfg.Categories), warplib.CategoriesFileName)
+	}
+	return cfg
+}
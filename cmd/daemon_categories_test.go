@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestLoadCategoryConfig(t *testing.T) {
+	newTestManager(t)
+	path := filepath.Join(warplib.ConfigDir, warplib.CategoriesFileName)
+
+	if cfg := loadCategoryConfig(logger.NewNopLogger()); len(cfg.Categories) != 0 {
+		t.Fatalf("expected no categories without a file, got %+v", cfg)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(path, []byte(`{"categories":[{"name":"Video","dir":"`+filepath.ToSlash(dir)+`"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadCategoryConfig(logger.NewNopLogger())
+	if len(cfg.Categories) != 1 || cfg.Categories[0].Dir != filepath.Clean(dir) {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"categories":[{"name":"a","regex":"("}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := loadCategoryConfig(logger.NewNopLogger()); len(cfg.Categories) != 0 {
+		t.Fatalf("expected no categories for invalid file, got %+v", cfg)
+	}
+}
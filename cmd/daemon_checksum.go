@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// checksumMismatchEnv sets what the daemon does with files failing their checksum.
+const checksumMismatchEnv = "WARPDL_CHECKSUM_MISMATCH"
+
+// checksumSidecarsEnv adds comma-separated checksum file patterns tried with --checksum auto.
+const checksumSidecarsEnv = "WARPDL_CHECKSUM_SIDECARS"
+
+// loadChecksumConfig returns the daemon's checksum validation config, failing the download
+// and keeping the file on a mismatch by default. An invalid value is logged and the default used.
+// Checksum file patterns from the environment are tried before the built-in ones.
+func loadChecksumConfig(log logger.Logger) *warplib.ChecksumConfig {
+	cfg := warplib.DefaultChecksumConfig()
+	a, err := warplib.ParseChecksumMismatchAction(os.Getenv(checksumMismatchEnv))
+	if err != nil {
+		log.Error("%s ignored: %v", checksumMismatchEnv, err)
+		a = warplib.ChecksumMismatchFail
+	}
+	cfg.OnMismatch = a
+	for _, p := range strings.Split(os.Getenv(checksumSidecarsEnv), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.Sidecars = append(cfg.Sidecars, p)
+		}
+	}
+	return &cfg
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestLoadChecksumConfig(t *testing.T) {
+	for env, want := range map[string]warplib.ChecksumMismatchAction{
+		"":           warplib.ChecksumMismatchFail,
+		"quarantine": warplib.ChecksumMismatchQuarantine,
+		"DELETE":     warplib.ChecksumMismatchDelete,
+		"ignore":     warplib.ChecksumMismatchFail,
+	} {
+		t.Setenv(checksumMismatchEnv, env)
+		cfg := loadChecksumConfig(logger.NewNopLogger())
+		if !cfg.Enabled || !cfg.FailOnMismatch || cfg.OnMismatch != want {
+			t.Errorf("loadChecksumConfig(%q) = %+v, want %q", env, cfg, want)
+		}
+	}
+}
+
+func TestLoadChecksumConfigSidecars(t *testing.T) {
+	t.Setenv(checksumSidecarsEnv, " {dir}/RELEASE.sha256 ,, {url}.asc.sha256")
+	cfg := loadChecksumConfig(logger.NewNopLogger())
+	if len(cfg.Sidecars) != 2 || cfg.Sidecars[0] != "{dir}/RELEASE.sha256" || cfg.Sidecars[1] != "{url}.asc.sha256" {
+		t.Errorf("Sidecars = %q", cfg.Sidecars)
+	}
+}
@@ -14,8 +14,10 @@ import (
 	"github.com/warpdl/warpdl/internal/api"
 	"github.com/warpdl/warpdl/internal/cookies"
 	"github.com/warpdl/warpdl/internal/extl"
+	"github.com/warpdl/warpdl/internal/hooks"
 	"github.com/warpdl/warpdl/internal/scheduler"
 	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/internal/webhook"
 	"github.com/warpdl/warpdl/pkg/credman"
 	"github.com/warpdl/warpdl/pkg/logger"
 	"github.com/warpdl/warpdl/pkg/warplib"
@@ -43,6 +45,8 @@ type DaemonComponents struct {
 	Api             *api.Api
 	Server          *server.Server
 	Scheduler       *scheduler.Scheduler
+	Policy          *scheduler.Policy
+	Webhooks        *webhook.Dispatcher
 	schedulerCancel context.CancelFunc
 	logger          logger.Logger
 	stdLogger       interface{ Println(v ...interface{}) }
@@ -72,6 +76,11 @@ func (c *DaemonComponents) Close() {
 		c.schedulerCancel()
 	}
 
+	// Drop pending webhook deliveries
+	if c.Webhooks != nil {
+		c.Webhooks.Close()
+	}
+
 	// Close API (closes manager, flushes state)
 	if c.Api != nil {
 		_ = c.Api.Close()
@@ -137,6 +146,35 @@ var initDaemonComponents = func(log logger.Logger, maxConcurrent int, rpcCfg *se
 		return nil, err
 	}
 
+	// Limit connections per host across all downloads.
+	m.SetHostLimits(loadHostLimits(log))
+
+	// Journal durably written ranges for exact resume after a crash.
+	m.SetJournalConfig(loadJournalConfig(log))
+
+	// Extract archives matching the auto-extract rules once they complete.
+	m.SetExtractConfig(loadExtractConfig(log))
+	// Sort downloads into categories, moving completed ones into their directories.
+	m.SetCategoryConfig(loadCategoryConfig(log))
+	// Catch downloads of a URL, path or checksum the daemon already has.
+	m.SetDuplicatePolicy(loadDuplicatePolicy(log))
+	// Fail, quarantine or delete downloads whose file fails its checksum.
+	m.SetChecksumConfig(loadChecksumConfig(log))
+	// Serve repeated downloads from the cache and add completed ones to it.
+	m.SetCache(loadCache(log))
+	// Verify signatures of downloads against the trusted keys.
+	m.SetKeyring(loadKeyring(log))
+
+	// Run the global and per-download hook commands at download events.
+	m.AddEventHandler(hooks.NewRunner(m, loadHooksConfig(log), log).HandleEvent)
+
+	// Push download events to the subscribed webhooks.
+	var webhooks *webhook.Dispatcher
+	if cfg := loadWebhooksConfig(log); cfg != nil {
+		webhooks = webhook.NewDispatcher(warplib.ConfigDir, cfg, log)
+		m.AddEventHandler(webhooks.HandleEvent)
+	}
+
 	// Set up download queue if max-concurrent is specified
 	if maxConcurrent > 0 {
 		// onStartDownload is called by the queue when a slot becomes available
@@ -280,6 +318,9 @@ var initDaemonComponents = func(log logger.Logger, maxConcurrent int, rpcCfg *se
 	if err != nil {
 		log.Error("API initialization failed: %v", err)
 		schedCancel()
+		if webhooks != nil {
+			webhooks.Close()
+		}
 		m.Close()
 		elEng.Close()
 		cm.Close()
@@ -290,6 +331,31 @@ var initDaemonComponents = func(log logger.Logger, maxConcurrent int, rpcCfg *se
 	serv := server.NewServer(stdLog, m, DEF_PORT, client, router, rpcCfg)
 	s.RegisterHandlers(serv)
 
+	// Apply time-window policies (active hours and bandwidth schedules).
+	// Boundaries run on their own scheduler tied to the same context.
+	// Downloads stopped by a pause window are resumed through the API, so
+	// the handlers must be registered first.
+	policy, err := scheduler.NewPolicy(schedCtx, loadPolicyConfig(log), &policyApplier{
+		m:       m,
+		resumer: s,
+		log:     log,
+	})
+	if err != nil {
+		log.Error("Policy initialization failed: %v", err)
+		schedCancel()
+		if webhooks != nil {
+			webhooks.Close()
+		}
+		m.Close()
+		elEng.Close()
+		cm.Close()
+		return nil, err
+	}
+	s.SetPolicy(policy)
+	serv.SetPolicy(policy)
+	s.SetWebhooks(webhooks)
+	serv.SetWebhooks(webhooks)
+
 	return &DaemonComponents{
 		CookieManager:   cm,
 		ExtEngine:       elEng,
@@ -297,6 +363,8 @@ var initDaemonComponents = func(log logger.Logger, maxConcurrent int, rpcCfg *se
 		Api:             s,
 		Server:          serv,
 		Scheduler:       sched,
+		Policy:          policy,
+		Webhooks:        webhooks,
 		schedulerCancel: schedCancel,
 		logger:          log,
 		stdLogger:       stdLog,
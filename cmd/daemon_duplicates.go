@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// duplicatePolicyEnv sets the daemon's policy for duplicate downloads.
+const duplicatePolicyEnv = "WARPDL_ON_DUPLICATE"
+
+// loadDuplicatePolicy returns the daemon's policy for downloads duplicating an existing one,
+// attaching to it by default. An invalid value is logged and the default used.
+func loadDuplicatePolicy(log logger.Logger) warplib.DuplicatePolicy {
+	p, err := warplib.ParseDuplicatePolicy(os.Getenv(duplicatePolicyEnv))
+	if err != nil {
+		log.Error("%s ignored: %v", duplicatePolicyEnv, err)
+		return warplib.DuplicateAttach
+	}
+	if p == "" {
+		return warplib.DuplicateAttach
+	}
+	return p
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestLoadDuplicatePolicy(t *testing.T) {
+	for env, want := range map[string]warplib.DuplicatePolicy{
+		"":       warplib.DuplicateAttach,
+		"refuse": warplib.DuplicateRefuse,
+		"ALLOW":  warplib.DuplicateAllow,
+		"skip":   warplib.DuplicateAttach,
+	} {
+		t.Setenv(duplicatePolicyEnv, env)
+		if got := loadDuplicatePolicy(logger.NewNopLogger()); got != want {
+			t.Errorf("loadDuplicatePolicy(%q) = %q, want %q", env, got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// loadExtractConfig reads the daemon's auto-extract rules and limits from the config directory.
+// An invalid file is logged and ignored so the daemon still starts, with no rules and default limits.
+func loadExtractConfig(log logger.Logger) *warplib.ExtractConfig {
+	cfg, err := warplib.LoadExtractConfig(filepath.Join(warplib.ConfigDir, warplib.ExtractFileName))
+	if err != nil {
+		log.Error("Extract rules disabled: %v", err)
+		return &warplib.ExtractConfig{}
+	}
+	if len(cfg.Rules) > 0 {
+		log.Info("Loaded %d extract rules from %s", len(cfg.Rules), warplib.ExtractFileName)
+	}
+	return cfg
+}
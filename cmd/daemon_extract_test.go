@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestLoadExtractConfig(t *testing.T) {
+	newTestManager(t)
+	path := filepath.Join(warplib.ConfigDir, warplib.ExtractFileName)
+
+	if cfg := loadExtractConfig(logger.NewNopLogger()); len(cfg.Rules) != 0 {
+		t.Fatalf("expected no rules without a file, got %+v", cfg)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"limits":{"max_files":10},"rules":[{"match":"*.zip","delete_archive":true}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadExtractConfig(logger.NewNopLogger())
+	if len(cfg.Rules) != 1 || !cfg.Rules[0].DeleteArchive || cfg.Limits.MaxFiles != 10 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rules":[{"match":"["}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := loadExtractConfig(logger.NewNopLogger()); len(cfg.Rules) != 0 {
+		t.Fatalf("expected no rules for invalid file, got %+v", cfg)
+	}
+}
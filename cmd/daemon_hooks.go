@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/warpdl/warpdl/internal/hooks"
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// loadHooksConfig reads the daemon's global hooks from the config directory.
+// An invalid file is logged and ignored so the daemon still starts, without global hooks.
+func loadHooksConfig(log logger.Logger) *hooks.Config {
+	cfg, err := hooks.Load(filepath.Join(warplib.ConfigDir, hooks.FileName))
+	if err != nil {
+		log.Error("Global hooks disabled: %v", err)
+		return nil
+	}
+	if !cfg.IsEmpty() {
+		log.Info("Global hooks loaded from %s", hooks.FileName)
+	}
+	return cfg
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// loadHostLimits reads the daemon's per-host connection limits from the config directory.
+// An invalid file is logged and ignored so the daemon still starts.
+func loadHostLimits(log logger.Logger) *warplib.HostLimits {
+	limits, err := warplib.LoadHostLimits(filepath.Join(warplib.ConfigDir, warplib.HostLimitsFileName))
+	if err != nil {
+		log.Error("Per-host connection limits disabled: %v", err)
+		return &warplib.HostLimits{}
+	}
+	if limits.Default > 0 || len(limits.Hosts) > 0 {
+		log.Info("Per-host connection limits: default %d, %d host overrides", limits.Default, len(limits.Hosts))
+	}
+	return limits
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestLoadHostLimits(t *testing.T) {
+	newTestManager(t)
+	path := filepath.Join(warplib.ConfigDir, warplib.HostLimitsFileName)
+
+	if limits := loadHostLimits(logger.NewNopLogger()); limits.Default != 0 || len(limits.Hosts) != 0 {
+		t.Fatalf("expected no limits without a file, got %+v", limits)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"default":8,"hosts":{"example.com":2}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	limits := loadHostLimits(logger.NewNopLogger())
+	if limits.Default != 8 || limits.Hosts["example.com"] != 2 {
+		t.Fatalf("unexpected limits: %+v", limits)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"default":-1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if limits := loadHostLimits(logger.NewNopLogger()); limits.Default != 0 {
+		t.Fatalf("expected no limits for invalid file, got %+v", limits)
+	}
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// loadJournalConfig reads the daemon's progress journal config from the config directory.
+// An invalid file is logged and ignored so the daemon still starts, with the journal off.
+func loadJournalConfig(log logger.Logger) *warplib.JournalConfig {
+	cfg, err := warplib.LoadJournalConfig(filepath.Join(warplib.ConfigDir, warplib.JournalConfigFileName))
+	if err != nil {
+		log.Error("Progress journal disabled: %v", err)
+		return &warplib.JournalConfig{}
+	}
+	if cfg.Enabled() {
+		log.Info("Progress journal: sync %s", cfg.Sync)
+	}
+	return cfg
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestLoadJournalConfig(t *testing.T) {
+	newPolicyTestManager(t)
+	path := filepath.Join(warplib.ConfigDir, warplib.JournalConfigFileName)
+
+	if cfg := loadJournalConfig(logger.NewNopLogger()); cfg.Enabled() {
+		t.Fatalf("expected journal off without a file, got %+v", cfg)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"sync":"interval","interval":"250ms"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadJournalConfig(logger.NewNopLogger())
+	if !cfg.Enabled() || cfg.Sync != warplib.JournalSyncInterval || cfg.SyncInterval().Milliseconds() != 250 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"sync":"sometimes"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := loadJournalConfig(logger.NewNopLogger()); cfg.Enabled() {
+		t.Fatalf("expected journal off for invalid file, got %+v", cfg)
+	}
+}
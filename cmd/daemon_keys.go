@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// loadKeyring opens the daemon's keyring of trusted signers in the config directory.
+// A keyring that can't be opened is logged and leaves signature verification disabled.
+func loadKeyring(log logger.Logger) *warplib.Keyring {
+	k, err := warplib.OpenKeyring(warplib.KeyringDir)
+	if err != nil {
+		log.Error("Signature verification disabled: %v", err)
+		return nil
+	}
+	return k
+}
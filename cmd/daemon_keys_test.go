@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestLoadKeyring(t *testing.T) {
+	newTestManager(t)
+	if k := loadKeyring(logger.NewNopLogger()); k == nil || k.Dir() != warplib.KeyringDir {
+		t.Fatalf("unexpected keyring: %+v", k)
+	}
+
+	orig := warplib.KeyringDir
+	defer func() { warplib.KeyringDir = orig }()
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	warplib.KeyringDir = filepath.Join(file, "keys")
+	if k := loadKeyring(logger.NewNopLogger()); k != nil {
+		t.Fatalf("expected no keyring under a file, got %s", k.Dir())
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/warpdl/warpdl/internal/scheduler"
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// policyFileName is the name of the time-window policy file inside the config directory.
+const policyFileName = "policy.json"
+
+// downloadResumer resumes downloads the way a client's resume request does.
+// It is implemented by api.Api.
+type downloadResumer interface {
+	ResumeDownload(hash string, opts *warplib.ResumeDownloadOpts) error
+}
+
+// policyApplier applies time-window policy changes to the daemon.
+// It only undoes what it did itself: a queue paused by the user stays paused
+// and only downloads stopped by a pause window are resumed afterwards.
+type policyApplier struct {
+	m       *warplib.Manager
+	resumer downloadResumer
+	log     logger.Logger
+
+	mu          sync.Mutex
+	queuePaused bool
+	// stopped are the downloads stopped by a pause window, with the
+	// options they were running with.
+	stopped map[string]*warplib.ResumeDownloadOpts
+}
+
+// ApplyPolicy implements scheduler.PolicyTarget.
+func (a *policyApplier) ApplyPolicy(st scheduler.PolicyState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if st.Action == scheduler.PolicyPause {
+		a.m.SetGlobalSpeedLimit(0)
+		if q := a.m.GetQueue(); q != nil && !q.IsPaused() {
+			q.Pause()
+			a.queuePaused = true
+		}
+		if a.stopped == nil {
+			a.stopped = make(map[string]*warplib.ResumeDownloadOpts)
+		}
+		for _, item := range a.m.GetItems() {
+			opts, err := item.ResumeOpts()
+			if err != nil {
+				// not downloading
+				continue
+			}
+			item.StopDownload()
+			a.stopped[item.Hash] = opts
+		}
+		a.log.Info("Policy: downloads paused (%d stopped)", len(a.stopped))
+		return
+	}
+
+	a.m.SetGlobalSpeedLimit(st.SpeedLimit)
+	if st.SpeedLimit > 0 {
+		a.log.Info("Policy: global speed limit set to %s/s", warplib.ContentLength(st.SpeedLimit).String())
+	} else {
+		a.log.Info("Policy: running at full speed")
+	}
+	if a.queuePaused {
+		if q := a.m.GetQueue(); q != nil {
+			q.Resume()
+		}
+		a.queuePaused = false
+	}
+	children := make(map[string]bool)
+	for hash := range a.stopped {
+		if item := a.m.GetItem(hash); item != nil && item.ChildHash != "" {
+			children[item.ChildHash] = true
+		}
+	}
+	for hash, opts := range a.stopped {
+		if children[hash] {
+			// resumed along with its parent
+			continue
+		}
+		if err := a.resumer.ResumeDownload(hash, opts); err != nil {
+			a.log.Error("Policy: resume failed for %s: %v", hash, err)
+		}
+	}
+	a.stopped = nil
+}
+
+// loadPolicyConfig reads the daemon's time-window policies from the config directory.
+// An invalid file is logged and ignored so the daemon still starts.
+func loadPolicyConfig(log logger.Logger) *scheduler.PolicyConfig {
+	cfg, err := scheduler.LoadPolicyConfig(filepath.Join(warplib.ConfigDir, policyFileName))
+	if err != nil {
+		log.Error("Time-window policies disabled: %v", err)
+		return &scheduler.PolicyConfig{}
+	}
+	if len(cfg.Windows) > 0 {
+		log.Info("Loaded %d time-window policies", len(cfg.Windows))
+	}
+	return cfg
+}
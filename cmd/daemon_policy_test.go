@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/warpdl/warpdl/internal/scheduler"
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func newPolicyTestManager(t *testing.T) *warplib.Manager {
+	t.Helper()
+	if err := warplib.SetConfigDir(t.TempDir()); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	m, err := warplib.InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestPolicyApplier_PauseAndResume(t *testing.T) {
+	m := newPolicyTestManager(t)
+	m.SetMaxConcurrentDownloads(2, nil)
+	a := &policyApplier{m: m, log: logger.NewNopLogger()}
+
+	a.ApplyPolicy(scheduler.PolicyState{Action: scheduler.PolicyPause})
+	if !m.GetQueue().IsPaused() {
+		t.Fatal("expected queue to be paused")
+	}
+
+	a.ApplyPolicy(scheduler.PolicyState{Action: scheduler.PolicyLimit, SpeedLimit: 500 * warplib.KB})
+	if m.GetQueue().IsPaused() {
+		t.Fatal("expected queue to be resumed")
+	}
+	if got := m.GetGlobalSpeedLimit(); got != 500*warplib.KB {
+		t.Fatalf("global limit = %d, want %d", got, 500*warplib.KB)
+	}
+
+	a.ApplyPolicy(scheduler.PolicyState{Action: scheduler.PolicyFull})
+	if got := m.GetGlobalSpeedLimit(); got != 0 {
+		t.Fatalf("global limit = %d, want 0", got)
+	}
+}
+
+func TestPolicyApplier_KeepsUserPausedQueue(t *testing.T) {
+	m := newPolicyTestManager(t)
+	m.SetMaxConcurrentDownloads(2, nil)
+	m.GetQueue().Pause()
+	a := &policyApplier{m: m, log: logger.NewNopLogger()}
+
+	a.ApplyPolicy(scheduler.PolicyState{Action: scheduler.PolicyPause})
+	a.ApplyPolicy(scheduler.PolicyState{Action: scheduler.PolicyFull})
+	if !m.GetQueue().IsPaused() {
+		t.Fatal("queue paused by the user must stay paused")
+	}
+}
+
+// fakeResumer records the downloads the policy applier resumes.
+type fakeResumer struct {
+	resumed map[string]*warplib.ResumeDownloadOpts
+}
+
+func (f *fakeResumer) ResumeDownload(hash string, opts *warplib.ResumeDownloadOpts) error {
+	f.resumed[hash] = opts
+	return nil
+}
+
+func TestPolicyApplier_ResumesWithOptions(t *testing.T) {
+	m := newPolicyTestManager(t)
+	content := bytes.Repeat([]byte("p"), 1024*1024)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	d, err := warplib.NewDownloader(&http.Client{}, srv.URL+"/file.bin", &warplib.DownloaderOpts{
+		DownloadDirectory: t.TempDir(),
+		MaxConnections:    3,
+		SpeedLimit:        64 * warplib.KB,
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &warplib.AddDownloadOpts{AbsoluteLocation: d.GetDownloadDirectory()}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	resumer := &fakeResumer{resumed: make(map[string]*warplib.ResumeDownloadOpts)}
+	a := &policyApplier{m: m, resumer: resumer, log: logger.NewNopLogger()}
+
+	a.ApplyPolicy(scheduler.PolicyState{Action: scheduler.PolicyPause})
+	if m.GetItem(d.GetHash()).IsDownloading() {
+		t.Fatal("download not stopped by the pause window")
+	}
+	a.ApplyPolicy(scheduler.PolicyState{Action: scheduler.PolicyFull})
+	opts := resumer.resumed[d.GetHash()]
+	if opts == nil {
+		t.Fatal("stopped download not resumed")
+	}
+	if opts.MaxConnections != 3 || opts.SpeedLimit != 64*warplib.KB {
+		t.Errorf("resumed with %+v, want the options it was stopped with", opts)
+	}
+}
+
+func TestLoadPolicyConfig_InvalidFileIgnored(t *testing.T) {
+	newPolicyTestManager(t)
+	path := filepath.Join(warplib.ConfigDir, policyFileName)
+	if err := os.WriteFile(path, []byte(`{"windows":[{"from":"x"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadPolicyConfig(logger.NewNopLogger())
+	if cfg == nil || len(cfg.Windows) != 0 {
+		t.Fatalf("expected empty config for invalid file, got %+v", cfg)
+	}
+}
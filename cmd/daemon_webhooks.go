@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/warpdl/warpdl/internal/webhook"
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// loadWebhooksConfig reads the daemon's webhooks from the config directory.
+// An invalid file is logged and nil is returned, disabling webhooks rather
+// than overwriting the file when webhooks are added through RPC.
+func loadWebhooksConfig(log logger.Logger) *webhook.Config {
+	cfg, err := webhook.Load(filepath.Join(warplib.ConfigDir, webhook.FileName))
+	if err != nil {
+		log.Error("Webhooks disabled: %v", err)
+		return nil
+	}
+	if len(cfg.Webhooks) > 0 {
+		log.Info("Loaded %d webhooks from %s", len(cfg.Webhooks), webhook.FileName)
+	}
+	return cfg
+}
@@ -28,6 +28,14 @@ var (
 			Usage:       "explicitly set the name of file (determined automatically if not specified)",
 			Destination: &fileName,
 		},
+		cli.StringFlag{
+			Name:  "output, O",
+			Usage: "stream the file in order to a file or named pipe instead of saving it, '-' for stdout (e.g. -O - | tar -x)",
+		},
+		cli.StringFlag{
+			Name:  "stream-window",
+			Usage: "memory used to fetch ahead while streaming with --output (default: 32MB)",
+		},
 		cli.StringFlag{
 			Name:        "download-path, l",
 			Usage:       "set the path where downloaded file should be saved (default: $WARPDL_DEFAULT_DL_DIR or current directory)",
@@ -49,6 +57,11 @@ var (
 			Usage:  "disable work stealing (fast parts taking over slow part ranges)",
 			EnvVar: "WARPDL_NO_WORK_STEAL",
 		},
+		cli.BoolFlag{
+			Name:   "direct-write",
+			Usage:  "write parts straight into the preallocated file, skipping the compile step (halves disk I/O and space)",
+			EnvVar: "WARPDL_DIRECT_WRITE",
+		},
 		cli.StringFlag{
 			Name:   "priority",
 			Usage:  "queue priority: high, normal, low (default: normal)",
@@ -57,7 +70,7 @@ var (
 		},
 		cli.StringFlag{
 			Name:  "input-file, i",
-			Usage: "read URLs from input file (one URL per line, # for comments)",
+			Usage: "read URLs from input file (one URL per line optionally followed by algorithm:hex checksums or auto, # for comments)",
 		},
 		cli.StringFlag{
 			Name:  "ssh-key",
@@ -79,9 +92,90 @@ var (
 			Name:  "cookies-from",
 			Usage: "import cookies from browser cookie file (Firefox, Chrome, Netscape) or 'auto' for auto-detection",
 		},
+		cli.StringFlag{
+			Name:  "on-complete",
+			Usage: "command the daemon runs when the download completes, with {hash} {name} {path} {dir} {url} {size} {sha256} replaced",
+		},
+		cli.StringFlag{
+			Name:  "on-error",
+			Usage: "command the daemon runs when the download fails, {error} holds the reason",
+		},
+		cli.StringFlag{
+			Name:  "on-stopped",
+			Usage: "command the daemon runs when the download is stopped",
+		},
+		cli.StringFlag{
+			Name:  "on-checksum-fail",
+			Usage: "command the daemon runs when the downloaded file fails its checksum",
+		},
+		cli.BoolFlag{
+			Name:  "extract",
+			Usage: "extract the archive (zip, tar, gz, bz2, xz, zst) into a directory named after it once the download completes",
+		},
+		cli.StringFlag{
+			Name:  "extract-dir",
+			Usage: "extract the archive into this directory, relative to the download path (implies --extract)",
+		},
+		cli.BoolFlag{
+			Name:  "extract-delete",
+			Usage: "delete the archive after it has been extracted (implies --extract)",
+		},
+		cli.StringFlag{
+			Name:  "on-duplicate",
+			Usage: "if the url, path or checksum matches an existing download: allow, return, refuse or attach (default: daemon's policy)",
+		},
+		cli.StringSliceFlag{
+			Name:  "checksum",
+			Usage: "expected checksum of the file as algorithm:hex, e.g. sha256:9f86d0... (md5, sha1, sha256, sha384, sha512, blake2b, blake3, crc32 or crc32c, can be specified multiple times), or auto to look it up in the SHA256SUMS or .sha256 files published next to it",
+		},
+		cli.StringFlag{
+			Name:  "verify-sig",
+			Usage: "URL of the detached signature (.asc, .sig or .minisig) to verify the file against with the keys added by 'warpdl keys add', or auto to look it up next to the file",
+		},
 	}
 )
 
+// hooksFromFlags returns the per-download hook commands set with the
+// --on-* flags, nil if none is set.
+func hooksFromFlags(ctx *cli.Context) *warplib.Hooks {
+	h := &warplib.Hooks{
+		OnComplete:     ctx.String("on-complete"),
+		OnError:        ctx.String("on-error"),
+		OnStopped:      ctx.String("on-stopped"),
+		OnChecksumFail: ctx.String("on-checksum-fail"),
+	}
+	if h.IsEmpty() {
+		return nil
+	}
+	return h
+}
+
+// extractFromFlags returns the extraction options set with the
+// --extract* flags, nil if extraction wasn't asked for.
+func extractFromFlags(ctx *cli.Context) *warplib.ExtractOpts {
+	dir := ctx.String("extract-dir")
+	if !ctx.Bool("extract") && dir == "" && !ctx.Bool("extract-delete") {
+		return nil
+	}
+	return &warplib.ExtractOpts{Dir: dir, DeleteArchive: ctx.Bool("extract-delete")}
+}
+
+// printDuplicate reports a download the daemon answered with an existing
+// one, returning whether the client follows its progress.
+func printDuplicate(d *common.DownloadResponse) (attached bool) {
+	switch d.Duplicate {
+	case warplib.DuplicateAttached:
+		fmt.Printf("Same %s as running download %s, attaching to it.\n", d.DuplicateMatch, d.DownloadId)
+		return true
+	case warplib.DuplicateReturned:
+		fmt.Printf("Same %s as download %s: %s\n", d.DuplicateMatch, d.DownloadId, d.SavePath)
+		if d.ContentLength <= 0 || d.Downloaded < d.ContentLength {
+			fmt.Printf("It is incomplete, use 'warpdl resume %s' to continue it.\n", d.DownloadId)
+		}
+	}
+	return false
+}
+
 // validateCookiesFrom validates the --cookies-from flag value.
 // Empty string and "auto" are accepted without file checks.
 // Otherwise, the path must exist and not be a directory.
@@ -171,6 +265,16 @@ func download(ctx *cli.Context) (err error) {
 		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
 	}
 
+	if output := ctx.String("output"); output != "" {
+		if inputFile != "" {
+			return cmdcommon.PrintErrWithCmdHelp(
+				ctx,
+				errors.New("--output streams a single url and can't be used with -i/--input-file"),
+			)
+		}
+		return streamDownload(ctx, strings.TrimSpace(url), output)
+	}
+
 	client, err := getClient()
 	if err != nil {
 		cmdcommon.PrintRuntimeErr(ctx, "download", "new_client", err)
@@ -246,6 +350,16 @@ func download(ctx *cli.Context) (err error) {
 			fmt.Println(warning)
 		}
 	}
+	onDuplicate, err := warplib.ParseDuplicatePolicy(ctx.String("on-duplicate"))
+	if err != nil {
+		cmdcommon.PrintRuntimeErr(ctx, "download", "on_duplicate", err)
+		return nil
+	}
+	checksums := ctx.StringSlice("checksum")
+	if _, _, err := warplib.ParseChecksumArgs(checksums); err != nil {
+		cmdcommon.PrintRuntimeErr(ctx, "download", "checksum", err)
+		return nil
+	}
 	// Validate --schedule flag (T066)
 	scheduleValue := ctx.String("schedule")
 	if scheduleValue != "" {
@@ -270,16 +384,26 @@ func download(ctx *cli.Context) (err error) {
 		RetryDelay:          retryDelay,
 		SpeedLimit:          ctx.String("speed-limit"),
 		DisableWorkStealing: ctx.Bool("no-work-steal"),
+		AutoConnections:     ctx.Bool("auto-connections"),
+		DirectWrite:         ctx.Bool("direct-write"),
 		Priority:            parsePriority(ctx.String("priority")),
 		SSHKeyPath:          ctx.String("ssh-key"),
 		StartAt:             startAtValue,
 		CookiesFrom:         cookiesFrom,
 		Schedule:            scheduleValue,
+		Hooks:               hooksFromFlags(ctx),
+		Extract:             extractFromFlags(ctx),
+		OnDuplicate:         onDuplicate,
+		Checksums:           checksums,
+		VerifySig:           ctx.String("verify-sig"),
 	})
 	if err != nil {
 		cmdcommon.PrintRuntimeErr(ctx, "info", "download", err)
 		return nil
 	}
+	if d.Duplicate != "" && !printDuplicate(d) {
+		return nil
+	}
 	txt := fmt.Sprintf(`
 Download Info
 Name`+"\t\t"+`: %s
@@ -345,6 +469,28 @@ func downloadBatchFromFile(ctx *cli.Context, client *warpcli.Client, inputFile s
 		}
 	}
 
+	onDuplicate, err := warplib.ParseDuplicatePolicy(ctx.String("on-duplicate"))
+	if err != nil {
+		cmdcommon.PrintRuntimeErr(ctx, "download", "on_duplicate", err)
+		return nil
+	}
+
+	// A checksum belongs to one file, the input file gives them per URL
+	if len(ctx.StringSlice("checksum")) > 0 {
+		return cmdcommon.PrintErrWithCmdHelp(
+			ctx,
+			errors.New("--checksum can't be used with -i/--input-file, put the checksums after the URLs in the file"),
+		)
+	}
+	// So does a signature, only looking each one up next to its file works
+	verifySig := ctx.String("verify-sig")
+	if verifySig != "" && verifySig != warplib.SignatureAuto {
+		return cmdcommon.PrintErrWithCmdHelp(
+			ctx,
+			errors.New("--verify-sig can only be auto with -i/--input-file"),
+		)
+	}
+
 	// Build download options
 	opts := &BatchDownloadOpts{
 		DownloadDir: resolvedPath,
@@ -360,8 +506,14 @@ func downloadBatchFromFile(ctx *cli.Context, client *warpcli.Client, inputFile s
 			RetryDelay:          retryDelay,
 			SpeedLimit:          ctx.String("speed-limit"),
 			DisableWorkStealing: ctx.Bool("no-work-steal"),
+			AutoConnections:     ctx.Bool("auto-connections"),
+			DirectWrite:         ctx.Bool("direct-write"),
 			Priority:            parsePriority(ctx.String("priority")),
 			SSHKeyPath:          ctx.String("ssh-key"),
+			Hooks:               hooksFromFlags(ctx),
+			Extract:             extractFromFlags(ctx),
+			OnDuplicate:         onDuplicate,
+			VerifySig:           verifySig,
 		},
 	}
 
@@ -454,6 +606,7 @@ func isBatchSubmissionCompleteInManager(submission BatchSubmission) bool {
 	resp, err := client.List(&warpcli.ListOpts{
 		ShowCompleted: true,
 		ShowPending:   true,
+		ShowHidden:    true,
 	})
 	if err != nil {
 		return false
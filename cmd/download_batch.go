@@ -155,6 +155,7 @@ func DownloadBatch(client BatchDownloadClient, inputFilePath string, directURLs
 	// Collect all URLs
 	var allURLs []string
 	var skippedURLs []SkippedURL
+	var checksums map[string][]string
 
 	// Parse URLs from input file if provided
 	if inputFilePath != "" {
@@ -163,6 +164,7 @@ func DownloadBatch(client BatchDownloadClient, inputFilePath string, directURLs
 			return nil, err
 		}
 		allURLs = append(allURLs, parseResult.URLs...)
+		checksums = parseResult.Checksums
 
 		// Copy invalid lines to skipped URLs for reporting
 		for _, inv := range parseResult.InvalidLines {
@@ -187,6 +189,11 @@ func DownloadBatch(client BatchDownloadClient, inputFilePath string, directURLs
 		if downloadOpts == nil {
 			downloadOpts = &warpcli.DownloadOpts{}
 		}
+		if cs := checksums[url]; len(cs) > 0 {
+			withChecksums := *downloadOpts
+			withChecksums.Checksums = cs
+			downloadOpts = &withChecksums
+		}
 
 		resp, err := client.Download(url, "", opts.DownloadDir, downloadOpts)
 		if err != nil {
@@ -3,6 +3,7 @@ package cmd
 import (
 	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/warpdl/warpdl/common"
@@ -956,3 +957,26 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestDownloadBatch_Checksums(t *testing.T) {
+	cs := "sha256:" + strings.Repeat("ab", 32)
+	tmpFile := createTempInputFile(t, "https://example.com/a.iso "+cs+"\nhttps://example.com/b.iso\n")
+
+	mock := &MockClient{}
+	opts := &warpcli.DownloadOpts{MaxConnections: 4}
+	if _, err := DownloadBatch(mock, tmpFile, nil, &BatchDownloadOpts{DownloadOpts: opts}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mock.Calls) != 2 {
+		t.Fatalf("expected 2 download calls, got %d", len(mock.Calls))
+	}
+	if got := mock.Calls[0].Opts; len(got.Checksums) != 1 || got.Checksums[0] != cs || got.MaxConnections != 4 {
+		t.Errorf("first download opts = %+v", got)
+	}
+	if got := mock.Calls[1].Opts.Checksums; len(got) != 0 {
+		t.Errorf("second download has checksums %v", got)
+	}
+	if len(opts.Checksums) != 0 {
+		t.Error("shared download options modified")
+	}
+}
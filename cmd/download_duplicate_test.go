@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestPrintDuplicate(t *testing.T) {
+	tests := []struct {
+		resp     common.DownloadResponse
+		attached bool
+		want     string
+	}{
+		{
+			common.DownloadResponse{DownloadId: "abc", Duplicate: warplib.DuplicateAttached, DuplicateMatch: warplib.DuplicateURL},
+			true, "Same url as running download abc, attaching to it.",
+		},
+		{
+			common.DownloadResponse{
+				DownloadId: "abc", SavePath: "/dl/f.zip", ContentLength: 10, Downloaded: 10,
+				Duplicate: warplib.DuplicateReturned, DuplicateMatch: warplib.DuplicateChecksum,
+			},
+			false, "Same checksum as download abc: /dl/f.zip\n",
+		},
+		{
+			common.DownloadResponse{
+				DownloadId: "abc", SavePath: "/dl/f.zip", ContentLength: 10, Downloaded: 4,
+				Duplicate: warplib.DuplicateReturned, DuplicateMatch: warplib.DuplicatePath,
+			},
+			false, "use 'warpdl resume abc' to continue it",
+		},
+	}
+	for _, tt := range tests {
+		var attached bool
+		stdout, _ := captureOutput(func() {
+			attached = printDuplicate(&tt.resp)
+		})
+		if attached != tt.attached || !strings.Contains(stdout, tt.want) {
+			t.Errorf("printDuplicate(%+v) = %v, output %q", tt.resp, attached, stdout)
+		}
+	}
+}
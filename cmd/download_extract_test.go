@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestExtractFromFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want *warplib.ExtractOpts
+	}{
+		{nil, nil},
+		{[]string{"--extract"}, &warplib.ExtractOpts{}},
+		{[]string{"--extract-dir", "src"}, &warplib.ExtractOpts{Dir: "src"}},
+		{[]string{"--extract-delete"}, &warplib.ExtractOpts{DeleteArchive: true}},
+	}
+	for _, tt := range tests {
+		set := flag.NewFlagSet("download", flag.ContinueOnError)
+		set.Bool("extract", false, "")
+		set.String("extract-dir", "", "")
+		set.Bool("extract-delete", false, "")
+		if err := set.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		got := extractFromFlags(cli.NewContext(cli.NewApp(), set, nil))
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("extractFromFlags(%v) = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
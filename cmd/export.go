@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+)
+
+var exportFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "format, f",
+		Usage: "format of the history: json, csv or aria2",
+		Value: "json",
+	},
+	cli.StringFlag{
+		Name:  "output, O",
+		Usage: "write the history to this file instead of the standard output",
+	},
+	cli.BoolFlag{
+		Name:  "secrets",
+		Usage: "keep the credentials of the downloads (auth headers, cookies, passwords in urls)",
+	},
+}
+
+func export(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	format := ctx.String("format")
+	switch format {
+	case "json", "csv", "aria2":
+	default:
+		return common.PrintErrWithCmdHelp(ctx, fmt.Errorf("unsupported export format %q, use json, csv or aria2", format))
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "export", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.ExportHistory(ctx.Bool("secrets"))
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "export", "export", err)
+		return nil
+	}
+	var w io.Writer = os.Stdout
+	if out := ctx.String("output"); out != "" {
+		f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			common.PrintRuntimeErr(ctx, "export", "create_file", err)
+			return nil
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(resp.History)
+	case "csv":
+		err = resp.History.WriteCSV(w)
+	case "aria2":
+		err = resp.History.WriteAria2Session(w)
+	}
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "export", "write", err)
+		return nil
+	}
+	if out := ctx.String("output"); out != "" {
+		fmt.Printf("Exported %d downloads to %s.\n", len(resp.History.Items), out)
+	}
+	return nil
+}
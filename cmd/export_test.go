@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestExport(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	flags := []struct {
+		name string
+		val  any
+	}{{"format", "json"}, {"output", ""}, {"secrets", false}}
+	out, _ := captureOutput(func() {
+		if err := export(newContextWithFlags(cli.NewApp(), flags, []string{"--format", "csv"}, nil, "export")); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+	})
+	if !strings.HasPrefix(out, "hash,name,url,status") || !strings.Contains(out, "id2,b.iso,https://example.com/b.iso,incomplete") {
+		t.Errorf("unexpected csv:\n%s", out)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.txt")
+	out, _ = captureOutput(func() {
+		if err := export(newContextWithFlags(cli.NewApp(), flags, []string{"--format", "aria2", "--output", path}, nil, "export")); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Exported 2 downloads to "+path) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "https://example.com/b.iso\n dir=/dl\n out=b.iso\n" {
+		t.Errorf("unexpected session:\n%s", b)
+	}
+}
+
+func TestExport_BadFormat(t *testing.T) {
+	flags := []struct {
+		name string
+		val  any
+	}{{"format", "json"}}
+	if err := export(newContextWithFlags(cli.NewApp(), flags, []string{"--format", "xml"}, nil, "export")); err == nil {
+		t.Error("export with an unknown format should fail")
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+var importFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "format, f",
+		Usage: "format of the file: warpdl, aria2, crawljob or uget, told from the file if auto",
+		Value: importFormatAuto,
+	},
+	cli.StringFlag{
+		Name:  "download-path, l",
+		Usage: "move the downloads imported to this directory",
+	},
+}
+
+func importHistory(ctx *cli.Context) error {
+	file := ctx.Args().First()
+	if file == "" {
+		return common.PrintErrWithCmdHelp(ctx, errors.New("no file provided"))
+	} else if file == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "import", "read_file", err)
+		return nil
+	}
+	format := ctx.String("format")
+	if format == "" || format == importFormatAuto {
+		format = detectImportFormat(file, b)
+	}
+	var list *ImportedList
+	switch format {
+	case importFormatWarpdl:
+		var h warplib.History
+		if err := json.Unmarshal(b, &h); err != nil || h.Version == 0 {
+			return common.PrintErrWithCmdHelp(ctx, fmt.Errorf("%s is not a history exported by warpdl", file))
+		}
+		return importWarpdlHistory(ctx, &h)
+	case importFormatAria2:
+		list, err = ParseAria2Session(b)
+	case importFormatCrawljob:
+		list, err = ParseCrawljob(b)
+	case importFormatUGet:
+		list, err = ParseUGetCategory(b)
+	default:
+		return common.PrintErrWithCmdHelp(ctx, fmt.Errorf("unsupported import format %q, use warpdl, aria2, crawljob or uget", format))
+	}
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "import", "parse_"+format, err)
+		return nil
+	}
+	return importDownloadList(ctx, list)
+}
+
+// importWarpdlHistory imports a history written by the export command.
+func importWarpdlHistory(ctx *cli.Context, h *warplib.History) error {
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "import", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.ImportHistory(h, ctx.String("download-path"))
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "import", "import", err)
+		return nil
+	}
+	fmt.Printf("Imported %d downloads, skipped %d already known.\n", resp.Imported, resp.Skipped)
+	if resp.Resumable > 0 || resp.Reset > 0 {
+		fmt.Printf("%d incomplete downloads resume where they stopped, %d start over.\n", resp.Resumable, resp.Reset)
+	}
+	return nil
+}
+
+// importDownloadList adds the downloads read from the list of another
+// download manager.
+func importDownloadList(ctx *cli.Context, list *ImportedList) error {
+	// the directories of the list are kept unless -l is given
+	var dir string
+	if l := ctx.String("download-path"); l != "" {
+		var err error
+		if dir, err = resolveDownloadPath(l); err != nil {
+			common.PrintRuntimeErr(ctx, "import", "resolve_path", err)
+			return nil
+		}
+	}
+	defaultDir, err := resolveDownloadPath("")
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "import", "resolve_path", err)
+		return nil
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "import", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	result := DownloadImported(client, list, dir, defaultDir)
+	fmt.Print(result.String())
+	return nil
+}
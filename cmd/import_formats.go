@@ -0,0 +1,459 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warpcli"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// Formats of the files the import command reads.
+const (
+	importFormatAuto     = "auto"
+	importFormatWarpdl   = "warpdl"
+	importFormatAria2    = "aria2"
+	importFormatCrawljob = "crawljob"
+	importFormatUGet     = "uget"
+)
+
+// ErrImportEmpty is returned when a download list holds no download.
+var ErrImportEmpty = errors.New("no download found in the list")
+
+// ImportedList holds the downloads read from the list of another download
+// manager, in the order they were listed.
+type ImportedList struct {
+	// Downloads are the downloads to add, with the options the list gave
+	// them.
+	Downloads []*common.DownloadParams
+	// Skipped are the entries which can't be downloaded by warpdl, such
+	// as magnet links.
+	Skipped []SkippedURL
+}
+
+// add appends the download, or skips it if warpdl can't download its URL.
+func (l *ImportedList) add(line int, p *common.DownloadParams) {
+	u, err := url.Parse(p.Url)
+	if err != nil || !importableSchemes[strings.ToLower(u.Scheme)] {
+		l.Skipped = append(l.Skipped, SkippedURL{LineNumber: line, Content: p.Url, Reason: "unsupported URL"})
+		return
+	}
+	l.Downloads = append(l.Downloads, p)
+}
+
+// importableSchemes are the URL schemes of the downloads which can be
+// imported.
+var importableSchemes = map[string]bool{
+	"http": true, "https": true, "ftp": true, "ftps": true, "sftp": true,
+}
+
+// detectImportFormat tells the format of a download list from its name
+// and content.
+func detectImportFormat(path string, data []byte) string {
+	if strings.EqualFold(filepath.Ext(path), ".crawljob") {
+		return importFormatCrawljob
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return importFormatCrawljob
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var probe struct {
+			Version int             `json:"version"`
+			Items   json.RawMessage `json:"items"`
+			Text    json.RawMessage `json:"text"`
+		}
+		_ = json.Unmarshal(trimmed, &probe)
+		switch {
+		case probe.Version > 0 && probe.Items != nil:
+			return importFormatWarpdl
+		case probe.Text != nil:
+			return importFormatCrawljob
+		}
+		return importFormatUGet
+	}
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "text=") {
+			return importFormatCrawljob
+		}
+	}
+	return importFormatAria2
+}
+
+// ParseAria2Session reads a session file saved by aria2c --save-session, or
+// an aria2 input file. Each download is a line of tab separated URIs, of
+// which the first is used, followed by its options indented on the next
+// lines: out, dir, header, checksum, split, max-connection-per-server,
+// all-proxy, max-download-limit and the user and password ones.
+func ParseAria2Session(data []byte) (*ImportedList, error) {
+	list := &ImportedList{}
+	var (
+		cur      *common.DownloadParams
+		curLine  int
+		user     string
+		password string
+	)
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.Url = withUserInfo(cur.Url, user, password)
+		list.add(curLine, cur)
+		cur, user, password = nil, "", ""
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			flush()
+			uri, _, _ := strings.Cut(trimmed, "\t")
+			cur, curLine = &common.DownloadParams{Url: uri, Priority: int(warplib.PriorityNormal)}, n
+			continue
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("line %d: option without a URI", n)
+		}
+		key, value, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: invalid option %q", n, trimmed)
+		}
+		switch key {
+		case "out":
+			cur.FileName = value
+		case "dir":
+			cur.DownloadDirectory = value
+		case "header":
+			name, val, ok := strings.Cut(value, ":")
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid header %q", n, value)
+			}
+			cur.Headers = append(cur.Headers, warplib.Header{Key: strings.TrimSpace(name), Value: strings.TrimSpace(val)})
+		case "user-agent":
+			cur.Headers = append(cur.Headers, warplib.Header{Key: warplib.USER_AGENT_KEY, Value: value})
+		case "referer":
+			cur.Headers = append(cur.Headers, warplib.Header{Key: "Referer", Value: value})
+		case "checksum":
+			algo, hex, ok := strings.Cut(value, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid checksum %q", n, value)
+			}
+			cs := strings.ReplaceAll(strings.ToLower(algo), "-", "") + ":" + hex
+			if _, err := warplib.ParseChecksum(cs); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			cur.Checksums = append(cur.Checksums, cs)
+		case "split":
+			cur.MaxSegments = int32(atoiOrZero(value))
+		case "max-connection-per-server":
+			cur.MaxConnections = int32(atoiOrZero(value))
+		case "all-proxy", "http-proxy", "https-proxy":
+			cur.Proxy = value
+		case "max-download-limit":
+			cur.SpeedLimit = value
+		case "http-user", "ftp-user":
+			user = value
+		case "http-passwd", "ftp-passwd":
+			password = value
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	if len(list.Downloads) == 0 {
+		return list, ErrImportEmpty
+	}
+	return list, nil
+}
+
+// crawljobPriorities maps the priorities of JDownloader to the queue
+// priorities.
+var crawljobPriorities = map[string]warplib.Priority{
+	"HIGHEST": warplib.PriorityHigh,
+	"HIGHER":  warplib.PriorityHigh,
+	"HIGH":    warplib.PriorityHigh,
+	"DEFAULT": warplib.PriorityNormal,
+	"LOWER":   warplib.PriorityLow,
+	"LOWEST":  warplib.PriorityLow,
+}
+
+// ParseCrawljob reads a JDownloader folder watch .crawljob file, either
+// as properties, with the jobs separated by empty lines, or as a JSON
+// array of jobs. The links of the text of a job are downloaded with its
+// filename, downloadFolder, chunks and priority.
+func ParseCrawljob(data []byte) (*ImportedList, error) {
+	type job struct {
+		line   int
+		fields map[string]string
+	}
+	var jobs []job
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		var raw []map[string]any
+		if trimmed[0] == '{' {
+			trimmed = append(append([]byte("["), trimmed...), ']')
+		}
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("invalid crawljob: %w", err)
+		}
+		for i, r := range raw {
+			fields := make(map[string]string, len(r))
+			for k, v := range r {
+				fields[k] = fmt.Sprint(v)
+			}
+			jobs = append(jobs, job{line: i + 1, fields: fields})
+		}
+	} else {
+		var cur *job
+		for n, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+				continue
+			}
+			if line == "" {
+				cur = nil
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid property %q", n+1, line)
+			}
+			key = strings.TrimSpace(key)
+			if cur == nil || cur.fields[key] != "" {
+				jobs = append(jobs, job{line: n + 1, fields: make(map[string]string)})
+				cur = &jobs[len(jobs)-1]
+			}
+			cur.fields[key] = unescapeProperty(strings.TrimSpace(value))
+		}
+	}
+
+	list := &ImportedList{}
+	for _, j := range jobs {
+		f := j.fields
+		dir := strings.ReplaceAll(f["downloadFolder"], "<jd:packagename>", f["packageName"])
+		priority := warplib.PriorityNormal
+		if p, ok := crawljobPriorities[strings.ToUpper(f["priority"])]; ok {
+			priority = p
+		}
+		links := strings.Fields(f["text"])
+		for _, link := range links {
+			p := &common.DownloadParams{
+				Url:               link,
+				DownloadDirectory: dir,
+				MaxConnections:    int32(atoiOrZero(f["chunks"])),
+				Priority:          int(priority),
+			}
+			// a file name only fits a job of a single link
+			if len(links) == 1 {
+				p.FileName = f["filename"]
+			}
+			list.add(j.line, p)
+		}
+	}
+	if len(list.Downloads) == 0 {
+		return list, ErrImportEmpty
+	}
+	return list, nil
+}
+
+// unescapeProperty removes the escaping of a value of a Java properties
+// file.
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 't':
+				sb.WriteByte('\t')
+			case 'n':
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// uGet priorities run from lowest to highest, normal being the middle one.
+const ugetPriorityNormal = 2
+
+// ParseUGetCategory reads a category file of uGet, the JSON files of its
+// category folder. Each download node holds its uri, file, folder,
+// connections, credentials and priority in the data of its info, the
+// folder and connections of the category applying to the downloads which
+// have none.
+func ParseUGetCategory(data []byte) (*ImportedList, error) {
+	var root ugetNode
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid uGet category: %w", err)
+	}
+	list := &ImportedList{}
+	root.walk(list, map[string]any{})
+	if len(list.Downloads) == 0 {
+		return list, ErrImportEmpty
+	}
+	return list, nil
+}
+
+// ugetNode is a category or a download of uGet. Its info holds its data
+// by kind (common, http, relation...), each a JSON object.
+type ugetNode struct {
+	Name     string                    `json:"name"`
+	Info     map[string]map[string]any `json:"info"`
+	Children []ugetNode                `json:"children"`
+}
+
+// walk adds the downloads of the node and its children to list, using
+// inherited for the values they don't set.
+func (n *ugetNode) walk(list *ImportedList, inherited map[string]any) {
+	values := make(map[string]any, len(inherited))
+	for k, v := range inherited {
+		values[k] = v
+	}
+	// The kinds are read in a fixed order, so a value set by several of
+	// them is always the same one.
+	kinds := make([]string, 0, len(n.Info))
+	for kind := range n.Info {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	var uri string
+	for _, kind := range kinds {
+		for k, v := range n.Info[kind] {
+			if k == "uri" {
+				uri, _ = v.(string)
+				continue
+			}
+			values[k] = v
+		}
+	}
+	if uri != "" {
+		str := func(k string) string {
+			s, _ := values[k].(string)
+			return s
+		}
+		num := func(k string) int {
+			f, _ := values[k].(float64)
+			return int(f)
+		}
+		p := &common.DownloadParams{
+			Url:               withUserInfo(uri, str("user"), str("password")),
+			FileName:          str("file"),
+			DownloadDirectory: str("folder"),
+			MaxConnections:    int32(num("max-connections")),
+			MaxRetries:        num("retry-limit"),
+			Priority:          int(warplib.PriorityNormal),
+		}
+		if prio, ok := values["priority"].(float64); ok {
+			switch {
+			case int(prio) < ugetPriorityNormal:
+				p.Priority = int(warplib.PriorityLow)
+			case int(prio) > ugetPriorityNormal:
+				p.Priority = int(warplib.PriorityHigh)
+			}
+		}
+		if ua := str("user-agent"); ua != "" {
+			p.Headers = append(p.Headers, warplib.Header{Key: warplib.USER_AGENT_KEY, Value: ua})
+		}
+		if ref := str("referrer"); ref != "" {
+			p.Headers = append(p.Headers, warplib.Header{Key: "Referer", Value: ref})
+		}
+		// uGet lists have no lines, entries are numbered instead
+		list.add(len(list.Downloads)+len(list.Skipped)+1, p)
+		return
+	}
+	for i := range n.Children {
+		n.Children[i].walk(list, values)
+	}
+}
+
+// withUserInfo sets the user and password of rawURL, if user is given.
+func withUserInfo(rawURL, user, password string) string {
+	if user == "" {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if password == "" {
+		u.User = url.User(user)
+	} else {
+		u.User = url.UserPassword(user, password)
+	}
+	return u.String()
+}
+
+// atoiOrZero parses s as an integer, zero if it isn't one.
+func atoiOrZero(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+// DownloadImported adds the downloads of list to the daemon in order, with
+// their priorities, so the queue keeps the order of the other manager. A
+// non-empty dir replaces the directories of the list, and defaultDir is
+// used for the downloads which have none. Relative directories of the list
+// are resolved against the working directory. It continues past the
+// downloads which fail.
+func DownloadImported(client BatchDownloadClient, list *ImportedList, dir, defaultDir string) *BatchResult {
+	result := NewBatchResult(len(list.Downloads))
+	result.SkippedURLs = list.Skipped
+	for _, p := range list.Downloads {
+		dlDir := p.DownloadDirectory
+		if dir != "" {
+			dlDir = dir
+		}
+		if dlDir == "" {
+			dlDir = defaultDir
+		} else if !filepath.IsAbs(dlDir) {
+			var err error
+			if dlDir, err = resolveDownloadPath(dlDir); err != nil {
+				result.AddError(p.Url, err)
+				continue
+			}
+		}
+		resp, err := client.Download(p.Url, p.FileName, dlDir, &warpcli.DownloadOpts{
+			Headers:        p.Headers,
+			MaxConnections: p.MaxConnections,
+			MaxSegments:    p.MaxSegments,
+			Proxy:          p.Proxy,
+			MaxRetries:     p.MaxRetries,
+			SpeedLimit:     p.SpeedLimit,
+			Priority:       p.Priority,
+			Checksums:      p.Checksums,
+		})
+		if err != nil {
+			result.AddError(p.Url, err)
+			continue
+		}
+		result.AddSuccess()
+		result.Submissions = append(result.Submissions, BatchSubmission{
+			URL:           p.Url,
+			DownloadID:    resp.DownloadId,
+			SavePath:      resp.SavePath,
+			ContentLength: int64(resp.ContentLength),
+		})
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/common"
+)
+
+func TestImportHistory(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"items":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := captureOutput(func() {
+		if err := importHistory(newContext(cli.NewApp(), []string{path}, "import")); err != nil {
+			t.Fatalf("import: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Imported 2 downloads, skipped 1 already known.") || !strings.Contains(out, "1 incomplete downloads resume where they stopped, 0 start over.") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestImportHistory_BadFile(t *testing.T) {
+	if err := importHistory(newContext(cli.NewApp(), nil, "import")); err == nil {
+		t.Error("import without a file should fail")
+	}
+	path := filepath.Join(t.TempDir(), "session.txt")
+	if err := os.WriteFile(path, []byte("https://example.com/a.iso\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	flags := []struct {
+		name string
+		val  any
+	}{{"format", "auto"}, {"download-path", ""}}
+	if err := importHistory(newContextWithFlags(cli.NewApp(), flags, []string{"--format", "metalink"}, []string{path}, "import")); err == nil {
+		t.Error("import with an unknown format should fail")
+	}
+	if err := importHistory(newContextWithFlags(cli.NewApp(), flags, []string{"--format", "warpdl"}, []string{path}, "import")); err == nil {
+		t.Error("import of a non-history file as warpdl should fail")
+	}
+}
+
+func TestImportHistory_ServerError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath, map[common.UpdateType]string{
+		common.UPDATE_IMPORT: "import failed",
+	})
+	defer srv.close()
+
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := os.WriteFile(path, []byte(`{"version":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := importHistory(newContext(cli.NewApp(), []string{path}, "import")); err != nil {
+		t.Fatalf("import should report runtime errors without failing: %v", err)
+	}
+}
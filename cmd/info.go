@@ -22,6 +22,17 @@ var (
 	}
 )
 
+// newDirectHTTPClient returns the client of the commands making requests
+// themselves rather than through the daemon, using the --proxy flag.
+func newDirectHTTPClient() (*http.Client, error) {
+	if proxyURL != "" {
+		return warplib.NewHTTPClientWithProxy(proxyURL)
+	}
+	return &http.Client{
+		CheckRedirect: warplib.RedirectPolicy(warplib.DefaultMaxRedirects),
+	}, nil
+}
+
 func info(ctx *cli.Context) error {
 	url := ctx.Args().First()
 	if url == "" {
@@ -39,18 +50,10 @@ func info(ctx *cli.Context) error {
 			Key: warplib.USER_AGENT_KEY, Value: getUserAgent(userAgent),
 		}}
 	}
-	var httpClient *http.Client
-	if proxyURL != "" {
-		var err error
-		httpClient, err = warplib.NewHTTPClientWithProxy(proxyURL)
-		if err != nil {
-			common.PrintRuntimeErr(ctx, "info", "invalid_proxy", err)
-			return nil
-		}
-	} else {
-		httpClient = &http.Client{
-			CheckRedirect: warplib.RedirectPolicy(warplib.DefaultMaxRedirects),
-		}
+	httpClient, err := newDirectHTTPClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "info", "invalid_proxy", err)
+		return nil
 	}
 	d, err := warplib.NewDownloader(
 		httpClient,
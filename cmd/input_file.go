@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/warpdl/warpdl/pkg/warplib"
 )
 
 // Sentinel errors for input file parsing.
@@ -56,9 +58,13 @@ type ParseResult struct {
 	TotalLines int
 	// InvalidLines contains lines that failed URL validation.
 	InvalidLines []InvalidLine
+	// Checksums holds the expected checksums given after a URL, by URL.
+	Checksums map[string][]string
 }
 
 // ParseInputFile reads an input file and extracts URLs.
+// A URL may be followed by its expected checksums as algorithm:hex,
+// e.g. "https://example.com/f.iso sha256:9f86d0...".
 // It skips empty lines and comment lines (starting with #).
 // Leading and trailing whitespace is trimmed from each line.
 // URLs are validated to ensure they start with http:// or https://.
@@ -96,6 +102,17 @@ func ParseInputFile(filePath string) (*ParseResult, error) {
 			continue
 		}
 
+		url, checksums, err := splitChecksums(trimmed)
+		if err != nil {
+			result.InvalidLines = append(result.InvalidLines, InvalidLine{
+				LineNumber: lineNumber,
+				Content:    trimmed,
+				Reason:     err.Error(),
+			})
+			continue
+		}
+		trimmed = url
+
 		// Validate URL scheme (must be http or https)
 		if !isValidURLScheme(trimmed) {
 			result.InvalidLines = append(result.InvalidLines, InvalidLine{
@@ -108,6 +125,12 @@ func ParseInputFile(filePath string) (*ParseResult, error) {
 
 		// Collect valid URL
 		result.URLs = append(result.URLs, trimmed)
+		if len(checksums) > 0 {
+			if result.Checksums == nil {
+				result.Checksums = make(map[string][]string)
+			}
+			result.Checksums[trimmed] = checksums
+		}
 	}
 
 	// Check if file contains no valid URLs
@@ -118,6 +141,38 @@ func ParseInputFile(filePath string) (*ParseResult, error) {
 	return result, nil
 }
 
+// splitChecksums splits the algorithm:hex checksums off the end of an
+// input file line, returning the rest of the line as the URL.
+func splitChecksums(line string) (url string, checksums []string, err error) {
+	fields := strings.Fields(line)
+	n := len(fields)
+	for n > 1 && isChecksumField(fields[n-1]) {
+		n--
+	}
+	if n == len(fields) {
+		return line, nil, nil
+	}
+	checksums = fields[n:]
+	if _, _, err := warplib.ParseChecksumArgs(checksums); err != nil {
+		return "", nil, err
+	}
+	return strings.Join(fields[:n], " "), checksums, nil
+}
+
+// isChecksumField reports whether field is meant as a checksum, by its
+// algorithm prefix, or asks for checksum discovery.
+func isChecksumField(field string) bool {
+	if strings.EqualFold(field, warplib.ChecksumAuto) {
+		return true
+	}
+	algo, _, ok := strings.Cut(field, ":")
+	if !ok {
+		return false
+	}
+	_, err := warplib.NewHasher(warplib.ChecksumAlgorithm(strings.ToLower(algo)))
+	return err == nil
+}
+
 // isValidURLScheme checks if the URL starts with http:// or https://.
 func isValidURLScheme(url string) bool {
 	lowerURL := strings.ToLower(url)
@@ -809,3 +809,32 @@ func createTempInputFile(t *testing.T, content string) string {
 	}
 	return tmpFile
 }
+
+func TestParseInputFile_Checksums(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	content := "https://example.com/a.iso sha256:" + sum + " MD5:" + strings.Repeat("cd", 16) + "\n" +
+		"https://example.com/b.iso\n" +
+		"https://example.com/c.iso sha256:1234\n" +
+		"https://example.com/d.iso auto\n"
+	tmpFile := createTempInputFile(t, content)
+
+	result, err := ParseInputFile(tmpFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.URLs) != 3 || result.URLs[0] != "https://example.com/a.iso" {
+		t.Fatalf("unexpected URLs: %v", result.URLs)
+	}
+	if cs := result.Checksums["https://example.com/a.iso"]; len(cs) != 2 || cs[0] != "sha256:"+sum {
+		t.Errorf("unexpected checksums: %v", result.Checksums)
+	}
+	if _, ok := result.Checksums["https://example.com/b.iso"]; ok {
+		t.Error("checksums recorded for a URL without any")
+	}
+	if cs := result.Checksums["https://example.com/d.iso"]; len(cs) != 1 || cs[0] != "auto" {
+		t.Errorf("checksum discovery not recorded: %v", result.Checksums)
+	}
+	if len(result.InvalidLines) != 1 || result.InvalidLines[0].LineNumber != 3 {
+		t.Errorf("expected line 3 invalid for its checksum, got %+v", result.InvalidLines)
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+)
+
+var keysCmd = cli.Command{
+	Name:        "keys",
+	Usage:       "manage the keys trusted to sign downloads",
+	Description: KeysDescription,
+	Subcommands: []cli.Command{
+		{
+			Name:      "add",
+			Usage:     "trust a public key: OpenPGP, minisign, signify or SSH",
+			ArgsUsage: "FILE",
+			Action:    keysAddAction,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "name to add the key under (default: the name or comment of the key)",
+				},
+			}, globalFlags...),
+		},
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "show the trusted keys",
+			Action:  keysListAction,
+			Flags:   globalFlags,
+		},
+		{
+			Name:      "rm",
+			Aliases:   []string{"remove"},
+			Usage:     "stop trusting a key",
+			ArgsUsage: "NAME",
+			Action:    keysRemoveAction,
+			Flags:     globalFlags,
+		},
+	},
+	Action: keysListAction,
+	Flags:  globalFlags,
+}
+
+// maxKeyFileSize is the size of the key files read at most.
+const maxKeyFileSize = 1 << 20
+
+func keysAddAction(ctx *cli.Context) error {
+	path := ctx.Args().First()
+	if path == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	if path == "" {
+		return common.PrintErrWithCmdHelp(ctx, errors.New("no key file provided"))
+	}
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			common.PrintRuntimeErr(ctx, "keys add", "read_key", err)
+			return nil
+		}
+		defer f.Close()
+		r = f
+	}
+	key, err := io.ReadAll(io.LimitReader(r, maxKeyFileSize))
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "keys add", "read_key", err)
+		return nil
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "keys add", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.KeysAdd(ctx.String("name"), string(key))
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "keys add", "add", err)
+		return nil
+	}
+	fmt.Printf("Added %s key %s (%s).\n", resp.Key.Format, resp.Key.Name, resp.Key.ID)
+	return nil
+}
+
+func keysListAction(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "keys", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.KeysList()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "keys", "list", err)
+		return nil
+	}
+	if len(resp.Keys) == 0 {
+		fmt.Printf("No trusted keys in %s.\n", resp.Dir)
+		return nil
+	}
+	for _, k := range resp.Keys {
+		fmt.Printf("%s\t%s\t%s\tadded %s\t%s\n", k.Name, k.Format, k.ID, k.Added.Format(time.DateTime), k.Comment)
+	}
+	return nil
+}
+
+func keysRemoveAction(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	if name == "" {
+		return common.PrintErrWithCmdHelp(ctx, errors.New("no key name provided"))
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "keys rm", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	if err := client.KeysRemove(name); err != nil {
+		common.PrintRuntimeErr(ctx, "keys rm", "remove", err)
+		return nil
+	}
+	fmt.Printf("Removed key %s.\n", name)
+	return nil
+}
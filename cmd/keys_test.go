@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/common"
+)
+
+func TestKeysCommands(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	app := cli.NewApp()
+	key := filepath.Join(t.TempDir(), "release.asc")
+	if err := os.WriteFile(key, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	flags := []struct {
+		name string
+		val  any
+	}{{"name", ""}}
+	out, _ := captureOutput(func() {
+		if err := keysAddAction(newContextWithFlags(app, flags, nil, []string{key}, "add")); err != nil {
+			t.Fatalf("keysAddAction: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Added openpgp key release (0123ABCD).") {
+		t.Errorf("unexpected add output: %q", out)
+	}
+	if err := keysAddAction(newContextWithFlags(app, flags, nil, nil, "add")); err == nil {
+		t.Error("keysAddAction accepted no key file")
+	}
+
+	out, _ = captureOutput(func() {
+		if err := keysListAction(newContext(app, nil, "ls")); err != nil {
+			t.Fatalf("keysListAction: %v", err)
+		}
+	})
+	if !strings.Contains(out, "release\tminisign\t0123ABCD\t") || !strings.Contains(out, "minisign public key") {
+		t.Errorf("unexpected listing:\n%s", out)
+	}
+
+	out, _ = captureOutput(func() {
+		if err := keysRemoveAction(newContext(app, []string{"release"}, "rm")); err != nil {
+			t.Fatalf("keysRemoveAction: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Removed key release.") {
+		t.Errorf("unexpected remove output: %q", out)
+	}
+	if err := keysRemoveAction(newContext(app, nil, "rm")); err == nil {
+		t.Error("keysRemoveAction accepted no key name")
+	}
+}
+
+func TestKeysRemove_ServerError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath, map[common.UpdateType]string{
+		common.UPDATE_KEYS_REMOVE: "key not found",
+	})
+	defer srv.close()
+
+	if err := keysRemoveAction(newContext(cli.NewApp(), []string{"nope"}, "rm")); err != nil {
+		t.Fatalf("keysRemoveAction should report runtime errors without failing: %v", err)
+	}
+}
@@ -1,8 +1,9 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"sort"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli"
@@ -70,6 +71,16 @@ var (
 	showCompleted bool
 	showPending   bool
 	showAll       bool
+	listCategory  string
+	listStatus    string
+	listSearch    string
+	listHost      string
+	listSince     string
+	listUntil     string
+	listMinSize   string
+	listSort      string
+	listLimit     int
+	listOffset    int
 
 	lsFlags = []cli.Flag{
 		cli.BoolFlag{
@@ -92,23 +103,138 @@ var (
 			Usage:       "use this flag to list hidden downloads (default: false)",
 			Destination: &showHidden,
 		},
+		cli.StringFlag{
+			Name:        "category",
+			Usage:       "only list downloads of this category, such as Video or Archives",
+			Destination: &listCategory,
+		},
+		cli.StringFlag{
+			Name:        "status",
+			Usage:       "only list downloads in these comma separated states: active, pending, completed, failed, scheduled (overrides the show flags)",
+			Destination: &listStatus,
+		},
+		cli.StringFlag{
+			Name:        "search, s",
+			Usage:       "only list downloads whose name or URL contain this text",
+			Destination: &listSearch,
+		},
+		cli.StringFlag{
+			Name:        "host",
+			Usage:       "only list downloads from this host or its subdomains",
+			Destination: &listHost,
+		},
+		cli.StringFlag{
+			Name:        "since",
+			Usage:       "only list downloads added on or after this date (YYYY-MM-DD or YYYY-MM-DD HH:MM)",
+			Destination: &listSince,
+		},
+		cli.StringFlag{
+			Name:        "until",
+			Usage:       "only list downloads added on or before this date (YYYY-MM-DD or YYYY-MM-DD HH:MM)",
+			Destination: &listUntil,
+		},
+		cli.StringFlag{
+			Name:        "min-size",
+			Usage:       "only list downloads at least this large, e.g. 100MB",
+			Destination: &listMinSize,
+		},
+		cli.StringFlag{
+			Name:        "sort",
+			Usage:       "order of the downloads: date (oldest first), size (largest first) or speed (fastest first)",
+			Value:       string(warplib.SortDate),
+			Destination: &listSort,
+		},
+		cli.IntFlag{
+			Name:        "limit",
+			Usage:       "list at most this many downloads (default: all)",
+			Destination: &listLimit,
+		},
+		cli.IntFlag{
+			Name:        "offset",
+			Usage:       "skip this many downloads of the listing",
+			Destination: &listOffset,
+		},
 	}
 )
 
+// parseListDate parses the value of --since or --until in local time. A
+// date without a time stands for the start of the day, or its end when
+// endOfDay is set.
+func parseListDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(startAtLayout, value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or YYYY-MM-DD HH:MM", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// listOpts builds the listing request out of the flags of the list command.
+func listOpts() (*warpcli.ListOpts, error) {
+	opts := &warpcli.ListOpts{
+		ShowCompleted: showCompleted || showAll,
+		ShowPending:   showPending || showAll,
+		ShowHidden:    showHidden,
+		Status:        listStatus,
+		Category:      listCategory,
+		Search:        listSearch,
+		Host:          listHost,
+		Sort:          listSort,
+		Offset:        listOffset,
+		Limit:         listLimit,
+	}
+	if listStatus != "" {
+		for _, name := range strings.Split(listStatus, ",") {
+			if _, err := warplib.ParseItemStatus(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if _, err := warplib.ParseItemSort(listSort); err != nil {
+		return nil, err
+	}
+	var err error
+	if listSince != "" {
+		if opts.Since, err = parseListDate(listSince, false); err != nil {
+			return nil, err
+		}
+	}
+	if listUntil != "" {
+		if opts.Until, err = parseListDate(listUntil, true); err != nil {
+			return nil, err
+		}
+	}
+	if listMinSize != "" {
+		if opts.MinSize, err = warplib.ParseSpeedLimit(listMinSize); err != nil {
+			return nil, fmt.Errorf("invalid min size %q", listMinSize)
+		}
+	}
+	if listLimit < 0 || listOffset < 0 {
+		return nil, errors.New("limit and offset can't be negative")
+	}
+	return opts, nil
+}
+
 func list(ctx *cli.Context) error {
 	if ctx.Args().First() == "help" {
 		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
 	}
+	opts, err := listOpts()
+	if err != nil {
+		return common.PrintErrWithCmdHelp(ctx, err)
+	}
 	client, err := getClient()
 	if err != nil {
 		common.PrintRuntimeErr(ctx, "list", "new_client", err)
 		return nil
 	}
 	defer client.Close()
-	l, err := client.List(&warpcli.ListOpts{
-		ShowCompleted: showCompleted || showAll,
-		ShowPending:   showPending || showAll,
-	})
+	l, err := client.List(opts)
 	if err != nil {
 		common.PrintRuntimeErr(ctx, "list", "get_list", err)
 		return nil
@@ -124,12 +250,8 @@ func list(ctx *cli.Context) error {
 	txt += "\n\n------------------------------------------------------------------------"
 	txt += "\n|Num|\t         Name         | Unique Hash | Status |   Scheduled    |"
 	txt += "\n|---|-------------------------|-------------|--------|----------------|"
-	var i int
-	sort.Sort(warplib.ItemSlice(l.Items))
+	i := listOffset
 	for _, item := range l.Items {
-		if !showHidden && (item.Hidden || item.Children) {
-			continue
-		}
 		i++
 		name := item.Name
 		n := len(name)
@@ -143,10 +265,10 @@ func list(ctx *cli.Context) error {
 		sched := formatScheduleColumn(item)
 		txt += fmt.Sprintf("\n| %d | %s |   %s  |  %s  | %s |", i, name, item.Hash, common.Beaut(perc, 4), common.Beaut(sched, 14))
 	}
-	if i == 0 {
-		return fback()
-	}
 	txt += "\n------------------------------------------------------------------------"
+	if l.Total > len(l.Items) {
+		txt += fmt.Sprintf("\nShowing %d-%d of %d downloads.", listOffset+1, i, l.Total)
+	}
 	fmt.Println(txt)
 	return nil
 }
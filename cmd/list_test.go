@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/urfave/cli"
 	"github.com/warpdl/warpdl/pkg/warplib"
 )
 
@@ -174,3 +176,118 @@ func TestFormatScheduleColumn_Cancelled(t *testing.T) {
 		t.Errorf("expected em dash for cancelled state, got %q", got)
 	}
 }
+
+func TestListCategory(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	item := func(hash, name, category string) *warplib.Item {
+		return &warplib.Item{
+			Hash: hash, Name: name, Category: category, TotalSize: 10,
+			DateAdded: time.Now(), Parts: make(map[int64]*warplib.ItemPart),
+		}
+	}
+	listOverride = []*warplib.Item{
+		item("v1", "talk.mkv", warplib.CategoryVideo),
+		item("a1", "src.tar.gz", warplib.CategoryArchives),
+	}
+	listCategory = "video"
+	defer func() { listOverride, listCategory = nil, "" }()
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	stdout, _ := captureOutput(func() {
+		if err := list(newContext(cli.NewApp(), nil, "list")); err != nil {
+			t.Errorf("list: %v", err)
+		}
+	})
+	if !strings.Contains(stdout, "talk.mkv") || strings.Contains(stdout, "src.tar.gz") {
+		t.Errorf("list --category video output:\n%s", stdout)
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	listStatus, listSearch, listHost, listSince, listMinSize, listSort, listLimit, listOffset =
+		"failed,scheduled", "iso", "example.com", "2024-01-02", "1MB", "size", 1, 0
+	defer func() {
+		listStatus, listSearch, listHost, listSince, listMinSize, listSort, listLimit, listOffset = "", "", "", "", "", "", 0, 0
+	}()
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	stdout, _ := captureOutput(func() {
+		if err := list(newContext(cli.NewApp(), nil, "list")); err != nil {
+			t.Errorf("list: %v", err)
+		}
+	})
+	if !strings.Contains(stdout, "file.bin") {
+		t.Errorf("list output:\n%s", stdout)
+	}
+	listParams.Lock()
+	p := listParams.ListParams
+	listParams.Unlock()
+	since := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	if p.Status != "failed,scheduled" || p.Search != "iso" || p.Host != "example.com" || !p.Since.Equal(since) ||
+		p.MinSize != 1024*1024 || p.Sort != "size" || p.Limit != 1 {
+		t.Errorf("list params = %+v", p)
+	}
+}
+
+func TestListQueryPaged(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	listOverride = []*warplib.Item{
+		{Hash: "a1", Name: "a.iso", TotalSize: 10, DateAdded: time.Now(), Parts: make(map[int64]*warplib.ItemPart)},
+		{Hash: "b1", Name: "b.iso", TotalSize: 10, DateAdded: time.Now(), Parts: make(map[int64]*warplib.ItemPart)},
+	}
+	listOffset = 5
+	defer func() { listOverride, listOffset = nil, 0 }()
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	stdout, _ := captureOutput(func() {
+		if err := list(newContext(cli.NewApp(), nil, "list")); err != nil {
+			t.Errorf("list: %v", err)
+		}
+	})
+	// the fake daemon doesn't page, numbering still starts after the offset
+	if !strings.Contains(stdout, "| 6 |") || !strings.Contains(stdout, "| 7 |") {
+		t.Errorf("list output:\n%s", stdout)
+	}
+}
+
+func TestListInvalidQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func()
+	}{
+		{"status", func() { listStatus = "stuck" }},
+		{"sort", func() { listSort = "name" }},
+		{"since", func() { listSince = "yesterday" }},
+		{"min size", func() { listMinSize = "lots" }},
+		{"limit", func() { listLimit = -1 }},
+	}
+	for _, tt := range tests {
+		tt.set()
+		err := list(newContext(cli.NewApp(), nil, "list"))
+		listStatus, listSort, listSince, listMinSize, listLimit = "", "", "", "", 0
+		if err == nil {
+			t.Errorf("%s: list succeeded", tt.name)
+		}
+	}
+}
+
+func TestParseListDate(t *testing.T) {
+	got, err := parseListDate("2024-03-05", true)
+	if err != nil || got.Day() != 5 || got.Hour() != 23 {
+		t.Errorf("parseListDate(until) = %v, %v", got, err)
+	}
+	got, err = parseListDate("2024-03-05 10:30", true)
+	if err != nil || got.Hour() != 10 || got.Minute() != 30 {
+		t.Errorf("parseListDate(time) = %v, %v", got, err)
+	}
+	if _, err := parseListDate("05/03/2024", false); err == nil {
+		t.Error("parseListDate accepted a malformed date")
+	}
+}
@@ -373,12 +373,15 @@ func TestWarpcliAdapterList(t *testing.T) {
 	client := warpcli.NewClientForTesting(c1)
 	adapter := &warpcliAdapter{Client: client}
 
+	sent := make(chan common.ListParams, 1)
 	go func() {
 		reqBytes, _ := warpcli.ReadForTesting(c2)
 		var req struct {
-			Method string `json:"method"`
+			Method  string            `json:"method"`
+			Message common.ListParams `json:"message"`
 		}
 		_ = json.Unmarshal(reqBytes, &req)
+		sent <- req.Message
 
 		resp := struct {
 			Ok     bool `json:"ok"`
@@ -393,10 +396,13 @@ func TestWarpcliAdapterList(t *testing.T) {
 		_ = warpcli.WriteForTesting(c2, respBytes)
 	}()
 
-	_, err := adapter.List(nil)
+	_, err := adapter.List(&nativehost.ListOptions{IncludeHidden: true, Search: "iso", Sort: "size", Limit: 5})
 	if err != nil {
 		t.Fatalf("List failed: %v", err)
 	}
+	if p := <-sent; !p.ShowPending || !p.ShowHidden || p.Search != "iso" || p.Sort != "size" || p.Limit != 5 {
+		t.Errorf("sent params = %+v", p)
+	}
 }
 
 // TestWarpcliAdapterGetDaemonVersion tests the adapter's GetDaemonVersion method
@@ -36,9 +36,25 @@ func (w *warpcliAdapter) Download(url, fileName, downloadDirectory string, opts
 }
 
 func (w *warpcliAdapter) List(opts *nativehost.ListOptions) (*common.ListResponse, error) {
-	// Map nativehost options to warpcli options
-	// Note: warpcli.ListOpts uses ShowCompleted/ShowPending instead of IncludeHidden/IncludeMetadata
-	return w.Client.List(nil)
+	var warpcliOpts *warpcli.ListOpts
+	if opts != nil {
+		warpcliOpts = &warpcli.ListOpts{
+			ShowCompleted: opts.IncludeCompleted,
+			ShowPending:   true,
+			ShowHidden:    opts.IncludeHidden,
+			Status:        opts.Status,
+			Category:      opts.Category,
+			Search:        opts.Search,
+			Host:          opts.Host,
+			Since:         opts.Since,
+			Until:         opts.Until,
+			MinSize:       opts.MinSize,
+			Sort:          opts.Sort,
+			Offset:        opts.Offset,
+			Limit:         opts.Limit,
+		}
+	}
+	return w.Client.List(warpcliOpts)
 }
 
 func (w *warpcliAdapter) GetDaemonVersion() (*common.VersionResponse, error) {
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+	sharedcommon "github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+var policyOverrideFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "speed-limit, l",
+		Usage: "daemon-wide speed limit for the 'limit' action (e.g., 500KB, 1MB)",
+	},
+	cli.StringFlag{
+		Name:  "until, u",
+		Usage: "end the override at this local time (format: \"YYYY-MM-DD HH:MM\" or \"HH:MM\")",
+	},
+	cli.StringFlag{
+		Name:  "for, d",
+		Usage: "end the override after a duration (e.g., 30m, 2h); mutually exclusive with --until",
+	},
+}
+
+var policyCmd = cli.Command{
+	Name:        "policy",
+	Usage:       "show or override the daemon's time-window policies",
+	Description: PolicyDescription,
+	Subcommands: []cli.Command{
+		{
+			Name:   "status",
+			Usage:  "show the effective policy",
+			Action: policyStatusAction,
+			Flags:  globalFlags,
+		},
+		{
+			Name:      "override",
+			Usage:     "force full speed, a speed limit or a pause until a given time",
+			ArgsUsage: "<full|limit|pause>",
+			Action:    policyOverrideAction,
+			Flags:     append(policyOverrideFlags, globalFlags...),
+		},
+		{
+			Name:   "clear",
+			Usage:  "remove the manual override and return to the weekly schedule",
+			Action: policyClearAction,
+			Flags:  globalFlags,
+		},
+	},
+	Action: policyStatusAction,
+	Flags:  globalFlags,
+}
+
+// parsePolicyUntil resolves the --until and --for flags of "policy override"
+// into an absolute end time. A zero time means "until the next window boundary".
+// "HH:MM" resolves to the next occurrence of that wall-clock time.
+func parsePolicyUntil(until, dur string, now time.Time) (time.Time, error) {
+	if until != "" && dur != "" {
+		return time.Time{}, errors.New("error: flags --until and --for are mutually exclusive")
+	}
+	if dur != "" {
+		d, err := time.ParseDuration(dur)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("error: invalid --for duration %q, expected format like 30m or 2h", dur)
+		}
+		return now.Add(d), nil
+	}
+	if until == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(startAtLayout, until, time.Local); err == nil {
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", until, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error: invalid --until %q, expected \"YYYY-MM-DD HH:MM\" or \"HH:MM\"", until)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// printPolicyStatus prints a policy status response in a human-readable form.
+func printPolicyStatus(st *sharedcommon.PolicyStatusResponse) {
+	action := st.Action
+	if st.Action == "limit" {
+		action = fmt.Sprintf("limit (%s/s)", warplib.ContentLength(st.SpeedLimit).String())
+	}
+	fmt.Printf("Policy: %s\n", action)
+	if st.Window != "" {
+		fmt.Printf("Active window: %s\n", st.Window)
+	}
+	if st.Override {
+		fmt.Printf("Manual override until %s\n", st.OverrideUntil.Local().Format(startAtLayout))
+	}
+}
+
+func policyStatusAction(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "policy", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	st, err := client.PolicyStatus()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "policy", "get_status", err)
+		return nil
+	}
+	printPolicyStatus(st)
+	return nil
+}
+
+func policyOverrideAction(ctx *cli.Context) error {
+	action := strings.ToLower(ctx.Args().First())
+	if action == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	switch action {
+	case "full", "limit", "pause":
+	case "":
+		return common.PrintErrWithCmdHelp(
+			ctx,
+			errors.New("usage: warpdl policy override <full|limit|pause> [--until TIME | --for DURATION]"),
+		)
+	default:
+		return common.PrintErrWithCmdHelp(
+			ctx,
+			fmt.Errorf("invalid action '%s': must be full, limit or pause", action),
+		)
+	}
+
+	var speedLimit int64
+	if action == "limit" {
+		limitStr := ctx.String("speed-limit")
+		if limitStr == "" {
+			return common.PrintErrWithCmdHelp(ctx, errors.New("--speed-limit is required for the 'limit' action"))
+		}
+		var err error
+		speedLimit, err = warplib.ParseSpeedLimit(limitStr)
+		if err != nil {
+			return common.PrintErrWithCmdHelp(ctx, err)
+		}
+	}
+
+	until, err := parsePolicyUntil(ctx.String("until"), ctx.String("for"), time.Now())
+	if err != nil {
+		return common.PrintErrWithCmdHelp(ctx, err)
+	}
+
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "policy override", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	st, err := client.PolicyOverride(action, speedLimit, until)
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "policy override", "override", err)
+		return nil
+	}
+	printPolicyStatus(st)
+	return nil
+}
+
+func policyClearAction(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "policy clear", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	st, err := client.PolicyClear()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "policy clear", "clear", err)
+		return nil
+	}
+	fmt.Println("Override cleared.")
+	printPolicyStatus(st)
+	return nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/common"
+)
+
+// newPolicyOverrideContext builds a CLI context with the policy override flags set.
+func newPolicyOverrideContext(args []string, flags map[string]string) *cli.Context {
+	set := flag.NewFlagSet("override", flag.ContinueOnError)
+	for _, name := range []string{"speed-limit", "until", "for"} {
+		set.String(name, "", "")
+	}
+	for k, v := range flags {
+		_ = set.Set(k, v)
+	}
+	_ = set.Parse(args)
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+	ctx.Command = cli.Command{Name: "override"}
+	return ctx
+}
+
+func TestParsePolicyUntil(t *testing.T) {
+	now := time.Date(2026, 10, 21, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		until   string
+		dur     string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "empty means next boundary", want: time.Time{}},
+		{name: "duration", dur: "90m", want: now.Add(90 * time.Minute)},
+		{name: "absolute", until: "2026-10-22 08:30", want: time.Date(2026, 10, 22, 8, 30, 0, 0, time.Local)},
+		{name: "clock later today", until: "18:00", want: time.Date(2026, 10, 21, 18, 0, 0, 0, time.Local)},
+		{name: "clock rolls to tomorrow", until: "09:00", want: time.Date(2026, 10, 22, 9, 0, 0, 0, time.Local)},
+		{name: "both flags", until: "18:00", dur: "1h", wantErr: true},
+		{name: "bad duration", dur: "soon", wantErr: true},
+		{name: "negative duration", dur: "-1h", wantErr: true},
+		{name: "bad until", until: "tomorrow", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePolicyUntil(tt.until, tt.dur, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCommands(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	app := cli.NewApp()
+	if err := policyStatusAction(newContext(app, nil, "policy")); err != nil {
+		t.Fatalf("policyStatusAction: %v", err)
+	}
+	if err := policyClearAction(newContext(app, nil, "clear")); err != nil {
+		t.Fatalf("policyClearAction: %v", err)
+	}
+	ctx := newPolicyOverrideContext([]string{"limit"}, map[string]string{"speed-limit": "500KB", "for": "1h"})
+	if err := policyOverrideAction(ctx); err != nil {
+		t.Fatalf("policyOverrideAction: %v", err)
+	}
+}
+
+func TestPolicyOverride_InvalidArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		flags map[string]string
+	}{
+		{name: "missing action", args: nil},
+		{name: "invalid action", args: []string{"turbo"}},
+		{name: "limit without speed", args: []string{"limit"}},
+		{name: "invalid speed", args: []string{"limit"}, flags: map[string]string{"speed-limit": "fast"}},
+		{name: "invalid until", args: []string{"pause"}, flags: map[string]string{"until": "later"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := policyOverrideAction(newPolicyOverrideContext(tt.args, tt.flags)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestPolicyStatus_ServerError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath, map[common.UpdateType]string{
+		common.UPDATE_POLICY_STATUS: "time-window policies not enabled",
+	})
+	defer srv.close()
+
+	if err := policyStatusAction(newContext(cli.NewApp(), nil, "policy")); err != nil {
+		t.Fatalf("policyStatusAction should report runtime errors without failing: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+var repairFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:   "max-connection, x",
+		Usage:  "specify the number of maximum parallel connection used to download the corrupted pieces again",
+		EnvVar: "WARP_MAX_CONN",
+	},
+}
+
+func repair(ctx *cli.Context) error {
+	hash := ctx.Args().First()
+	if hash == "" {
+		return common.PrintErrWithCmdHelp(ctx, errors.New("no hash provided"))
+	} else if hash == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "repair", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	fmt.Println("Checking the pieces of", hash+"...")
+	resp, err := client.Repair(hash, int32(ctx.Int("max-connection")))
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "repair", "repair", err)
+		return nil
+	}
+	switch {
+	case resp.Corrupt == 0 && resp.Verified:
+		fmt.Printf("All %d pieces are intact and the checksum matches.\n", resp.Pieces)
+	case resp.Corrupt == 0:
+		fmt.Printf("All %d pieces are intact.\n", resp.Pieces)
+	default:
+		fmt.Printf("Repaired %d of %d pieces, downloaded %s again.\n", resp.Corrupt, resp.Pieces, warplib.ContentLength(resp.Refetched))
+		if resp.Verified {
+			fmt.Println("The checksum matches.")
+		}
+	}
+	return nil
+}
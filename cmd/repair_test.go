@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/common"
+)
+
+func TestRepair(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	out, _ := captureOutput(func() {
+		if err := repair(newContext(cli.NewApp(), []string{"id"}, "repair")); err != nil {
+			t.Fatalf("repair: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Repaired 2 of 8 pieces, downloaded 2KB again.") || !strings.Contains(out, "The checksum matches.") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestRepair_NoHash(t *testing.T) {
+	if err := repair(newContext(cli.NewApp(), nil, "repair")); err == nil {
+		t.Error("repair without a hash should fail")
+	}
+}
+
+func TestRepair_ServerError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath, map[common.UpdateType]string{
+		common.UPDATE_REPAIR: "no piece hashes",
+	})
+	defer srv.close()
+
+	if err := repair(newContext(cli.NewApp(), []string{"id"}, "repair")); err != nil {
+		t.Fatalf("repair should report runtime errors without failing: %v", err)
+	}
+}
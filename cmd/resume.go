@@ -78,6 +78,11 @@ var (
 			Usage: "run download in background (exit immediately without progress display)",
 		},
 		speedLimitFlag,
+		cli.BoolFlag{
+			Name:   "auto-connections",
+			Usage:  "find the best number of connections automatically, up to --max-connection",
+			EnvVar: "WARPDL_AUTO_CONNECTIONS",
+		},
 	}
 )
 
@@ -122,15 +127,16 @@ func resume(ctx *cli.Context) (err error) {
 		}
 	}
 	r, err := client.Resume(hash, &warpcli.ResumeOpts{
-		ForceParts:     forceParts,
-		MaxConnections: int32(maxConns),
-		MaxSegments:    int32(maxParts),
-		Headers:        headers,
-		Proxy:          proxyURL,
-		Timeout:        timeout,
-		MaxRetries:     maxRetries,
-		RetryDelay:     retryDelay,
-		SpeedLimit:     ctx.String("speed-limit"),
+		ForceParts:      forceParts,
+		MaxConnections:  int32(maxConns),
+		MaxSegments:     int32(maxParts),
+		Headers:         headers,
+		Proxy:           proxyURL,
+		Timeout:         timeout,
+		MaxRetries:      maxRetries,
+		RetryDelay:      retryDelay,
+		SpeedLimit:      ctx.String("speed-limit"),
+		AutoConnections: ctx.Bool("auto-connections"),
 	})
 	if err != nil {
 		common.PrintRuntimeErr(ctx, "resume", "client-resume", err)
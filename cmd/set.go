@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+var setFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "speed-limit, S",
+		Usage: "new speed limit for the download (e.g., 1MB, 512KB, 0 for unlimited)",
+	},
+	cli.IntFlag{
+		Name:  "max-connection, x",
+		Usage: "new number of maximum parallel connections",
+	},
+}
+
+func set(ctx *cli.Context) error {
+	hash := ctx.Args().First()
+	if hash == "" {
+		return common.PrintErrWithCmdHelp(
+			ctx,
+			errors.New("no hash provided"),
+		)
+	} else if hash == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+
+	speedLimit := ctx.String("speed-limit")
+	if speedLimit != "" {
+		if _, err := warplib.ParseSpeedLimit(speedLimit); err != nil {
+			return common.PrintErrWithCmdHelp(ctx, err)
+		}
+	}
+	var maxConns int32
+	if ctx.IsSet("max-connection") {
+		n := ctx.Int("max-connection")
+		if n < 1 {
+			return common.PrintErrWithCmdHelp(ctx, errors.New("--max-connection must be at least 1"))
+		}
+		maxConns = int32(n)
+	}
+	if speedLimit == "" && maxConns == 0 {
+		return common.PrintErrWithCmdHelp(
+			ctx,
+			errors.New("nothing to change, use --speed-limit and/or --max-connection"),
+		)
+	}
+
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "set", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+	resp, err := client.SetOptions(hash, speedLimit, maxConns)
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "set", "set-options", err)
+		return nil
+	}
+	limit := "unlimited"
+	if resp.SpeedLimit > 0 {
+		limit = warplib.ContentLength(resp.SpeedLimit).String() + "/s"
+	}
+	fmt.Printf("Updated download %s: speed limit %s, %d max connections\n", resp.DownloadId, limit, resp.MaxConnections)
+	return nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/common"
+)
+
+// newSetContext builds a CLI context with the set flags parsed from args.
+func newSetContext(args []string) *cli.Context {
+	set := flag.NewFlagSet("set", flag.ContinueOnError)
+	set.String("speed-limit", "", "")
+	set.Int("max-connection", 0, "")
+	_ = set.Parse(args)
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+	ctx.Command = cli.Command{Name: "set"}
+	return ctx
+}
+
+func TestSet(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	if err := set(newSetContext([]string{"--speed-limit", "1MB", "--max-connection", "8", "id"})); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+}
+
+func TestSet_InvalidArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "missing hash", args: nil},
+		{name: "nothing to change", args: []string{"id"}},
+		{name: "invalid speed", args: []string{"--speed-limit", "fast", "id"}},
+		{name: "zero connections", args: []string{"--max-connection", "0", "id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := set(newSetContext(tt.args)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestSet_ServerError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath, map[common.UpdateType]string{
+		common.UPDATE_SET: "download not running",
+	})
+	defer srv.close()
+
+	if err := set(newSetContext([]string{"-speed-limit", "1MB", "id"})); err != nil {
+		t.Fatalf("set should report runtime errors without failing: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// streamOutput opens where a streamed download goes: stdout for "-",
+// otherwise the file or named pipe at path.
+func streamOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// streamErr reports a failed stream on stderr, as stdout carries the
+// stream, and exits with an error so pipelines notice.
+func streamErr(ctx *cli.Context, action string, err error) error {
+	return cli.NewExitError(fmt.Sprintf("%s: download[%s]: %s", ctx.App.HelpName, action, err), 1)
+}
+
+// streamDownload downloads url in this process and writes it strictly in
+// order to output, e.g. `warpdl download URL -O - | tar -x`.
+// Streams don't go through the daemon as there's nothing to resume,
+// and all messages go to stderr to keep stdout clean.
+func streamDownload(ctx *cli.Context, url, output string) error {
+	var window int64
+	if s := ctx.String("stream-window"); s != "" {
+		var err error
+		// same size syntax as the speed limit
+		if window, err = warplib.ParseSpeedLimit(s); err != nil {
+			return streamErr(ctx, "stream_window", err)
+		}
+	}
+	var speedLimit int64
+	if s := ctx.String("speed-limit"); s != "" {
+		var err error
+		if speedLimit, err = warplib.ParseSpeedLimit(s); err != nil {
+			return streamErr(ctx, "speed_limit", err)
+		}
+	}
+	headers := warplib.Headers{}
+	if userAgent != "" {
+		headers = append(headers, warplib.Header{
+			Key: warplib.USER_AGENT_KEY, Value: getUserAgent(userAgent),
+		})
+	}
+	headers, err := AppendCookieHeader(headers, ctx.StringSlice("cookie"))
+	if err != nil {
+		return streamErr(ctx, "parse_cookies", err)
+	}
+	var client *http.Client
+	if proxyURL != "" {
+		if client, err = warplib.NewHTTPClientWithProxy(proxyURL); err != nil {
+			return streamErr(ctx, "invalid_proxy", err)
+		}
+	} else {
+		client = &http.Client{
+			CheckRedirect: warplib.RedirectPolicy(warplib.DefaultMaxRedirects),
+		}
+	}
+	retryConfig := warplib.DefaultRetryConfig()
+	if maxRetries != 0 {
+		retryConfig.MaxRetries = maxRetries
+	}
+	if retryDelay != 0 {
+		retryConfig.BaseDelay = time.Duration(retryDelay) * time.Millisecond
+	}
+
+	out, err := streamOutput(output)
+	if err != nil {
+		return streamErr(ctx, "open_output", err)
+	}
+	defer out.Close()
+
+	d, err := warplib.NewDownloader(client, url, &warplib.DownloaderOpts{
+		ForceParts:     forceParts,
+		MaxConnections: int32(maxConns),
+		MaxSegments:    int32(maxParts),
+		Headers:        headers,
+		RetryConfig:    &retryConfig,
+		RequestTimeout: time.Duration(timeout) * time.Second,
+		SpeedLimit:     speedLimit,
+		Stream:         out,
+		StreamWindow:   window,
+	})
+	if err != nil {
+		return streamErr(ctx, "new_downloader", err)
+	}
+	defer d.Close()
+	fmt.Fprintf(os.Stderr, "Streaming %s (%s)\n", d.GetFileName(), d.GetContentLengthAsString())
+	if err := d.Start(); err != nil {
+		return streamErr(ctx, "stream", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestStreamDownload(t *testing.T) {
+	if err := warplib.SetConfigDir(t.TempDir()); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("stream-to-file"), 50000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		start, end := 0, len(content)-1
+		if rng := strings.TrimPrefix(r.Header.Get("Range"), "bytes="); rng != "" {
+			bounds := strings.SplitN(rng, "-", 2)
+			start, _ = strconv.Atoi(bounds[0])
+			if bounds[1] != "" {
+				end, _ = strconv.Atoi(bounds[1])
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		_, _ = w.Write(content[start : end+1])
+	}))
+	defer srv.Close()
+
+	oldConns, oldParts := maxConns, maxParts
+	maxConns, maxParts = 4, 4
+	defer func() { maxConns, maxParts = oldConns, oldParts }()
+
+	out := filepath.Join(t.TempDir(), "out.bin")
+	app := cli.NewApp()
+	app.HelpName = "warpdl"
+	ctx := newContextWithFlags(app, []struct {
+		name string
+		val  any
+	}{{"output", ""}, {"stream-window", ""}, {"speed-limit", ""}},
+		[]string{"--output", out, "--stream-window", "128KB"}, []string{srv.URL + "/file.bin"}, "download")
+
+	if err := download(ctx); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("streamed %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestStreamDownload_InvalidWindow(t *testing.T) {
+	app := cli.NewApp()
+	app.HelpName = "warpdl"
+	ctx := newContextWithFlags(app, []struct {
+		name string
+		val  any
+	}{{"output", ""}, {"stream-window", ""}},
+		[]string{"--output", "-", "--stream-window", "lots"}, []string{"http://127.0.0.1:1/file.bin"}, "download")
+
+	err := download(ctx)
+	if err == nil || !strings.Contains(err.Error(), "stream_window") {
+		t.Fatalf("download = %v, want stream_window error", err)
+	}
+}
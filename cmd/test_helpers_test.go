@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/pkg/warplib"
 )
 
 // captureOutput captures stdout and stderr during function execution.
@@ -102,3 +103,18 @@ func newContext(app *cli.App, args []string, name string) *cli.Context {
 	ctx.Command = cli.Command{Name: name}
 	return ctx
 }
+
+// newTestManager points the config directory at a temporary directory and
+// returns a manager using it, closed when the test ends.
+func newTestManager(t *testing.T) *warplib.Manager {
+	t.Helper()
+	if err := warplib.SetConfigDir(t.TempDir()); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	m, err := warplib.InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
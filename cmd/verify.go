@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+	sharedcommon "github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+var verifyFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "all, a",
+		Usage: "verify all the completed downloads",
+	},
+	cli.StringSliceFlag{
+		Name:  "search, s",
+		Usage: "directory to look for the missing files in, searched recursively (can be specified multiple times)",
+	},
+	cli.BoolFlag{
+		Name:  "redownload, r",
+		Usage: "download the missing and modified files again",
+	},
+	cli.IntFlag{
+		Name:   "max-connection, x",
+		Usage:  "specify the number of maximum parallel connection used to download files again",
+		EnvVar: "WARP_MAX_CONN",
+	},
+}
+
+func verify(ctx *cli.Context) error {
+	hashes := []string(ctx.Args())
+	if len(hashes) > 0 && hashes[0] == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	all := ctx.Bool("all")
+	if len(hashes) == 0 && !all {
+		return common.PrintErrWithCmdHelp(ctx, errors.New("no hash provided, use --all to verify all the downloads"))
+	}
+	if len(hashes) > 0 && all {
+		return common.PrintErrWithCmdHelp(ctx, errors.New("--all can't be used with hashes"))
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "verify", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.Verify(&sharedcommon.VerifyParams{
+		DownloadIds:    hashes,
+		SearchDirs:     ctx.StringSlice("search"),
+		Redownload:     ctx.Bool("redownload"),
+		MaxConnections: int32(ctx.Int("max-connection")),
+	}, func(v *sharedcommon.VerifyingResponse) {
+		if v.Result != nil {
+			fmt.Print("\r\033[K")
+			printVerifyResult(v.Result)
+			return
+		}
+		if v.Size > 0 {
+			fmt.Printf("\r\033[KVerifying %s: %d%%", v.DownloadId, v.Hashed*100/v.Size)
+		}
+	})
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "verify", "verify", err)
+		return nil
+	}
+	if len(resp.Results) == 0 {
+		fmt.Println("No completed downloads to verify.")
+		return nil
+	}
+	var broken int
+	for _, res := range resp.Results {
+		if !verifyPassed(res) {
+			broken++
+		}
+	}
+	if broken > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d of %d downloads failed verification", broken, len(resp.Results)), 1)
+	}
+	fmt.Printf("All %d downloads verified.\n", len(resp.Results))
+	return nil
+}
+
+// printVerifyResult prints a line describing the result of the
+// verification of a download.
+func printVerifyResult(res *warplib.VerifyResult) {
+	line := fmt.Sprintf("%-10s %s  %s", res.Status, res.Hash, res.Path)
+	if res.Status == warplib.VerifyMoved {
+		line = fmt.Sprintf("%-10s %s  %s -> %s", res.Status, res.Hash, res.MovedFrom, res.Path)
+	}
+	switch {
+	case res.Redownloaded:
+		line += " (downloaded again)"
+	case res.Error != "":
+		line += " (" + res.Error + ")"
+	}
+	fmt.Println(line)
+}
+
+// verifyPassed reports whether the verification found the file intact
+// or downloaded it again.
+func verifyPassed(res *warplib.VerifyResult) bool {
+	switch res.Status {
+	case warplib.VerifyOK, warplib.VerifyMoved, warplib.VerifyUnrecorded:
+		return true
+	}
+	return res.Redownloaded
+}
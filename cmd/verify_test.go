@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/common"
+)
+
+func TestVerify(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	var err error
+	out, _ := captureOutput(func() {
+		err = verify(newContext(cli.NewApp(), []string{"id", "id2", "id3"}, "verify"))
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 downloads failed verification") {
+		t.Errorf("verify = %v, want a failed verification", err)
+	}
+	for _, want := range []string{"Verifying id: 50%", "ok         id  /dl/a.iso", "moved      id2  /dl/b.iso -> /archive/b.iso", "modified   id3  /dl/c.iso"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestVerify_Usage(t *testing.T) {
+	flags := []struct {
+		name string
+		val  any
+	}{{"all", false}}
+	if err := verify(newContextWithFlags(cli.NewApp(), flags, nil, nil, "verify")); err == nil {
+		t.Error("verify without a hash or --all should fail")
+	}
+	if err := verify(newContextWithFlags(cli.NewApp(), flags, []string{"--all"}, []string{"id"}, "verify")); err == nil {
+		t.Error("verify with a hash and --all should fail")
+	}
+}
+
+func TestVerify_ServerError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath, map[common.UpdateType]string{
+		common.UPDATE_VERIFY: "item you are trying to verify is not completely downloaded",
+	})
+	defer srv.close()
+
+	if err := verify(newContext(cli.NewApp(), []string{"id"}, "verify")); err != nil {
+		t.Fatalf("verify should report runtime errors without failing: %v", err)
+	}
+}
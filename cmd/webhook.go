@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+)
+
+var webhookCmd = cli.Command{
+	Name:        "webhook",
+	Usage:       "list and test the daemon's webhooks",
+	Description: WebhookDescription,
+	Subcommands: []cli.Command{
+		{
+			Name:    "list",
+			Aliases: []string{"ls"},
+			Usage:   "show the webhook subscriptions",
+			Action:  webhookListAction,
+			Flags:   globalFlags,
+		},
+		{
+			Name:      "test",
+			Usage:     "send a test delivery to a webhook, or to all of them",
+			ArgsUsage: "[ID]",
+			Action:    webhookTestAction,
+			Flags:     globalFlags,
+		},
+	},
+	Action: webhookListAction,
+	Flags:  globalFlags,
+}
+
+func webhookListAction(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "webhook", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.WebhookList()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "webhook", "list", err)
+		return nil
+	}
+	if len(resp.Webhooks) == 0 {
+		fmt.Println("No webhooks.")
+		return nil
+	}
+	for _, w := range resp.Webhooks {
+		events := "all events"
+		if len(w.Events) > 0 {
+			events = strings.Join(w.Events, ", ")
+		}
+		signed := "unsigned"
+		if w.Signed {
+			signed = "signed"
+		}
+		fmt.Printf("%s\t%s\t%s, %s", w.ID, w.URL, events, signed)
+		if w.Failures > 0 {
+			fmt.Printf(", %d failed deliveries", w.Failures)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func webhookTestAction(ctx *cli.Context) error {
+	id := ctx.Args().First()
+	if id == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	client, err := getClient()
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "webhook test", "new_client", err)
+		return nil
+	}
+	defer client.Close()
+
+	resp, err := client.WebhookTest(id)
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "webhook test", "test", err)
+		return nil
+	}
+	if len(resp.Results) == 0 {
+		fmt.Println("No webhooks.")
+		return nil
+	}
+	for _, r := range resp.Results {
+		if r.Error != "" {
+			fmt.Printf("%s\t%s\tfailed: %s\n", r.ID, r.URL, r.Error)
+			continue
+		}
+		fmt.Printf("%s\t%s\tok\n", r.ID, r.URL)
+	}
+	return nil
+}
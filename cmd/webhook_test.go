@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/common"
+)
+
+func TestWebhookCommands(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath)
+	defer srv.close()
+
+	app := cli.NewApp()
+	if err := webhookListAction(newContext(app, nil, "list")); err != nil {
+		t.Fatalf("webhookListAction: %v", err)
+	}
+	if err := webhookTestAction(newContext(app, []string{"bot"}, "test")); err != nil {
+		t.Fatalf("webhookTestAction: %v", err)
+	}
+}
+
+func TestWebhookList_ServerError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "warpdl.sock")
+	t.Setenv("WARPDL_SOCKET_PATH", socketPath)
+	srv := startFakeServer(t, socketPath, map[common.UpdateType]string{
+		common.UPDATE_WEBHOOK_LIST: "webhooks not enabled",
+	})
+	defer srv.close()
+
+	if err := webhookListAction(newContext(cli.NewApp(), nil, "list")); err != nil {
+		t.Fatalf("webhookListAction should report runtime errors without failing: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"github.com/warpdl/warpdl/cmd/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+var (
+	zipFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:        "user-agent",
+			Usage:       "HTTP user agent to use for the requests (default: warp)",
+			Destination: &userAgent,
+		},
+		cli.StringFlag{
+			Name:        "proxy",
+			Usage:       "proxy server URL (http://host:port, https://host:port, socks5://host:port)",
+			EnvVar:      "WARPDL_PROXY",
+			Destination: &proxyURL,
+		},
+	}
+
+	zipGetFlags = append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "download-path, l",
+			Usage: "directory the files are saved in (default: current directory)",
+		},
+		cli.StringFlag{
+			Name:  "output, O",
+			Usage: "save the only requested file to this path, '-' for stdout",
+		},
+		cli.BoolFlag{
+			Name:  "overwrite, y",
+			Usage: "overwrite existing files",
+		},
+	}, zipFlags...)
+)
+
+var zipCmd = cli.Command{
+	Name:        "zip",
+	Usage:       "list or fetch files inside a remote zip without downloading all of it",
+	Description: ZipDescription,
+	Subcommands: []cli.Command{
+		{
+			Name:      "ls",
+			Aliases:   []string{"list"},
+			Usage:     "list the files of a remote zip",
+			ArgsUsage: "URL",
+			Action:    zipListAction,
+			Flags:     zipFlags,
+		},
+		{
+			Name:      "get",
+			Usage:     "download files out of a remote zip",
+			ArgsUsage: "URL PATH...",
+			Action:    zipGetAction,
+			Flags:     zipGetFlags,
+		},
+	},
+}
+
+// openRemoteZip reads the directory of the zip at the first argument.
+func openRemoteZip(ctx *cli.Context) (*warplib.RemoteZip, error) {
+	url := ctx.Args().First()
+	if url == "" {
+		return nil, errors.New("no url provided")
+	}
+	client, err := newDirectHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	var headers warplib.Headers
+	if userAgent != "" {
+		headers = warplib.Headers{{
+			Key: warplib.USER_AGENT_KEY, Value: getUserAgent(userAgent),
+		}}
+	}
+	return warplib.OpenRemoteZip(client, url, headers)
+}
+
+func zipListAction(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	if ctx.Args().First() == "" {
+		return common.PrintErrWithCmdHelp(ctx, errors.New("no url provided"))
+	}
+	z, err := openRemoteZip(ctx)
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "zip ls", "open", err)
+		return nil
+	}
+	var total uint64
+	for _, f := range z.Files() {
+		total += f.UncompressedSize64
+		fmt.Printf("%12d  %s  %s\n",
+			f.UncompressedSize64,
+			f.Modified.Local().Format("2006-01-02 15:04"),
+			f.Name,
+		)
+	}
+	fmt.Printf("%12d  %d files, archive of %d bytes\n", total, len(z.Files()), z.Size())
+	return nil
+}
+
+func zipGetAction(ctx *cli.Context) error {
+	if ctx.Args().First() == "help" {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	names := ctx.Args().Tail()
+	switch {
+	case ctx.Args().First() == "":
+		return common.PrintErrWithCmdHelp(ctx, errors.New("no url provided"))
+	case len(names) == 0:
+		return common.PrintErrWithCmdHelp(ctx, errors.New("no file in the zip provided"))
+	case ctx.String("output") != "" && len(names) > 1:
+		return common.PrintErrWithCmdHelp(ctx, errors.New("--output takes a single file"))
+	}
+	z, err := openRemoteZip(ctx)
+	if err != nil {
+		common.PrintRuntimeErr(ctx, "zip get", "open", err)
+		return nil
+	}
+	for _, name := range names {
+		dest := ctx.String("output")
+		if dest == "" {
+			dest = filepath.Join(ctx.String("download-path"), path.Base(strings.TrimSuffix(name, "/")))
+		}
+		n, err := zipGetFile(z, name, dest, ctx.Bool("overwrite"))
+		if err != nil {
+			common.PrintRuntimeErr(ctx, "zip get", "get", err)
+			return nil
+		}
+		if dest != "-" {
+			fmt.Printf("%s: saved %s (%d bytes, CRC-32 verified)\n", name, dest, n)
+		}
+	}
+	return nil
+}
+
+// zipGetFile fetches the file of the zip named name into dest, or to
+// stdout for "-". A partial or corrupt file is removed.
+func zipGetFile(z *warplib.RemoteZip, name, dest string, overwrite bool) (int64, error) {
+	f, err := z.File(name)
+	if err != nil {
+		return 0, err
+	}
+	if f.FileInfo().IsDir() {
+		return 0, fmt.Errorf("%s is a directory", name)
+	}
+	rc, err := z.Open(f)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	if dest == "-" {
+		return io.Copy(os.Stdout, rc)
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	out, err := os.OpenFile(dest, flag, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return 0, fmt.Errorf("%s: %w, use --overwrite", dest, warplib.ErrFileExists)
+		}
+		return 0, err
+	}
+	n, err := io.Copy(out, rc)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dest)
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return n, nil
+}
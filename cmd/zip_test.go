@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+func newZipTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("data/report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("a,b\n1,2\n"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.zip", time.Time{}, bytes.NewReader(buf.Bytes()))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestZipCommands(t *testing.T) {
+	srv := newZipTestServer(t)
+	app := cli.NewApp()
+
+	stdout, _ := captureOutput(func() {
+		if err := zipListAction(newContext(app, []string{srv.URL}, "ls")); err != nil {
+			t.Errorf("zipListAction: %v", err)
+		}
+	})
+	if !strings.Contains(stdout, "data/report.csv") || !strings.Contains(stdout, "1 files") {
+		t.Errorf("zip ls output = %q", stdout)
+	}
+
+	dir := t.TempDir()
+	flags := []struct {
+		name string
+		val  any
+	}{{"download-path", ""}, {"output", ""}, {"overwrite", false}}
+	ctx := newContextWithFlags(app, flags, []string{"--download-path", dir}, []string{srv.URL, "data/report.csv"}, "get")
+	captureOutput(func() {
+		if err := zipGetAction(ctx); err != nil {
+			t.Errorf("zipGetAction: %v", err)
+		}
+	})
+	got, err := os.ReadFile(filepath.Join(dir, "report.csv"))
+	if err != nil || string(got) != "a,b\n1,2\n" {
+		t.Fatalf("saved file = %q, %v", got, err)
+	}
+
+	// an existing file is kept without --overwrite
+	if err := os.WriteFile(filepath.Join(dir, "report.csv"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx = newContextWithFlags(app, flags, []string{"--download-path", dir}, []string{srv.URL, "data/report.csv"}, "get")
+	captureOutput(func() { _ = zipGetAction(ctx) })
+	if got, _ := os.ReadFile(filepath.Join(dir, "report.csv")); string(got) != "mine" {
+		t.Errorf("existing file overwritten with %q", got)
+	}
+}
+
+func TestZipGet_MissingArgs(t *testing.T) {
+	srv := newZipTestServer(t)
+	app := cli.NewApp()
+	for _, args := range [][]string{nil, {srv.URL}} {
+		captureOutput(func() {
+			if err := zipGetAction(newContext(app, args, "get")); err == nil {
+				t.Errorf("zipGetAction(%v) succeeded", args)
+			}
+		})
+	}
+}
@@ -67,6 +67,39 @@ const (
 	UPDATE_QUEUE_RESUME UpdateType = "queue_resume"
 	// UPDATE_QUEUE_MOVE moves a queued item to a new position.
 	UPDATE_QUEUE_MOVE UpdateType = "queue_move"
+	// UPDATE_SET changes the speed limit or connection count of a running download.
+	UPDATE_SET UpdateType = "set"
+	// UPDATE_POLICY_STATUS requests the effective time-window policy.
+	UPDATE_POLICY_STATUS UpdateType = "policy_status"
+	// UPDATE_POLICY_OVERRIDE forces a policy action until a given time.
+	UPDATE_POLICY_OVERRIDE UpdateType = "policy_override"
+	// UPDATE_POLICY_CLEAR removes a manual policy override.
+	UPDATE_POLICY_CLEAR UpdateType = "policy_clear"
+	// UPDATE_WEBHOOK_LIST requests the webhook subscriptions.
+	UPDATE_WEBHOOK_LIST UpdateType = "webhook_list"
+	// UPDATE_WEBHOOK_TEST sends a test delivery to webhooks.
+	UPDATE_WEBHOOK_TEST UpdateType = "webhook_test"
+	// UPDATE_CACHE_LIST requests the files in the download cache.
+	UPDATE_CACHE_LIST UpdateType = "cache_list"
+	// UPDATE_CACHE_PRUNE evicts files from the download cache.
+	UPDATE_CACHE_PRUNE UpdateType = "cache_prune"
+	// UPDATE_KEYS_ADD adds a public key to the keyring of trusted signers.
+	UPDATE_KEYS_ADD UpdateType = "keys_add"
+	// UPDATE_KEYS_LIST requests the keys of the keyring.
+	UPDATE_KEYS_LIST UpdateType = "keys_list"
+	// UPDATE_KEYS_REMOVE removes a key from the keyring.
+	UPDATE_KEYS_REMOVE UpdateType = "keys_remove"
+	// UPDATE_REPAIR repairs the corrupted pieces of a completed download.
+	UPDATE_REPAIR UpdateType = "repair"
+	// UPDATE_VERIFY rehashes the files of completed downloads.
+	UPDATE_VERIFY UpdateType = "verify"
+	// UPDATE_VERIFYING reports the progress of a verification, sent before
+	// the response to UPDATE_VERIFY.
+	UPDATE_VERIFYING UpdateType = "verifying"
+	// UPDATE_EXPORT exports the history of the downloads and the queue.
+	UPDATE_EXPORT UpdateType = "export"
+	// UPDATE_IMPORT imports a history of downloads exported before.
+	UPDATE_IMPORT UpdateType = "import"
 )
 
 // DownloadingAction represents the current state or action occurring during
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"time"
+
 	"github.com/warpdl/warpdl/pkg/warplib"
 )
 
@@ -50,6 +52,12 @@ type DownloadParams struct {
 	// DisableWorkStealing disables dynamic work stealing where fast parts
 	// take over remaining work from slow adjacent parts.
 	DisableWorkStealing bool `json:"disable_work_stealing,omitempty"`
+	// AutoConnections tunes the number of connections automatically,
+	// using MaxConnections as the upper bound.
+	AutoConnections bool `json:"auto_connections,omitempty"`
+	// DirectWrite preallocates the target file and writes the parts straight
+	// into it instead of compiling part files at the end.
+	DirectWrite bool `json:"direct_write,omitempty"`
 	// Priority specifies the queue priority (0=low, 1=normal, 2=high).
 	// Defaults to normal (1) if not specified.
 	Priority int `json:"priority,omitempty"`
@@ -68,6 +76,24 @@ type DownloadParams struct {
 	// CookiesFrom specifies the cookie source: file path, "auto", or "".
 	// Empty means no cookie import. "auto" triggers browser auto-detection.
 	CookiesFrom string `json:"cookies_from,omitempty"`
+	// Hooks are commands the daemon runs when the download completes,
+	// fails, stops or fails its checksum, after the global hooks.
+	Hooks *warplib.Hooks `json:"hooks,omitempty"`
+	// Extract unpacks the downloaded archive once it completes and its
+	// checksum is verified. Nil falls back to the daemon's extract rules.
+	Extract *warplib.ExtractOpts `json:"extract,omitempty"`
+	// OnDuplicate is what to do if the download duplicates an existing one
+	// by URL, path or checksum: allow, return, refuse or attach. Empty
+	// uses the daemon's policy.
+	OnDuplicate warplib.DuplicatePolicy `json:"on_duplicate,omitempty"`
+	// Checksums are the expected checksums of the file as "algorithm:hex",
+	// e.g. "sha256:9f86d0...". They replace those announced by the server.
+	// "auto" looks them up in the checksum files published next to the file.
+	Checksums []string `json:"checksums,omitempty"`
+	// VerifySig is the URL of the detached signature the file is verified
+	// against with the daemon's trusted keys, or "auto" to look it up next
+	// to the file.
+	VerifySig string `json:"verify_sig,omitempty"`
 }
 
 // DownloadResponse contains the server response after initiating a download.
@@ -88,6 +114,13 @@ type DownloadResponse struct {
 	MaxConnections int32 `json:"max_connections"`
 	// MaxSegments is the number of segments the download is split into.
 	MaxSegments int32 `json:"max_segments"`
+	// Duplicate is set when the response is an existing download that the
+	// request duplicated: "returned", or "attached" if the connection
+	// follows its progress.
+	Duplicate warplib.DuplicateAction `json:"duplicate,omitempty"`
+	// DuplicateMatch is what the request had in common with the existing
+	// download: "url", "path" or "checksum".
+	DuplicateMatch warplib.DuplicateMatch `json:"duplicate_match,omitempty"`
 }
 
 // DownloadingResponse contains progress information for an active download.
@@ -125,6 +158,30 @@ type ResumeParams struct {
 	// SpeedLimit specifies the maximum download speed (e.g., "1MB", "512KB", or raw bytes).
 	// If empty or "0", no limit is applied.
 	SpeedLimit string `json:"speed_limit,omitempty"`
+	// AutoConnections tunes the number of connections automatically,
+	// using MaxConnections as the upper bound.
+	AutoConnections bool `json:"auto_connections,omitempty"`
+}
+
+// SetParams contains the options to change on a running download.
+// Fields left at their zero value are not changed.
+type SetParams struct {
+	// DownloadId is the unique identifier of the running download.
+	DownloadId string `json:"download_id"`
+	// SpeedLimit is the new speed limit (e.g., "1MB", "512KB", or "0" for unlimited).
+	SpeedLimit string `json:"speed_limit,omitempty"`
+	// MaxConnections is the new number of parallel connections.
+	MaxConnections int32 `json:"max_connections,omitempty"`
+}
+
+// SetResponse contains the options of a download after they were changed.
+type SetResponse struct {
+	// DownloadId is the unique identifier of the download.
+	DownloadId string `json:"download_id"`
+	// SpeedLimit is the speed limit in bytes per second (0 = unlimited).
+	SpeedLimit int64 `json:"speed_limit"`
+	// MaxConnections is the number of parallel connections.
+	MaxConnections int32 `json:"max_connections"`
 }
 
 // ResumeResponse contains the server response after resuming a download.
@@ -162,12 +219,38 @@ type ListParams struct {
 	ShowCompleted bool `json:"show_completed"`
 	// ShowPending includes pending or in-progress downloads in the listing.
 	ShowPending bool `json:"show_pending"`
+	// ShowHidden includes hidden and child downloads in the listing.
+	ShowHidden bool `json:"show_hidden,omitempty"`
+	// Status lists only the downloads in these comma separated states
+	// (active, pending, completed, failed, scheduled). It takes precedence
+	// over ShowCompleted and ShowPending.
+	Status string `json:"status,omitempty"`
+	// Category lists only the downloads of this category.
+	Category string `json:"category,omitempty"`
+	// Search lists only the downloads whose name or URL contain this text.
+	Search string `json:"search,omitempty"`
+	// Host lists only the downloads from this host or its subdomains.
+	Host string `json:"host,omitempty"`
+	// Since and Until bound the time the listed downloads were added at.
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// MinSize is the smallest size in bytes of the listed downloads.
+	MinSize int64 `json:"min_size,omitempty"`
+	// Sort is the order of the listing: date (default), size or speed.
+	Sort string `json:"sort,omitempty"`
+	// Offset skips as many downloads of the listing.
+	Offset int `json:"offset,omitempty"`
+	// Limit caps the number of listed downloads if positive.
+	Limit int `json:"limit,omitempty"`
 }
 
 // ListResponse contains the response for a download listing request.
 type ListResponse struct {
 	// Items contains the list of download items matching the query.
 	Items []*warplib.Item `json:"items"`
+	// Total is the number of downloads matching the query before the
+	// offset and limit were applied.
+	Total int `json:"total"`
 }
 
 // AddExtensionParams contains parameters for adding a new extension.
@@ -263,3 +346,193 @@ type QueueMoveParams struct {
 	// Position is the target 0-indexed position in the queue.
 	Position int `json:"position"`
 }
+
+// PolicyOverrideParams holds parameters for a manual time-window policy override.
+type PolicyOverrideParams struct {
+	// Action is the forced action: "full", "limit" or "pause".
+	Action string `json:"action"`
+	// SpeedLimit is the daemon-wide limit in bytes per second, required for "limit".
+	SpeedLimit int64 `json:"speed_limit,omitempty"`
+	// Until is when the override ends. Zero means until the next window boundary.
+	Until time.Time `json:"until"`
+}
+
+// PolicyStatusResponse is the response for policy status, override and clear requests.
+type PolicyStatusResponse struct {
+	// Action is the effective action: "full", "limit" or "pause".
+	Action string `json:"action"`
+	// SpeedLimit is the effective daemon-wide limit in bytes per second (0 = unlimited).
+	SpeedLimit int64 `json:"speed_limit"`
+	// Window is the name of the active policy window, empty if none.
+	Window string `json:"window,omitempty"`
+	// Override indicates that a manual override is in effect.
+	Override bool `json:"override"`
+	// OverrideUntil is when the manual override expires.
+	OverrideUntil time.Time `json:"override_until"`
+}
+
+// WebhookInfo describes a webhook subscription. The secret is not exposed.
+type WebhookInfo struct {
+	// ID identifies the webhook.
+	ID string `json:"id"`
+	// URL is the endpoint the events are posted to.
+	URL string `json:"url"`
+	// Events are the subscribed events, empty for all of them.
+	Events []string `json:"events,omitempty"`
+	// Signed indicates that deliveries carry an HMAC-SHA256 signature.
+	Signed bool `json:"signed"`
+	// Failures is the number of saved failed deliveries of the webhook.
+	Failures int `json:"failures"`
+}
+
+// WebhookListResponse is the response for a webhook list request.
+type WebhookListResponse struct {
+	Webhooks []WebhookInfo `json:"webhooks"`
+}
+
+// WebhookTestParams holds parameters for a webhook test request.
+type WebhookTestParams struct {
+	// ID is the webhook to test. Empty tests all of them.
+	ID string `json:"id,omitempty"`
+}
+
+// WebhookTestResult is the outcome of the test delivery to one webhook.
+type WebhookTestResult struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Error is why the delivery failed, empty on success.
+	Error string `json:"error,omitempty"`
+}
+
+// WebhookTestResponse is the response for a webhook test request.
+type WebhookTestResponse struct {
+	Results []WebhookTestResult `json:"results"`
+}
+
+// CacheListResponse is the response for a cache list request.
+type CacheListResponse struct {
+	// Dir is the directory of the cache.
+	Dir string `json:"dir"`
+	// MaxSize is the size cap of the cache in bytes.
+	MaxSize int64 `json:"max_size"`
+	// Size is the total size of the cached files in bytes.
+	Size int64 `json:"size"`
+	// Entries are the cached files, most recently used first.
+	Entries []warplib.CacheEntry `json:"entries"`
+}
+
+// CachePruneParams holds parameters for a cache prune request.
+type CachePruneParams struct {
+	// MaxSize is the size in bytes to shrink the cache to, evicting the
+	// least recently used files. Zero with All unset prunes to the cap.
+	MaxSize int64 `json:"max_size,omitempty"`
+	// All empties the cache.
+	All bool `json:"all,omitempty"`
+}
+
+// CachePruneResponse is the response for a cache prune request.
+type CachePruneResponse struct {
+	// Removed are the evicted files.
+	Removed []warplib.CacheEntry `json:"removed"`
+	// Size is the size of the cache afterwards in bytes.
+	Size int64 `json:"size"`
+}
+
+// KeysAddParams holds parameters for a keys add request.
+type KeysAddParams struct {
+	// Name is the name to add the key under, empty for the name or
+	// comment the key carries.
+	Name string `json:"name,omitempty"`
+	// Key is the public key: OpenPGP (armored), minisign, signify or SSH.
+	Key string `json:"key"`
+}
+
+// KeysAddResponse is the response for a keys add request.
+type KeysAddResponse struct {
+	// Key is the added key.
+	Key warplib.TrustedKey `json:"key"`
+}
+
+// KeysListResponse is the response for a keys list request.
+type KeysListResponse struct {
+	// Dir is the directory of the keyring.
+	Dir string `json:"dir"`
+	// Keys are the trusted keys, sorted by name.
+	Keys []warplib.TrustedKey `json:"keys"`
+}
+
+// KeysRemoveParams holds parameters for a keys remove request.
+type KeysRemoveParams struct {
+	// Name is the name of the key to remove.
+	Name string `json:"name"`
+}
+
+// RepairParams holds parameters for a repair request.
+type RepairParams struct {
+	// DownloadId is the unique identifier of the download to repair.
+	DownloadId string `json:"download_id"`
+	// MaxConnections limits the connections used to download the
+	// corrupted pieces again.
+	MaxConnections int32 `json:"max_connections,omitempty"`
+}
+
+// RepairResponse is the response for a repair request.
+type RepairResponse struct {
+	warplib.RepairResult
+}
+
+// VerifyParams holds parameters for a verify request.
+type VerifyParams struct {
+	// DownloadIds are the downloads to verify, all the completed ones if
+	// empty.
+	DownloadIds []string `json:"download_ids,omitempty"`
+	// SearchDirs are the directories searched for the files missing from
+	// their path.
+	SearchDirs []string `json:"search_dirs,omitempty"`
+	// Redownload downloads the missing and modified files again.
+	Redownload bool `json:"redownload,omitempty"`
+	// MaxConnections limits the connections used to download files again.
+	MaxConnections int32 `json:"max_connections,omitempty"`
+}
+
+// VerifyingResponse reports the progress of a verification: the bytes
+// hashed of a download so far, or its result once verified.
+type VerifyingResponse struct {
+	// DownloadId is the download being verified.
+	DownloadId string `json:"download_id"`
+	// Hashed is the number of bytes of its file hashed so far.
+	Hashed int64 `json:"hashed,omitempty"`
+	// Size is the size of its file.
+	Size int64 `json:"size,omitempty"`
+	// Result is set once the download is verified.
+	Result *warplib.VerifyResult `json:"result,omitempty"`
+}
+
+// VerifyResponse is the response for a verify request.
+type VerifyResponse struct {
+	Results []*warplib.VerifyResult `json:"results"`
+}
+
+// ExportParams holds parameters for an export request.
+type ExportParams struct {
+	// Secrets keeps the credentials of the downloads in the history.
+	Secrets bool `json:"secrets,omitempty"`
+}
+
+// ExportResponse is the response for an export request.
+type ExportResponse struct {
+	History *warplib.History `json:"history"`
+}
+
+// ImportParams holds parameters for an import request.
+type ImportParams struct {
+	// History is the history to import.
+	History *warplib.History `json:"history"`
+	// DownloadDirectory moves the downloads imported to this directory.
+	DownloadDirectory string `json:"download_directory,omitempty"`
+}
+
+// ImportResponse is the response for an import request.
+type ImportResponse struct {
+	warplib.ImportResult
+}
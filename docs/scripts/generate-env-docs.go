@@ -45,6 +45,9 @@ WarpDL can be configured using environment variables. These take precedence over
 | ` + "`WARPDL_DEFAULT_DL_DIR`" + ` | Default download directory | current directory |
 | ` + "`WARPDL_SPEED_LIMIT`" + ` | Default speed limit (e.g., 1MB, 512KB) | unlimited |
 | ` + "`WARPDL_NO_WORK_STEAL`" + ` | Disable work stealing (set to "1") | ` + "`false`" + ` |
+| ` + "`WARPDL_ON_DUPLICATE`" + ` | Daemon policy for duplicate downloads: allow, return, refuse or attach | ` + "`attach`" + ` |
+| ` + "`WARPDL_CHECKSUM_MISMATCH`" + ` | What the daemon does with a file failing its checksum: fail, quarantine or delete | ` + "`fail`" + ` |
+| ` + "`WARPDL_CHECKSUM_SIDECARS`" + ` | Comma-separated checksum file patterns tried with ` + "`--checksum auto`" + ` before the built-in ones ({url}, {dir}, {name}) | none |
 | ` + "`WARP_MAX_PARTS`" + ` | Maximum file segments | ` + "`200`" + ` |
 | ` + "`WARP_MAX_CONN`" + ` | Maximum parallel connections | ` + "`24`" + ` |
 | ` + "`WARP_FORCE_SEGMENTS`" + ` | Force file segmentation (set to "1") | ` + "`true`" + ` |
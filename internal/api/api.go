@@ -11,6 +11,7 @@ import (
 	"github.com/warpdl/warpdl/internal/extl"
 	"github.com/warpdl/warpdl/internal/scheduler"
 	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/internal/webhook"
 	"github.com/warpdl/warpdl/pkg/warplib"
 )
 
@@ -24,9 +25,16 @@ type Api struct {
 	client       *http.Client
 	schemeRouter *warplib.SchemeRouter
 	scheduler    *scheduler.Scheduler
+	policy       *scheduler.Policy
+	webhooks     *webhook.Dispatcher
 	version      string
 	commit       string
 	buildType    string
+
+	// pool and notify are taken from the server in RegisterHandlers,
+	// for downloads the daemon resumes by itself.
+	pool   *server.Pool
+	notify *warplib.Handlers
 }
 
 // NewApi creates a new Api instance with the provided dependencies.
@@ -54,7 +62,12 @@ func NewApi(l *log.Logger, m *warplib.Manager, client *http.Client, elEngine *ex
 // It sets up handlers for download operations (download, resume, attach, flush,
 // stop, list) and extension management operations (add, get, list, delete,
 // activate, deactivate).
+// It also keeps the server's pool and JSON-RPC notifications for
+// downloads resumed through ResumeDownload.
 func (s *Api) RegisterHandlers(server *server.Server) {
+	s.pool = server.Pool()
+	s.notify = server.NotifyHandlers()
+
 	// downloader API methods
 	server.RegisterHandler(common.UPDATE_DOWNLOAD, s.downloadHandler)
 	server.RegisterHandler(common.UPDATE_RESUME, s.resumeHandler)
@@ -62,6 +75,7 @@ func (s *Api) RegisterHandlers(server *server.Server) {
 	server.RegisterHandler(common.UPDATE_FLUSH, s.flushHandler)
 	server.RegisterHandler(common.UPDATE_STOP, s.stopHandler)
 	server.RegisterHandler(common.UPDATE_LIST, s.listHandler)
+	server.RegisterHandler(common.UPDATE_SET, s.setHandler)
 
 	// extension API methods
 	server.RegisterHandler(common.UPDATE_ADD_EXT, s.addExtHandler)
@@ -79,6 +93,33 @@ func (s *Api) RegisterHandlers(server *server.Server) {
 	server.RegisterHandler(common.UPDATE_QUEUE_PAUSE, s.queuePauseHandler)
 	server.RegisterHandler(common.UPDATE_QUEUE_RESUME, s.queueResumeHandler)
 	server.RegisterHandler(common.UPDATE_QUEUE_MOVE, s.queueMoveHandler)
+
+	// time-window policy methods
+	server.RegisterHandler(common.UPDATE_POLICY_STATUS, s.policyStatusHandler)
+	server.RegisterHandler(common.UPDATE_POLICY_OVERRIDE, s.policyOverrideHandler)
+	server.RegisterHandler(common.UPDATE_POLICY_CLEAR, s.policyClearHandler)
+
+	// webhook methods
+	server.RegisterHandler(common.UPDATE_WEBHOOK_LIST, s.webhookListHandler)
+	server.RegisterHandler(common.UPDATE_WEBHOOK_TEST, s.webhookTestHandler)
+
+	// download cache methods
+	server.RegisterHandler(common.UPDATE_CACHE_LIST, s.cacheListHandler)
+	server.RegisterHandler(common.UPDATE_CACHE_PRUNE, s.cachePruneHandler)
+	// keyring of trusted signers
+	server.RegisterHandler(common.UPDATE_KEYS_ADD, s.keysAddHandler)
+	server.RegisterHandler(common.UPDATE_KEYS_LIST, s.keysListHandler)
+	server.RegisterHandler(common.UPDATE_KEYS_REMOVE, s.keysRemoveHandler)
+	server.RegisterHandler(common.UPDATE_REPAIR, s.repairHandler)
+	server.RegisterHandler(common.UPDATE_VERIFY, s.verifyHandler)
+	server.RegisterHandler(common.UPDATE_EXPORT, s.exportHandler)
+	server.RegisterHandler(common.UPDATE_IMPORT, s.importHandler)
+}
+
+// SetPolicy sets the time-window policy controlled by the policy handlers.
+// Used by daemon startup after the policy has been loaded.
+func (s *Api) SetPolicy(p *scheduler.Policy) {
+	s.policy = p
 }
 
 // Close releases resources held by the Api, specifically closing the
@@ -174,6 +174,54 @@ func TestDownloadHandler(t *testing.T) {
 	}
 }
 
+func TestDownloadHandlerDuplicate(t *testing.T) {
+	api, pool, cleanup := newTestApi(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("d"), 2048)
+	srv := newRangeServer(content)
+	defer srv.Close()
+
+	add := func(policy warplib.DuplicatePolicy) (*common.DownloadResponse, error) {
+		body, _ := json.Marshal(common.DownloadParams{
+			Url:               srv.URL + "/file.bin",
+			DownloadDirectory: warplib.ConfigDir,
+			OnDuplicate:       policy,
+		})
+		_, msg, err := api.downloadHandler(nil, pool, body)
+		if err != nil {
+			return nil, err
+		}
+		return msg.(*common.DownloadResponse), nil
+	}
+	first, err := add("")
+	if err != nil {
+		t.Fatalf("downloadHandler: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for item := api.manager.GetItem(first.DownloadId); item.GetDownloaded() != item.GetTotalSize(); {
+		if time.Now().After(deadline) {
+			t.Fatal("download did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err := add(warplib.DuplicateAttach)
+	if err != nil {
+		t.Fatalf("downloadHandler(duplicate): %v", err)
+	}
+	if resp.DownloadId != first.DownloadId || resp.Duplicate != warplib.DuplicateReturned ||
+		resp.DuplicateMatch != warplib.DuplicateURL || resp.SavePath != first.SavePath {
+		t.Errorf("duplicate response = %+v", resp)
+	}
+	if _, err := add(warplib.DuplicateRefuse); !errors.Is(err, warplib.ErrDuplicateDownload) {
+		t.Errorf("downloadHandler(refuse) = %v, want ErrDuplicateDownload", err)
+	}
+	if n := len(api.manager.GetItems()); n != 1 {
+		t.Errorf("%d items, want 1", n)
+	}
+}
+
 func TestDownloadHandlerExtensionErrorFallback(t *testing.T) {
 	api, pool, cleanup := newTestApi(t)
 	defer cleanup()
@@ -274,6 +322,24 @@ func TestListHandler(t *testing.T) {
 	if len(msg.(*common.ListResponse).Items) != 1 {
 		t.Fatalf("expected completed items")
 	}
+
+	item2.Error = "connection reset"
+	api.manager.UpdateItem(item2)
+	body, _ = json.Marshal(common.ListParams{Status: "failed,scheduled", Search: "B", Sort: "size", Limit: 5})
+	_, msg, err = api.listHandler(nil, pool, body)
+	if err != nil {
+		t.Fatalf("listHandler: %v", err)
+	}
+	if resp := msg.(*common.ListResponse); len(resp.Items) != 1 || resp.Items[0].Hash != "h2" || resp.Total != 1 {
+		t.Fatalf("expected the failed item, got %+v", resp)
+	}
+
+	for _, params := range []common.ListParams{{Status: "stuck"}, {Sort: "name"}} {
+		body, _ = json.Marshal(params)
+		if _, _, err := api.listHandler(nil, pool, body); err == nil {
+			t.Fatalf("listHandler(%+v) succeeded", params)
+		}
+	}
 }
 
 func TestFlushHandler(t *testing.T) {
@@ -1641,3 +1707,25 @@ func TestStopHandlerCancelsRecurringItem(t *testing.T) {
 		t.Errorf("expected ScheduleStateCancelled, got %q", updated.ScheduleState)
 	}
 }
+
+func TestDownloadHandlerChecksums(t *testing.T) {
+	api, pool, cleanup := newTestApi(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(common.DownloadParams{
+		Url:               "http://127.0.0.1:1/file.bin",
+		DownloadDirectory: warplib.ConfigDir,
+		Checksums:         []string{"sha1:abcd"},
+	})
+	if _, _, err := api.downloadHandler(nil, pool, body); err == nil {
+		t.Error("downloadHandler accepted an invalid checksum")
+	}
+	body, _ = json.Marshal(common.DownloadParams{
+		Url:               "ftp://127.0.0.1:1/file.bin",
+		DownloadDirectory: warplib.ConfigDir,
+		Checksums:         []string{"md5:" + strings.Repeat("ab", 16)},
+	})
+	if _, _, err := api.downloadHandler(nil, pool, body); !errors.Is(err, warplib.ErrChecksumNotSupported) {
+		t.Errorf("downloadHandler(ftp with checksum) = %v, want ErrChecksumNotSupported", err)
+	}
+}
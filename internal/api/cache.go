@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// errCacheNotEnabled is returned when the daemon runs without a download
+// cache, because it has no cache file or an invalid one.
+var errCacheNotEnabled = errors.New("download cache not enabled")
+
+// cacheListHandler returns the files in the download cache.
+func (s *Api) cacheListHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	c := s.manager.GetCache()
+	if c == nil {
+		return common.UPDATE_CACHE_LIST, nil, errCacheNotEnabled
+	}
+	return common.UPDATE_CACHE_LIST, &common.CacheListResponse{
+		Dir:     c.Dir(),
+		MaxSize: c.MaxSize(),
+		Size:    c.Size(),
+		Entries: c.Entries(),
+	}, nil
+}
+
+// cachePruneHandler evicts the least recently used files from the download
+// cache down to the requested size.
+func (s *Api) cachePruneHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.CachePruneParams
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &m); err != nil {
+			return common.UPDATE_CACHE_PRUNE, nil, err
+		}
+	}
+	if m.MaxSize < 0 {
+		return common.UPDATE_CACHE_PRUNE, nil, errors.New("max size must not be negative")
+	}
+	c := s.manager.GetCache()
+	if c == nil {
+		return common.UPDATE_CACHE_PRUNE, nil, errCacheNotEnabled
+	}
+	maxSize := m.MaxSize
+	switch {
+	case m.All:
+		maxSize = 0
+	case maxSize == 0:
+		maxSize = c.MaxSize()
+	}
+	removed, err := c.Prune(maxSize)
+	if err != nil {
+		return common.UPDATE_CACHE_PRUNE, nil, err
+	}
+	if removed == nil {
+		removed = []warplib.CacheEntry{}
+	}
+	return common.UPDATE_CACHE_PRUNE, &common.CachePruneResponse{Removed: removed, Size: c.Size()}, nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestCacheHandlers(t *testing.T) {
+	api, _, cleanup := newTestApi(t)
+	defer cleanup()
+
+	if _, _, err := api.cacheListHandler(nil, nil, nil); err != errCacheNotEnabled {
+		t.Fatalf("list: expected errCacheNotEnabled, got %v", err)
+	}
+	if _, _, err := api.cachePruneHandler(nil, nil, nil); err != errCacheNotEnabled {
+		t.Fatalf("prune: expected errCacheNotEnabled, got %v", err)
+	}
+
+	c, err := warplib.OpenCache(&warplib.CacheConfig{Dir: t.TempDir(), MaxSize: 1024})
+	if err != nil {
+		t.Fatalf("OpenCache: %v", err)
+	}
+	api.manager.SetCache(c)
+	dir := t.TempDir()
+	for _, name := range []string{"a", "bb"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Put(path, "https://example.com/"+name, ""); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	_, msg, err := api.cacheListHandler(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cacheListHandler: %v", err)
+	}
+	list := msg.(*common.CacheListResponse)
+	if len(list.Entries) != 2 || list.Size != 3 || list.MaxSize != 1024 {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	body, _ := json.Marshal(common.CachePruneParams{MaxSize: 2})
+	_, msg, err = api.cachePruneHandler(nil, nil, body)
+	if err != nil {
+		t.Fatalf("cachePruneHandler: %v", err)
+	}
+	pruned := msg.(*common.CachePruneResponse)
+	if len(pruned.Removed) != 1 || pruned.Removed[0].Size != 1 || pruned.Size != 2 {
+		t.Fatalf("unexpected prune: %+v", pruned)
+	}
+
+	body, _ = json.Marshal(common.CachePruneParams{All: true})
+	if _, msg, err = api.cachePruneHandler(nil, nil, body); err != nil || msg.(*common.CachePruneResponse).Size != 0 {
+		t.Fatalf("prune all: %+v, %v", msg, err)
+	}
+}
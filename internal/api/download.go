@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -23,6 +24,13 @@ func (s *Api) downloadHandler(sconn *server.SyncConn, pool *server.Pool, body js
 	if err := json.Unmarshal(body, &m); err != nil {
 		return common.UPDATE_DOWNLOAD, nil, err
 	}
+	// Without a queue to hold them, new downloads are refused during a
+	// pause window. Scheduled downloads only start later.
+	if s.manager.GetQueue() == nil && m.Schedule == "" && m.StartAt == "" {
+		if err := s.policy.CheckStart(); err != nil {
+			return common.UPDATE_DOWNLOAD, nil, err
+		}
+	}
 
 	dlURL, err := s.elEngine.Extract(m.Url)
 	if err != nil {
@@ -102,6 +110,11 @@ func (s *Api) downloadHTTPHandler(sconn *server.SyncConn, pool *server.Pool, dlU
 		}
 	}
 
+	checksums, discover, err := warplib.ParseChecksumArgs(m.Checksums)
+	if err != nil {
+		return common.UPDATE_DOWNLOAD, nil, err
+	}
+
 	// Import cookies if requested
 	if m.CookiesFrom != "" {
 		parsedURL, urlErr := url.Parse(dlURL)
@@ -141,6 +154,12 @@ func (s *Api) downloadHTTPHandler(sconn *server.SyncConn, pool *server.Pool, dlU
 		RetryConfig:       retryConfig,
 		RequestTimeout:    requestTimeout,
 		SpeedLimit:        speedLimit,
+		AutoConnections:   m.AutoConnections,
+		DirectWrite:       m.DirectWrite,
+		Checksums:         checksums,
+		DiscoverChecksums: discover,
+		ChecksumConfig:    s.manager.GetChecksumConfig(),
+		Signature:         m.VerifySig,
 		Handlers: &warplib.Handlers{
 			ErrorHandler: func(_ string, err error) {
 				if errors.Is(err, context.Canceled) && d.IsStopped() {
@@ -219,7 +238,17 @@ func (s *Api) downloadHTTPHandler(sconn *server.SyncConn, pool *server.Pool, dlU
 		AbsoluteLocation: d.GetDownloadDirectory(),
 		Priority:         warplib.Priority(m.Priority),
 		SkipQueue:        skipQueue,
+		Hooks:            m.Hooks,
+		Extract:          m.Extract,
+		OnDuplicate:      m.OnDuplicate,
 	})
+	var dup *warplib.DuplicateError
+	if errors.As(err, &dup) {
+		pool.StopDownload(d.GetHash())
+		_ = d.Close()
+		_ = os.RemoveAll(filepath.Join(warplib.DlDataDir, d.GetHash()))
+		return duplicateResponse(sconn, pool, dup)
+	}
 	if err != nil {
 		return common.UPDATE_DOWNLOAD, nil, err
 	}
@@ -335,6 +364,12 @@ func (s *Api) downloadHTTPHandler(sconn *server.SyncConn, pool *server.Pool, dlU
 
 // downloadProtocolHandler handles FTP, FTPS, and SFTP downloads via SchemeRouter.
 func (s *Api) downloadProtocolHandler(sconn *server.SyncConn, pool *server.Pool, rawURL, scheme string, m *common.DownloadParams) (common.UpdateType, any, error) {
+	if len(m.Checksums) > 0 {
+		return common.UPDATE_DOWNLOAD, nil, warplib.ErrChecksumNotSupported
+	}
+	if m.VerifySig != "" {
+		return common.UPDATE_DOWNLOAD, nil, warplib.ErrSignatureNotSupported
+	}
 	if s.schemeRouter == nil {
 		return common.UPDATE_DOWNLOAD, nil, fmt.Errorf("%s downloads not available: scheme router not initialized", scheme)
 	}
@@ -421,7 +456,16 @@ func (s *Api) downloadProtocolHandler(sconn *server.SyncConn, pool *server.Pool,
 		Priority:         warplib.Priority(m.Priority),
 		SkipQueue:        skipQueue,
 		SSHKeyPath:       m.SSHKeyPath,
+		Hooks:            m.Hooks,
+		Extract:          m.Extract,
+		OnDuplicate:      m.OnDuplicate,
 	})
+	var dup *warplib.DuplicateError
+	if errors.As(err, &dup) {
+		pool.StopDownload(pd.GetHash())
+		pd.Close()
+		return duplicateResponse(sconn, pool, dup)
+	}
 	if err != nil {
 		return common.UPDATE_DOWNLOAD, nil, err
 	}
@@ -448,6 +492,39 @@ func (s *Api) downloadProtocolHandler(sconn *server.SyncConn, pool *server.Pool,
 	}, nil
 }
 
+// duplicateResponse answers a download request that duplicates an
+// existing download with that download, attaching the connection to it if
+// it's running. A refused duplicate is an error.
+func duplicateResponse(sconn *server.SyncConn, pool *server.Pool, dup *warplib.DuplicateError) (common.UpdateType, any, error) {
+	if dup.Action == warplib.DuplicateRefused {
+		return common.UPDATE_DOWNLOAD, nil, dup
+	}
+	item := dup.Item
+	action := dup.Action
+	if action == warplib.DuplicateAttached {
+		if pool.HasDownload(item.Hash) {
+			pool.AddConnection(item.Hash, sconn)
+		} else {
+			action = warplib.DuplicateReturned
+		}
+	}
+	// a download that isn't running has no connections to report
+	maxConn, _ := item.GetMaxConnections()
+	maxParts, _ := item.GetMaxParts()
+	return common.UPDATE_DOWNLOAD, &common.DownloadResponse{
+		ContentLength:     item.GetTotalSize(),
+		DownloadId:        item.Hash,
+		FileName:          item.Name,
+		SavePath:          item.GetSavePath(),
+		DownloadDirectory: item.DownloadLocation,
+		Downloaded:        item.GetDownloaded(),
+		MaxConnections:    maxConn,
+		MaxSegments:       maxParts,
+		Duplicate:         action,
+		DuplicateMatch:    dup.Match,
+	}, nil
+}
+
 // applyTimestampSuffix adds a timestamp suffix to a filename before the last extension.
 // Format: <basename>-<YYYY-MM-DDTHHMMSS>.<ext>
 // For files with no extension: <basename>-<timestamp>
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// exportHandler exports the history of the downloads and the queue.
+func (s *Api) exportHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.ExportParams
+	if err := json.Unmarshal(body, &m); err != nil {
+		return common.UPDATE_EXPORT, nil, err
+	}
+	h, err := s.manager.ExportHistory(&warplib.ExportOpts{Secrets: m.Secrets})
+	if err != nil {
+		return common.UPDATE_EXPORT, nil, err
+	}
+	return common.UPDATE_EXPORT, &common.ExportResponse{History: h}, nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/scheduler"
+	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// importHandler imports a history of downloads and schedules the scheduled
+// ones among those imported.
+func (s *Api) importHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.ImportParams
+	if err := json.Unmarshal(body, &m); err != nil {
+		return common.UPDATE_IMPORT, nil, err
+	}
+	if m.History == nil {
+		return common.UPDATE_IMPORT, nil, errors.New("history is required")
+	}
+	res, err := s.manager.ImportHistory(m.History, &warplib.ImportOpts{DownloadDirectory: m.DownloadDirectory})
+	if err != nil {
+		return common.UPDATE_IMPORT, nil, err
+	}
+	if s.scheduler != nil {
+		for _, item := range m.History.Items {
+			// skipped items are the ones the manager already had
+			if s.manager.GetItem(item.Hash) != item {
+				continue
+			}
+			if item.ScheduleState != warplib.ScheduleStateScheduled || item.ScheduledAt.IsZero() {
+				continue
+			}
+			s.scheduler.Add(scheduler.ScheduleEvent{
+				ItemHash:  item.Hash,
+				TriggerAt: item.ScheduledAt,
+				CronExpr:  item.CronExpr,
+			})
+		}
+	}
+	return common.UPDATE_IMPORT, &common.ImportResponse{ImportResult: *res}, nil
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestImportExportHandlers(t *testing.T) {
+	api, _, cleanup := newTestApi(t)
+	defer cleanup()
+
+	h := &warplib.History{Version: warplib.HistoryVersion, Items: []*warplib.Item{{
+		Hash:             "a1b2c3d4",
+		Name:             "file.bin",
+		Url:              "https://example.com/file.bin",
+		Headers:          warplib.Headers{{Key: "Cookie", Value: "session=1"}},
+		DateAdded:        time.Now(),
+		TotalSize:        10,
+		Downloaded:       10,
+		AbsoluteLocation: "/data",
+		DownloadLocation: "/data",
+	}}}
+	body, _ := json.Marshal(common.ImportParams{History: h})
+	_, msg, err := api.importHandler(nil, nil, body)
+	if err != nil {
+		t.Fatalf("importHandler: %v", err)
+	}
+	if res := msg.(*common.ImportResponse); res.Imported != 1 || res.Skipped != 0 {
+		t.Errorf("import = %+v", res)
+	}
+	if _, _, err := api.importHandler(nil, nil, []byte("{}")); err == nil {
+		t.Error("expected an error without a history")
+	}
+
+	body, _ = json.Marshal(common.ExportParams{})
+	_, msg, err = api.exportHandler(nil, nil, body)
+	if err != nil {
+		t.Fatalf("exportHandler: %v", err)
+	}
+	got := msg.(*common.ExportResponse).History
+	if len(got.Items) != 1 || got.Items[0].Hash != "a1b2c3d4" || len(got.Items[0].Headers) != 0 {
+		t.Errorf("export = %+v", got.Items)
+	}
+	if _, _, err := api.exportHandler(nil, nil, []byte("{")); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
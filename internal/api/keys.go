@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// errKeyringNotAvailable is returned when the daemon couldn't open its
+// keyring of trusted signers.
+var errKeyringNotAvailable = errors.New("keyring not available")
+
+// keysAddHandler adds a public key to the keyring of trusted signers.
+func (s *Api) keysAddHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.KeysAddParams
+	if err := json.Unmarshal(body, &m); err != nil {
+		return common.UPDATE_KEYS_ADD, nil, err
+	}
+	k := s.manager.GetKeyring()
+	if k == nil {
+		return common.UPDATE_KEYS_ADD, nil, errKeyringNotAvailable
+	}
+	key, err := k.Add(m.Name, []byte(m.Key))
+	if err != nil {
+		return common.UPDATE_KEYS_ADD, nil, err
+	}
+	return common.UPDATE_KEYS_ADD, &common.KeysAddResponse{Key: key}, nil
+}
+
+// keysListHandler returns the keys of the keyring of trusted signers.
+func (s *Api) keysListHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	k := s.manager.GetKeyring()
+	if k == nil {
+		return common.UPDATE_KEYS_LIST, nil, errKeyringNotAvailable
+	}
+	keys, err := k.List()
+	if err != nil {
+		return common.UPDATE_KEYS_LIST, nil, err
+	}
+	if keys == nil {
+		keys = []warplib.TrustedKey{}
+	}
+	return common.UPDATE_KEYS_LIST, &common.KeysListResponse{Dir: k.Dir(), Keys: keys}, nil
+}
+
+// keysRemoveHandler removes a key from the keyring of trusted signers.
+func (s *Api) keysRemoveHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.KeysRemoveParams
+	if err := json.Unmarshal(body, &m); err != nil {
+		return common.UPDATE_KEYS_REMOVE, nil, err
+	}
+	k := s.manager.GetKeyring()
+	if k == nil {
+		return common.UPDATE_KEYS_REMOVE, nil, errKeyringNotAvailable
+	}
+	if err := k.Remove(m.Name); err != nil {
+		return common.UPDATE_KEYS_REMOVE, nil, err
+	}
+	return common.UPDATE_KEYS_REMOVE, nil, nil
+}
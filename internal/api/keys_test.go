@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestKeysHandlers(t *testing.T) {
+	api, _, cleanup := newTestApi(t)
+	defer cleanup()
+
+	if _, _, err := api.keysListHandler(nil, nil, nil); err != errKeyringNotAvailable {
+		t.Fatalf("list: expected errKeyringNotAvailable, got %v", err)
+	}
+
+	k, err := warplib.OpenKeyring(filepath.Join(t.TempDir(), "keys"))
+	if err != nil {
+		t.Fatalf("OpenKeyring: %v", err)
+	}
+	api.manager.SetKeyring(k)
+	key, err := os.ReadFile(filepath.Join("..", "..", "pkg", "warplib", "testdata", "signature", "ssh.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(common.KeysAddParams{Name: "ci", Key: string(key)})
+	_, msg, err := api.keysAddHandler(nil, nil, body)
+	if err != nil {
+		t.Fatalf("keysAddHandler: %v", err)
+	}
+	if added := msg.(*common.KeysAddResponse).Key; added.Name != "ci" || added.Format != warplib.KeySSH {
+		t.Fatalf("unexpected key: %+v", added)
+	}
+	if _, _, err := api.keysAddHandler(nil, nil, body); !errors.Is(err, warplib.ErrKeyExists) {
+		t.Fatalf("add twice: expected ErrKeyExists, got %v", err)
+	}
+
+	_, msg, err = api.keysListHandler(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("keysListHandler: %v", err)
+	}
+	if list := msg.(*common.KeysListResponse); list.Dir != k.Dir() || len(list.Keys) != 1 {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	body, _ = json.Marshal(common.KeysRemoveParams{Name: "ci"})
+	if _, _, err := api.keysRemoveHandler(nil, nil, body); err != nil {
+		t.Fatalf("keysRemoveHandler: %v", err)
+	}
+	if _, _, err := api.keysRemoveHandler(nil, nil, body); !errors.Is(err, warplib.ErrKeyNotFound) {
+		t.Fatalf("remove twice: expected ErrKeyNotFound, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/warpdl/warpdl/common"
 	"github.com/warpdl/warpdl/internal/server"
@@ -13,16 +14,52 @@ func (s *Api) listHandler(sconn *server.SyncConn, pool *server.Pool, body json.R
 	if err := json.Unmarshal(body, &m); err != nil {
 		return common.UPDATE_LIST, nil, err
 	}
-	var items []*warplib.Item
+	q, err := listQuery(&m)
+	if err != nil {
+		return common.UPDATE_LIST, nil, err
+	}
+	items, total := s.manager.QueryItems(q)
+	return common.UPDATE_LIST, &common.ListResponse{
+		Items: items,
+		Total: total,
+	}, nil
+}
+
+// listQuery translates the parameters of a listing into a query of the
+// manager.
+func listQuery(m *common.ListParams) (*warplib.ItemQuery, error) {
+	sort, err := warplib.ParseItemSort(m.Sort)
+	if err != nil {
+		return nil, err
+	}
+	q := &warplib.ItemQuery{
+		Hidden:   m.ShowHidden,
+		Category: m.Category,
+		Search:   m.Search,
+		Host:     m.Host,
+		Since:    m.Since,
+		Until:    m.Until,
+		MinSize:  m.MinSize,
+		Sort:     sort,
+		Offset:   m.Offset,
+		Limit:    m.Limit,
+	}
 	switch {
+	case m.Status != "":
+		for _, name := range strings.Split(m.Status, ",") {
+			st, err := warplib.ParseItemStatus(name)
+			if err != nil {
+				return nil, err
+			}
+			q.Statuses = append(q.Statuses, st)
+		}
 	case m.ShowCompleted && m.ShowPending:
-		items = s.manager.GetItems()
 	case m.ShowCompleted:
-		items = s.manager.GetCompletedItems()
+		q.Statuses = []warplib.ItemStatus{warplib.StatusCompleted}
 	default:
-		items = s.manager.GetIncompleteItems()
+		q.Statuses = []warplib.ItemStatus{
+			warplib.StatusActive, warplib.StatusPending, warplib.StatusFailed, warplib.StatusScheduled,
+		}
 	}
-	return common.UPDATE_LIST, &common.ListResponse{
-		Items: items,
-	}, nil
+	return q, nil
 }
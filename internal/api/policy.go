@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/scheduler"
+	"github.com/warpdl/warpdl/internal/server"
+)
+
+// errPolicyNotEnabled is returned when the daemon runs without a policy engine.
+var errPolicyNotEnabled = errors.New("time-window policies not enabled")
+
+// policyStatusResponse converts a scheduler.PolicyState into its wire form.
+func policyStatusResponse(st scheduler.PolicyState) *common.PolicyStatusResponse {
+	return &common.PolicyStatusResponse{
+		Action:        string(st.Action),
+		SpeedLimit:    st.SpeedLimit,
+		Window:        st.Window,
+		Override:      st.Override,
+		OverrideUntil: st.OverrideUntil,
+	}
+}
+
+// policyStatusHandler returns the effective time-window policy.
+func (s *Api) policyStatusHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	if s.policy == nil {
+		return common.UPDATE_POLICY_STATUS, nil, errPolicyNotEnabled
+	}
+	return common.UPDATE_POLICY_STATUS, policyStatusResponse(s.policy.State()), nil
+}
+
+// policyOverrideHandler forces a policy action until the requested time.
+func (s *Api) policyOverrideHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.PolicyOverrideParams
+	if err := json.Unmarshal(body, &m); err != nil {
+		return common.UPDATE_POLICY_OVERRIDE, nil, err
+	}
+	if s.policy == nil {
+		return common.UPDATE_POLICY_OVERRIDE, nil, errPolicyNotEnabled
+	}
+	st, err := s.policy.Override(scheduler.PolicyAction(m.Action), m.SpeedLimit, m.Until)
+	if err != nil {
+		return common.UPDATE_POLICY_OVERRIDE, nil, err
+	}
+	return common.UPDATE_POLICY_OVERRIDE, policyStatusResponse(st), nil
+}
+
+// policyClearHandler removes a manual override and returns to the weekly schedule.
+func (s *Api) policyClearHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	if s.policy == nil {
+		return common.UPDATE_POLICY_CLEAR, nil, errPolicyNotEnabled
+	}
+	return common.UPDATE_POLICY_CLEAR, policyStatusResponse(s.policy.ClearOverride()), nil
+}
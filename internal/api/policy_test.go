@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/scheduler"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// newTestApiWithPolicy creates a test API with an empty time-window policy.
+func newTestApiWithPolicy(t *testing.T) (*Api, func()) {
+	t.Helper()
+	api, _, cleanup := newTestApi(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := scheduler.NewPolicy(ctx, nil, nil)
+	if err != nil {
+		cancel()
+		cleanup()
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	api.SetPolicy(p)
+	return api, func() {
+		cancel()
+		cleanup()
+	}
+}
+
+func TestPolicyHandlers_NotEnabled(t *testing.T) {
+	api, _, cleanup := newTestApi(t)
+	defer cleanup()
+
+	if _, _, err := api.policyStatusHandler(nil, nil, nil); err != errPolicyNotEnabled {
+		t.Fatalf("status: expected errPolicyNotEnabled, got %v", err)
+	}
+	body, _ := json.Marshal(common.PolicyOverrideParams{Action: "pause", Until: time.Now().Add(time.Hour)})
+	if _, _, err := api.policyOverrideHandler(nil, nil, body); err != errPolicyNotEnabled {
+		t.Fatalf("override: expected errPolicyNotEnabled, got %v", err)
+	}
+	if _, _, err := api.policyClearHandler(nil, nil, nil); err != errPolicyNotEnabled {
+		t.Fatalf("clear: expected errPolicyNotEnabled, got %v", err)
+	}
+}
+
+func TestPolicyHandlers_OverrideAndClear(t *testing.T) {
+	api, cleanup := newTestApiWithPolicy(t)
+	defer cleanup()
+
+	_, msg, err := api.policyStatusHandler(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("policyStatusHandler: %v", err)
+	}
+	if resp := msg.(*common.PolicyStatusResponse); resp.Action != "full" || resp.Override {
+		t.Fatalf("unexpected initial status: %+v", resp)
+	}
+
+	until := time.Now().Add(time.Hour)
+	body, _ := json.Marshal(common.PolicyOverrideParams{Action: "limit", SpeedLimit: 1024, Until: until})
+	updateType, msg, err := api.policyOverrideHandler(nil, nil, body)
+	if err != nil {
+		t.Fatalf("policyOverrideHandler: %v", err)
+	}
+	if updateType != common.UPDATE_POLICY_OVERRIDE {
+		t.Fatalf("expected UPDATE_POLICY_OVERRIDE, got %v", updateType)
+	}
+	resp := msg.(*common.PolicyStatusResponse)
+	if !resp.Override || resp.Action != "limit" || resp.SpeedLimit != 1024 {
+		t.Fatalf("unexpected override status: %+v", resp)
+	}
+
+	_, msg, err = api.policyClearHandler(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("policyClearHandler: %v", err)
+	}
+	if resp := msg.(*common.PolicyStatusResponse); resp.Override || resp.Action != "full" {
+		t.Fatalf("unexpected status after clear: %+v", resp)
+	}
+}
+
+func TestPolicyOverrideHandler_InvalidParams(t *testing.T) {
+	api, cleanup := newTestApiWithPolicy(t)
+	defer cleanup()
+
+	if _, _, err := api.policyOverrideHandler(nil, nil, json.RawMessage(`{invalid`)); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+	body, _ := json.Marshal(common.PolicyOverrideParams{Action: "turbo", Until: time.Now().Add(time.Hour)})
+	if _, _, err := api.policyOverrideHandler(nil, nil, body); err == nil {
+		t.Fatal("expected error for invalid action")
+	}
+}
+
+func TestPolicyPause_RefusesDownloadAndResume(t *testing.T) {
+	api, cleanup := newTestApiWithPolicy(t)
+	defer cleanup()
+	if _, err := api.policy.Override(scheduler.PolicyPause, 0, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Override: %v", err)
+	}
+
+	// no queue: the download would start right away
+	body, _ := json.Marshal(common.DownloadParams{Url: "http://127.0.0.1:1/file.bin"})
+	if _, _, err := api.downloadHandler(nil, nil, body); !errors.Is(err, scheduler.ErrPolicyPaused) {
+		t.Fatalf("downloadHandler: expected ErrPolicyPaused, got %v", err)
+	}
+	body, _ = json.Marshal(common.ResumeParams{DownloadId: "h1"})
+	if _, _, err := api.resumeHandler(nil, nil, body); !errors.Is(err, scheduler.ErrPolicyPaused) {
+		t.Fatalf("resumeHandler: expected ErrPolicyPaused, got %v", err)
+	}
+}
+
+func TestApi_ResumeDownload(t *testing.T) {
+	api, pool, cleanup := newTestApi(t)
+	defer cleanup()
+	api.pool = pool
+
+	item := &warplib.Item{
+		Hash:             "h1",
+		Name:             "a",
+		Url:              "u",
+		TotalSize:        10,
+		DownloadLocation: warplib.ConfigDir,
+		AbsoluteLocation: warplib.ConfigDir,
+		Resumable:        true,
+		Parts:            make(map[int64]*warplib.ItemPart),
+	}
+	api.manager.UpdateItem(item)
+	if err := os.MkdirAll(filepath.Join(warplib.DlDataDir, item.Hash), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := api.ResumeDownload(item.Hash, &warplib.ResumeDownloadOpts{MaxConnections: 3, SpeedLimit: 1024}); err != nil {
+		t.Fatalf("ResumeDownload: %v", err)
+	}
+	if !pool.HasDownload(item.Hash) {
+		t.Error("resumed download not in the pool, clients can't attach to it")
+	}
+	if n, err := item.GetMaxConnections(); err != nil || n != 3 {
+		t.Errorf("max connections = %d (%v), want 3", n, err)
+	}
+	if limit, err := item.GetSpeedLimit(); err != nil || limit != 1024 {
+		t.Errorf("speed limit = %d (%v), want 1024", limit, err)
+	}
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// repairHandler downloads the corrupted pieces of a completed download
+// again. It replies once the repair is done, which can take a while for
+// large files.
+func (s *Api) repairHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.RepairParams
+	if err := json.Unmarshal(body, &m); err != nil {
+		return common.UPDATE_REPAIR, nil, err
+	}
+	res, err := s.manager.RepairDownload(s.client, m.DownloadId, &warplib.RepairOpts{MaxConnections: m.MaxConnections})
+	if err != nil {
+		return common.UPDATE_REPAIR, nil, err
+	}
+	return common.UPDATE_REPAIR, &common.RepairResponse{RepairResult: *res}, nil
+}
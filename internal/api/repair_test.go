@@ -0,0 +1,23 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestRepairHandler(t *testing.T) {
+	api, _, cleanup := newTestApi(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(common.RepairParams{DownloadId: "missing"})
+	if _, _, err := api.repairHandler(nil, nil, body); !errors.Is(err, warplib.ErrDownloadNotFound) {
+		t.Fatalf("expected ErrDownloadNotFound, got %v", err)
+	}
+	if _, _, err := api.repairHandler(nil, nil, []byte("{")); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -160,24 +161,66 @@ func (s *Api) resumeHandler(sconn *server.SyncConn, pool *server.Pool, body json
 		}
 	}
 
+	if err := s.policy.CheckStart(); err != nil {
+		return common.UPDATE_RESUME, nil, err
+	}
+	item, err := s.resumeDownload(pool, sconn, rsClient, m.DownloadId, &warplib.ResumeDownloadOpts{
+		Headers:         m.Headers,
+		ForceParts:      m.ForceParts,
+		MaxConnections:  m.MaxConnections,
+		MaxSegments:     m.MaxSegments,
+		RetryConfig:     retryConfig,
+		RequestTimeout:  requestTimeout,
+		SpeedLimit:      speedLimit,
+		AutoConnections: m.AutoConnections,
+	}, nil)
+	if err != nil {
+		return common.UPDATE_RESUME, nil, err
+	}
+	maxConn, _ := item.GetMaxConnections()
+	maxParts, _ := item.GetMaxParts()
+	return common.UPDATE_RESUME, &common.ResumeResponse{
+		ChildHash:         item.ChildHash,
+		ContentLength:     item.TotalSize,
+		Downloaded:        item.Downloaded,
+		FileName:          item.Name,
+		SavePath:          item.GetSavePath(),
+		DownloadDirectory: item.DownloadLocation,
+		AbsoluteLocation:  item.AbsoluteLocation,
+		MaxConnections:    maxConn,
+		MaxSegments:       maxParts,
+	}, nil
+}
+
+// ResumeDownload resumes a download the daemon stopped by itself, such as
+// one stopped by a pause window, through the same path as a client's resume
+// request: CLI clients can attach to it and JSON-RPC subscribers get its
+// events. opts are the options the download had when it was stopped.
+func (s *Api) ResumeDownload(hash string, opts *warplib.ResumeDownloadOpts) error {
+	if s.pool == nil {
+		return errors.New("api: handlers not registered")
+	}
+	_, err := s.resumeDownload(s.pool, nil, s.client, hash, opts, s.notify)
+	return err
+}
+
+// resumeDownload resumes the download hash and its child, if any, and
+// reports their progress to the connections in pool watching hash.
+// sconn is nil when the daemon resumes a download by itself, and notify
+// are optional handlers that also receive the download events.
+func (s *Api) resumeDownload(pool *server.Pool, sconn *server.SyncConn, client *http.Client, hash string, opts *warplib.ResumeDownloadOpts, notify *warplib.Handlers) (*warplib.Item, error) {
+	if opts == nil {
+		opts = &warplib.ResumeDownloadOpts{}
+	}
 	var (
-		item         *warplib.Item
-		hash         = &m.DownloadId
 		stopDownload = &__stop
 		isStopped    = func() bool { return false }
 	)
-	item, err = s.manager.ResumeDownload(rsClient, m.DownloadId, &warplib.ResumeDownloadOpts{
-		Headers:        m.Headers,
-		ForceParts:     m.ForceParts,
-		MaxConnections: m.MaxConnections,
-		MaxSegments:    m.MaxSegments,
-		Handlers:       getHandler(pool, hash, stopDownload, &isStopped),
-		RetryConfig:    retryConfig,
-		RequestTimeout: requestTimeout,
-		SpeedLimit:     speedLimit,
-	})
+	pOpts := *opts
+	pOpts.Handlers = chainHandlers(getHandler(pool, &hash, stopDownload, &isStopped), notify)
+	item, err := s.manager.ResumeDownload(client, hash, &pOpts)
 	if err != nil {
-		return common.UPDATE_RESUME, nil, err
+		return nil, err
 	}
 	// Re-import cookies on resume if CookieSourcePath is set
 	if item.CookieSourcePath != "" {
@@ -203,28 +246,20 @@ func (s *Api) resumeHandler(sconn *server.SyncConn, pool *server.Pool, body json
 		}
 	}
 
-	pool.AddDownload(m.DownloadId, sconn)
-	*hash = item.Hash
+	pool.AddDownload(hash, sconn)
 	*stopDownload = item.StopDownload
 	isStopped = item.IsStopped
 	var cItem *warplib.Item
 	if item.ChildHash != "" {
 		var cStopDownload = &__stop
 		cIsStopped := func() bool { return false }
-		cItem, err = s.manager.ResumeDownload(rsClient, item.ChildHash, &warplib.ResumeDownloadOpts{
-			Headers:        m.Headers,
-			ForceParts:     m.ForceParts,
-			MaxConnections: m.MaxConnections,
-			MaxSegments:    m.MaxSegments,
-			Handlers:       getHandler(pool, &item.ChildHash, cStopDownload, &cIsStopped),
-			RetryConfig:    retryConfig,
-			RequestTimeout: requestTimeout,
-			SpeedLimit:     speedLimit,
-		})
+		cOpts := *opts
+		cOpts.Handlers = chainHandlers(getHandler(pool, &item.ChildHash, cStopDownload, &cIsStopped), notify)
+		cItem, err = s.manager.ResumeDownload(client, item.ChildHash, &cOpts)
 		if err != nil {
 			// Clean up parent's downloader before returning
 			_ = item.CloseDownloader()
-			return common.UPDATE_RESUME, nil, err
+			return nil, err
 		}
 		pool.AddDownload(item.ChildHash, sconn)
 		*cStopDownload = cItem.StopDownload
@@ -240,17 +275,32 @@ func (s *Api) resumeHandler(sconn *server.SyncConn, pool *server.Pool, body json
 			reportAsyncResumeError(pool, cItem, resumeItem(cItem))
 		}()
 	}
-	maxConn, _ := item.GetMaxConnections()
-	maxParts, _ := item.GetMaxParts()
-	return common.UPDATE_RESUME, &common.ResumeResponse{
-		ChildHash:         item.ChildHash,
-		ContentLength:     item.TotalSize,
-		Downloaded:        item.Downloaded,
-		FileName:          item.Name,
-		SavePath:          item.GetSavePath(),
-		DownloadDirectory: item.DownloadLocation,
-		AbsoluteLocation:  item.AbsoluteLocation,
-		MaxConnections:    maxConn,
-		MaxSegments:       maxParts,
-	}, nil
+	return item, nil
+}
+
+// chainHandlers returns h extended to also call the error, progress and
+// completion handlers of notify. notify may be nil.
+func chainHandlers(h, notify *warplib.Handlers) *warplib.Handlers {
+	if notify == nil {
+		return h
+	}
+	if fn, next := h.ErrorHandler, notify.ErrorHandler; next != nil {
+		h.ErrorHandler = func(hash string, err error) {
+			fn(hash, err)
+			next(hash, err)
+		}
+	}
+	if fn, next := h.DownloadProgressHandler, notify.DownloadProgressHandler; next != nil {
+		h.DownloadProgressHandler = func(hash string, nread int) {
+			fn(hash, nread)
+			next(hash, nread)
+		}
+	}
+	if fn, next := h.DownloadCompleteHandler, notify.DownloadCompleteHandler; next != nil {
+		h.DownloadCompleteHandler = func(hash string, tread int64) {
+			fn(hash, tread)
+			next(hash, tread)
+		}
+	}
+	return h
 }
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// setHandler changes the speed limit and/or connection count of a running
+// download without restarting it.
+func (s *Api) setHandler(_ *server.SyncConn, _ *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.SetParams
+	if err := json.Unmarshal(body, &m); err != nil {
+		return common.UPDATE_SET, nil, err
+	}
+	if m.DownloadId == "" {
+		return common.UPDATE_SET, nil, errors.New("download_id is required")
+	}
+	if m.SpeedLimit == "" && m.MaxConnections == 0 {
+		return common.UPDATE_SET, nil, errors.New("nothing to change: speed_limit or max_connections is required")
+	}
+	var speedLimit int64
+	if m.SpeedLimit != "" {
+		var err error
+		if speedLimit, err = warplib.ParseSpeedLimit(m.SpeedLimit); err != nil {
+			return common.UPDATE_SET, nil, err
+		}
+	}
+	if m.MaxConnections < 0 {
+		return common.UPDATE_SET, nil, warplib.ErrInvalidMaxConnections
+	}
+
+	item := s.manager.GetItem(m.DownloadId)
+	if item == nil {
+		return common.UPDATE_SET, nil, errors.New("download not found")
+	}
+	if !item.IsDownloading() {
+		return common.UPDATE_SET, nil, errors.New("download not running")
+	}
+	// Connections first: it is the only change that can be refused.
+	if m.MaxConnections != 0 {
+		if err := item.SetMaxConnections(m.MaxConnections); err != nil {
+			return common.UPDATE_SET, nil, err
+		}
+	}
+	if m.SpeedLimit != "" {
+		if err := item.SetSpeedLimit(speedLimit); err != nil {
+			return common.UPDATE_SET, nil, err
+		}
+	}
+
+	resp := &common.SetResponse{DownloadId: item.Hash}
+	resp.SpeedLimit, _ = item.GetSpeedLimit()
+	resp.MaxConnections, _ = item.GetMaxConnections()
+	return common.UPDATE_SET, resp, nil
+}
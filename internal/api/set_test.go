@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestSetHandler(t *testing.T) {
+	api, pool, cleanup := newTestApi(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("x"), 128)
+	srv := newRangeServer(content)
+	defer srv.Close()
+	d, err := warplib.NewDownloader(&http.Client{}, srv.URL+"/file.bin", &warplib.DownloaderOpts{
+		DownloadDirectory: warplib.ConfigDir,
+		MaxConnections:    2,
+		MaxSegments:       8,
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	defer d.Close()
+	if err := api.manager.AddDownload(d, &warplib.AddDownloadOpts{AbsoluteLocation: d.GetDownloadDirectory()}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+
+	body, _ := json.Marshal(common.SetParams{DownloadId: d.GetHash(), SpeedLimit: "1MB", MaxConnections: 6})
+	updateType, msg, err := api.setHandler(nil, pool, body)
+	if err != nil {
+		t.Fatalf("setHandler: %v", err)
+	}
+	if updateType != common.UPDATE_SET {
+		t.Fatalf("expected UPDATE_SET, got %v", updateType)
+	}
+	resp := msg.(*common.SetResponse)
+	if resp.SpeedLimit != warplib.MB || resp.MaxConnections != 6 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if d.GetSpeedLimit() != warplib.MB || d.GetMaxConnections() != 6 {
+		t.Fatalf("downloader not updated: limit=%d conns=%d", d.GetSpeedLimit(), d.GetMaxConnections())
+	}
+
+	// Only the given option changes.
+	body, _ = json.Marshal(common.SetParams{DownloadId: d.GetHash(), SpeedLimit: "0"})
+	if _, msg, err = api.setHandler(nil, pool, body); err != nil {
+		t.Fatalf("setHandler: %v", err)
+	}
+	if resp := msg.(*common.SetResponse); resp.SpeedLimit != 0 || resp.MaxConnections != 6 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestSetHandler_Errors(t *testing.T) {
+	api, pool, cleanup := newTestApi(t)
+	defer cleanup()
+
+	api.manager.UpdateItem(&warplib.Item{Hash: "idle", Parts: make(map[int64]*warplib.ItemPart)})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid json", `{invalid`},
+		{"missing id", `{"speed_limit":"1MB"}`},
+		{"nothing to change", `{"download_id":"idle"}`},
+		{"invalid speed limit", `{"download_id":"idle","speed_limit":"fast"}`},
+		{"negative connections", `{"download_id":"idle","max_connections":-1}`},
+		{"not found", `{"download_id":"missing","speed_limit":"1MB"}`},
+		{"not running", `{"download_id":"idle","speed_limit":"1MB"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := api.setHandler(nil, pool, json.RawMessage(tt.body)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
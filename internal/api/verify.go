@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// verifyHandler rehashes the files of completed downloads. The progress
+// is written to the connection as UPDATE_VERIFYING updates before the
+// response, which comes once all of them are verified.
+func (s *Api) verifyHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.VerifyParams
+	if err := json.Unmarshal(body, &m); err != nil {
+		return common.UPDATE_VERIFY, nil, err
+	}
+	update := func(res *common.VerifyingResponse) {
+		if sconn == nil {
+			return
+		}
+		// a client gone away doesn't stop the verification
+		_ = sconn.Write(server.MakeResult(common.UPDATE_VERIFYING, res))
+	}
+	results, err := s.manager.VerifyDownloads(s.client, m.DownloadIds, &warplib.VerifyOpts{
+		SearchDirs:     m.SearchDirs,
+		Redownload:     m.Redownload,
+		MaxConnections: m.MaxConnections,
+		ProgressHandler: func(hash string, hashed int64) {
+			var size int64
+			if item := s.manager.GetItem(hash); item != nil {
+				size = int64(item.GetTotalSize())
+			}
+			update(&common.VerifyingResponse{DownloadId: hash, Hashed: hashed, Size: size})
+		},
+		ResultHandler: func(res *warplib.VerifyResult) {
+			update(&common.VerifyingResponse{DownloadId: res.Hash, Result: res})
+		},
+	})
+	if err != nil {
+		return common.UPDATE_VERIFY, nil, err
+	}
+	return common.UPDATE_VERIFY, &common.VerifyResponse{Results: results}, nil
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+func TestVerifyHandler(t *testing.T) {
+	api, _, cleanup := newTestApi(t)
+	defer cleanup()
+
+	_, msg, err := api.verifyHandler(nil, nil, []byte("{}"))
+	if err != nil {
+		t.Fatalf("verifyHandler: %v", err)
+	}
+	if res := msg.(*common.VerifyResponse); len(res.Results) != 0 {
+		t.Fatalf("unexpected results: %+v", res.Results)
+	}
+	body, _ := json.Marshal(common.VerifyParams{DownloadIds: []string{"missing"}})
+	if _, _, err := api.verifyHandler(nil, nil, body); !errors.Is(err, warplib.ErrDownloadNotFound) {
+		t.Fatalf("expected ErrDownloadNotFound, got %v", err)
+	}
+}
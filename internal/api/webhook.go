@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/server"
+	"github.com/warpdl/warpdl/internal/webhook"
+)
+
+// errWebhooksNotEnabled is returned when the daemon runs without webhooks,
+// because its webhooks file is invalid.
+var errWebhooksNotEnabled = errors.New("webhooks not enabled")
+
+// SetWebhooks sets the webhook dispatcher used by the webhook handlers.
+// Used by daemon startup after the webhooks have been loaded.
+func (s *Api) SetWebhooks(d *webhook.Dispatcher) {
+	s.webhooks = d
+}
+
+// webhookListHandler returns the webhook subscriptions.
+func (s *Api) webhookListHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	if s.webhooks == nil {
+		return common.UPDATE_WEBHOOK_LIST, nil, errWebhooksNotEnabled
+	}
+	failures := make(map[string]int)
+	for _, f := range s.webhooks.Failures() {
+		failures[f.WebhookID]++
+	}
+	resp := &common.WebhookListResponse{Webhooks: []common.WebhookInfo{}}
+	for _, w := range s.webhooks.List() {
+		resp.Webhooks = append(resp.Webhooks, common.WebhookInfo{
+			ID:       w.ID,
+			URL:      w.URL,
+			Events:   w.Events,
+			Signed:   w.Secret != "",
+			Failures: failures[w.ID],
+		})
+	}
+	return common.UPDATE_WEBHOOK_LIST, resp, nil
+}
+
+// webhookTestHandler sends a test delivery to one webhook, or to all of them.
+func (s *Api) webhookTestHandler(sconn *server.SyncConn, pool *server.Pool, body json.RawMessage) (common.UpdateType, any, error) {
+	var m common.WebhookTestParams
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &m); err != nil {
+			return common.UPDATE_WEBHOOK_TEST, nil, err
+		}
+	}
+	if s.webhooks == nil {
+		return common.UPDATE_WEBHOOK_TEST, nil, errWebhooksNotEnabled
+	}
+	var hooks []webhook.Webhook
+	for _, w := range s.webhooks.List() {
+		if m.ID == "" || w.ID == m.ID {
+			hooks = append(hooks, w)
+		}
+	}
+	if m.ID != "" && len(hooks) == 0 {
+		return common.UPDATE_WEBHOOK_TEST, nil, webhook.ErrNotFound
+	}
+	resp := &common.WebhookTestResponse{Results: []common.WebhookTestResult{}}
+	for _, w := range hooks {
+		res := common.WebhookTestResult{ID: w.ID, URL: w.URL}
+		if err := s.webhooks.Test(context.Background(), w.ID); err != nil {
+			res.Error = err.Error()
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	return common.UPDATE_WEBHOOK_TEST, resp, nil
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/warpdl/warpdl/common"
+	"github.com/warpdl/warpdl/internal/webhook"
+	"github.com/warpdl/warpdl/pkg/logger"
+)
+
+func TestWebhookHandlers_NotEnabled(t *testing.T) {
+	api, _, cleanup := newTestApi(t)
+	defer cleanup()
+
+	if _, _, err := api.webhookListHandler(nil, nil, nil); err != errWebhooksNotEnabled {
+		t.Fatalf("list: expected errWebhooksNotEnabled, got %v", err)
+	}
+	if _, _, err := api.webhookTestHandler(nil, nil, nil); err != errWebhooksNotEnabled {
+		t.Fatalf("test: expected errWebhooksNotEnabled, got %v", err)
+	}
+}
+
+func TestWebhookHandlers_ListAndTest(t *testing.T) {
+	api, _, cleanup := newTestApi(t)
+	defer cleanup()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	gone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer gone.Close()
+
+	d := webhook.NewDispatcher(t.TempDir(), &webhook.Config{Webhooks: []*webhook.Webhook{
+		{ID: "ok", URL: ok.URL, Secret: "k"},
+		{ID: "gone", URL: gone.URL},
+	}}, logger.NewNopLogger())
+	defer d.Close()
+	api.SetWebhooks(d)
+
+	_, msg, err := api.webhookListHandler(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("webhookListHandler: %v", err)
+	}
+	list := msg.(*common.WebhookListResponse)
+	if len(list.Webhooks) != 2 || !list.Webhooks[0].Signed || list.Webhooks[1].Signed {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	_, msg, err = api.webhookTestHandler(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("webhookTestHandler: %v", err)
+	}
+	results := msg.(*common.WebhookTestResponse).Results
+	if len(results) != 2 || results[0].Error != "" || results[1].Error == "" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	body, _ := json.Marshal(common.WebhookTestParams{ID: "missing"})
+	if _, _, err := api.webhookTestHandler(nil, nil, body); !errors.Is(err, webhook.ErrNotFound) {
+		t.Fatalf("test missing: expected ErrNotFound, got %v", err)
+	}
+}
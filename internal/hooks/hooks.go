@@ -0,0 +1,268 @@
+// Package hooks runs commands in the daemon when downloads complete, fail
+// or stop, and records each run on the download's item.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// FileName is the name of the global hooks file inside the config directory.
+const FileName = "hooks.json"
+
+// DefaultTimeout bounds a hook run when the config sets no timeout.
+const DefaultTimeout = 5 * time.Minute
+
+// maxOutput is the number of bytes of output kept of a run.
+const maxOutput = 4 * 1024
+
+// Config is the global hooks config, run for every download before the
+// download's own hooks:
+//
+//	{
+//	  "on_complete": "mv {path} /srv/media/",
+//	  "on_error": "notify-send 'Download failed' {name}",
+//	  "timeout": "2m"
+//	}
+type Config struct {
+	warplib.Hooks
+	// Timeout bounds each run, in Go duration syntax. Empty means DefaultTimeout.
+	Timeout string `json:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+// Load reads the global hooks config from path.
+// A missing file results in no hooks.
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Config{timeout: DefaultTimeout}, nil
+		}
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse hooks file %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the timeout.
+func (c *Config) Validate() error {
+	c.timeout = DefaultTimeout
+	if c.Timeout == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid hook timeout %q: %w", c.Timeout, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("hook timeout must be positive, got %s", c.Timeout)
+	}
+	c.timeout = d
+	return nil
+}
+
+// Runner runs the hooks of download events. Each run is recorded on the
+// item and saved through the manager.
+type Runner struct {
+	m       *warplib.Manager
+	global  warplib.Hooks
+	timeout time.Duration
+	log     logger.Logger
+	wg      sync.WaitGroup
+}
+
+// NewRunner returns a runner of the global hooks of cfg and the hooks of
+// each download. A nil cfg means no global hooks.
+func NewRunner(m *warplib.Manager, cfg *Config, log logger.Logger) *Runner {
+	r := &Runner{m: m, timeout: DefaultTimeout, log: log}
+	if cfg != nil {
+		r.global = cfg.Hooks
+		if cfg.timeout > 0 {
+			r.timeout = cfg.timeout
+		}
+	}
+	return r
+}
+
+// HandleEvent starts the hooks of ev, the global one first. It doesn't
+// wait for them, as it is called on the download's goroutine.
+// Its signature matches warplib.ItemEventHandlerFunc.
+func (r *Runner) HandleEvent(item *warplib.Item, ev warplib.ItemEvent, err error) {
+	var cmds []string
+	if c := r.global.Command(ev); c != "" {
+		cmds = append(cmds, c)
+	}
+	if c := item.Hooks.Command(ev); c != "" {
+		cmds = append(cmds, c)
+	}
+	if len(cmds) == 0 {
+		return
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for _, c := range cmds {
+			r.run(item, ev, err, c)
+		}
+	}()
+}
+
+// Wait waits for the running hooks to finish.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// run runs one hook command and records the run.
+func (r *Runner) run(item *warplib.Item, ev warplib.ItemEvent, evErr error, command string) {
+	vars := itemVars(item, ev, evErr, needsSHA256(command))
+	expanded := expand(command, vars)
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, expanded)
+	cmd.Dir = item.AbsoluteLocation
+	cmd.Env = os.Environ()
+	for _, v := range vars {
+		cmd.Env = append(cmd.Env, "WARPDL_"+strings.ToUpper(v.name)+"="+v.value)
+	}
+	out := &limitedBuffer{max: maxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// don't wait forever for children that keep the output open
+	cmd.WaitDelay = time.Second
+
+	run := warplib.HookRun{Event: ev, Command: expanded, StartedAt: time.Now(), ExitCode: -1}
+	err := cmd.Run()
+	run.Duration = time.Since(run.StartedAt)
+	run.Output = out.String()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		run.Error = fmt.Sprintf("timed out after %s", r.timeout)
+	case errors.As(err, &exitErr):
+		run.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		run.Error = err.Error()
+	default:
+		run.ExitCode = 0
+	}
+	if run.ExitCode != 0 {
+		msg := run.Error
+		if msg == "" {
+			msg = fmt.Sprintf("exit status %d", run.ExitCode)
+		}
+		r.log.Warning("Hook on-%s of %s failed: %s", ev, item.Hash, msg)
+	}
+	item.AddHookRun(run)
+	r.m.UpdateItem(item)
+}
+
+// hookVar is a variable available to hook commands as {name} and as the
+// environment variable WARPDL_NAME.
+type hookVar struct {
+	name, value string
+}
+
+// itemVars returns the variables of a hook run. The SHA-256 of the file
+// is only computed if withSHA256 is set, as it reads the whole file.
+func itemVars(item *warplib.Item, ev warplib.ItemEvent, err error, withSHA256 bool) []hookVar {
+	path := item.GetAbsolutePath()
+	var errMsg, sum string
+	if err != nil {
+		errMsg = err.Error()
+	}
+	if withSHA256 {
+		sum = fileSHA256(path)
+	}
+	return []hookVar{
+		{"hash", item.Hash},
+		{"name", item.Name},
+		{"path", path},
+		{"dir", item.AbsoluteLocation},
+		{"url", item.Url},
+		{"size", strconv.FormatInt(int64(item.GetTotalSize()), 10)},
+		{"sha256", sum},
+		{"event", string(ev)},
+		{"error", errMsg},
+	}
+}
+
+// needsSHA256 reports whether command uses the checksum, as {sha256} or
+// through the environment.
+func needsSHA256(command string) bool {
+	return strings.Contains(command, "{sha256}") || strings.Contains(command, "WARPDL_SHA256")
+}
+
+// expand replaces the {name} variables in command by their values, quoted
+// for the shell so they stay one argument.
+func expand(command string, vars []hookVar) string {
+	pairs := make([]string, 0, 2*len(vars))
+	for _, v := range vars {
+		pairs = append(pairs, "{"+v.name+"}", shellQuote(v.value))
+	}
+	return strings.NewReplacer(pairs...).Replace(command)
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path, "" if it can't
+// be read.
+func fileSHA256(path string) string {
+	f, err := warplib.WarpOpen(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if left := b.max - b.buf.Len(); left > 0 {
+		if len(p) > left {
+			b.buf.Write(p[:left])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
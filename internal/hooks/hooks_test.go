@@ -0,0 +1,157 @@
+package hooks
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// newTestItem returns a manager with one complete download of content.
+func newTestItem(t *testing.T, content string, hooks *warplib.Hooks) (*warplib.Manager, *warplib.Item) {
+	t.Helper()
+	base := t.TempDir()
+	if err := warplib.SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	m, err := warplib.InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write([]byte(content))
+	}))
+	defer srv.Close()
+	d, err := warplib.NewDownloader(&http.Client{}, srv.URL+"/my file.txt", &warplib.DownloaderOpts{
+		DownloadDirectory: base,
+		Handlers:          &warplib.Handlers{},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &warplib.AddDownloadOpts{AbsoluteLocation: base, Hooks: hooks}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return m, m.GetItem(d.GetHash())
+}
+
+func skipOnWindows(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in these tests use sh")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil || !cfg.IsEmpty() {
+		t.Fatalf("Load(missing) = %+v, %v; want empty config", cfg, err)
+	}
+
+	path := filepath.Join(dir, FileName)
+	if err := os.WriteFile(path, []byte(`{"on_complete":"echo done","timeout":"30s"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.OnComplete != "echo done" || cfg.timeout != 30*time.Second {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	for _, bad := range []string{`{"timeout":"soon"}`, `{"timeout":"-1s"}`, `{`} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestExpand_QuotesValues(t *testing.T) {
+	skipOnWindows(t)
+	got := expand("mv {path} /dst/{name}", []hookVar{{"path", "/tmp/it's here"}, {"name", "a b"}})
+	want := `mv '/tmp/it'\''s here' /dst/'a b'`
+	if got != want {
+		t.Errorf("expand = %s, want %s", got, want)
+	}
+}
+
+func TestRunner_RecordsRuns(t *testing.T) {
+	skipOnWindows(t)
+	m, item := newTestItem(t, "hello hooks", &warplib.Hooks{
+		OnComplete: `echo "item $WARPDL_HASH"; cat {path}; echo {sha256}; exit 3`,
+	})
+	r := NewRunner(m, &Config{Hooks: warplib.Hooks{OnComplete: "echo global {size}"}}, logger.NewNopLogger())
+
+	r.HandleEvent(item, warplib.EventComplete, nil)
+	r.HandleEvent(item, warplib.EventStopped, nil) // no hook
+	r.Wait()
+
+	runs := item.GetHookRuns()
+	if len(runs) != 2 {
+		t.Fatalf("runs = %+v, want 2", runs)
+	}
+	if runs[0].ExitCode != 0 || strings.TrimSpace(runs[0].Output) != "global 11" {
+		t.Errorf("global run = %+v", runs[0])
+	}
+	own := runs[1]
+	// sha256 of "hello hooks"
+	const sum = "64bafa0502ce42ce2b287f9d0a99089be6fbf4a41721c5a9d54981aeb572ee3e"
+	if own.ExitCode != 3 || !strings.Contains(own.Output, "item "+item.Hash) ||
+		!strings.Contains(own.Output, "hello hooks") || !strings.Contains(own.Output, sum) {
+		t.Errorf("own run = %+v", own)
+	}
+	if own.Event != warplib.EventComplete || own.StartedAt.IsZero() {
+		t.Errorf("own run = %+v", own)
+	}
+}
+
+func TestRunner_Timeout(t *testing.T) {
+	skipOnWindows(t)
+	m, item := newTestItem(t, "x", &warplib.Hooks{OnError: "sleep 5"})
+	cfg := &Config{Timeout: "100ms"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(m, cfg, logger.NewNopLogger())
+
+	start := time.Now()
+	r.HandleEvent(item, warplib.EventError, errors.New("boom"))
+	r.Wait()
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("hook was not killed at its timeout")
+	}
+	runs := item.GetHookRuns()
+	if len(runs) != 1 || runs[0].ExitCode != -1 || !strings.Contains(runs[0].Error, "timed out") {
+		t.Fatalf("runs = %+v, want one timed out run", runs)
+	}
+}
+
+func TestAddHookRun_KeepsLatest(t *testing.T) {
+	_, item := newTestItem(t, "x", nil)
+	for i := 0; i < warplib.MaxHookRuns+5; i++ {
+		item.AddHookRun(warplib.HookRun{ExitCode: i})
+	}
+	runs := item.GetHookRuns()
+	if len(runs) != warplib.MaxHookRuns || runs[0].ExitCode != 5 {
+		t.Fatalf("kept %d runs starting at %d, want %d starting at 5", len(runs), runs[0].ExitCode, warplib.MaxHookRuns)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/warpdl/warpdl/common"
 )
@@ -47,8 +48,19 @@ type ResumeOptions struct {
 
 // ListOptions mirrors warpcli.ListOpts
 type ListOptions struct {
-	IncludeHidden   bool `json:"include_hidden,omitempty"`
-	IncludeMetadata bool `json:"include_metadata,omitempty"`
+	IncludeHidden    bool      `json:"include_hidden,omitempty"`
+	IncludeMetadata  bool      `json:"include_metadata,omitempty"`
+	IncludeCompleted bool      `json:"include_completed,omitempty"`
+	Status           string    `json:"status,omitempty"`
+	Category         string    `json:"category,omitempty"`
+	Search           string    `json:"search,omitempty"`
+	Host             string    `json:"host,omitempty"`
+	Since            time.Time `json:"since"`
+	Until            time.Time `json:"until"`
+	MinSize          int64     `json:"min_size,omitempty"`
+	Sort             string    `json:"sort,omitempty"`
+	Offset           int       `json:"offset,omitempty"`
+	Limit            int       `json:"limit,omitempty"`
 }
 
 // DownloadParams represents parameters for a download request.
@@ -89,9 +101,21 @@ type FlushParams struct {
 }
 
 // ListParams represents parameters for a list request.
+// Status, as in "failed,scheduled", takes precedence over IncludeCompleted.
 type ListParams struct {
-	IncludeHidden   bool `json:"includeHidden,omitempty"`
-	IncludeMetadata bool `json:"includeMetadata,omitempty"`
+	IncludeHidden    bool      `json:"includeHidden,omitempty"`
+	IncludeMetadata  bool      `json:"includeMetadata,omitempty"`
+	IncludeCompleted bool      `json:"includeCompleted,omitempty"`
+	Status           string    `json:"status,omitempty"`
+	Category         string    `json:"category,omitempty"`
+	Search           string    `json:"search,omitempty"`
+	Host             string    `json:"host,omitempty"`
+	Since            time.Time `json:"since"`
+	Until            time.Time `json:"until"`
+	MinSize          int64     `json:"minSize,omitempty"`
+	Sort             string    `json:"sort,omitempty"`
+	Offset           int       `json:"offset,omitempty"`
+	Limit            int       `json:"limit,omitempty"`
 }
 
 // Host is the native messaging host that bridges browser extensions to the daemon.
@@ -184,8 +208,19 @@ func (h *Host) handleRequest(req *Request) []byte {
 			}
 		}
 		opts := &ListOptions{
-			IncludeHidden:   params.IncludeHidden,
-			IncludeMetadata: params.IncludeMetadata,
+			IncludeHidden:    params.IncludeHidden,
+			IncludeMetadata:  params.IncludeMetadata,
+			IncludeCompleted: params.IncludeCompleted,
+			Status:           params.Status,
+			Category:         params.Category,
+			Search:           params.Search,
+			Host:             params.Host,
+			Since:            params.Since,
+			Until:            params.Until,
+			MinSize:          params.MinSize,
+			Sort:             params.Sort,
+			Offset:           params.Offset,
+			Limit:            params.Limit,
 		}
 		result, err = h.client.List(opts)
 
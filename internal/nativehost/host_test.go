@@ -300,7 +300,7 @@ func TestFlushParams(t *testing.T) {
 
 // TestListParams verifies list parameter parsing
 func TestListParams(t *testing.T) {
-	msg := json.RawMessage(`{"includeHidden":true}`)
+	msg := json.RawMessage(`{"includeHidden":true,"status":"failed","search":"iso","since":"2024-01-02T00:00:00Z","minSize":1024,"sort":"size","limit":20}`)
 	var p ListParams
 	if err := json.Unmarshal(msg, &p); err != nil {
 		t.Fatalf("Failed to parse: %v", err)
@@ -308,6 +308,9 @@ func TestListParams(t *testing.T) {
 	if !p.IncludeHidden {
 		t.Error("IncludeHidden should be true")
 	}
+	if p.Status != "failed" || p.Search != "iso" || p.Since.Year() != 2024 || p.MinSize != 1024 || p.Sort != "size" || p.Limit != 20 {
+		t.Errorf("params = %+v", p)
+	}
 }
 
 // TestResumeRequest verifies resume request handling
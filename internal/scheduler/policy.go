@@ -0,0 +1,359 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adhocore/gronx"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// PolicyAction is the effect a time-window policy has on the daemon.
+type PolicyAction string
+
+const (
+	// PolicyFull runs downloads without a daemon-wide speed limit.
+	PolicyFull PolicyAction = "full"
+	// PolicyLimit runs downloads under the window's SpeedLimit.
+	PolicyLimit PolicyAction = "limit"
+	// PolicyPause pauses the queue and stops active downloads.
+	PolicyPause PolicyAction = "pause"
+)
+
+// ErrPolicyPaused is returned for downloads that may not start while a
+// pause window or override is in effect.
+var ErrPolicyPaused = errors.New("downloads are paused by a time-window policy")
+
+// overrideKey is the heap key used for the one-shot override expiry event.
+const overrideKey = "policy:override"
+
+// PolicyWindow is a recurring weekly time window with an action.
+//
+// Days uses the cron day-of-week syntax ("*", "1-5", "mon-fri", "sat,sun").
+// From and To are "HH:MM" in local time. If To is not after From the window
+// wraps past midnight and ends on the following day.
+type PolicyWindow struct {
+	// Name is an optional label shown in status output.
+	Name string `json:"name,omitempty"`
+	// Days is the cron day-of-week field the window starts on. Empty means every day.
+	Days string `json:"days,omitempty"`
+	// From is the local start time of the window ("HH:MM").
+	From string `json:"from"`
+	// To is the local end time of the window ("HH:MM").
+	To string `json:"to"`
+	// Action is applied while the window is active.
+	Action PolicyAction `json:"action"`
+	// SpeedLimit is the daemon-wide limit for PolicyLimit (e.g. "500KB").
+	SpeedLimit string `json:"speed_limit,omitempty"`
+
+	from, to int // minutes since midnight
+	limit    int64
+	dayExpr  string
+	fromCron string
+	toCron   string
+}
+
+// PolicyConfig is the on-disk representation of the daemon's time-window policies.
+// Later windows take precedence over earlier ones when they overlap.
+type PolicyConfig struct {
+	Windows []PolicyWindow `json:"windows"`
+}
+
+// PolicyState is the effective policy at a point in time.
+type PolicyState struct {
+	// Action is the effective action.
+	Action PolicyAction
+	// SpeedLimit is the daemon-wide limit in bytes per second (0 = unlimited).
+	SpeedLimit int64
+	// Window is the name of the active window, empty if none is active.
+	Window string
+	// Override is true if a manual override is in effect.
+	Override bool
+	// OverrideUntil is when the manual override expires.
+	OverrideUntil time.Time
+}
+
+// PolicyTarget receives policy changes. The daemon implements it to pause or
+// resume the queue and to switch the global speed limit.
+type PolicyTarget interface {
+	ApplyPolicy(state PolicyState)
+}
+
+// LoadPolicyConfig reads a PolicyConfig from a JSON file.
+// A missing file yields an empty config and no error.
+func LoadPolicyConfig(path string) (*PolicyConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &PolicyConfig{}, nil
+		}
+		return nil, err
+	}
+	var cfg PolicyConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse policy file %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks every window and precomputes its boundaries.
+func (c *PolicyConfig) Validate() error {
+	for i := range c.Windows {
+		if err := c.Windows[i].validate(); err != nil {
+			name := c.Windows[i].Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return fmt.Errorf("policy window %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (w *PolicyWindow) validate() error {
+	var err error
+	if w.from, err = parseClock(w.From); err != nil {
+		return fmt.Errorf("invalid from: %w", err)
+	}
+	if w.to, err = parseClock(w.To); err != nil {
+		return fmt.Errorf("invalid to: %w", err)
+	}
+	days := strings.TrimSpace(w.Days)
+	if days == "" {
+		days = "*"
+	}
+	w.dayExpr = "0 0 * * " + days
+	if !gronx.IsValid(w.dayExpr) {
+		return fmt.Errorf("invalid days %q", w.Days)
+	}
+	switch w.Action {
+	case PolicyFull, PolicyPause:
+	case PolicyLimit:
+		if w.limit, err = warplib.ParseSpeedLimit(w.SpeedLimit); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid action %q (use full, limit or pause)", w.Action)
+	}
+	// Boundaries fire daily; Evaluate decides whether the day matches.
+	w.fromCron = fmt.Sprintf("%d %d * * *", w.from%60, w.from/60)
+	w.toCron = fmt.Sprintf("%d %d * * *", w.to%60, w.to/60)
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// dayMatches reports whether the day of t matches the window's day-of-week field.
+func (w *PolicyWindow) dayMatches(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	ok, err := gronx.New().IsDue(w.dayExpr, midnight)
+	return err == nil && ok
+}
+
+// activeAt reports whether the window is active at t.
+func (w *PolicyWindow) activeAt(t time.Time) bool {
+	c := t.Hour()*60 + t.Minute()
+	if w.from < w.to {
+		return w.dayMatches(t) && c >= w.from && c < w.to
+	}
+	// Wraps past midnight (or spans a full day when from == to).
+	return (w.dayMatches(t) && c >= w.from) || (w.dayMatches(t.AddDate(0, 0, -1)) && c < w.to)
+}
+
+// Evaluate returns the scheduled (non-override) policy state at t.
+// Later windows win over earlier ones; outside of all windows the daemon runs at full speed.
+func (c *PolicyConfig) Evaluate(t time.Time) PolicyState {
+	for i := len(c.Windows) - 1; i >= 0; i-- {
+		w := &c.Windows[i]
+		if !w.activeAt(t) {
+			continue
+		}
+		st := PolicyState{Action: w.Action, Window: w.Name}
+		if w.Action == PolicyLimit {
+			st.SpeedLimit = w.limit
+		}
+		return st
+	}
+	return PolicyState{Action: PolicyFull}
+}
+
+// nextBoundary returns the earliest window boundary strictly after t.
+// The zero time is returned if there are no windows.
+func (c *PolicyConfig) nextBoundary(t time.Time) time.Time {
+	var next time.Time
+	for i := range c.Windows {
+		for _, expr := range []string{c.Windows[i].fromCron, c.Windows[i].toCron} {
+			if expr == "" {
+				continue
+			}
+			n, err := nextCronOccurrence(expr, t)
+			if err == nil && (next.IsZero() || n.Before(next)) {
+				next = n
+			}
+		}
+	}
+	return next
+}
+
+// Policy applies time-window policies to a PolicyTarget.
+// Window boundaries are scheduled as recurring events on a dedicated
+// Scheduler, so the same min-heap and max-sleep-cap handling used for
+// scheduled downloads also drives policy switches.
+type Policy struct {
+	mu sync.Mutex
+	// applyMu serialises reevaluations so the target sees changes in order.
+	applyMu  sync.Mutex
+	cfg      *PolicyConfig
+	target   PolicyTarget
+	sched    *Scheduler
+	override *PolicyState
+	applied  *PolicyState
+	now      func() time.Time
+}
+
+// NewPolicy validates cfg, applies the state for the current time and
+// schedules all window boundaries. The policy stops when ctx is cancelled.
+func NewPolicy(ctx context.Context, cfg *PolicyConfig, target PolicyTarget) (*Policy, error) {
+	if cfg == nil {
+		cfg = &PolicyConfig{}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Policy{
+		cfg:    cfg,
+		target: target,
+		now:    time.Now,
+	}
+	p.sched = New(ctx, func(string) { p.reevaluate() })
+	now := p.now()
+	for i, w := range cfg.Windows {
+		for j, expr := range []string{w.fromCron, w.toCron} {
+			next, err := nextCronOccurrence(expr, now)
+			if err != nil {
+				continue
+			}
+			p.sched.Add(ScheduleEvent{
+				ItemHash:  fmt.Sprintf("policy:%d:%d", i, j),
+				TriggerAt: next,
+				CronExpr:  expr,
+			})
+		}
+	}
+	p.reevaluate()
+	return p, nil
+}
+
+// State returns the effective policy state, including any manual override.
+func (p *Policy) State() PolicyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.effectiveLocked(p.now())
+}
+
+// CheckStart returns ErrPolicyPaused if downloads may not start now.
+// A nil policy never pauses downloads.
+func (p *Policy) CheckStart() error {
+	if p == nil {
+		return nil
+	}
+	st := p.State()
+	if st.Action != PolicyPause {
+		return nil
+	}
+	if st.Override {
+		return fmt.Errorf("%w (override until %s)", ErrPolicyPaused, st.OverrideUntil.Format("2006-01-02 15:04"))
+	}
+	if st.Window != "" {
+		return fmt.Errorf("%w (window %q)", ErrPolicyPaused, st.Window)
+	}
+	return ErrPolicyPaused
+}
+
+// Override forces action until the given time, ignoring the schedule.
+// If until is zero, the override lasts until the next window boundary.
+func (p *Policy) Override(action PolicyAction, speedLimit int64, until time.Time) (PolicyState, error) {
+	switch action {
+	case PolicyFull, PolicyPause:
+		speedLimit = 0
+	case PolicyLimit:
+		if speedLimit <= 0 {
+			return PolicyState{}, errors.New("limit override requires a positive speed limit")
+		}
+	default:
+		return PolicyState{}, fmt.Errorf("invalid action %q (use full, limit or pause)", action)
+	}
+	now := p.now()
+	if until.IsZero() {
+		until = p.cfg.nextBoundary(now)
+		if until.IsZero() {
+			return PolicyState{}, errors.New("no policy windows configured, an explicit until time is required")
+		}
+	}
+	if !until.After(now) {
+		return PolicyState{}, errors.New("override end time is in the past")
+	}
+	p.mu.Lock()
+	p.override = &PolicyState{
+		Action:        action,
+		SpeedLimit:    speedLimit,
+		Override:      true,
+		OverrideUntil: until,
+	}
+	p.mu.Unlock()
+	// An earlier override's event is left in place: Add and Remove are not
+	// ordered against each other, and a stale trigger only reevaluates.
+	p.sched.Add(ScheduleEvent{ItemHash: overrideKey, TriggerAt: until})
+	return p.reevaluate(), nil
+}
+
+// ClearOverride removes a manual override and returns to the schedule.
+func (p *Policy) ClearOverride() PolicyState {
+	p.mu.Lock()
+	p.override = nil
+	p.mu.Unlock()
+	return p.reevaluate()
+}
+
+// effectiveLocked returns the state at now. p.mu must be held.
+// An expired override is dropped.
+func (p *Policy) effectiveLocked(now time.Time) PolicyState {
+	if p.override != nil {
+		if now.Before(p.override.OverrideUntil) {
+			return *p.override
+		}
+		p.override = nil
+	}
+	return p.cfg.Evaluate(now)
+}
+
+// reevaluate computes the effective state and notifies the target if it changed.
+func (p *Policy) reevaluate() PolicyState {
+	p.applyMu.Lock()
+	defer p.applyMu.Unlock()
+	p.mu.Lock()
+	st := p.effectiveLocked(p.now())
+	changed := p.applied == nil || p.applied.Action != st.Action || p.applied.SpeedLimit != st.SpeedLimit
+	p.applied = &st
+	p.mu.Unlock()
+	if changed && p.target != nil {
+		p.target.ApplyPolicy(st)
+	}
+	return st
+}
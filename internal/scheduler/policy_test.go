@@ -0,0 +1,247 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// recordingTarget collects every PolicyState applied by a Policy.
+type recordingTarget struct {
+	mu     sync.Mutex
+	states []PolicyState
+}
+
+func (r *recordingTarget) ApplyPolicy(st PolicyState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, st)
+}
+
+func (r *recordingTarget) last() PolicyState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.states[len(r.states)-1]
+}
+
+func testPolicyConfig(t *testing.T) *PolicyConfig {
+	t.Helper()
+	cfg := &PolicyConfig{Windows: []PolicyWindow{
+		{Name: "night", From: "01:00", To: "07:00", Action: PolicyFull},
+		{Name: "office", Days: "mon-fri", From: "09:00", To: "17:00", Action: PolicyLimit, SpeedLimit: "500KB"},
+		{Name: "calls", Days: "wed", From: "14:00", To: "15:00", Action: PolicyPause},
+		{Name: "late", Days: "sat", From: "22:00", To: "02:00", Action: PolicyLimit, SpeedLimit: "1MB"},
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	return cfg
+}
+
+func TestPolicyConfig_Evaluate(t *testing.T) {
+	cfg := testPolicyConfig(t)
+	// 2026-10-21 is a Wednesday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 10, day, hour, min, 0, 0, time.Local)
+	}
+	tests := []struct {
+		name   string
+		t      time.Time
+		action PolicyAction
+		limit  int64
+		window string
+	}{
+		{"night window", at(21, 3, 0), PolicyFull, 0, "night"},
+		{"office hours", at(21, 10, 0), PolicyLimit, 500 * warplib.KB, "office"},
+		{"video call overrides office", at(21, 14, 30), PolicyPause, 0, "calls"},
+		{"end is exclusive", at(21, 17, 0), PolicyFull, 0, ""},
+		{"weekend outside office", at(24, 10, 0), PolicyFull, 0, ""},
+		{"wrap before midnight", at(24, 23, 0), PolicyLimit, 1 * warplib.MB, "late"},
+		{"wrap after midnight", at(25, 1, 30), PolicyLimit, 1 * warplib.MB, "late"},
+		{"wrap only from start day", at(26, 1, 30), PolicyFull, 0, "night"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := cfg.Evaluate(tt.t)
+			if st.Action != tt.action || st.SpeedLimit != tt.limit || st.Window != tt.window {
+				t.Errorf("Evaluate(%v) = %+v, want action=%s limit=%d window=%q",
+					tt.t, st, tt.action, tt.limit, tt.window)
+			}
+		})
+	}
+}
+
+func TestPolicyConfig_ValidateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		w    PolicyWindow
+	}{
+		{"bad from", PolicyWindow{From: "25:00", To: "07:00", Action: PolicyFull}},
+		{"bad to", PolicyWindow{From: "01:00", To: "x", Action: PolicyFull}},
+		{"bad days", PolicyWindow{Days: "funday", From: "01:00", To: "07:00", Action: PolicyFull}},
+		{"bad action", PolicyWindow{From: "01:00", To: "07:00", Action: "slow"}},
+		{"limit without speed", PolicyWindow{From: "01:00", To: "07:00", Action: PolicyLimit}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &PolicyConfig{Windows: []PolicyWindow{tt.w}}
+			if err := cfg.Validate(); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestLoadPolicyConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := LoadPolicyConfig(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	if len(cfg.Windows) != 0 {
+		t.Fatalf("missing file should yield empty config, got %d windows", len(cfg.Windows))
+	}
+
+	path := filepath.Join(dir, "policy.json")
+	data := `{"windows":[{"name":"office","days":"1-5","from":"09:00","to":"17:00","action":"limit","speed_limit":"500KB"}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadPolicyConfig(path)
+	if err != nil {
+		t.Fatalf("LoadPolicyConfig: %v", err)
+	}
+	if len(cfg.Windows) != 1 || cfg.Windows[0].limit != 500*warplib.KB {
+		t.Fatalf("unexpected config: %+v", cfg.Windows)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"windows":[{"from":"09:00","to":"17:00","action":"nope"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPolicyConfig(path); err == nil {
+		t.Fatal("expected error for invalid action")
+	}
+}
+
+func TestPolicy_OverrideAndClear(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	target := &recordingTarget{}
+	p, err := NewPolicy(ctx, &PolicyConfig{}, target)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if got := target.last(); got.Action != PolicyFull {
+		t.Fatalf("initial state = %+v, want full", got)
+	}
+
+	until := time.Now().Add(time.Hour)
+	st, err := p.Override(PolicyLimit, 100*warplib.KB, until)
+	if err != nil {
+		t.Fatalf("Override: %v", err)
+	}
+	if !st.Override || st.Action != PolicyLimit || st.SpeedLimit != 100*warplib.KB {
+		t.Fatalf("override state = %+v", st)
+	}
+	if got := target.last(); got.Action != PolicyLimit {
+		t.Fatalf("target not notified of override: %+v", got)
+	}
+
+	st = p.ClearOverride()
+	if st.Override || st.Action != PolicyFull {
+		t.Fatalf("state after clear = %+v", st)
+	}
+	if got := target.last(); got.Action != PolicyFull {
+		t.Fatalf("target not notified of clear: %+v", got)
+	}
+}
+
+func TestPolicy_CheckStart(t *testing.T) {
+	var nilPolicy *Policy
+	if err := nilPolicy.CheckStart(); err != nil {
+		t.Fatalf("nil policy: CheckStart = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := NewPolicy(ctx, &PolicyConfig{}, &recordingTarget{})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if err := p.CheckStart(); err != nil {
+		t.Fatalf("full: CheckStart = %v", err)
+	}
+	if _, err := p.Override(PolicyPause, 0, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Override: %v", err)
+	}
+	if err := p.CheckStart(); !errors.Is(err, ErrPolicyPaused) {
+		t.Fatalf("pause: CheckStart = %v, want ErrPolicyPaused", err)
+	}
+}
+
+func TestPolicy_OverrideValidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := NewPolicy(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if _, err := p.Override(PolicyLimit, 0, time.Now().Add(time.Hour)); err == nil {
+		t.Error("expected error for limit override without speed")
+	}
+	if _, err := p.Override("bogus", 0, time.Now().Add(time.Hour)); err == nil {
+		t.Error("expected error for invalid action")
+	}
+	if _, err := p.Override(PolicyPause, 0, time.Now().Add(-time.Minute)); err == nil {
+		t.Error("expected error for past until")
+	}
+	if _, err := p.Override(PolicyPause, 0, time.Time{}); err == nil {
+		t.Error("expected error for zero until without windows")
+	}
+}
+
+func TestPolicy_OverrideExpires(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	target := &recordingTarget{}
+	p, err := NewPolicy(ctx, nil, target)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if _, err := p.Override(PolicyPause, 0, time.Now().Add(100*time.Millisecond)); err != nil {
+		t.Fatalf("Override: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if target.last().Action == PolicyFull {
+			if p.State().Override {
+				t.Fatal("override should have been cleared")
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("override did not expire, last state %+v", target.last())
+}
+
+func TestPolicyConfig_NextBoundary(t *testing.T) {
+	cfg := testPolicyConfig(t)
+	from := time.Date(2026, 10, 21, 10, 0, 0, 0, time.Local)
+	want := time.Date(2026, 10, 21, 14, 0, 0, 0, time.Local)
+	if got := cfg.nextBoundary(from); !got.Equal(want) {
+		t.Errorf("nextBoundary = %v, want %v", got, want)
+	}
+	if got := (&PolicyConfig{}).nextBoundary(from); !got.IsZero() {
+		t.Errorf("empty config nextBoundary = %v, want zero", got)
+	}
+}
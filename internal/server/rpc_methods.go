@@ -2,14 +2,20 @@ package server
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/creachadair/jrpc2"
 	"github.com/creachadair/jrpc2/handler"
 	"github.com/creachadair/jrpc2/jhttp"
+	"github.com/warpdl/warpdl/internal/scheduler"
+	"github.com/warpdl/warpdl/internal/webhook"
 	"github.com/warpdl/warpdl/pkg/warplib"
 )
 
@@ -18,6 +24,8 @@ const (
 	codeDownloadNotFound  = jrpc2.Code(-32001)
 	codeDownloadNotActive = jrpc2.Code(-32002)
 	codeInvalidParams     = jrpc2.Code(-32602)
+	// codeDuplicateDownload is returned when a duplicate download is refused.
+	codeDuplicateDownload = jrpc2.Code(-32007)
 )
 
 // RPCConfig holds configuration for the JSON-RPC endpoint.
@@ -41,6 +49,8 @@ type RPCServer struct {
 	pool         *Pool
 	schemeRouter *warplib.SchemeRouter
 	notifier     *RPCNotifier
+	policy       *scheduler.Policy
+	webhooks     *webhook.Dispatcher
 }
 
 // VersionResult is the response for system.getVersion.
@@ -52,17 +62,32 @@ type VersionResult struct {
 
 // AddParams is the input for download.add.
 type AddParams struct {
-	URL         string          `json:"url"`
-	FileName    string          `json:"fileName,omitempty"`
-	Dir         string          `json:"dir,omitempty"`
-	Headers     warplib.Headers `json:"headers,omitempty"`
-	Connections int32           `json:"connections,omitempty"`
-	SSHKeyPath  string          `json:"sshKeyPath,omitempty"`
+	URL         string               `json:"url"`
+	FileName    string               `json:"fileName,omitempty"`
+	Dir         string               `json:"dir,omitempty"`
+	Headers     warplib.Headers      `json:"headers,omitempty"`
+	Connections int32                `json:"connections,omitempty"`
+	SSHKeyPath  string               `json:"sshKeyPath,omitempty"`
+	Hooks       *warplib.Hooks       `json:"hooks,omitempty"`
+	Extract     *warplib.ExtractOpts `json:"extract,omitempty"`
+	// OnDuplicate is the policy for a duplicate of an existing download:
+	// allow, return, refuse or attach. Empty uses the daemon's policy.
+	OnDuplicate warplib.DuplicatePolicy `json:"onDuplicate,omitempty"`
+	// Checksums are the expected checksums of the file as "algorithm:hex",
+	// or "auto" to look them up in the checksum files published next to it.
+	Checksums []string `json:"checksums,omitempty"`
+	// VerifySig is the URL of the detached signature the file is verified
+	// against with the daemon's trusted keys, or "auto" to look it up next
+	// to the file.
+	VerifySig string `json:"verifySig,omitempty"`
 }
 
-// AddResult is the response for download.add.
+// AddResult is the response for download.add. For a duplicate, GID is the
+// existing download and Duplicate tells if it was returned or attached to.
 type AddResult struct {
-	GID string `json:"gid"`
+	GID            string                  `json:"gid"`
+	Duplicate      warplib.DuplicateAction `json:"duplicate,omitempty"`
+	DuplicateMatch warplib.DuplicateMatch  `json:"duplicateMatch,omitempty"`
 }
 
 // GIDParam is a common input with just a download GID.
@@ -80,9 +105,36 @@ type StatusResult struct {
 	FileName        string `json:"fileName"`
 }
 
+// ChangeOptionParams is the input for download.changeOption.
+// Options left at their zero value are not changed.
+type ChangeOptionParams struct {
+	GID            string `json:"gid"`
+	SpeedLimit     string `json:"speedLimit,omitempty"` // e.g. "1MB", "0" for unlimited
+	MaxConnections int32  `json:"maxConnections,omitempty"`
+}
+
+// OptionResult is the response for download.changeOption.
+type OptionResult struct {
+	GID            string `json:"gid"`
+	SpeedLimit     int64  `json:"speedLimit"`
+	MaxConnections int32  `json:"maxConnections"`
+}
+
 // ListParams is the input for download.list.
 type ListParams struct {
-	Status string `json:"status,omitempty"` // "active", "waiting", "complete", "all" (default)
+	Status string `json:"status,omitempty"` // "active", "waiting", "complete", "failed", "scheduled", "all" (default)
+	// Search lists only the downloads whose name or URL contain this text.
+	Search string `json:"search,omitempty"`
+	// Host lists only the downloads from this host or its subdomains.
+	Host string `json:"host,omitempty"`
+	// Since and Until bound the time the downloads were added at.
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// MinSize is the smallest size in bytes of the listed downloads.
+	MinSize int64  `json:"minSize,omitempty"`
+	Sort    string `json:"sort,omitempty"` // "date" (default), "size", "speed"
+	Offset  int    `json:"offset,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
 }
 
 // ListItem is a single entry in the download.list response.
@@ -97,6 +149,8 @@ type ListItem struct {
 // ListResult is the response for download.list.
 type ListResult struct {
 	Downloads []*ListItem `json:"downloads"`
+	// Total is the number of matching downloads before offset and limit.
+	Total int `json:"total"`
 }
 
 // EmptyResult is a placeholder for methods that return no data.
@@ -123,13 +177,23 @@ func NewRPCServer(cfg *RPCConfig, m *warplib.Manager, client *http.Client, pool
 // methods returns the handler.Map used by both the HTTP bridge and WebSocket servers.
 func (rs *RPCServer) methods() handler.Map {
 	return handler.Map{
-		"system.getVersion": handler.New(rs.systemGetVersion),
-		"download.add":      handler.New(rs.downloadAdd),
-		"download.pause":    handler.New(rs.downloadPause),
-		"download.resume":   handler.New(rs.downloadResume),
-		"download.remove":   handler.New(rs.downloadRemove),
-		"download.status":   handler.New(rs.downloadStatus),
-		"download.list":     handler.New(rs.downloadList),
+		"system.getVersion":     handler.New(rs.systemGetVersion),
+		"download.add":          handler.New(rs.downloadAdd),
+		"download.pause":        handler.New(rs.downloadPause),
+		"download.resume":       handler.New(rs.downloadResume),
+		"download.remove":       handler.New(rs.downloadRemove),
+		"download.status":       handler.New(rs.downloadStatus),
+		"download.changeOption": handler.New(rs.downloadChangeOption),
+		"download.list":         handler.New(rs.downloadList),
+		"download.verify":       handler.New(rs.downloadVerify),
+		"policy.getStatus":      handler.New(rs.policyGetStatus),
+		"policy.override":       handler.New(rs.policyOverride),
+		"policy.clear":          handler.New(rs.policyClear),
+		"webhook.add":           handler.New(rs.webhookAdd),
+		"webhook.remove":        handler.New(rs.webhookRemove),
+		"webhook.list":          handler.New(rs.webhookList),
+		"webhook.test":          handler.New(rs.webhookTest),
+		"webhook.failures":      handler.New(rs.webhookFailures),
 	}
 }
 
@@ -152,6 +216,16 @@ func (rs *RPCServer) downloadAdd(_ context.Context, p *AddParams) (*AddResult, e
 		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: "invalid url: " + err.Error()}
 	}
 
+	// download.add starts right away, so it's refused during a pause window
+	if err := rs.policy.CheckStart(); err != nil {
+		return nil, &jrpc2.Error{Code: codeDownloadPaused, Message: err.Error()}
+	}
+
+	checksums, discover, err := warplib.ParseChecksumArgs(p.Checksums)
+	if err != nil {
+		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+	}
+
 	scheme := strings.ToLower(parsed.Scheme)
 	connections := p.Connections
 	if connections <= 0 {
@@ -164,31 +238,14 @@ func (rs *RPCServer) downloadAdd(_ context.Context, p *AddParams) (*AddResult, e
 		Headers:           p.Headers,
 		MaxConnections:    connections,
 		SSHKeyPath:        p.SSHKeyPath,
+		Checksums:         checksums,
+		DiscoverChecksums: discover,
+		ChecksumConfig:    rs.manager.GetChecksumConfig(),
+		Signature:         p.VerifySig,
 	}
 
 	// Wire notifier into download event handlers if available.
-	if rs.notifier != nil {
-		opts.Handlers = &warplib.Handlers{
-			ErrorHandler: func(hash string, err error) {
-				rs.notifier.Broadcast("download.error", &DownloadErrorNotification{
-					GID:   hash,
-					Error: err.Error(),
-				})
-			},
-			DownloadProgressHandler: func(hash string, nread int) {
-				rs.notifier.Broadcast("download.progress", &DownloadProgressNotification{
-					GID:             hash,
-					CompletedLength: int64(nread),
-				})
-			},
-			DownloadCompleteHandler: func(hash string, tread int64) {
-				rs.notifier.Broadcast("download.complete", &DownloadCompleteNotification{
-					GID:         hash,
-					TotalLength: tread,
-				})
-			},
-		}
-	}
+	opts.Handlers = rs.notifyHandlers()
 
 	switch scheme {
 	case "http", "https":
@@ -198,8 +255,17 @@ func (rs *RPCServer) downloadAdd(_ context.Context, p *AddParams) (*AddResult, e
 		}
 		if err := rs.manager.AddDownload(d, &warplib.AddDownloadOpts{
 			AbsoluteLocation: d.GetDownloadDirectory(),
+			Hooks:            p.Hooks,
+			Extract:          p.Extract,
+			OnDuplicate:      p.OnDuplicate,
 		}); err != nil {
-			return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+			if !errors.Is(err, warplib.ErrDuplicateDownload) {
+				return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+			}
+			// the duplicate is dropped with the files it created
+			_ = d.Close()
+			_ = os.RemoveAll(filepath.Join(warplib.DlDataDir, d.GetHash()))
+			return duplicateResult(err)
 		}
 		hash := d.GetHash()
 		if rs.pool != nil {
@@ -220,6 +286,12 @@ func (rs *RPCServer) downloadAdd(_ context.Context, p *AddParams) (*AddResult, e
 		if rs.schemeRouter == nil {
 			return nil, &jrpc2.Error{Code: codeInvalidParams, Message: "unsupported scheme: " + scheme}
 		}
+		if len(checksums) > 0 || discover {
+			return nil, &jrpc2.Error{Code: codeInvalidParams, Message: warplib.ErrChecksumNotSupported.Error()}
+		}
+		if p.VerifySig != "" {
+			return nil, &jrpc2.Error{Code: codeInvalidParams, Message: warplib.ErrSignatureNotSupported.Error()}
+		}
 		pd, err := rs.schemeRouter.NewDownloader(p.URL, opts)
 		if err != nil {
 			return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
@@ -242,8 +314,15 @@ func (rs *RPCServer) downloadAdd(_ context.Context, p *AddParams) (*AddResult, e
 		if err := rs.manager.AddProtocolDownload(pd, probe, cleanURL, proto, opts.Handlers, &warplib.AddDownloadOpts{
 			AbsoluteLocation: pd.GetDownloadDirectory(),
 			SSHKeyPath:       p.SSHKeyPath,
+			Hooks:            p.Hooks,
+			Extract:          p.Extract,
+			OnDuplicate:      p.OnDuplicate,
 		}); err != nil {
-			return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+			if !errors.Is(err, warplib.ErrDuplicateDownload) {
+				return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+			}
+			pd.Close()
+			return duplicateResult(err)
 		}
 		hash := pd.GetHash()
 		if rs.pool != nil {
@@ -261,6 +340,44 @@ func (rs *RPCServer) downloadAdd(_ context.Context, p *AddParams) (*AddResult, e
 	}
 }
 
+// duplicateResult turns a DuplicateError into the result for a returned
+// or attached duplicate, and into a JSON-RPC error for a refused one.
+func duplicateResult(err error) (*AddResult, error) {
+	var dup *warplib.DuplicateError
+	if !errors.As(err, &dup) || dup.Action == warplib.DuplicateRefused {
+		return nil, &jrpc2.Error{Code: codeDuplicateDownload, Message: err.Error()}
+	}
+	return &AddResult{GID: dup.Item.Hash, Duplicate: dup.Action, DuplicateMatch: dup.Match}, nil
+}
+
+// notifyHandlers returns download handlers that broadcast the error,
+// progress and completion notifications, nil without a notifier.
+func (rs *RPCServer) notifyHandlers() *warplib.Handlers {
+	if rs.notifier == nil {
+		return nil
+	}
+	return &warplib.Handlers{
+		ErrorHandler: func(hash string, err error) {
+			rs.notifier.Broadcast("download.error", &DownloadErrorNotification{
+				GID:   hash,
+				Error: err.Error(),
+			})
+		},
+		DownloadProgressHandler: func(hash string, nread int) {
+			rs.notifier.Broadcast("download.progress", &DownloadProgressNotification{
+				GID:             hash,
+				CompletedLength: int64(nread),
+			})
+		},
+		DownloadCompleteHandler: func(hash string, tread int64) {
+			rs.notifier.Broadcast("download.complete", &DownloadCompleteNotification{
+				GID:         hash,
+				TotalLength: tread,
+			})
+		},
+	}
+}
+
 // downloadPause stops an active download.
 func (rs *RPCServer) downloadPause(_ context.Context, p *GIDParam) (*EmptyResult, error) {
 	item := rs.manager.GetItem(p.GID)
@@ -283,30 +400,12 @@ func (rs *RPCServer) downloadResume(_ context.Context, p *GIDParam) (*EmptyResul
 		return nil, &jrpc2.Error{Code: codeDownloadNotFound, Message: "download not found"}
 	}
 
+	if err := rs.policy.CheckStart(); err != nil {
+		return nil, &jrpc2.Error{Code: codeDownloadPaused, Message: err.Error()}
+	}
 	var resumeOpts *warplib.ResumeDownloadOpts
-	if rs.notifier != nil {
-		resumeOpts = &warplib.ResumeDownloadOpts{
-			Handlers: &warplib.Handlers{
-				ErrorHandler: func(hash string, err error) {
-					rs.notifier.Broadcast("download.error", &DownloadErrorNotification{
-						GID:   hash,
-						Error: err.Error(),
-					})
-				},
-				DownloadProgressHandler: func(hash string, nread int) {
-					rs.notifier.Broadcast("download.progress", &DownloadProgressNotification{
-						GID:             hash,
-						CompletedLength: int64(nread),
-					})
-				},
-				DownloadCompleteHandler: func(hash string, tread int64) {
-					rs.notifier.Broadcast("download.complete", &DownloadCompleteNotification{
-						GID:         hash,
-						TotalLength: tread,
-					})
-				},
-			},
-		}
+	if h := rs.notifyHandlers(); h != nil {
+		resumeOpts = &warplib.ResumeDownloadOpts{Handlers: h}
 	}
 
 	resumedItem, err := rs.manager.ResumeDownload(rs.client, p.GID, resumeOpts)
@@ -357,35 +456,76 @@ func (rs *RPCServer) downloadStatus(_ context.Context, p *GIDParam) (*StatusResu
 	}, nil
 }
 
-// downloadList returns a list of downloads, optionally filtered by status.
-func (rs *RPCServer) downloadList(_ context.Context, p *ListParams) (*ListResult, error) {
-	var items []*warplib.Item
-
-	status := p.Status
-	if status == "" {
-		status = "all"
+// downloadChangeOption changes the speed limit and/or connection count of a
+// running download without restarting it.
+func (rs *RPCServer) downloadChangeOption(_ context.Context, p *ChangeOptionParams) (*OptionResult, error) {
+	if p.SpeedLimit == "" && p.MaxConnections == 0 {
+		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: "speedLimit or maxConnections is required"}
+	}
+	var speedLimit int64
+	if p.SpeedLimit != "" {
+		var err error
+		if speedLimit, err = warplib.ParseSpeedLimit(p.SpeedLimit); err != nil {
+			return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+		}
+	}
+	if p.MaxConnections < 0 {
+		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: warplib.ErrInvalidMaxConnections.Error()}
+	}
+	item := rs.manager.GetItem(p.GID)
+	if item == nil {
+		return nil, &jrpc2.Error{Code: codeDownloadNotFound, Message: "download not found"}
+	}
+	if !item.IsDownloading() {
+		return nil, &jrpc2.Error{Code: codeDownloadNotActive, Message: "download not running"}
 	}
+	if p.MaxConnections != 0 {
+		if err := item.SetMaxConnections(p.MaxConnections); err != nil {
+			return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+		}
+	}
+	if p.SpeedLimit != "" {
+		if err := item.SetSpeedLimit(speedLimit); err != nil {
+			return nil, &jrpc2.Error{Code: codeDownloadNotActive, Message: err.Error()}
+		}
+	}
+	res := &OptionResult{GID: item.Hash}
+	res.SpeedLimit, _ = item.GetSpeedLimit()
+	res.MaxConnections, _ = item.GetMaxConnections()
+	return res, nil
+}
 
-	switch status {
-	case "all":
-		items = rs.manager.GetItems()
+// downloadList returns a page of downloads, optionally filtered by status,
+// name, host, date and size.
+func (rs *RPCServer) downloadList(_ context.Context, p *ListParams) (*ListResult, error) {
+	sort, err := warplib.ParseItemSort(p.Sort)
+	if err != nil {
+		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+	}
+	q := &warplib.ItemQuery{
+		Hidden:  true,
+		Search:  p.Search,
+		Host:    p.Host,
+		Since:   p.Since,
+		Until:   p.Until,
+		MinSize: p.MinSize,
+		Sort:    sort,
+		Offset:  p.Offset,
+		Limit:   p.Limit,
+	}
+	switch p.Status {
 	case "active":
-		for _, item := range rs.manager.GetItems() {
-			if item.IsDownloading() {
-				items = append(items, item)
-			}
-		}
+		q.Statuses = []warplib.ItemStatus{warplib.StatusActive}
 	case "complete":
-		items = rs.manager.GetCompletedItems()
+		q.Statuses = []warplib.ItemStatus{warplib.StatusCompleted}
 	case "waiting":
-		for _, item := range rs.manager.GetIncompleteItems() {
-			if !item.IsDownloading() {
-				items = append(items, item)
-			}
-		}
-	default:
-		items = rs.manager.GetItems()
+		q.Statuses = []warplib.ItemStatus{warplib.StatusPending, warplib.StatusFailed, warplib.StatusScheduled}
+	case "failed":
+		q.Statuses = []warplib.ItemStatus{warplib.StatusFailed}
+	case "scheduled":
+		q.Statuses = []warplib.ItemStatus{warplib.StatusScheduled}
 	}
+	items, total := rs.manager.QueryItems(q)
 
 	downloads := make([]*ListItem, 0, len(items))
 	for _, item := range items {
@@ -398,7 +538,7 @@ func (rs *RPCServer) downloadList(_ context.Context, p *ListParams) (*ListResult
 		})
 	}
 
-	return &ListResult{Downloads: downloads}, nil
+	return &ListResult{Downloads: downloads, Total: total}, nil
 }
 
 // itemStatus returns the status string for a download item.
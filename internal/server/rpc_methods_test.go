@@ -2,6 +2,8 @@ package server
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"log"
@@ -300,6 +302,37 @@ func TestRPCDownloadAdd_Success(t *testing.T) {
 	t.Fatal("download item was not added to manager")
 }
 
+func TestRPCDownloadAdd_Duplicate(t *testing.T) {
+	handler, secret, cleanup, m, dlDir := newTestRPCHandlerWithManager(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("a"), 1024)
+	srv := newRangeServer(content)
+	defer srv.Close()
+
+	add := func(policy string) map[string]any {
+		_, resp := rpcCall(t, handler, "download.add", map[string]any{
+			"url":         srv.URL + "/file.bin",
+			"dir":         dlDir,
+			"onDuplicate": policy,
+		}, secret)
+		return resp
+	}
+	gid := rpcResult(t, add(""))["gid"].(string)
+
+	result := rpcResult(t, add("return"))
+	if result["gid"] != gid || result["duplicate"] != "returned" || result["duplicateMatch"] != "url" {
+		t.Fatalf("duplicate result = %v, want download %s returned", result, gid)
+	}
+	errObj := rpcError(t, add("refuse"))
+	if errObj["code"].(float64) != float64(codeDuplicateDownload) {
+		t.Fatalf("expected error code %d, got %v", codeDuplicateDownload, errObj["code"])
+	}
+	if n := len(m.GetItems()); n != 1 {
+		t.Fatalf("%d items, want 1", n)
+	}
+}
+
 func TestRPCDownloadAdd_MissingURL(t *testing.T) {
 	handler, secret, cleanup, _, _ := newTestRPCHandlerWithManager(t)
 	defer cleanup()
@@ -614,6 +647,55 @@ func TestRPCDownloadList_UnknownStatusDefaultsToAll(t *testing.T) {
 	}
 }
 
+func TestRPCDownloadList_Query(t *testing.T) {
+	handler, secret, cleanup, m, dlDir := newTestRPCHandlerWithManager(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i, name := range []string{"small.iso", "big.iso", "other.zip"} {
+		item := &warplib.Item{
+			Hash:             name,
+			Name:             name,
+			Url:              "https://example.com/" + name,
+			DateAdded:        now.Add(time.Duration(i) * time.Minute),
+			TotalSize:        warplib.ContentLength(100 * (i + 1)),
+			DownloadLocation: dlDir,
+			AbsoluteLocation: dlDir,
+			Parts:            make(map[int64]*warplib.ItemPart),
+		}
+		if name == "other.zip" {
+			item.Error = "connection reset"
+		}
+		m.UpdateItem(item)
+	}
+
+	code, resp := rpcCall(t, handler, "download.list", map[string]any{
+		"status": "waiting",
+		"search": ".iso",
+		"sort":   "size",
+		"limit":  1,
+	}, secret)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	result := rpcResult(t, resp)
+	downloads := result["downloads"].([]any)
+	if len(downloads) != 1 || downloads[0].(map[string]any)["gid"] != "big.iso" || result["total"] != float64(2) {
+		t.Fatalf("unexpected result %v", result)
+	}
+
+	_, resp = rpcCall(t, handler, "download.list", map[string]any{"status": "failed"}, secret)
+	downloads = rpcResult(t, resp)["downloads"].([]any)
+	if len(downloads) != 1 || downloads[0].(map[string]any)["gid"] != "other.zip" {
+		t.Fatalf("unexpected failed downloads %v", downloads)
+	}
+
+	_, resp = rpcCall(t, handler, "download.list", map[string]any{"sort": "name"}, secret)
+	if errCode := rpcError(t, resp)["code"].(float64); errCode != float64(codeInvalidParams) {
+		t.Fatalf("expected error code %d, got %v", codeInvalidParams, errCode)
+	}
+}
+
 // --- download.remove tests ---
 
 func TestRPCDownloadRemove_Success(t *testing.T) {
@@ -850,3 +932,97 @@ func TestItemStatus_ZeroSize(t *testing.T) {
 		t.Fatalf("expected 'waiting' for zero-size item, got %q", status)
 	}
 }
+
+// --- download.changeOption tests ---
+
+func TestRPCDownloadChangeOption_InvalidParams(t *testing.T) {
+	handler, secret, cleanup, _, _ := newTestRPCHandlerWithManager(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		params map[string]any
+	}{
+		{"no options", map[string]any{"gid": "some-hash"}},
+		{"invalid speed limit", map[string]any{"gid": "some-hash", "speedLimit": "fast"}},
+		{"negative connections", map[string]any{"gid": "some-hash", "maxConnections": -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := rpcCall(t, handler, "download.changeOption", tt.params, secret)
+			if code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", code)
+			}
+			errObj := rpcError(t, resp)
+			if errCode := errObj["code"].(float64); errCode != float64(codeInvalidParams) {
+				t.Fatalf("expected error code %d, got %v", codeInvalidParams, errCode)
+			}
+		})
+	}
+}
+
+func TestRPCDownloadChangeOption_NotFound(t *testing.T) {
+	handler, secret, cleanup, _, _ := newTestRPCHandlerWithManager(t)
+	defer cleanup()
+
+	code, resp := rpcCall(t, handler, "download.changeOption", map[string]any{
+		"gid":        "nonexistent-hash",
+		"speedLimit": "1MB",
+	}, secret)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	errObj := rpcError(t, resp)
+	if errCode := errObj["code"].(float64); errCode != float64(codeDownloadNotFound) {
+		t.Fatalf("expected error code %d, got %v", codeDownloadNotFound, errCode)
+	}
+}
+
+func TestRPCDownloadChangeOption_NotActive(t *testing.T) {
+	handler, secret, cleanup, m, _ := newTestRPCHandlerWithManager(t)
+	defer cleanup()
+
+	m.UpdateItem(&warplib.Item{Hash: "idle-hash", Parts: make(map[int64]*warplib.ItemPart)})
+
+	code, resp := rpcCall(t, handler, "download.changeOption", map[string]any{
+		"gid":            "idle-hash",
+		"maxConnections": 4,
+	}, secret)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	errObj := rpcError(t, resp)
+	if errCode := errObj["code"].(float64); errCode != float64(codeDownloadNotActive) {
+		t.Fatalf("expected error code %d, got %v", codeDownloadNotActive, errCode)
+	}
+}
+
+func TestRPCDownloadAdd_Checksums(t *testing.T) {
+	handler, secret, cleanup, m, dlDir := newTestRPCHandlerWithManager(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("a"), 1024)
+	srv := newRangeServer(content)
+	defer srv.Close()
+
+	_, resp := rpcCall(t, handler, "download.add", map[string]any{
+		"url":       srv.URL + "/file.bin",
+		"dir":       dlDir,
+		"checksums": []string{"sha256:1234"},
+	}, secret)
+	if errObj := rpcError(t, resp); errObj["code"].(float64) != float64(codeInvalidParams) {
+		t.Fatalf("expected error code %d, got %v", codeInvalidParams, errObj["code"])
+	}
+
+	sum := sha256.Sum256(content)
+	_, resp = rpcCall(t, handler, "download.add", map[string]any{
+		"url":       srv.URL + "/file.bin",
+		"dir":       dlDir,
+		"checksums": []string{"sha256:" + hex.EncodeToString(sum[:])},
+	}, secret)
+	gid := rpcResult(t, resp)["gid"].(string)
+	item := m.GetItem(gid)
+	if item == nil || len(item.Checksums) != 1 || item.Checksums[0].Algorithm != warplib.ChecksumSHA256 {
+		t.Fatalf("item checksums = %+v", item)
+	}
+}
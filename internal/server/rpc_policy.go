@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/warpdl/warpdl/internal/scheduler"
+)
+
+// codePolicyNotEnabled is returned by policy.* methods when the daemon runs without a policy engine.
+const codePolicyNotEnabled = jrpc2.Code(-32003)
+
+// codeDownloadPaused is returned when a download may not start because a
+// pause window or override is in effect.
+const codeDownloadPaused = jrpc2.Code(-32004)
+
+// PolicyOverrideParams is the input for policy.override.
+type PolicyOverrideParams struct {
+	Action     string    `json:"action"`               // "full", "limit" or "pause"
+	SpeedLimit int64     `json:"speedLimit,omitempty"` // bytes per second, required for "limit"
+	Until      time.Time `json:"until,omitempty"`      // RFC 3339; zero means next window boundary
+}
+
+// PolicyResult is the response for policy.getStatus, policy.override and policy.clear.
+type PolicyResult struct {
+	Action        string     `json:"action"`
+	SpeedLimit    int64      `json:"speedLimit"`
+	Window        string     `json:"window,omitempty"`
+	Override      bool       `json:"override"`
+	OverrideUntil *time.Time `json:"overrideUntil,omitempty"`
+}
+
+// SetPolicy sets the time-window policy exposed through the policy.* RPC methods.
+// It is a no-op if the JSON-RPC endpoint is disabled.
+func (s *Server) SetPolicy(p *scheduler.Policy) {
+	if s.ws != nil && s.ws.rpc != nil {
+		s.ws.rpc.policy = p
+	}
+}
+
+func newPolicyResult(st scheduler.PolicyState) *PolicyResult {
+	res := &PolicyResult{
+		Action:     string(st.Action),
+		SpeedLimit: st.SpeedLimit,
+		Window:     st.Window,
+		Override:   st.Override,
+	}
+	if st.Override {
+		until := st.OverrideUntil
+		res.OverrideUntil = &until
+	}
+	return res
+}
+
+func (rs *RPCServer) policyNotEnabled() error {
+	return &jrpc2.Error{Code: codePolicyNotEnabled, Message: "time-window policies not enabled"}
+}
+
+// policyGetStatus returns the effective time-window policy.
+func (rs *RPCServer) policyGetStatus(_ context.Context) (*PolicyResult, error) {
+	if rs.policy == nil {
+		return nil, rs.policyNotEnabled()
+	}
+	return newPolicyResult(rs.policy.State()), nil
+}
+
+// policyOverride forces a policy action until the requested time.
+func (rs *RPCServer) policyOverride(_ context.Context, p *PolicyOverrideParams) (*PolicyResult, error) {
+	if rs.policy == nil {
+		return nil, rs.policyNotEnabled()
+	}
+	if p.Action == "" {
+		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: "missing required param: action"}
+	}
+	st, err := rs.policy.Override(scheduler.PolicyAction(p.Action), p.SpeedLimit, p.Until)
+	if err != nil {
+		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return newPolicyResult(st), nil
+}
+
+// policyClear removes a manual override and returns to the weekly schedule.
+func (rs *RPCServer) policyClear(_ context.Context) (*PolicyResult, error) {
+	if rs.policy == nil {
+		return nil, rs.policyNotEnabled()
+	}
+	return newPolicyResult(rs.policy.ClearOverride()), nil
+}
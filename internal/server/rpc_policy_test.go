@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/warpdl/warpdl/internal/scheduler"
+)
+
+func newTestRPCHandlerWithPolicy(t *testing.T) (http.Handler, string, func()) {
+	t.Helper()
+	secret := "test-rpc-secret"
+	rs := NewRPCServer(&RPCConfig{Secret: secret}, nil, nil, nil, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := scheduler.NewPolicy(ctx, nil, nil)
+	if err != nil {
+		cancel()
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	rs.policy = p
+	return requireToken(secret, rs.bridge), secret, func() {
+		cancel()
+		rs.Close()
+	}
+}
+
+func TestRPCPolicy_NotEnabled(t *testing.T) {
+	handler, secret, cleanup := newTestRPCHandler(t)
+	defer cleanup()
+
+	for _, method := range []string{"policy.getStatus", "policy.clear"} {
+		_, resp := rpcCall(t, handler, method, nil, secret)
+		errObj := rpcError(t, resp)
+		if errObj["code"].(float64) != float64(codePolicyNotEnabled) {
+			t.Fatalf("%s: expected code %d, got %v", method, codePolicyNotEnabled, errObj["code"])
+		}
+	}
+}
+
+func TestRPCPolicy_OverrideAndClear(t *testing.T) {
+	handler, secret, cleanup := newTestRPCHandlerWithPolicy(t)
+	defer cleanup()
+
+	_, resp := rpcCall(t, handler, "policy.getStatus", nil, secret)
+	result := rpcResult(t, resp)
+	if result["action"] != "full" || result["override"] != false {
+		t.Fatalf("unexpected initial status: %v", result)
+	}
+
+	_, resp = rpcCall(t, handler, "policy.override", map[string]any{
+		"action":     "limit",
+		"speedLimit": 2048,
+		"until":      time.Now().Add(time.Hour).Format(time.RFC3339),
+	}, secret)
+	result = rpcResult(t, resp)
+	if result["action"] != "limit" || result["speedLimit"].(float64) != 2048 || result["override"] != true {
+		t.Fatalf("unexpected override result: %v", result)
+	}
+	if _, ok := result["overrideUntil"]; !ok {
+		t.Fatal("expected overrideUntil in override result")
+	}
+
+	_, resp = rpcCall(t, handler, "policy.clear", nil, secret)
+	result = rpcResult(t, resp)
+	if result["action"] != "full" || result["override"] != false {
+		t.Fatalf("unexpected status after clear: %v", result)
+	}
+}
+
+func TestRPCPolicy_OverrideInvalidParams(t *testing.T) {
+	handler, secret, cleanup := newTestRPCHandlerWithPolicy(t)
+	defer cleanup()
+
+	tests := []map[string]any{
+		{},
+		{"action": "turbo", "until": time.Now().Add(time.Hour).Format(time.RFC3339)},
+		{"action": "limit", "until": time.Now().Add(time.Hour).Format(time.RFC3339)},
+		{"action": "pause"}, // no windows, so an explicit until is required
+	}
+	for _, params := range tests {
+		_, resp := rpcCall(t, handler, "policy.override", params, secret)
+		errObj := rpcError(t, resp)
+		if errObj["code"].(float64) != float64(codeInvalidParams) {
+			t.Fatalf("params %v: expected code %d, got %v", params, codeInvalidParams, errObj["code"])
+		}
+	}
+}
+
+func TestRPCPolicy_PauseRefusesDownloadAdd(t *testing.T) {
+	handler, secret, cleanup := newTestRPCHandlerWithPolicy(t)
+	defer cleanup()
+
+	_, resp := rpcCall(t, handler, "policy.override", map[string]any{
+		"action": "pause",
+		"until":  time.Now().Add(time.Hour).Format(time.RFC3339),
+	}, secret)
+	rpcResult(t, resp)
+
+	_, resp = rpcCall(t, handler, "download.add", map[string]any{"url": "http://127.0.0.1:1/file.bin"}, secret)
+	errObj := rpcError(t, resp)
+	if errObj["code"].(float64) != float64(codeDownloadPaused) {
+		t.Fatalf("expected code %d, got %v", codeDownloadPaused, errObj["code"])
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// codeDownloadIncomplete is returned by download.verify for a download
+// which isn't completely downloaded.
+const codeDownloadIncomplete = jrpc2.Code(-32008)
+
+// VerifyParams is the input for download.verify.
+type VerifyParams struct {
+	GIDs       []string `json:"gids,omitempty"`       // all completed downloads if empty
+	SearchDirs []string `json:"searchDirs,omitempty"` // searched for the missing files
+	Redownload bool     `json:"redownload,omitempty"` // download missing and modified files again
+}
+
+// VerifyResult is the response for download.verify.
+type VerifyResult struct {
+	Results []*warplib.VerifyResult `json:"results"`
+}
+
+// VerifyProgressNotification is sent as the file of a download is hashed
+// by download.verify.
+type VerifyProgressNotification struct {
+	GID          string `json:"gid"`
+	HashedLength int64  `json:"hashedLength"`
+	TotalLength  int64  `json:"totalLength"`
+}
+
+// downloadVerify rehashes the files of completed downloads and compares
+// them with the checksums kept when they were downloaded. It replies once
+// all of them are verified, notifying the progress meanwhile.
+func (rs *RPCServer) downloadVerify(_ context.Context, p *VerifyParams) (*VerifyResult, error) {
+	results, err := rs.manager.VerifyDownloads(rs.client, p.GIDs, &warplib.VerifyOpts{
+		SearchDirs: p.SearchDirs,
+		Redownload: p.Redownload,
+		ProgressHandler: func(hash string, hashed int64) {
+			var total int64
+			if item := rs.manager.GetItem(hash); item != nil {
+				total = int64(item.GetTotalSize())
+			}
+			rs.notifier.Broadcast("download.verifyProgress", &VerifyProgressNotification{
+				GID:          hash,
+				HashedLength: hashed,
+				TotalLength:  total,
+			})
+		},
+		ResultHandler: func(res *warplib.VerifyResult) {
+			rs.notifier.Broadcast("download.verified", res)
+		},
+	})
+	switch {
+	case errors.Is(err, warplib.ErrDownloadNotFound):
+		return nil, &jrpc2.Error{Code: codeDownloadNotFound, Message: "download not found"}
+	case errors.Is(err, warplib.ErrVerifyIncomplete):
+		return nil, &jrpc2.Error{Code: codeDownloadIncomplete, Message: err.Error()}
+	case err != nil:
+		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return &VerifyResult{Results: results}, nil
+}
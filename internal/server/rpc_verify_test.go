@@ -0,0 +1,18 @@
+package server
+
+import "testing"
+
+func TestRPCDownloadVerify(t *testing.T) {
+	handler, secret, cleanup, _, _ := newTestRPCHandlerWithManager(t)
+	defer cleanup()
+
+	_, resp := rpcCall(t, handler, "download.verify", map[string]any{}, secret)
+	if results, ok := rpcResult(t, resp)["results"].([]any); !ok || len(results) != 0 {
+		t.Fatalf("expected no results, got %v", resp)
+	}
+
+	_, resp = rpcCall(t, handler, "download.verify", map[string]any{"gids": []string{"nope"}}, secret)
+	if errObj := rpcError(t, resp); errObj["code"].(float64) != float64(codeDownloadNotFound) {
+		t.Fatalf("expected code %d, got %v", codeDownloadNotFound, errObj["code"])
+	}
+}
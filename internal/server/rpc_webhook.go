@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/warpdl/warpdl/internal/webhook"
+)
+
+// codeWebhooksNotEnabled is returned by webhook.* methods when the daemon
+// runs without webhooks, because its webhooks file is invalid.
+const codeWebhooksNotEnabled = jrpc2.Code(-32005)
+
+// codeWebhookNotFound is returned for an unknown webhook ID.
+const codeWebhookNotFound = jrpc2.Code(-32006)
+
+// WebhookAddParams is the input for webhook.add.
+type WebhookAddParams struct {
+	ID     string   `json:"id,omitempty"` // generated if empty
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"` // all events if empty
+}
+
+// WebhookIDParam is the input for webhook.remove and webhook.test.
+type WebhookIDParam struct {
+	ID string `json:"id"`
+}
+
+// WebhookResult describes a webhook. The secret is not exposed.
+type WebhookResult struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Signed bool     `json:"signed"`
+}
+
+// WebhookListResult is the response for webhook.list.
+type WebhookListResult struct {
+	Webhooks []*WebhookResult `json:"webhooks"`
+}
+
+// WebhookTestResult is the response for webhook.test.
+type WebhookTestResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// WebhookFailuresResult is the response for webhook.failures.
+type WebhookFailuresResult struct {
+	Failures []webhook.Failure `json:"failures"`
+}
+
+// SetWebhooks sets the webhook dispatcher exposed through the webhook.* RPC methods.
+// It is a no-op if the JSON-RPC endpoint is disabled.
+func (s *Server) SetWebhooks(d *webhook.Dispatcher) {
+	if s.ws != nil && s.ws.rpc != nil {
+		s.ws.rpc.webhooks = d
+	}
+}
+
+func newWebhookResult(w *webhook.Webhook) *WebhookResult {
+	return &WebhookResult{ID: w.ID, URL: w.URL, Events: w.Events, Signed: w.Secret != ""}
+}
+
+func (rs *RPCServer) webhooksNotEnabled() error {
+	return &jrpc2.Error{Code: codeWebhooksNotEnabled, Message: "webhooks not enabled"}
+}
+
+func webhookError(err error) error {
+	if errors.Is(err, webhook.ErrNotFound) {
+		return &jrpc2.Error{Code: codeWebhookNotFound, Message: err.Error()}
+	}
+	return &jrpc2.Error{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// webhookAdd subscribes an endpoint to download events.
+func (rs *RPCServer) webhookAdd(_ context.Context, p *WebhookAddParams) (*WebhookResult, error) {
+	if rs.webhooks == nil {
+		return nil, rs.webhooksNotEnabled()
+	}
+	if p.URL == "" {
+		return nil, &jrpc2.Error{Code: codeInvalidParams, Message: "missing required param: url"}
+	}
+	w, err := rs.webhooks.Add(webhook.Webhook{ID: p.ID, URL: p.URL, Secret: p.Secret, Events: p.Events})
+	if err != nil {
+		return nil, webhookError(err)
+	}
+	return newWebhookResult(w), nil
+}
+
+// webhookRemove unsubscribes a webhook.
+func (rs *RPCServer) webhookRemove(_ context.Context, p *WebhookIDParam) (*EmptyResult, error) {
+	if rs.webhooks == nil {
+		return nil, rs.webhooksNotEnabled()
+	}
+	if err := rs.webhooks.Remove(p.ID); err != nil {
+		return nil, webhookError(err)
+	}
+	return &EmptyResult{}, nil
+}
+
+// webhookList returns the webhooks.
+func (rs *RPCServer) webhookList(_ context.Context) (*WebhookListResult, error) {
+	if rs.webhooks == nil {
+		return nil, rs.webhooksNotEnabled()
+	}
+	res := &WebhookListResult{Webhooks: []*WebhookResult{}}
+	for _, w := range rs.webhooks.List() {
+		res.Webhooks = append(res.Webhooks, newWebhookResult(&w))
+	}
+	return res, nil
+}
+
+// webhookTest sends a test delivery to a webhook. A failed delivery is a
+// result, not an error.
+func (rs *RPCServer) webhookTest(ctx context.Context, p *WebhookIDParam) (*WebhookTestResult, error) {
+	if rs.webhooks == nil {
+		return nil, rs.webhooksNotEnabled()
+	}
+	err := rs.webhooks.Test(ctx, p.ID)
+	if errors.Is(err, webhook.ErrNotFound) {
+		return nil, webhookError(err)
+	}
+	if err != nil {
+		return &WebhookTestResult{Error: err.Error()}, nil
+	}
+	return &WebhookTestResult{OK: true}, nil
+}
+
+// webhookFailures returns the saved failed deliveries, oldest first.
+func (rs *RPCServer) webhookFailures(_ context.Context) (*WebhookFailuresResult, error) {
+	if rs.webhooks == nil {
+		return nil, rs.webhooksNotEnabled()
+	}
+	return &WebhookFailuresResult{Failures: rs.webhooks.Failures()}, nil
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/warpdl/warpdl/internal/webhook"
+	"github.com/warpdl/warpdl/pkg/logger"
+)
+
+func newTestRPCHandlerWithWebhooks(t *testing.T) (http.Handler, string, func()) {
+	t.Helper()
+	secret := "test-rpc-secret"
+	rs := NewRPCServer(&RPCConfig{Secret: secret}, nil, nil, nil, nil, nil)
+	d := webhook.NewDispatcher(t.TempDir(), nil, logger.NewNopLogger())
+	rs.webhooks = d
+	return requireToken(secret, rs.bridge), secret, func() {
+		d.Close()
+		rs.Close()
+	}
+}
+
+func TestRPCWebhook_NotEnabled(t *testing.T) {
+	handler, secret, cleanup := newTestRPCHandler(t)
+	defer cleanup()
+
+	for _, method := range []string{"webhook.list", "webhook.failures"} {
+		_, resp := rpcCall(t, handler, method, nil, secret)
+		errObj := rpcError(t, resp)
+		if errObj["code"].(float64) != float64(codeWebhooksNotEnabled) {
+			t.Fatalf("%s: expected code %d, got %v", method, codeWebhooksNotEnabled, errObj["code"])
+		}
+	}
+}
+
+func TestRPCWebhook_AddTestRemove(t *testing.T) {
+	handler, secret, cleanup := newTestRPCHandlerWithWebhooks(t)
+	defer cleanup()
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer endpoint.Close()
+
+	_, resp := rpcCall(t, handler, "webhook.add", map[string]any{
+		"id": "bot", "url": endpoint.URL, "secret": "k", "events": []string{"download.complete"},
+	}, secret)
+	result := rpcResult(t, resp)
+	if result["id"] != "bot" || result["signed"] != true {
+		t.Fatalf("unexpected add result: %v", result)
+	}
+	if _, ok := result["secret"]; ok {
+		t.Fatal("add result exposes the secret")
+	}
+
+	_, resp = rpcCall(t, handler, "webhook.list", nil, secret)
+	if hooks := rpcResult(t, resp)["webhooks"].([]any); len(hooks) != 1 {
+		t.Fatalf("expected 1 webhook, got %v", hooks)
+	}
+
+	_, resp = rpcCall(t, handler, "webhook.test", map[string]any{"id": "bot"}, secret)
+	if result := rpcResult(t, resp); result["ok"] != true {
+		t.Fatalf("unexpected test result: %v", result)
+	}
+
+	_, resp = rpcCall(t, handler, "webhook.remove", map[string]any{"id": "bot"}, secret)
+	rpcResult(t, resp)
+	_, resp = rpcCall(t, handler, "webhook.test", map[string]any{"id": "bot"}, secret)
+	if errObj := rpcError(t, resp); errObj["code"].(float64) != float64(codeWebhookNotFound) {
+		t.Fatalf("expected code %d, got %v", codeWebhookNotFound, errObj["code"])
+	}
+}
+
+func TestRPCWebhook_AddInvalidParams(t *testing.T) {
+	handler, secret, cleanup := newTestRPCHandlerWithWebhooks(t)
+	defer cleanup()
+
+	tests := []map[string]any{
+		{},
+		{"url": "file:///etc/passwd"},
+		{"url": "http://localhost/hook", "events": []string{"download.done"}},
+	}
+	for _, params := range tests {
+		_, resp := rpcCall(t, handler, "webhook.add", params, secret)
+		errObj := rpcError(t, resp)
+		if errObj["code"].(float64) != float64(codeInvalidParams) {
+			t.Fatalf("params %v: expected code %d, got %v", params, codeInvalidParams, errObj["code"])
+		}
+	}
+}
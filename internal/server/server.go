@@ -43,6 +43,20 @@ func NewServer(l *log.Logger, m *warplib.Manager, port int, client *http.Client,
 	}
 }
 
+// Pool returns the pool of active downloads and the connections watching them.
+func (s *Server) Pool() *Pool {
+	return s.pool
+}
+
+// NotifyHandlers returns handlers that announce download events to the
+// JSON-RPC subscribers, nil if JSON-RPC is disabled.
+func (s *Server) NotifyHandlers() *warplib.Handlers {
+	if s.ws == nil || s.ws.rpc == nil {
+		return nil
+	}
+	return s.ws.rpc.notifyHandlers()
+}
+
 // RegisterHandler associates a handler function with a specific update type method.
 // When a request with the given method is received, the corresponding handler is invoked.
 func (s *Server) RegisterHandler(method common.UpdateType, handler HandlerFunc) {
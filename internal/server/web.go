@@ -173,6 +173,7 @@ func (s *WebServer) handleConnection(conn *websocket.Conn) {
 func (s *WebServer) handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/", websocket.Handler(s.handleConnection))
+	mux.HandleFunc("/files/", s.handleFile)
 	if s.rpc != nil {
 		mux.Handle("/jsonrpc", requireToken(s.rpc.secret, s.rpc.bridge))
 		mux.HandleFunc("/jsonrpc/ws", s.handleJSONRPCWebSocket)
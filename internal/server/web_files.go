@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// handleFile serves the file of a download at /files/{hash}, including
+// while it is still downloading. Range requests are supported, and a read
+// of bytes that aren't downloaded yet makes the downloader fetch them next,
+// so players can seek in a partially downloaded video.
+//
+// Local clients are always allowed; remote ones need the RPC secret, as a
+// Bearer token or in the token query parameter.
+func (s *WebServer) handleFile(w http.ResponseWriter, r *http.Request) {
+	if !s.fileAccessAllowed(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hash := strings.TrimPrefix(r.URL.Path, "/files/")
+	item := s.m.GetItem(hash)
+	if hash == "" || item == nil {
+		http.NotFound(w, r)
+		return
+	}
+	reader, err := warplib.NewItemReader(r.Context(), item)
+	if errors.Is(err, warplib.ErrItemSizeUnknown) {
+		http.Error(w, "file size is not known yet", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	ctype := mime.TypeByExtension(filepath.Ext(item.Name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	http.ServeContent(w, r, item.Name, time.Time{}, reader)
+}
+
+// fileAccessAllowed reports whether r may read download files.
+func (s *WebServer) fileAccessAllowed(r *http.Request) bool {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return true
+		}
+	}
+	if s.rpc == nil {
+		return false
+	}
+	if validToken(s.rpc.secret, r.Header.Get("Authorization")) {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	return token != "" && validToken(s.rpc.secret, "Bearer "+token)
+}
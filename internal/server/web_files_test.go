@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+// newFileTestServer returns a web server whose manager holds one complete
+// download of content, and the hash of that download.
+func newFileTestServer(t *testing.T, content []byte, rpcCfg *RPCConfig) (*WebServer, string) {
+	t.Helper()
+	base := t.TempDir()
+	if err := warplib.SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	m, err := warplib.InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	srv := newRangeServer(content)
+	defer srv.Close()
+	d, err := warplib.NewDownloader(&http.Client{}, srv.URL+"/clip.mp4", &warplib.DownloaderOpts{
+		DownloadDirectory: base,
+		Handlers:          &warplib.Handlers{},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &warplib.AddDownloadOpts{AbsoluteLocation: base}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	ws := NewWebServer(log.New(io.Discard, "", 0), m, NewPool(log.New(io.Discard, "", 0)), 0, nil, nil, rpcCfg)
+	t.Cleanup(func() {
+		if ws.rpc != nil {
+			ws.rpc.Close()
+		}
+	})
+	return ws, d.GetHash()
+}
+
+func TestWebServerHandleFile_Range(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	ws, hash := newFileTestServer(t, content, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/"+hash, nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	req.Header.Set("Range", "bytes=10-29")
+	rec := httptest.NewRecorder()
+	ws.handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", rec.Code)
+	}
+	if got := rec.Body.Bytes(); !bytes.Equal(got, content[10:30]) {
+		t.Fatalf("body = %q, want %q", got, content[10:30])
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "video/mp4" {
+		t.Errorf("Content-Type = %q, want video/mp4", ct)
+	}
+}
+
+func TestWebServerHandleFile_NotFound(t *testing.T) {
+	ws, _ := newFileTestServer(t, []byte("data"), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/missing", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	rec := httptest.NewRecorder()
+	ws.handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestWebServerHandleFile_RemoteNeedsToken(t *testing.T) {
+	content := []byte("remote content")
+	ws, hash := newFileTestServer(t, content, &RPCConfig{Secret: "test-secret", ListenAll: true})
+
+	tests := []struct {
+		name   string
+		target string
+		auth   string
+		want   int
+	}{
+		{"no token", "/files/" + hash, "", http.StatusUnauthorized},
+		{"wrong token", "/files/" + hash + "?token=nope", "", http.StatusUnauthorized},
+		{"query token", "/files/" + hash + "?token=test-secret", "", http.StatusOK},
+		{"bearer token", "/files/" + hash, "Bearer test-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.RemoteAddr = "192.0.2.10:40000"
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			ws.handler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && !bytes.Equal(rec.Body.Bytes(), content) {
+				t.Fatalf("body = %q, want %q", rec.Body.Bytes(), content)
+			}
+		})
+	}
+}
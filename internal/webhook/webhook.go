@@ -0,0 +1,611 @@
+// Package webhook delivers download events to HTTP endpoints as JSON POST
+// requests signed with HMAC-SHA256. Deliveries are retried with backoff and
+// the ones that still fail are saved in the config directory.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+const (
+	// FileName is the name of the webhooks file inside the config directory.
+	FileName = "webhooks.json"
+	// FailuresFileName is the name of the file of failed deliveries inside
+	// the config directory.
+	FailuresFileName = "webhook-failures.json"
+	// MaxFailures is the number of failed deliveries kept.
+	MaxFailures = 100
+	// MaxAttempts is the number of times a delivery is tried.
+	MaxAttempts = 5
+	// DefaultBackoff is the wait before the first retry of a delivery,
+	// doubled before each next one.
+	DefaultBackoff = time.Second
+
+	// queueSize is the number of deliveries waiting for one endpoint
+	// before new ones are dropped.
+	queueSize = 256
+	// requestTimeout bounds one delivery attempt.
+	requestTimeout = 10 * time.Second
+)
+
+// Headers of a delivery.
+const (
+	// SignatureHeader is "sha256=" followed by the hex HMAC-SHA256 of the
+	// body, keyed with the webhook's secret. Only set with a secret.
+	SignatureHeader = "X-Warpdl-Signature"
+	// EventHeader is the event of the delivery.
+	EventHeader = "X-Warpdl-Event"
+	// DeliveryHeader is the ID of the delivery, the same on every attempt.
+	DeliveryHeader = "X-Warpdl-Delivery"
+)
+
+// Events a webhook can subscribe to. They are named after the JSON-RPC
+// notifications of the same events.
+const (
+	EventAdded    = "download.added"
+	EventStarted  = "download.started"
+	EventProgress = "download.progress"
+	EventComplete = "download.complete"
+	EventError    = "download.error"
+	// EventTest is only sent by Dispatcher.Test.
+	EventTest = "webhook.test"
+)
+
+// Events are the events a webhook can subscribe to.
+var Events = []string{EventAdded, EventStarted, EventProgress, EventComplete, EventError}
+
+var (
+	// ErrNotFound is returned for an unknown webhook ID.
+	ErrNotFound = errors.New("webhook not found")
+	// errQueueFull is recorded for deliveries dropped because their
+	// endpoint is too far behind.
+	errQueueFull = errors.New("delivery queue full")
+)
+
+// Webhook is a subscription of an endpoint to download events.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret keys the signature of the deliveries. Empty means unsigned.
+	Secret string `json:"secret,omitempty"`
+	// Events are the subscribed events. Empty means all of them.
+	Events []string `json:"events,omitempty"`
+}
+
+// Wants reports whether the webhook is subscribed to event.
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the URL and events of the webhook.
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: must be an http or https URL", w.URL)
+	}
+	for _, e := range w.Events {
+		if !knownEvent(e) {
+			return fmt.Errorf("unknown webhook event %q", e)
+		}
+	}
+	return nil
+}
+
+func knownEvent(e string) bool {
+	for _, k := range Events {
+		if k == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is the webhooks file:
+//
+//	{
+//	  "webhooks": [
+//	    {"id": "dashboard", "url": "https://dash.example.com/warpdl", "secret": "s3cr3t"},
+//	    {"id": "bot", "url": "http://localhost:9000/hook", "events": ["download.complete", "download.error"]}
+//	  ]
+//	}
+type Config struct {
+	Webhooks []*Webhook `json:"webhooks"`
+}
+
+// Load reads the webhooks file at path.
+// A missing file results in no webhooks.
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse webhooks file %s: %w", path, err)
+	}
+	ids := make(map[string]bool)
+	for _, w := range cfg.Webhooks {
+		if w.ID == "" {
+			return nil, fmt.Errorf("webhook %s has no id", w.URL)
+		}
+		if ids[w.ID] {
+			return nil, fmt.Errorf("duplicate webhook id %q", w.ID)
+		}
+		ids[w.ID] = true
+		if err := w.Validate(); err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", w.ID, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// Data is the download a delivery is about. It carries the fields of the
+// JSON-RPC notifications of the same event.
+type Data struct {
+	GID             string `json:"gid"`
+	FileName        string `json:"fileName,omitempty"`
+	TotalLength     int64  `json:"totalLength"`
+	CompletedLength int64  `json:"completedLength"`
+	Percentage      int64  `json:"percentage"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Payload is the body of a delivery.
+type Payload struct {
+	ID    string    `json:"id"`
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Data  *Data     `json:"data,omitempty"`
+}
+
+// Failure is a delivery that failed all its attempts.
+type Failure struct {
+	WebhookID string    `json:"webhook_id"`
+	URL       string    `json:"url"`
+	Event     string    `json:"event"`
+	Delivery  string    `json:"delivery"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	Time      time.Time `json:"time"`
+	// Payload is the body that could not be delivered.
+	Payload json.RawMessage `json:"payload"`
+}
+
+// delivery is a payload waiting to be sent to one endpoint.
+type delivery struct {
+	payload *Payload
+	body    []byte
+}
+
+// subscriber delivers the payloads of one webhook in order.
+type subscriber struct {
+	hook  *Webhook
+	queue chan *delivery
+	stop  chan struct{}
+}
+
+// Dispatcher sends download events to the subscribed webhooks. Each
+// webhook has its own queue, so a slow or failing endpoint doesn't delay
+// the others.
+type Dispatcher struct {
+	dir     string
+	client  *http.Client
+	log     logger.Logger
+	backoff time.Duration
+
+	mu       sync.Mutex
+	subs     []*subscriber
+	failures []Failure
+	// failuresChanged asks saveFailures to write the failures file, so
+	// the event path never waits for the disk.
+	failuresChanged chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher returns a dispatcher of the webhooks of cfg. Webhooks added
+// or removed later and failed deliveries are saved in dir.
+func NewDispatcher(dir string, cfg *Config, log logger.Logger) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		dir:     dir,
+		client:  &http.Client{Timeout: requestTimeout},
+		log:     log,
+		backoff: DefaultBackoff,
+		ctx:     ctx,
+		cancel:  cancel,
+
+		failuresChanged: make(chan struct{}, 1),
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, FailuresFileName)); err == nil {
+		if err := json.Unmarshal(b, &d.failures); err != nil {
+			log.Warning("Ignoring unreadable %s: %v", FailuresFileName, err)
+			d.failures = nil
+		}
+	}
+	if cfg != nil {
+		for _, w := range cfg.Webhooks {
+			d.subscribe(w)
+		}
+	}
+	d.wg.Add(1)
+	go d.saveFailures()
+	return d
+}
+
+// subscribe starts the delivery of the events of w. Called with mu held or
+// before the dispatcher is shared.
+func (d *Dispatcher) subscribe(w *Webhook) {
+	s := &subscriber{
+		hook:  w,
+		queue: make(chan *delivery, queueSize),
+		stop:  make(chan struct{}),
+	}
+	d.subs = append(d.subs, s)
+	d.wg.Add(1)
+	go d.work(s)
+}
+
+// HandleEvent queues the deliveries of a download event. Its signature
+// matches warplib.ItemEventHandlerFunc.
+func (d *Dispatcher) HandleEvent(item *warplib.Item, ev warplib.ItemEvent, err error) {
+	data := &Data{
+		GID:             item.Hash,
+		FileName:        item.Name,
+		TotalLength:     int64(item.GetTotalSize()),
+		CompletedLength: int64(item.GetDownloaded()),
+		Percentage:      item.GetPercentage(),
+	}
+	var event string
+	switch ev {
+	case warplib.EventAdded:
+		event = EventAdded
+	case warplib.EventStarted:
+		event = EventStarted
+	case warplib.EventProgress:
+		event = EventProgress
+		// the milestone passed, not how far the download got since
+		data.Percentage = data.Percentage / warplib.ProgressMilestone * warplib.ProgressMilestone
+	case warplib.EventComplete:
+		event = EventComplete
+		data.CompletedLength = data.TotalLength
+		data.Percentage = 100
+	case warplib.EventError, warplib.EventChecksumFail:
+		event = EventError
+		if err != nil {
+			data.Error = err.Error()
+		}
+	default:
+		return
+	}
+	d.Send(event, data)
+}
+
+// Send queues a payload of event with data for the webhooks subscribed
+// to event.
+func (d *Dispatcher) Send(event string, data *Data) {
+	p, body, err := newPayload(event, data)
+	if err != nil {
+		d.log.Error("Webhook payload of %s: %v", event, err)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.subs {
+		if !s.hook.Wants(event) {
+			continue
+		}
+		select {
+		case s.queue <- &delivery{payload: p, body: body}:
+		default:
+			d.recordFailureLocked(s.hook, p, body, 0, errQueueFull)
+		}
+	}
+}
+
+func newPayload(event string, data *Data) (*Payload, []byte, error) {
+	p := &Payload{ID: newID(), Event: event, Time: time.Now().UTC(), Data: data}
+	body, err := json.Marshal(p)
+	return p, body, err
+}
+
+// work delivers the payloads queued for s until s is removed or the
+// dispatcher is closed.
+func (d *Dispatcher) work(s *subscriber) {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case dl := <-s.queue:
+			d.deliver(s, dl)
+		}
+	}
+}
+
+// deliver sends dl to the endpoint of s, retrying with backoff, and
+// records it as failed if no attempt succeeded.
+func (d *Dispatcher) deliver(s *subscriber, dl *delivery) {
+	wait := d.backoff
+	var err error
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		var retry bool
+		retry, err = d.post(d.ctx, s.hook, dl)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == MaxAttempts {
+			d.mu.Lock()
+			d.recordFailureLocked(s.hook, dl.payload, dl.body, attempt, err)
+			d.mu.Unlock()
+			return
+		}
+		select {
+		case <-time.After(wait):
+		case <-d.ctx.Done():
+			return
+		case <-s.stop:
+			return
+		}
+		wait *= 2
+	}
+}
+
+// post makes one delivery attempt. retry reports whether a failed attempt
+// is worth repeating: network errors, timeouts, rate limiting and server
+// errors are, other rejections aren't.
+func (d *Dispatcher) post(ctx context.Context, w *Webhook, dl *delivery) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "warpdl-webhook")
+	req.Header.Set(EventHeader, dl.payload.Event)
+	req.Header.Set(DeliveryHeader, dl.payload.ID)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, dl.body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+	switch {
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusRequestTimeout:
+		return true, err
+	default:
+		return false, err
+	}
+}
+
+// Sign returns the SignatureHeader value of body for secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordFailureLocked saves a failed delivery, keeping the latest
+// MaxFailures. Called with mu held.
+func (d *Dispatcher) recordFailureLocked(w *Webhook, p *Payload, body []byte, attempts int, err error) {
+	d.log.Warning("Webhook %s: delivery %s of %s failed after %d attempts: %v", w.ID, p.ID, p.Event, attempts, err)
+	d.failures = append(d.failures, Failure{
+		WebhookID: w.ID,
+		URL:       w.URL,
+		Event:     p.Event,
+		Delivery:  p.ID,
+		Attempts:  attempts,
+		Error:     err.Error(),
+		Time:      time.Now().UTC(),
+		Payload:   json.RawMessage(body),
+	})
+	if n := len(d.failures) - MaxFailures; n > 0 {
+		d.failures = append([]Failure(nil), d.failures[n:]...)
+	}
+	select {
+	case d.failuresChanged <- struct{}{}:
+	default:
+		// a write is pending already and will see this failure
+	}
+}
+
+// saveFailures writes the failures file each time they change until the
+// dispatcher is closed.
+func (d *Dispatcher) saveFailures() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-d.failuresChanged:
+			d.writeFailures()
+		}
+	}
+}
+
+// writeFailures writes a copy of the failures taken under mu to the
+// failures file.
+func (d *Dispatcher) writeFailures() {
+	d.mu.Lock()
+	failures := append([]Failure(nil), d.failures...)
+	d.mu.Unlock()
+	if err := writeJSON(filepath.Join(d.dir, FailuresFileName), failures); err != nil {
+		d.log.Error("Saving webhook failures: %v", err)
+	}
+}
+
+// Failures returns the saved failed deliveries, oldest first.
+func (d *Dispatcher) Failures() []Failure {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Failure(nil), d.failures...)
+}
+
+// List returns the webhooks.
+func (d *Dispatcher) List() []Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	hooks := make([]Webhook, len(d.subs))
+	for i, s := range d.subs {
+		hooks[i] = *s.hook
+	}
+	return hooks
+}
+
+// Add subscribes w and saves the webhooks file. An empty ID is generated.
+func (d *Dispatcher) Add(w Webhook) (*Webhook, error) {
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if w.ID == "" {
+		w.ID = newID()
+	}
+	for _, s := range d.subs {
+		if s.hook.ID == w.ID {
+			return nil, fmt.Errorf("duplicate webhook id %q", w.ID)
+		}
+	}
+	w.Events = append([]string(nil), w.Events...)
+	d.subscribe(&w)
+	if err := d.saveLocked(); err != nil {
+		d.removeLocked(w.ID)
+		return nil, err
+	}
+	res := w
+	return &res, nil
+}
+
+// Remove unsubscribes the webhook with id and saves the webhooks file.
+// Its pending deliveries are dropped.
+func (d *Dispatcher) Remove(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.removeLocked(id)
+	if s == nil {
+		return ErrNotFound
+	}
+	if err := d.saveLocked(); err != nil {
+		d.subscribe(s.hook)
+		return err
+	}
+	return nil
+}
+
+// removeLocked stops the subscriber of id and returns it, nil if there is
+// none. Called with mu held.
+func (d *Dispatcher) removeLocked(id string) *subscriber {
+	for i, s := range d.subs {
+		if s.hook.ID == id {
+			d.subs = append(d.subs[:i:i], d.subs[i+1:]...)
+			close(s.stop)
+			return s
+		}
+	}
+	return nil
+}
+
+// saveLocked writes the webhooks file. Called with mu held.
+func (d *Dispatcher) saveLocked() error {
+	cfg := Config{Webhooks: make([]*Webhook, len(d.subs))}
+	for i, s := range d.subs {
+		cfg.Webhooks[i] = s.hook
+	}
+	return writeJSON(filepath.Join(d.dir, FileName), &cfg)
+}
+
+// Test sends an EventTest payload to the webhook with id, once and right
+// away, and returns why it failed. Test deliveries are not saved as failures.
+func (d *Dispatcher) Test(ctx context.Context, id string) error {
+	d.mu.Lock()
+	var hook *Webhook
+	for _, s := range d.subs {
+		if s.hook.ID == id {
+			hook = s.hook
+		}
+	}
+	d.mu.Unlock()
+	if hook == nil {
+		return ErrNotFound
+	}
+	p, body, err := newPayload(EventTest, nil)
+	if err != nil {
+		return err
+	}
+	_, err = d.post(ctx, hook, &delivery{payload: p, body: body})
+	return err
+}
+
+// Close stops the deliveries, dropping the pending ones, and waits for
+// the attempts in flight.
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+	// save the failures recorded since the last write
+	select {
+	case <-d.failuresChanged:
+		d.writeFailures()
+	default:
+	}
+}
+
+// writeJSON writes v to path through a temporary file, readable by the
+// owner only as webhooks carry secrets.
+func writeJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return warplib.WarpRename(tmp, path)
+}
+
+// newID returns a random hex ID.
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
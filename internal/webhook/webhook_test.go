@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/warpdl/warpdl/pkg/logger"
+	"github.com/warpdl/warpdl/pkg/warplib"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// newEndpoint returns a server answering status to every delivery, and
+// the deliveries received so far.
+func newEndpoint(t *testing.T, status int) (*httptest.Server, func() []received) {
+	t.Helper()
+	var (
+		mu  sync.Mutex
+		got []received
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, received{r.Header.Clone(), b})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), got...)
+	}
+}
+
+func newTestDispatcher(t *testing.T, dir string, hooks ...*Webhook) *Dispatcher {
+	t.Helper()
+	d := NewDispatcher(dir, &Config{Webhooks: hooks}, logger.NewNopLogger())
+	d.backoff = time.Millisecond
+	t.Cleanup(d.Close)
+	return d
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil || len(cfg.Webhooks) != 0 {
+		t.Fatalf("Load(missing) = %+v, %v; want no webhooks", cfg, err)
+	}
+
+	path := filepath.Join(dir, FileName)
+	for _, bad := range []string{
+		`{"webhooks":[{"url":"http://a"}]}`,
+		`{"webhooks":[{"id":"a","url":"ftp://a"}]}`,
+		`{"webhooks":[{"id":"a","url":"http://a","events":["download.done"]}]}`,
+		`{"webhooks":[{"id":"a","url":"http://a"},{"id":"a","url":"http://b"}]}`,
+		`{`,
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestDispatcher_DeliversSignedEvents(t *testing.T) {
+	srv, got := newEndpoint(t, http.StatusNoContent)
+	d := newTestDispatcher(t, t.TempDir(), &Webhook{
+		ID: "bot", URL: srv.URL, Secret: "s3cr3t", Events: []string{EventComplete, EventError},
+	})
+	item := &warplib.Item{Hash: "h1", Name: "f.iso", TotalSize: 100, Downloaded: 40}
+
+	d.HandleEvent(item, warplib.EventProgress, nil) // not subscribed
+	d.HandleEvent(item, warplib.EventError, errors.New("boom"))
+	d.HandleEvent(item, warplib.EventComplete, nil)
+	waitFor(t, "two deliveries", func() bool { return len(got()) == 2 })
+
+	var events []string
+	for _, r := range got() {
+		if sig := r.header.Get(SignatureHeader); sig != Sign("s3cr3t", r.body) {
+			t.Errorf("signature = %q, want %q", sig, Sign("s3cr3t", r.body))
+		}
+		var p Payload
+		if err := json.Unmarshal(r.body, &p); err != nil {
+			t.Fatal(err)
+		}
+		if r.header.Get(EventHeader) != p.Event || r.header.Get(DeliveryHeader) != p.ID {
+			t.Errorf("headers %v don't match payload %+v", r.header, p)
+		}
+		if p.Data.GID != "h1" || p.Data.FileName != "f.iso" || p.Data.TotalLength != 100 {
+			t.Errorf("data = %+v", p.Data)
+		}
+		switch p.Event {
+		case EventError:
+			if p.Data.Error != "boom" {
+				t.Errorf("error data = %+v", p.Data)
+			}
+		case EventComplete:
+			if p.Data.CompletedLength != 100 || p.Data.Percentage != 100 {
+				t.Errorf("complete data = %+v", p.Data)
+			}
+		}
+		events = append(events, p.Event)
+	}
+	// one endpoint gets its events in order
+	if events[0] != EventError || events[1] != EventComplete {
+		t.Errorf("events = %v", events)
+	}
+}
+
+func TestDispatcher_RetriesThenSavesFailure(t *testing.T) {
+	dir := t.TempDir()
+	srv, got := newEndpoint(t, http.StatusBadGateway)
+	d := newTestDispatcher(t, dir, &Webhook{ID: "dash", URL: srv.URL})
+
+	d.Send(EventAdded, &Data{GID: "h1"})
+	waitFor(t, "a saved failure", func() bool { return len(d.Failures()) == 1 })
+	if n := len(got()); n != MaxAttempts {
+		t.Errorf("attempts = %d, want %d", n, MaxAttempts)
+	}
+	f := d.Failures()[0]
+	if f.WebhookID != "dash" || f.Event != EventAdded || f.Attempts != MaxAttempts || f.Error == "" {
+		t.Errorf("failure = %+v", f)
+	}
+
+	// failures survive a restart
+	d.Close()
+	reloaded := newTestDispatcher(t, dir)
+	if fs := reloaded.Failures(); len(fs) != 1 || fs[0].Delivery != f.Delivery {
+		t.Errorf("reloaded failures = %+v", fs)
+	}
+}
+
+func TestDispatcher_ClientErrorIsNotRetried(t *testing.T) {
+	srv, got := newEndpoint(t, http.StatusForbidden)
+	d := newTestDispatcher(t, t.TempDir(), &Webhook{ID: "a", URL: srv.URL})
+
+	d.Send(EventAdded, &Data{GID: "h1"})
+	waitFor(t, "a saved failure", func() bool { return len(d.Failures()) == 1 })
+	if n := len(got()); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+}
+
+func TestDispatcher_AddRemoveSaves(t *testing.T) {
+	dir := t.TempDir()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+	d := newTestDispatcher(t, dir)
+
+	if _, err := d.Add(Webhook{URL: "mailto:x"}); err == nil {
+		t.Error("Add(invalid URL) succeeded")
+	}
+	w, err := d.Add(Webhook{URL: srv.URL, Secret: "k"})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if w.ID == "" {
+		t.Fatal("Add didn't generate an ID")
+	}
+	cfg, err := Load(filepath.Join(dir, FileName))
+	if err != nil || len(cfg.Webhooks) != 1 || cfg.Webhooks[0].Secret != "k" {
+		t.Fatalf("saved config = %+v, %v", cfg, err)
+	}
+
+	if err := d.Test(context.Background(), w.ID); err != nil {
+		t.Errorf("Test: %v", err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("test deliveries = %d, want 1", hits.Load())
+	}
+
+	if err := d.Remove(w.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := d.Remove(w.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove twice = %v, want ErrNotFound", err)
+	}
+	if err := d.Test(context.Background(), w.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Test(removed) = %v, want ErrNotFound", err)
+	}
+	if cfg, _ := Load(filepath.Join(dir, FileName)); len(cfg.Webhooks) != 0 {
+		t.Errorf("saved config after Remove = %+v", cfg)
+	}
+}
@@ -183,3 +183,45 @@ func (c *Client) invoke(method common.UpdateType, message any) (json.RawMessage,
 	}
 	return res.Update.Message, nil
 }
+
+// invokeWithUpdates is invoke for methods which report their progress:
+// the updates of type updates received before the response are passed to
+// onUpdate.
+func (c *Client) invokeWithUpdates(method common.UpdateType, message any, updates common.UpdateType, onUpdate func(json.RawMessage) error) (json.RawMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buf, err := json.Marshal(&Request{
+		Method:  method,
+		Message: message,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke %s: %s", method, err.Error())
+	}
+	err = write(c.conn, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke %s: %s", method, err.Error())
+	}
+	for {
+		buf, err = read(c.conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to invoke %s: %s", method, err.Error())
+		}
+		var res Response
+		err = json.Unmarshal(buf, &res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", method, err.Error())
+		}
+		if !res.Ok {
+			return nil, errors.New(res.Error)
+		}
+		if res.Update == nil {
+			return nil, nil
+		}
+		if res.Update.Type != updates {
+			return res.Update.Message, nil
+		}
+		if err = onUpdate(res.Update.Message); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -2,6 +2,7 @@ package warpcli
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/warpdl/warpdl/common"
 	"github.com/warpdl/warpdl/pkg/warplib"
@@ -54,6 +55,12 @@ type DownloadOpts struct {
 	// DisableWorkStealing disables dynamic work stealing where fast parts
 	// take over remaining work from slow adjacent parts.
 	DisableWorkStealing bool `json:"disable_work_stealing,omitempty"`
+	// AutoConnections tunes the number of connections automatically,
+	// using MaxConnections as the upper bound.
+	AutoConnections bool `json:"auto_connections,omitempty"`
+	// DirectWrite preallocates the target file and writes the parts straight
+	// into it instead of compiling part files at the end.
+	DirectWrite bool `json:"direct_write,omitempty"`
 	// Priority specifies the queue priority (0=low, 1=normal, 2=high).
 	// Defaults to normal if not specified.
 	Priority int `json:"priority,omitempty"`
@@ -70,6 +77,20 @@ type DownloadOpts struct {
 	// (e.g., "0 2 * * *" = daily at 2 AM). May be combined with StartAt or
 	// StartIn to delay the first occurrence. Empty means no recurring schedule.
 	Schedule string `json:"schedule,omitempty"`
+	// Hooks are commands the daemon runs at the events of the download.
+	Hooks *warplib.Hooks `json:"hooks,omitempty"`
+	// Extract unpacks the downloaded archive once it completes.
+	Extract *warplib.ExtractOpts `json:"extract,omitempty"`
+	// OnDuplicate is what to do if the download duplicates an existing one.
+	// Empty uses the daemon's policy.
+	OnDuplicate warplib.DuplicatePolicy `json:"on_duplicate,omitempty"`
+	// Checksums are the expected checksums of the file as "algorithm:hex",
+	// or "auto" to look them up in the checksum files published next to it.
+	Checksums []string `json:"checksums,omitempty"`
+	// VerifySig is the URL of the detached signature the file is verified
+	// against with the daemon's trusted keys, or "auto" to look it up next
+	// to the file.
+	VerifySig string `json:"verify_sig,omitempty"`
 }
 
 // Download initiates a new download from the specified URL.
@@ -98,11 +119,18 @@ func (c *Client) Download(url, fileName, downloadDirectory string, opts *Downloa
 		RetryDelay:          opts.RetryDelay,
 		SpeedLimit:          opts.SpeedLimit,
 		DisableWorkStealing: opts.DisableWorkStealing,
+		AutoConnections:     opts.AutoConnections,
+		DirectWrite:         opts.DirectWrite,
 		Priority:            opts.Priority,
 		SSHKeyPath:          opts.SSHKeyPath,
 		StartAt:             opts.StartAt,
 		CookiesFrom:         opts.CookiesFrom,
 		Schedule:            opts.Schedule,
+		Hooks:               opts.Hooks,
+		Extract:             opts.Extract,
+		OnDuplicate:         opts.OnDuplicate,
+		Checksums:           opts.Checksums,
+		VerifySig:           opts.VerifySig,
 	})
 }
 
@@ -130,6 +158,9 @@ type ResumeOpts struct {
 	// SpeedLimit specifies the maximum download speed (e.g., "1MB", "512KB", or raw bytes).
 	// If empty or "0", no limit is applied.
 	SpeedLimit string `json:"speed_limit,omitempty"`
+	// AutoConnections tunes the number of connections automatically,
+	// using MaxConnections as the upper bound.
+	AutoConnections bool `json:"auto_connections,omitempty"`
 }
 
 // Resume resumes a previously paused or interrupted download.
@@ -141,16 +172,17 @@ func (c *Client) Resume(downloadId string, opts *ResumeOpts) (*common.ResumeResp
 		opts = &ResumeOpts{}
 	}
 	return invoke[common.ResumeResponse](c, common.UPDATE_RESUME, &common.ResumeParams{
-		DownloadId:     downloadId,
-		Headers:        opts.Headers,
-		ForceParts:     opts.ForceParts,
-		MaxConnections: opts.MaxConnections,
-		MaxSegments:    opts.MaxSegments,
-		Proxy:          opts.Proxy,
-		Timeout:        opts.Timeout,
-		MaxRetries:     opts.MaxRetries,
-		RetryDelay:     opts.RetryDelay,
-		SpeedLimit:     opts.SpeedLimit,
+		DownloadId:      downloadId,
+		Headers:         opts.Headers,
+		ForceParts:      opts.ForceParts,
+		MaxConnections:  opts.MaxConnections,
+		MaxSegments:     opts.MaxSegments,
+		Proxy:           opts.Proxy,
+		Timeout:         opts.Timeout,
+		MaxRetries:      opts.MaxRetries,
+		RetryDelay:      opts.RetryDelay,
+		SpeedLimit:      opts.SpeedLimit,
+		AutoConnections: opts.AutoConnections,
 	})
 }
 
@@ -159,11 +191,12 @@ func (c *Client) Resume(downloadId string, opts *ResumeOpts) (*common.ResumeResp
 type ListOpts common.ListParams
 
 // List retrieves a list of downloads from the daemon.
-// Pass nil for opts to use default settings (exclude hidden, include metadata).
-// Returns a list of downloads or an error if the operation fails.
+// Pass nil for opts to use default settings (visible pending downloads,
+// oldest first). Returns a list of downloads or an error if the operation
+// fails.
 func (c *Client) List(opts *ListOpts) (*common.ListResponse, error) {
 	if opts == nil {
-		opts = &ListOpts{false, true}
+		opts = &ListOpts{ShowPending: true}
 	}
 	return invoke[common.ListResponse](c, common.UPDATE_LIST, opts)
 }
@@ -191,6 +224,17 @@ func (c *Client) StopDownload(downloadId string) (bool, error) {
 	return err == nil, err
 }
 
+// SetOptions changes the speed limit and/or connection count of a running
+// download without restarting it. An empty speedLimit or a zero
+// maxConnections leaves that option unchanged. Returns the resulting options.
+func (c *Client) SetOptions(downloadId, speedLimit string, maxConnections int32) (*common.SetResponse, error) {
+	return invoke[common.SetResponse](c, common.UPDATE_SET, &common.SetParams{
+		DownloadId:     downloadId,
+		SpeedLimit:     speedLimit,
+		MaxConnections: maxConnections,
+	})
+}
+
 // AddExtension installs a new extension from the specified path.
 // The path should point to a valid extension package. Returns extension
 // metadata on success or an error if installation fails.
@@ -264,3 +308,109 @@ func (c *Client) QueueMove(hash string, position int) error {
 	_, err := invoke[any](c, common.UPDATE_QUEUE_MOVE, params)
 	return err
 }
+
+// PolicyStatus returns the effective time-window policy of the daemon.
+func (c *Client) PolicyStatus() (*common.PolicyStatusResponse, error) {
+	return invoke[common.PolicyStatusResponse](c, common.UPDATE_POLICY_STATUS, nil)
+}
+
+// PolicyOverride forces a policy action ("full", "limit" or "pause") until the given time,
+// ignoring the weekly schedule. A zero until lasts until the next window boundary.
+// speedLimit is in bytes per second and only used by the "limit" action.
+func (c *Client) PolicyOverride(action string, speedLimit int64, until time.Time) (*common.PolicyStatusResponse, error) {
+	return invoke[common.PolicyStatusResponse](c, common.UPDATE_POLICY_OVERRIDE, &common.PolicyOverrideParams{
+		Action:     action,
+		SpeedLimit: speedLimit,
+		Until:      until,
+	})
+}
+
+// PolicyClear removes a manual policy override and returns to the weekly schedule.
+func (c *Client) PolicyClear() (*common.PolicyStatusResponse, error) {
+	return invoke[common.PolicyStatusResponse](c, common.UPDATE_POLICY_CLEAR, nil)
+}
+
+// WebhookList returns the webhook subscriptions of the daemon.
+func (c *Client) WebhookList() (*common.WebhookListResponse, error) {
+	return invoke[common.WebhookListResponse](c, common.UPDATE_WEBHOOK_LIST, nil)
+}
+
+// WebhookTest sends a test delivery to the webhook with the given ID,
+// or to all webhooks if id is empty, and returns the outcome of each.
+func (c *Client) WebhookTest(id string) (*common.WebhookTestResponse, error) {
+	return invoke[common.WebhookTestResponse](c, common.UPDATE_WEBHOOK_TEST, &common.WebhookTestParams{ID: id})
+}
+
+// CacheList returns the files in the daemon's download cache.
+func (c *Client) CacheList() (*common.CacheListResponse, error) {
+	return invoke[common.CacheListResponse](c, common.UPDATE_CACHE_LIST, nil)
+}
+
+// CachePrune evicts the least recently used files from the download cache
+// until it holds at most maxSize bytes, or all of them if all is set.
+// A zero maxSize prunes to the configured cap.
+func (c *Client) CachePrune(maxSize int64, all bool) (*common.CachePruneResponse, error) {
+	return invoke[common.CachePruneResponse](c, common.UPDATE_CACHE_PRUNE, &common.CachePruneParams{MaxSize: maxSize, All: all})
+}
+
+// KeysAdd adds the public key to the daemon's keyring of trusted signers
+// under name, empty for the name the key carries.
+func (c *Client) KeysAdd(name, key string) (*common.KeysAddResponse, error) {
+	return invoke[common.KeysAddResponse](c, common.UPDATE_KEYS_ADD, &common.KeysAddParams{Name: name, Key: key})
+}
+
+// KeysList returns the keys of the daemon's keyring of trusted signers.
+func (c *Client) KeysList() (*common.KeysListResponse, error) {
+	return invoke[common.KeysListResponse](c, common.UPDATE_KEYS_LIST, nil)
+}
+
+// KeysRemove removes the key called name from the daemon's keyring.
+func (c *Client) KeysRemove(name string) error {
+	_, err := c.invoke(common.UPDATE_KEYS_REMOVE, &common.KeysRemoveParams{Name: name})
+	return err
+}
+
+// Repair hashes the pieces of the completed download with the given hash
+// and downloads the corrupted ones again, using up to maxConn connections
+// or the default if zero. It blocks until the repair is done.
+func (c *Client) Repair(downloadId string, maxConn int32) (*common.RepairResponse, error) {
+	return invoke[common.RepairResponse](c, common.UPDATE_REPAIR, &common.RepairParams{DownloadId: downloadId, MaxConnections: maxConn})
+}
+
+// Verify rehashes the files of the completed downloads in params, or of
+// all of them if none is given, and compares them with their checksums.
+// onUpdate, if not nil, is called with the progress of the verification.
+// It blocks until all of them are verified.
+func (c *Client) Verify(params *common.VerifyParams, onUpdate func(*common.VerifyingResponse)) (*common.VerifyResponse, error) {
+	resp, err := c.invokeWithUpdates(common.UPDATE_VERIFY, params, common.UPDATE_VERIFYING, func(m json.RawMessage) error {
+		if onUpdate == nil {
+			return nil
+		}
+		var v common.VerifyingResponse
+		if err := json.Unmarshal(m, &v); err != nil {
+			return err
+		}
+		onUpdate(&v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var v common.VerifyResponse
+	if len(resp) == 0 {
+		return &v, nil
+	}
+	return &v, json.Unmarshal(resp, &v)
+}
+
+// ExportHistory exports the history of the downloads and the queue of the
+// daemon, with the credentials of the downloads if secrets is true.
+func (c *Client) ExportHistory(secrets bool) (*common.ExportResponse, error) {
+	return invoke[common.ExportResponse](c, common.UPDATE_EXPORT, &common.ExportParams{Secrets: secrets})
+}
+
+// ImportHistory imports a history of downloads exported before, moving
+// them to dir if it isn't empty.
+func (c *Client) ImportHistory(history *warplib.History, dir string) (*common.ImportResponse, error) {
+	return invoke[common.ImportResponse](c, common.UPDATE_IMPORT, &common.ImportParams{History: history, DownloadDirectory: dir})
+}
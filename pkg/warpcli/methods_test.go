@@ -5,6 +5,7 @@ import (
 	"net"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/warpdl/warpdl/common"
 	"github.com/warpdl/warpdl/pkg/warplib"
@@ -98,6 +99,22 @@ func TestClientMethods(t *testing.T) {
 				payload, _ = json.Marshal(common.ExtensionName{Name: "Ext"})
 			case common.UPDATE_LIST_EXT:
 				payload, _ = json.Marshal([]common.ExtensionInfoShort{{Name: "Ext"}})
+			case common.UPDATE_SET:
+				payload, _ = json.Marshal(common.SetResponse{DownloadId: "id", MaxConnections: 8})
+			case common.UPDATE_POLICY_STATUS, common.UPDATE_POLICY_OVERRIDE, common.UPDATE_POLICY_CLEAR:
+				payload, _ = json.Marshal(common.PolicyStatusResponse{Action: "full"})
+			case common.UPDATE_VERIFY:
+				progress, _ := json.Marshal(common.VerifyingResponse{DownloadId: "id", Hashed: 42})
+				update, _ := json.Marshal(Response{
+					Ok:     true,
+					Update: &Update{Type: common.UPDATE_VERIFYING, Message: json.RawMessage(progress)},
+				})
+				_ = write(c2, update)
+				payload, _ = json.Marshal(common.VerifyResponse{Results: []*warplib.VerifyResult{{Hash: "id", Status: warplib.VerifyOK}}})
+			case common.UPDATE_EXPORT:
+				payload, _ = json.Marshal(common.ExportResponse{History: &warplib.History{Version: warplib.HistoryVersion}})
+			case common.UPDATE_IMPORT:
+				payload, _ = json.Marshal(common.ImportResponse{ImportResult: warplib.ImportResult{Imported: 2}})
 			default:
 				payload = []byte(`{}`)
 			}
@@ -124,6 +141,9 @@ func TestClientMethods(t *testing.T) {
 	if ok, err := client.StopDownload("id"); err != nil || !ok {
 		t.Fatalf("StopDownload: %v", err)
 	}
+	if resp, err := client.SetOptions("id", "1MB", 8); err != nil || resp.MaxConnections != 8 {
+		t.Fatalf("SetOptions: %v", err)
+	}
 	if _, err := client.AddExtension("."); err != nil {
 		t.Fatalf("AddExtension: %v", err)
 	}
@@ -142,4 +162,26 @@ func TestClientMethods(t *testing.T) {
 	if _, err := client.ListExtension(true); err != nil {
 		t.Fatalf("ListExtension: %v", err)
 	}
+	if st, err := client.PolicyStatus(); err != nil || st.Action != "full" {
+		t.Fatalf("PolicyStatus: %v", err)
+	}
+	if _, err := client.PolicyOverride("pause", 0, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PolicyOverride: %v", err)
+	}
+	if _, err := client.PolicyClear(); err != nil {
+		t.Fatalf("PolicyClear: %v", err)
+	}
+	var hashed int64
+	resp, err := client.Verify(&common.VerifyParams{DownloadIds: []string{"id"}}, func(v *common.VerifyingResponse) {
+		hashed = v.Hashed
+	})
+	if err != nil || hashed != 42 || len(resp.Results) != 1 || resp.Results[0].Status != warplib.VerifyOK {
+		t.Fatalf("Verify = %+v, %v after %d bytes", resp, err, hashed)
+	}
+	if exp, err := client.ExportHistory(false); err != nil || exp.History == nil || exp.History.Version != warplib.HistoryVersion {
+		t.Fatalf("ExportHistory = %+v, %v", exp, err)
+	}
+	if imp, err := client.ImportHistory(&warplib.History{}, ""); err != nil || imp.Imported != 2 {
+		t.Fatalf("ImportHistory = %+v, %v", imp, err)
+	}
 }
@@ -0,0 +1,100 @@
+package warplib
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// BandwidthLimiter is a daemon-wide bandwidth cap shared by every part of
+// every download. Unlike RateLimitedReader, which throttles a single stream,
+// all readers wrapped by the same BandwidthLimiter draw from one budget, so
+// the aggregate throughput stays under the limit regardless of how many
+// downloads or parts are active.
+//
+// A limit of 0 or negative means unlimited. The limit can be changed at any
+// time with SetLimit and takes effect on the next read of every wrapped reader.
+type BandwidthLimiter struct {
+	mu    sync.Mutex
+	limit int64
+	// next is the earliest instant at which the next byte may be consumed.
+	// Readers reserve time slots by advancing next and sleep until their slot.
+	next time.Time
+}
+
+// NewBandwidthLimiter creates a shared limiter with the given limit in bytes per second.
+// 0 or negative means unlimited.
+func NewBandwidthLimiter(limit int64) *BandwidthLimiter {
+	return &BandwidthLimiter{limit: limit}
+}
+
+// SetLimit updates the shared limit. 0 or negative means unlimited.
+func (b *BandwidthLimiter) SetLimit(limit int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+	// Drop reservations made under the previous limit so a raised limit
+	// (or switching to unlimited) takes effect immediately.
+	b.next = time.Time{}
+}
+
+// GetLimit returns the current shared limit in bytes per second.
+func (b *BandwidthLimiter) GetLimit() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit
+}
+
+// reserve books n bytes against the shared budget and returns how long the
+// caller has to wait before the bytes are considered consumed.
+func (b *BandwidthLimiter) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit <= 0 || n <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(float64(time.Second) * float64(n) / float64(b.limit)))
+	return b.next.Sub(now)
+}
+
+// Wrap returns rc throttled by the shared limiter.
+// If b is nil, rc is returned unchanged.
+func (b *BandwidthLimiter) Wrap(rc io.ReadCloser) io.ReadCloser {
+	if b == nil {
+		return rc
+	}
+	return &bandwidthReadCloser{rc: rc, b: b}
+}
+
+// bandwidthReadCloser charges every read against a shared BandwidthLimiter.
+type bandwidthReadCloser struct {
+	rc io.ReadCloser
+	b  *BandwidthLimiter
+}
+
+func (r *bandwidthReadCloser) Read(p []byte) (n int, err error) {
+	// Never read more than one second worth of data in a single call so a
+	// single reader cannot starve the others.
+	if limit := r.b.GetLimit(); limit > 0 && int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err = r.rc.Read(p)
+	if wait := r.b.reserve(n); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+func (r *bandwidthReadCloser) Close() error {
+	return r.rc.Close()
+}
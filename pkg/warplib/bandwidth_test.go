@@ -0,0 +1,91 @@
+package warplib
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiter_NilIsUnlimited(t *testing.T) {
+	var b *BandwidthLimiter
+	rc := io.NopCloser(bytes.NewReader([]byte("hello")))
+	if got := b.Wrap(rc); got != rc {
+		t.Fatal("nil limiter should return the reader unchanged")
+	}
+	if b.GetLimit() != 0 {
+		t.Fatalf("nil limiter GetLimit() = %d, want 0", b.GetLimit())
+	}
+	b.SetLimit(100) // must not panic
+}
+
+func TestBandwidthLimiter_Unlimited(t *testing.T) {
+	b := NewBandwidthLimiter(0)
+	data := bytes.Repeat([]byte("x"), int(MB))
+	start := time.Now()
+	n, err := io.Copy(io.Discard, b.Wrap(io.NopCloser(bytes.NewReader(data))))
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("copied %d bytes, want %d", n, len(data))
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("unlimited copy took too long: %v", time.Since(start))
+	}
+}
+
+func TestBandwidthLimiter_SharedAcrossReaders(t *testing.T) {
+	// Two readers of 10KB each at 40KB/s shared should take ~500ms total,
+	// whereas independent limiters would take ~250ms.
+	b := NewBandwidthLimiter(40 * KB)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := bytes.Repeat([]byte("x"), int(10*KB))
+			if _, err := io.Copy(io.Discard, b.Wrap(io.NopCloser(bytes.NewReader(data)))); err != nil {
+				t.Errorf("copy: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if elapsed < 400*time.Millisecond {
+		t.Fatalf("shared limiter too fast: %v, want >= 400ms", elapsed)
+	}
+	if elapsed > 2*time.Second {
+		t.Fatalf("shared limiter too slow: %v", elapsed)
+	}
+}
+
+func TestBandwidthLimiter_SetLimitLive(t *testing.T) {
+	b := NewBandwidthLimiter(1 * KB)
+	b.SetLimit(0)
+	if b.GetLimit() != 0 {
+		t.Fatalf("GetLimit() = %d, want 0", b.GetLimit())
+	}
+	data := bytes.Repeat([]byte("x"), int(64*KB))
+	start := time.Now()
+	if _, err := io.Copy(io.Discard, b.Wrap(io.NopCloser(bytes.NewReader(data)))); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("limit change not applied: took %v", time.Since(start))
+	}
+}
+
+func TestManager_GlobalSpeedLimit(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	if m.GetGlobalSpeedLimit() != 0 {
+		t.Fatalf("default global limit = %d, want 0", m.GetGlobalSpeedLimit())
+	}
+	m.SetGlobalSpeedLimit(500 * KB)
+	if m.GetGlobalSpeedLimit() != 500*KB {
+		t.Fatalf("global limit = %d, want %d", m.GetGlobalSpeedLimit(), 500*KB)
+	}
+}
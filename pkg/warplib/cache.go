@@ -0,0 +1,460 @@
+package warplib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CacheFileName is the name of the cache config file inside the
+	// config directory. The cache is enabled by its presence.
+	CacheFileName = "cache.json"
+	// DEF_CACHE_MAX_SIZE is the default size cap of the cache.
+	DEF_CACHE_MAX_SIZE = 10 * GB
+	// cacheIndexName is the index of the cache inside its directory.
+	cacheIndexName = "index.json"
+	// cacheMaxSources is the number of URLs remembered per blob.
+	cacheMaxSources = 8
+)
+
+// CacheConfig is the cache config file:
+//
+//	{"dir": "~/.cache/warpdl", "max_size": 21474836480}
+//
+// Dir defaults to the cache directory inside the config directory and
+// MaxSize, in bytes, to 10GB.
+type CacheConfig struct {
+	Dir     string `json:"dir,omitempty"`
+	MaxSize int64  `json:"max_size,omitempty"`
+}
+
+// LoadCacheConfig reads the cache config file at path. A missing file
+// gives nil, the cache being disabled.
+func LoadCacheConfig(path string) (*CacheConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var cfg CacheConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse cache file %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the size cap and expands the directory, filling in the
+// defaults.
+func (c *CacheConfig) Validate() error {
+	if c.MaxSize < 0 {
+		return errors.New("cache max_size must not be negative")
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = DEF_CACHE_MAX_SIZE
+	}
+	if c.Dir == "" {
+		c.Dir = filepath.Join(ConfigDir, "cache")
+	}
+	dir, err := expandHome(c.Dir)
+	if err != nil {
+		return fmt.Errorf("cache dir: %w", err)
+	}
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("cache dir %q is not absolute", c.Dir)
+	}
+	c.Dir = filepath.Clean(dir)
+	return nil
+}
+
+// CacheSource is a URL a cached file was downloaded from, with the ETag
+// the server sent for it.
+type CacheSource struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag,omitempty"`
+}
+
+// CacheEntry is a file in the cache, stored under its SHA-256.
+type CacheEntry struct {
+	SHA256   string        `json:"sha256"`
+	Size     int64         `json:"size"`
+	Sources  []CacheSource `json:"sources,omitempty"`
+	Added    time.Time     `json:"added"`
+	LastUsed time.Time     `json:"last_used"`
+	// Hits is the number of downloads served from the entry.
+	Hits int `json:"hits"`
+}
+
+// Cache is a content-addressed store of downloaded files. Completed
+// downloads are added to it, and downloads whose SHA-256, or URL and
+// ETag, match a cached file are served from it instead of the network.
+// The least recently used files are evicted beyond its size cap.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+}
+
+// OpenCache opens the cache in the directory of cfg, creating it if
+// needed. Entries whose file is missing are dropped.
+func OpenCache(cfg *CacheConfig) (*Cache, error) {
+	c := &Cache{
+		dir:     cfg.Dir,
+		maxSize: cfg.MaxSize,
+		entries: make(map[string]*CacheEntry),
+	}
+	if err := WarpMkdirAll(filepath.Join(c.dir, "sha256"), 0755); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(c.dir, cacheIndexName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		var entries []*CacheEntry
+		if err := json.Unmarshal(b, &entries); err != nil {
+			return nil, fmt.Errorf("parse cache index: %w", err)
+		}
+		for _, e := range entries {
+			if fi, err := WarpStat(c.blobPath(e.SHA256)); err == nil && fi.Size() == e.Size {
+				c.entries[e.SHA256] = e
+			}
+		}
+	}
+	return c, nil
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// MaxSize returns the size cap of the cache in bytes.
+func (c *Cache) MaxSize() int64 {
+	return c.maxSize
+}
+
+// Entries returns the cached files, most recently used first.
+func (c *Cache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries
+}
+
+// Size returns the total size of the cached files in bytes.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size()
+}
+
+func (c *Cache) size() (n int64) {
+	for _, e := range c.entries {
+		n += e.Size
+	}
+	return
+}
+
+// Prune evicts the least recently used files until the cache holds at
+// most maxSize bytes, returning the evicted entries.
+func (c *Cache) Prune(maxSize int64) ([]CacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := c.evict(maxSize)
+	return removed, c.saveIndex()
+}
+
+// Put adds the file at path, downloaded from rawURL with the given ETag,
+// to the cache. The file is copied into the cache, a hard link would let
+// writes to either change both, then older files are evicted to stay
+// within the size cap.
+func (c *Cache) Put(path, rawURL, etag string) error {
+	sum, size, err := sha256File(path)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	e := c.entries[sum]
+	if e == nil {
+		if size > c.maxSize {
+			return nil
+		}
+		blob := c.blobPath(sum)
+		if err := WarpMkdirAll(filepath.Dir(blob), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(path, blob); err != nil && !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("cache %s: %w", path, err)
+		}
+		e = &CacheEntry{SHA256: sum, Size: size, Added: now}
+		c.entries[sum] = e
+	}
+	e.LastUsed = now
+	e.addSource(normalizeURL(rawURL), etag)
+	c.evict(c.maxSize)
+	return c.saveIndex()
+}
+
+// addSource records a URL of the entry, the latest last.
+func (e *CacheEntry) addSource(rawURL, etag string) {
+	for i, s := range e.Sources {
+		if s.URL == rawURL {
+			e.Sources = append(e.Sources[:i], e.Sources[i+1:]...)
+			break
+		}
+	}
+	e.Sources = append(e.Sources, CacheSource{URL: rawURL, ETag: etag})
+	if len(e.Sources) > cacheMaxSources {
+		e.Sources = e.Sources[len(e.Sources)-cacheMaxSources:]
+	}
+}
+
+// lookup returns the entry with a SHA-256 of checksums, or else with the
+// URL and strong ETag of a download, nil if none.
+func (c *Cache) lookup(checksums []ExpectedChecksum, rawURL, etag string) *CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cs := range checksums {
+		if cs.Algorithm != ChecksumSHA256 {
+			continue
+		}
+		if e := c.entries[hex.EncodeToString(cs.Value)]; e != nil {
+			copied := *e
+			return &copied
+		}
+	}
+	if etag == "" {
+		return nil
+	}
+	u := normalizeURL(rawURL)
+	for _, e := range c.entries {
+		for _, s := range e.Sources {
+			if s.URL == u && s.ETag == etag {
+				copied := *e
+				return &copied
+			}
+		}
+	}
+	return nil
+}
+
+// fetch copies the file of e to dst after checking its SHA-256. A file
+// that no longer matches is evicted.
+func (c *Cache) fetch(e *CacheEntry, dst string) error {
+	blob := c.blobPath(e.SHA256)
+	sum, _, err := sha256File(blob)
+	if err != nil || sum != e.SHA256 {
+		c.mu.Lock()
+		c.remove(e.SHA256)
+		_ = c.saveIndex()
+		c.mu.Unlock()
+		if err == nil {
+			err = fmt.Errorf("cached file %s was modified", e.SHA256)
+		}
+		return err
+	}
+	if err := copyFile(blob, dst); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cur := c.entries[e.SHA256]; cur != nil {
+		cur.LastUsed = time.Now()
+		cur.Hits++
+	}
+	return c.saveIndex()
+}
+
+// evict removes the least recently used entries until the cache holds at
+// most maxSize bytes.
+func (c *Cache) evict(maxSize int64) []CacheEntry {
+	var removed []CacheEntry
+	for size := c.size(); size > maxSize; {
+		var oldest *CacheEntry
+		for _, e := range c.entries {
+			if oldest == nil || e.LastUsed.Before(oldest.LastUsed) {
+				oldest = e
+			}
+		}
+		size -= oldest.Size
+		removed = append(removed, *oldest)
+		c.remove(oldest.SHA256)
+	}
+	return removed
+}
+
+func (c *Cache) remove(sum string) {
+	delete(c.entries, sum)
+	if err := WarpRemove(c.blobPath(sum)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("warplib: warning: failed to remove cached file %s: %v", sum, err)
+	}
+}
+
+// saveIndex writes the index of the cache atomically.
+func (c *Cache) saveIndex() error {
+	entries := make([]*CacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].SHA256 < entries[j].SHA256 })
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.dir, cacheIndexName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return WarpRename(tmp, path)
+}
+
+// blobPath returns the path of the file with the given SHA-256, fanned
+// out by its first byte.
+func (c *Cache) blobPath(sum string) string {
+	if len(sum) < 2 {
+		return filepath.Join(c.dir, "sha256", sum)
+	}
+	return filepath.Join(c.dir, "sha256", sum[:2], sum)
+}
+
+// sha256File returns the hex SHA-256 and the size of the file at path.
+func sha256File(path string) (string, int64, error) {
+	f, err := WarpOpen(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.CopyBuffer(h, f, make([]byte, DEF_CHUNK_SIZE))
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// copyFile copies src to dst through a temporary file renamed into place.
+// dst must not exist.
+func copyFile(src, dst string) error {
+	if _, err := WarpStat(dst); err == nil {
+		return fmt.Errorf("%w: %s", os.ErrExist, dst)
+	}
+	in, err := WarpOpen(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".part"
+	out, err := WarpOpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, DefaultFileMode)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyBuffer(out, in, make([]byte, DEF_CHUNK_SIZE))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = WarpRename(tmp, dst)
+	}
+	if err != nil {
+		_ = WarpRemove(tmp)
+	}
+	return err
+}
+
+// SetCache sets the cache downloads are served from and added to, nil
+// disabling it.
+func (m *Manager) SetCache(c *Cache) {
+	m.cache = c
+}
+
+// GetCache returns the download cache, nil if disabled.
+func (m *Manager) GetCache() *Cache {
+	return m.cache
+}
+
+// cacheDownload adds a completed download to the cache, unless it was
+// served from it. A failure only loses the cached copy.
+func (m *Manager) cacheDownload(item *Item, etag string) {
+	if m.cache == nil {
+		return
+	}
+	if err := m.cache.Put(item.GetAbsolutePath(), item.Url, etag); err != nil {
+		log.Printf("warplib: warning: failed to cache %s: %v", item.Hash, err)
+	}
+}
+
+// fromCache saves the file out of the cache if a cached file matches the
+// SHA-256 the server announced, or the URL and strong ETag, and the
+// length, reporting whether it did. A cache failure falls back to downloading.
+func (d *Downloader) fromCache() (bool, error) {
+	if d.cache == nil {
+		return false, nil
+	}
+	e := d.cache.lookup(d.expectedChecksums, d.url, d.etag)
+	if e == nil {
+		return false, nil
+	}
+	// a length that differs means the cached file is of another version
+	size := d.contentLength.v()
+	if size > 0 && e.Size != size {
+		return false, nil
+	}
+	size = e.Size
+	savePath := d.GetSavePath()
+	if _, err := WarpStat(savePath); err == nil {
+		if !d.overwrite {
+			return false, fmt.Errorf("%w: %s", ErrFileExists, savePath)
+		}
+		if err := WarpRemove(savePath); err != nil {
+			return false, err
+		}
+	}
+	if err := d.cache.fetch(e, savePath); err != nil {
+		d.Log("Cache: %v, downloading instead", err)
+		return false, nil
+	}
+	d.Log("Served from cache (sha256 %s)", e.SHA256)
+	d.cached = true
+	d.nread = size
+	if sum, err := hex.DecodeString(e.SHA256); err == nil {
+		d.handlers.FileHashedHandler([]ExpectedChecksum{{Algorithm: ChecksumSHA256, Value: sum}})
+	}
+	if err := d.verifySignature(); err != nil {
+		return true, d.checksumFailed(err)
+	}
+	d.handlers.DownloadCompleteHandler(MAIN_HASH, size)
+	return true, nil
+}
+
+// isWeakETag reports whether etag is a weak validator, which doesn't
+// promise identical bytes.
+func isWeakETag(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
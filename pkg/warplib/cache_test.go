@@ -0,0 +1,200 @@
+package warplib
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, maxSize int64) *Cache {
+	t.Helper()
+	cfg := &CacheConfig{Dir: t.TempDir(), MaxSize: maxSize}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenCache(cfg)
+	if err != nil {
+		t.Fatalf("OpenCache: %v", err)
+	}
+	return c
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCacheConfig(t *testing.T) {
+	dir := t.TempDir()
+	if cfg, err := LoadCacheConfig(filepath.Join(dir, CacheFileName)); cfg != nil || err != nil {
+		t.Errorf("LoadCacheConfig(missing) = %v, %v, want disabled", cfg, err)
+	}
+	path := writeTestFile(t, dir, CacheFileName, `{}`)
+	cfg, err := LoadCacheConfig(path)
+	if err != nil {
+		t.Fatalf("LoadCacheConfig: %v", err)
+	}
+	if cfg.MaxSize != DEF_CACHE_MAX_SIZE || cfg.Dir != filepath.Join(ConfigDir, "cache") {
+		t.Errorf("defaults = %+v", cfg)
+	}
+	for _, bad := range []string{`{"dir": "relative"}`, `{"max_size": -1}`, `{`} {
+		writeTestFile(t, dir, CacheFileName, bad)
+		if _, err := LoadCacheConfig(path); err == nil {
+			t.Errorf("LoadCacheConfig(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestCachePutLookupPrune(t *testing.T) {
+	c := newTestCache(t, 10)
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "a", "hello")
+	if err := c.Put(a, "https://Example.com/a#x", `"v1"`); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	entries := c.Entries()
+	if len(entries) != 1 || entries[0].Size != 5 || c.Size() != 5 {
+		t.Fatalf("Entries = %+v", entries)
+	}
+	sum := entries[0].SHA256
+	if e := c.lookup(nil, "https://example.com/a", `"v1"`); e == nil || e.SHA256 != sum {
+		t.Errorf("lookup by URL and ETag = %v", e)
+	}
+	if e := c.lookup(nil, "https://example.com/a", `"v2"`); e != nil {
+		t.Errorf("lookup with another ETag = %v, want none", e)
+	}
+	value, _ := hex.DecodeString(sum)
+	cs := ExpectedChecksum{Algorithm: ChecksumSHA256, Value: value}
+	if e := c.lookup([]ExpectedChecksum{cs}, "https://other.org/b", ""); e == nil {
+		t.Error("lookup by sha256 found nothing")
+	}
+
+	dst := filepath.Join(dir, "copy")
+	if err := c.fetch(&entries[0], dst); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if got, _ := os.ReadFile(dst); string(got) != "hello" {
+		t.Errorf("fetched %q", got)
+	}
+	if e := c.Entries()[0]; e.Hits != 1 {
+		t.Errorf("Hits = %d, want 1", e.Hits)
+	}
+
+	// "world" is used last, so adding a third file evicts "hello"
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Put(writeTestFile(t, dir, "b", "world"), "https://example.com/b", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(writeTestFile(t, dir, "c", "!"), "https://example.com/c", ""); err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != 6 || c.lookup(nil, "https://example.com/a", `"v1"`) != nil {
+		t.Errorf("Size = %d after eviction, entries %+v", c.Size(), c.Entries())
+	}
+	if _, err := os.Stat(c.blobPath(sum)); !os.IsNotExist(err) {
+		t.Errorf("evicted file left: %v", err)
+	}
+
+	// the index survives reopening
+	reopened, err := OpenCache(&CacheConfig{Dir: c.Dir(), MaxSize: 10})
+	if err != nil || reopened.Size() != 6 {
+		t.Fatalf("reopened cache = %v, %v", reopened, err)
+	}
+	removed, err := reopened.Prune(0)
+	if err != nil || len(removed) != 2 || reopened.Size() != 0 {
+		t.Errorf("Prune(0) = %d removed, %v", len(removed), err)
+	}
+}
+
+func TestCacheFetchModifiedBlob(t *testing.T) {
+	c := newTestCache(t, MB)
+	dir := t.TempDir()
+	if err := c.Put(writeTestFile(t, dir, "a", "hello"), "https://example.com/a", ""); err != nil {
+		t.Fatal(err)
+	}
+	e := c.Entries()[0]
+	if err := os.WriteFile(c.blobPath(e.SHA256), []byte("jello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.fetch(&e, filepath.Join(dir, "copy")); err == nil {
+		t.Error("fetch of a modified file succeeded")
+	}
+	if len(c.Entries()) != 0 {
+		t.Error("modified file not evicted")
+	}
+}
+
+func TestManagerServesFromCache(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	m.SetCache(newTestCache(t, MB))
+	content := strings.Repeat("cached ", 512)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	download := func(name string) *Downloader {
+		t.Helper()
+		d, err := NewDownloader(&http.Client{}, srv.URL+"/file.txt", &DownloaderOpts{
+			DownloadDirectory: dir,
+			FileName:          name,
+			Handlers:          &Handlers{},
+		})
+		if err != nil {
+			t.Fatalf("NewDownloader: %v", err)
+		}
+		if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir}); err != nil {
+			t.Fatalf("AddDownload: %v", err)
+		}
+		if err := d.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		return d
+	}
+	if d := download("first.txt"); d.cached {
+		t.Error("first download served from the empty cache")
+	}
+	if n := len(m.GetCache().Entries()); n != 1 {
+		t.Fatalf("%d cache entries, want the first download", n)
+	}
+	d := download("second.txt")
+	if !d.cached {
+		t.Error("second download not served from the cache")
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "second.txt"))
+	if err != nil || string(got) != content {
+		t.Fatalf("second file = %d bytes, %v", len(got), err)
+	}
+	item := m.GetItem(d.GetHash())
+	if item.GetDownloaded() != item.GetTotalSize() {
+		t.Errorf("item at %d of %d", item.GetDownloaded(), item.GetTotalSize())
+	}
+	if len(item.Hashes) != 1 || item.Hashes[0].Algorithm != ChecksumSHA256 {
+		t.Errorf("Hashes = %v, want the SHA-256 of the cached file", item.Hashes)
+	}
+	e := m.GetCache().Entries()[0]
+	if e.Hits != 1 {
+		t.Errorf("Hits = %d, want 1", e.Hits)
+	}
+	// the downloads are copies, writing to them leaves the cache intact
+	if err := os.WriteFile(filepath.Join(dir, "second.txt"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if sum, _, err := sha256File(m.GetCache().blobPath(e.SHA256)); err != nil || sum != e.SHA256 {
+		t.Errorf("cached file changed with the download: %s, %v", sum, err)
+	}
+}
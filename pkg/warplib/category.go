@@ -0,0 +1,290 @@
+package warplib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CategoriesFileName is the name of the download categories file inside
+// the config directory.
+const CategoriesFileName = "categories.json"
+
+// Names of the built-in categories.
+const (
+	CategoryVideo     = "Video"
+	CategoryArchives  = "Archives"
+	CategoryISOs      = "ISOs"
+	CategoryDocuments = "Documents"
+)
+
+// Category groups downloads by type. A download belongs to the first
+// category one of whose criteria matches it, and is moved into the
+// directory of its category once complete.
+type Category struct {
+	// Name identifies the category, case-insensitively.
+	Name string `json:"name"`
+	// Dir is the absolute directory completed downloads are moved into,
+	// "~/" expanding to the home directory. Empty leaves them in place.
+	Dir string `json:"dir,omitempty"`
+	// Extensions match the end of the file name, such as ".mkv".
+	Extensions []string `json:"extensions,omitempty"`
+	// MimeTypes match the Content-Type of the response, such as
+	// "application/pdf" or "video/*".
+	MimeTypes []string `json:"mime_types,omitempty"`
+	// Hosts match the host of the download or its subdomains.
+	Hosts []string `json:"hosts,omitempty"`
+	// Regex matches the URL of the download.
+	Regex string `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// defaultCategories returns the built-in categories, which have no
+// directory unless the categories file gives them one.
+func defaultCategories() []Category {
+	return []Category{
+		{
+			Name:       CategoryVideo,
+			Extensions: []string{".mp4", ".mkv", ".webm", ".avi", ".mov", ".m4v", ".wmv", ".flv", ".mpg", ".mpeg"},
+			MimeTypes:  []string{"video/*"},
+		},
+		{
+			Name:       CategoryISOs,
+			Extensions: []string{".iso", ".img", ".dmg"},
+			MimeTypes:  []string{"application/x-iso9660-image", "application/x-apple-diskimage"},
+		},
+		{
+			Name: CategoryArchives,
+			Extensions: []string{".zip", ".rar", ".7z", ".tar", ".gz", ".tgz", ".bz2", ".tbz2", ".xz", ".txz",
+				".zst", ".tzst"},
+			MimeTypes: []string{"application/zip", "application/x-7z-compressed", "application/vnd.rar",
+				"application/x-rar-compressed", "application/x-tar", "application/gzip", "application/x-gzip",
+				"application/x-bzip2", "application/x-xz", "application/zstd"},
+		},
+		{
+			Name: CategoryDocuments,
+			Extensions: []string{".pdf", ".epub", ".doc", ".docx", ".odt", ".rtf", ".txt", ".md", ".xls",
+				".xlsx", ".ods", ".csv", ".ppt", ".pptx", ".odp"},
+			MimeTypes: []string{"application/pdf", "application/epub+zip", "application/msword",
+				"application/vnd.openxmlformats-officedocument.*", "application/vnd.oasis.opendocument.*",
+				"application/vnd.ms-excel", "application/vnd.ms-powerpoint", "application/rtf", "text/plain",
+				"text/markdown", "text/csv"},
+		},
+	}
+}
+
+// matches reports whether a download of name from rawURL, served as
+// contentType, belongs to the category.
+func (c *Category) matches(name, rawURL, contentType string) bool {
+	lname := strings.ToLower(name)
+	for _, ext := range c.Extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if strings.HasSuffix(lname, ext) {
+			return true
+		}
+	}
+	if contentType != "" {
+		for _, mt := range c.MimeTypes {
+			if ok, _ := path.Match(strings.ToLower(mt), strings.ToLower(contentType)); ok {
+				return true
+			}
+		}
+	}
+	if len(c.Hosts) > 0 {
+		if u, err := url.Parse(rawURL); err == nil {
+			host := strings.ToLower(u.Hostname())
+			for _, h := range c.Hosts {
+				h = strings.ToLower(h)
+				if host == h || strings.HasSuffix(host, "."+h) {
+					return true
+				}
+			}
+		}
+	}
+	return c.re != nil && c.re.MatchString(rawURL)
+}
+
+// CategoryConfig is the categories file:
+//
+//	{
+//	  "categories": [
+//	    {"name": "Work", "hosts": ["intranet.example.com"], "dir": "~/Work"},
+//	    {"name": "Video", "dir": "/srv/media"},
+//	    {"name": "Papers", "regex": "arxiv\\.org/pdf/", "dir": "~/Papers"}
+//	  ]
+//	}
+//
+// Categories are tried in order, then the built-in Video, ISOs, Archives
+// and Documents not listed. A listed built-in without criteria keeps its
+// own.
+type CategoryConfig struct {
+	Categories []Category `json:"categories,omitempty"`
+
+	// all are the categories tried, in order.
+	all []Category
+}
+
+// LoadCategoryConfig reads the categories file at path. A missing file
+// gives the built-in categories, without directories.
+func LoadCategoryConfig(path string) (*CategoryConfig, error) {
+	var cfg CategoryConfig
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return nil, fmt.Errorf("parse categories file %s: %w", path, err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the categories, compiles their regexes and expands
+// their directories.
+func (c *CategoryConfig) Validate() error {
+	seen := make(map[string]bool)
+	for i := range c.Categories {
+		cat := &c.Categories[i]
+		key := strings.ToLower(cat.Name)
+		if key == "" {
+			return fmt.Errorf("category %d: missing name", i+1)
+		}
+		if seen[key] {
+			return fmt.Errorf("category %q: duplicate name", cat.Name)
+		}
+		seen[key] = true
+		if cat.Regex != "" {
+			re, err := regexp.Compile(cat.Regex)
+			if err != nil {
+				return fmt.Errorf("category %q: invalid regex: %w", cat.Name, err)
+			}
+			cat.re = re
+		}
+		if cat.Dir != "" {
+			dir, err := expandHome(cat.Dir)
+			if err != nil {
+				return fmt.Errorf("category %q: %w", cat.Name, err)
+			}
+			if !filepath.IsAbs(dir) {
+				return fmt.Errorf("category %q: dir %q is not absolute", cat.Name, cat.Dir)
+			}
+			cat.Dir = filepath.Clean(dir)
+		}
+	}
+	c.all = mergeCategories(c.Categories)
+	return nil
+}
+
+// mergeCategories returns the configured categories followed by the
+// built-in ones not configured, configured built-ins without criteria
+// taking the built-in ones.
+func mergeCategories(configured []Category) []Category {
+	builtin := defaultCategories()
+	all := make([]Category, 0, len(configured)+len(builtin))
+	for _, cat := range configured {
+		for i, b := range builtin {
+			if !strings.EqualFold(b.Name, cat.Name) {
+				continue
+			}
+			if len(cat.Extensions) == 0 && len(cat.MimeTypes) == 0 && len(cat.Hosts) == 0 && cat.re == nil {
+				cat.Name, cat.Extensions, cat.MimeTypes = b.Name, b.Extensions, b.MimeTypes
+			}
+			builtin = append(builtin[:i], builtin[i+1:]...)
+			break
+		}
+		all = append(all, cat)
+	}
+	return append(all, builtin...)
+}
+
+// expandHome replaces a leading "~/" of p with the home directory.
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(p[1:], "/")), nil
+}
+
+// categories returns the categories tried, the built-in ones if no file
+// was loaded.
+func (c *CategoryConfig) categories() []Category {
+	if c == nil || c.all == nil {
+		return defaultCategories()
+	}
+	return c.all
+}
+
+// match returns the name of the category of a download, empty if none.
+func (c *CategoryConfig) match(name, rawURL, contentType string) string {
+	for _, cat := range c.categories() {
+		if cat.matches(name, rawURL, contentType) {
+			return cat.Name
+		}
+	}
+	return ""
+}
+
+// dir returns the directory of the category named name, empty if it has
+// none.
+func (c *CategoryConfig) dir(name string) string {
+	if name == "" {
+		return ""
+	}
+	for _, cat := range c.categories() {
+		if strings.EqualFold(cat.Name, name) {
+			return cat.Dir
+		}
+	}
+	return ""
+}
+
+// SetCategoryConfig sets the categories of the downloads added or
+// completed from now on.
+func (m *Manager) SetCategoryConfig(cfg *CategoryConfig) {
+	m.categories = cfg
+}
+
+// categorizeDownload moves a completed download into the directory of its
+// category, if it has one and the download is elsewhere. The item keeps
+// its path if the move fails.
+func (m *Manager) categorizeDownload(item *Item) error {
+	dir := m.categories.dir(item.Category)
+	if dir == "" || filepath.Clean(item.AbsoluteLocation) == dir {
+		return nil
+	}
+	src := item.GetAbsolutePath()
+	dst := GetPath(dir, item.Name)
+	if err := WarpMkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("move to category %s: %w", item.Category, err)
+	}
+	if _, err := WarpStat(dst); err == nil {
+		return fmt.Errorf("move to category %s: %s: %w", item.Category, dst, ErrFileExists)
+	}
+	if err := moveFile(src, dst); err != nil {
+		return fmt.Errorf("move to category %s: %w", item.Category, err)
+	}
+	item.mu.Lock()
+	item.DownloadLocation = dir
+	item.AbsoluteLocation = dir
+	item.mu.Unlock()
+	m.UpdateItem(item)
+	return nil
+}
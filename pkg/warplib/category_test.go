@@ -0,0 +1,128 @@
+package warplib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCategoryConfig_Match(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, CategoriesFileName)
+	data := `{"categories":[
+		{"name":"Work","hosts":["intranet.example.com"],"dir":"` + filepath.ToSlash(dir) + `/work"},
+		{"name":"Papers","regex":"arxiv\\.org/pdf/"},
+		{"name":"video","dir":"` + filepath.ToSlash(dir) + `/media"}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadCategoryConfig(path)
+	if err != nil {
+		t.Fatalf("LoadCategoryConfig: %v", err)
+	}
+	tests := []struct {
+		name, url, contentType, want string
+	}{
+		{"talk.MKV", "https://cdn.example.org/talk.MKV", "", "Video"},
+		{"stream", "https://cdn.example.org/stream", "video/mp4", "Video"},
+		{"report.mkv", "https://docs.intranet.example.com/report.mkv", "", "Work"},
+		{"2401.00001", "https://arxiv.org/pdf/2401.00001", "application/pdf", "Papers"},
+		{"debian.iso", "https://cdimage.debian.org/debian.iso", "", CategoryISOs},
+		{"src.tar.gz", "https://example.org/src.tar.gz", "", CategoryArchives},
+		{"spec", "https://example.org/spec", "application/vnd.oasis.opendocument.text", CategoryDocuments},
+		{"tool.exe", "https://example.org/tool.exe", "application/octet-stream", ""},
+	}
+	for _, tt := range tests {
+		if got := cfg.match(tt.name, tt.url, tt.contentType); got != tt.want {
+			t.Errorf("match(%s, %s, %s) = %q, want %q", tt.name, tt.url, tt.contentType, got, tt.want)
+		}
+	}
+	if got := cfg.dir("VIDEO"); got != filepath.Join(dir, "media") {
+		t.Errorf("dir(VIDEO) = %q", got)
+	}
+	if got := cfg.dir(CategoryArchives); got != "" {
+		t.Errorf("dir(Archives) = %q, want none", got)
+	}
+
+	// without a file the built-in categories still apply
+	var none *CategoryConfig
+	if got := none.match("movie.webm", "https://example.org/movie.webm", ""); got != CategoryVideo {
+		t.Errorf("nil config match = %q", got)
+	}
+}
+
+func TestLoadCategoryConfig_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CategoriesFileName)
+	if cfg, err := LoadCategoryConfig(path); err != nil || len(cfg.categories()) != 4 {
+		t.Fatalf("LoadCategoryConfig(missing) = %+v, %v", cfg, err)
+	}
+	for _, bad := range []string{
+		`{`,
+		`{"categories":[{"dir":"/tmp"}]}`,
+		`{"categories":[{"name":"a"},{"name":"A"}]}`,
+		`{"categories":[{"name":"a","regex":"("}]}`,
+		`{"categories":[{"name":"a","dir":"relative/dir"}]}`,
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadCategoryConfig(path); err == nil {
+			t.Errorf("LoadCategoryConfig(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestManagerMovesCompletedDownloadToCategory(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	content := []byte("%PDF-1.7 not really")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf; charset=binary")
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	target := filepath.Join(t.TempDir(), "docs")
+	cfg := &CategoryConfig{Categories: []Category{{Name: "documents", Dir: target}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	m.SetCategoryConfig(cfg)
+
+	dir := t.TempDir()
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/paper", &DownloaderOpts{
+		DownloadDirectory: dir,
+		FileName:          "paper",
+		Handlers:          &Handlers{},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if d.GetContentType() != "application/pdf" {
+		t.Errorf("GetContentType = %q", d.GetContentType())
+	}
+	if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	item := m.GetItem(d.GetHash())
+	if item.Category != CategoryDocuments {
+		t.Errorf("Category = %q, want %q", item.Category, CategoryDocuments)
+	}
+	if item.AbsoluteLocation != target || item.GetAbsolutePath() != filepath.Join(target, "paper") {
+		t.Errorf("item at %s, want in %s", item.GetAbsolutePath(), target)
+	}
+	got, err := os.ReadFile(filepath.Join(target, "paper"))
+	if err != nil || string(got) != string(content) {
+		t.Fatalf("moved file = %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "paper")); !os.IsNotExist(err) {
+		t.Errorf("file left in the download directory: %v", err)
+	}
+}
@@ -2,13 +2,19 @@ package warplib
 
 import (
 	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"hash"
+	"hash/crc32"
 	"net/http"
 	"strings"
+
+	"github.com/zeebo/blake3"
+	"golang.org/x/crypto/blake2b"
 )
 
 // ChecksumAlgorithm represents supported hash algorithms
@@ -16,14 +22,75 @@ type ChecksumAlgorithm string
 
 const (
 	ChecksumMD5    ChecksumAlgorithm = "md5"
+	ChecksumSHA1   ChecksumAlgorithm = "sha1"
 	ChecksumSHA256 ChecksumAlgorithm = "sha256"
+	ChecksumSHA384 ChecksumAlgorithm = "sha384"
 	ChecksumSHA512 ChecksumAlgorithm = "sha512"
+	// ChecksumBLAKE2b is BLAKE2b-512.
+	ChecksumBLAKE2b ChecksumAlgorithm = "blake2b"
+	// ChecksumBLAKE3 is BLAKE3 with its default 256-bit output.
+	ChecksumBLAKE3 ChecksumAlgorithm = "blake3"
+	// ChecksumCRC32 is the IEEE CRC-32, big-endian.
+	ChecksumCRC32 ChecksumAlgorithm = "crc32"
+	// ChecksumCRC32C is the Castagnoli CRC-32, big-endian, as used by
+	// Google Cloud Storage and S3.
+	ChecksumCRC32C ChecksumAlgorithm = "crc32c"
 )
 
+// checksumAlgorithms are the supported algorithms, strongest first.
+var checksumAlgorithms = []ChecksumAlgorithm{
+	ChecksumSHA512,
+	ChecksumBLAKE2b,
+	ChecksumSHA384,
+	ChecksumBLAKE3,
+	ChecksumSHA256,
+	ChecksumSHA1,
+	ChecksumMD5,
+	ChecksumCRC32C,
+	ChecksumCRC32,
+}
+
 // ExpectedChecksum contains the expected hash value and algorithm
 type ExpectedChecksum struct {
-	Algorithm ChecksumAlgorithm
-	Value     []byte // raw bytes (decoded from base64)
+	Algorithm ChecksumAlgorithm `json:"algorithm"`
+	Value     []byte            `json:"value"` // raw bytes (decoded from base64)
+}
+
+// String returns the checksum as "algorithm:hex".
+func (c ExpectedChecksum) String() string {
+	return string(c.Algorithm) + ":" + hex.EncodeToString(c.Value)
+}
+
+// ParseChecksum parses a checksum given as "algorithm:hex", such as
+// "sha256:9f86d0...". The algorithm is one of those NewHasher supports.
+func ParseChecksum(s string) (ExpectedChecksum, error) {
+	algo, value, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return ExpectedChecksum{}, fmt.Errorf("invalid checksum %q: want algorithm:hex", s)
+	}
+	cs := ExpectedChecksum{Algorithm: ChecksumAlgorithm(strings.ToLower(algo))}
+	h, err := NewHasher(cs.Algorithm)
+	if err != nil {
+		return ExpectedChecksum{}, fmt.Errorf("invalid checksum %q: %w", s, err)
+	}
+	cs.Value, err = hex.DecodeString(value)
+	if err != nil || len(cs.Value) != h.Size() {
+		return ExpectedChecksum{}, fmt.Errorf("invalid checksum %q: want %d hex digits", s, 2*h.Size())
+	}
+	return cs, nil
+}
+
+// ParseChecksums parses checksums given as "algorithm:hex".
+func ParseChecksums(ss []string) ([]ExpectedChecksum, error) {
+	var checksums []ExpectedChecksum
+	for _, s := range ss {
+		cs, err := ParseChecksum(s)
+		if err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, cs)
+	}
+	return checksums, nil
 }
 
 // ChecksumResult contains the result of checksum validation
@@ -34,10 +101,42 @@ type ChecksumResult struct {
 	Match     bool
 }
 
+// ChecksumMismatchAction is what is done with a downloaded file that
+// fails its checksum.
+type ChecksumMismatchAction string
+
+const (
+	// ChecksumMismatchFail fails the download, leaving the file in place.
+	ChecksumMismatchFail ChecksumMismatchAction = "fail"
+	// ChecksumMismatchQuarantine fails the download and moves the file to
+	// the quarantine directory.
+	ChecksumMismatchQuarantine ChecksumMismatchAction = "quarantine"
+	// ChecksumMismatchDelete fails the download and deletes the file.
+	ChecksumMismatchDelete ChecksumMismatchAction = "delete"
+)
+
+// ParseChecksumMismatchAction parses a checksum mismatch action, empty
+// meaning fail.
+func ParseChecksumMismatchAction(s string) (ChecksumMismatchAction, error) {
+	switch a := ChecksumMismatchAction(strings.ToLower(strings.TrimSpace(s))); a {
+	case "":
+		return ChecksumMismatchFail, nil
+	case ChecksumMismatchFail, ChecksumMismatchQuarantine, ChecksumMismatchDelete:
+		return a, nil
+	}
+	return "", fmt.Errorf("invalid checksum mismatch action %q (want fail, quarantine or delete)", s)
+}
+
 // ChecksumConfig configures checksum validation behavior
 type ChecksumConfig struct {
 	Enabled        bool
 	FailOnMismatch bool
+	// OnMismatch is what is done with the file when FailOnMismatch is
+	// set, empty meaning ChecksumMismatchFail.
+	OnMismatch ChecksumMismatchAction
+	// Sidecars are checksum file patterns tried before
+	// DefaultChecksumSidecars when discovering checksums.
+	Sidecars []string
 }
 
 // NewHasher creates a hash.Hash for the specified algorithm
@@ -45,10 +144,22 @@ func NewHasher(algo ChecksumAlgorithm) (hash.Hash, error) {
 	switch algo {
 	case ChecksumMD5:
 		return md5.New(), nil
+	case ChecksumSHA1:
+		return sha1.New(), nil
 	case ChecksumSHA256:
 		return sha256.New(), nil
+	case ChecksumSHA384:
+		return sha512.New384(), nil
 	case ChecksumSHA512:
 		return sha512.New(), nil
+	case ChecksumBLAKE2b:
+		return blake2b.New512(nil)
+	case ChecksumBLAKE3:
+		return blake3.New(), nil
+	case ChecksumCRC32:
+		return crc32.NewIEEE(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
 	default:
 		return nil, fmt.Errorf("unsupported checksum algorithm: %s", algo)
 	}
@@ -81,15 +192,8 @@ func ParseDigestHeader(header string) ([]ExpectedChecksum, error) {
 		}
 
 		// Map RFC 3230 algorithm names to our types
-		var algo ChecksumAlgorithm
-		switch strings.ToLower(algoStr) {
-		case "md5":
-			algo = ChecksumMD5
-		case "sha-256":
-			algo = ChecksumSHA256
-		case "sha-512":
-			algo = ChecksumSHA512
-		default:
+		algo, ok := digestAlgorithms[strings.ToLower(algoStr)]
+		if !ok {
 			// Skip unsupported algorithms
 			continue
 		}
@@ -113,6 +217,99 @@ func ParseDigestHeader(header string) ([]ExpectedChecksum, error) {
 	return checksums, nil
 }
 
+// ParseStructuredDigestHeader parses RFC 9530 Repr-Digest and
+// Content-Digest headers
+// Format: "sha-256=:BASE64:, sha-512=:BASE64:"
+func ParseStructuredDigestHeader(header string) ([]ExpectedChecksum, error) {
+	if header == "" {
+		return nil, fmt.Errorf("empty digest header")
+	}
+
+	var checksums []ExpectedChecksum
+	for _, part := range strings.Split(header, ",") {
+		algoStr, valueStr, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid digest format: missing '=' in %q", part)
+		}
+		// Values are structured field byte sequences, wrapped in colons
+		valueStr = strings.TrimSpace(valueStr)
+		if len(valueStr) < 2 || valueStr[0] != ':' || valueStr[len(valueStr)-1] != ':' {
+			return nil, fmt.Errorf("invalid digest format: %q is not a byte sequence", part)
+		}
+		algo, ok := digestAlgorithms[strings.ToLower(strings.TrimSpace(algoStr))]
+		if !ok {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(valueStr[1 : len(valueStr)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 in digest: %w", err)
+		}
+		checksums = append(checksums, ExpectedChecksum{Algorithm: algo, Value: value})
+	}
+
+	if len(checksums) == 0 {
+		return nil, fmt.Errorf("no supported algorithms found in digest header")
+	}
+	return checksums, nil
+}
+
+// digestAlgorithms maps the algorithm names of the IANA HTTP digest
+// registries (RFC 3230, RFC 9530) to our types.
+var digestAlgorithms = map[string]ChecksumAlgorithm{
+	"md5":     ChecksumMD5,
+	"sha":     ChecksumSHA1,
+	"sha-256": ChecksumSHA256,
+	"sha-384": ChecksumSHA384,
+	"sha-512": ChecksumSHA512,
+	"crc32c":  ChecksumCRC32C,
+}
+
+// ParseGoogHashHeader parses the x-goog-hash header of Google Cloud
+// Storage
+// Format: "crc32c=BASE64,md5=BASE64", possibly split across headers
+func ParseGoogHashHeader(values []string) ([]ExpectedChecksum, error) {
+	var checksums []ExpectedChecksum
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			algoStr, valueStr, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid x-goog-hash format: missing '=' in %q", part)
+			}
+			var algo ChecksumAlgorithm
+			switch strings.ToLower(algoStr) {
+			case "crc32c":
+				algo = ChecksumCRC32C
+			case "md5":
+				algo = ChecksumMD5
+			default:
+				continue
+			}
+			value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(valueStr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 in x-goog-hash: %w", err)
+			}
+			checksums = append(checksums, ExpectedChecksum{Algorithm: algo, Value: value})
+		}
+	}
+
+	if len(checksums) == 0 {
+		return nil, fmt.Errorf("no supported algorithms found in x-goog-hash header")
+	}
+	return checksums, nil
+}
+
+// amzChecksumHeaders maps the x-amz-checksum-* headers of S3 to our
+// types. Their values are base64 encoded.
+var amzChecksumHeaders = []struct {
+	header string
+	algo   ChecksumAlgorithm
+}{
+	{"X-Amz-Checksum-Sha256", ChecksumSHA256},
+	{"X-Amz-Checksum-Sha1", ChecksumSHA1},
+	{"X-Amz-Checksum-Crc32c", ChecksumCRC32C},
+	{"X-Amz-Checksum-Crc32", ChecksumCRC32},
+}
+
 // ParseContentMD5Header parses RFC 2616 Content-MD5 header
 // Format: Base64-encoded MD5
 func ParseContentMD5Header(header string) (*ExpectedChecksum, error) {
@@ -132,11 +329,24 @@ func ParseContentMD5Header(header string) (*ExpectedChecksum, error) {
 }
 
 // ExtractChecksums extracts checksums from HTTP headers
-// Checks both Digest and Content-MD5 headers
+// Checks the Repr-Digest, Content-Digest, Digest, Content-MD5,
+// x-goog-hash and x-amz-checksum-* headers
 func ExtractChecksums(h http.Header) []ExpectedChecksum {
 	var checksums []ExpectedChecksum
 
-	// Try Digest header first (RFC 3230)
+	// RFC 9530 digests are of the encoded content, which the file isn't
+	// when the transport decodes it
+	if ce := h.Get("Content-Encoding"); ce == "" || strings.EqualFold(ce, "identity") {
+		for _, name := range []string{"Repr-Digest", "Content-Digest"} {
+			if digest := h.Get(name); digest != "" {
+				if parsed, err := ParseStructuredDigestHeader(digest); err == nil {
+					checksums = append(checksums, parsed...)
+				}
+			}
+		}
+	}
+
+	// Try Digest header (RFC 3230)
 	if digest := h.Get("Digest"); digest != "" {
 		if parsed, err := ParseDigestHeader(digest); err == nil {
 			checksums = append(checksums, parsed...)
@@ -150,7 +360,51 @@ func ExtractChecksums(h http.Header) []ExpectedChecksum {
 		}
 	}
 
-	return checksums
+	// Cloud storage hashes
+	if values := h.Values("X-Goog-Hash"); len(values) > 0 {
+		if parsed, err := ParseGoogHashHeader(values); err == nil {
+			checksums = append(checksums, parsed...)
+		}
+	}
+	for _, amz := range amzChecksumHeaders {
+		// composite checksums of multipart uploads end in "-N" and
+		// aren't of the whole file
+		v := h.Get(amz.header)
+		if v == "" || strings.Contains(v, "-") {
+			continue
+		}
+		if value, err := base64.StdEncoding.DecodeString(v); err == nil {
+			checksums = append(checksums, ExpectedChecksum{Algorithm: amz.algo, Value: value})
+		}
+	}
+
+	return dedupeChecksums(checksums)
+}
+
+// dedupeChecksums drops the checksums of an algorithm already given,
+// keeping the first one.
+func dedupeChecksums(checksums []ExpectedChecksum) []ExpectedChecksum {
+	seen := make(map[ChecksumAlgorithm]bool, len(checksums))
+	out := checksums[:0]
+	for _, cs := range checksums {
+		if !seen[cs.Algorithm] {
+			seen[cs.Algorithm] = true
+			out = append(out, cs)
+		}
+	}
+	return out
+}
+
+// SetChecksumConfig sets the checksum validation config of the downloads
+// added or resumed from now on, nil meaning DefaultChecksumConfig.
+func (m *Manager) SetChecksumConfig(cfg *ChecksumConfig) {
+	m.checksum = cfg
+}
+
+// GetChecksumConfig returns the checksum validation config of the
+// manager, nil if none was set.
+func (m *Manager) GetChecksumConfig() *ChecksumConfig {
+	return m.checksum
 }
 
 // DefaultChecksumConfig returns the default checksum configuration
@@ -162,33 +416,110 @@ func DefaultChecksumConfig() ChecksumConfig {
 }
 
 // SelectBestAlgorithm returns the strongest algorithm from the list
-// Priority: SHA-512 > SHA-256 > MD5
+// Priority: SHA-512 > BLAKE2b > SHA-384 > BLAKE3 > SHA-256 > SHA-1 > MD5
+// > CRC32C > CRC32
 func SelectBestAlgorithm(checksums []ExpectedChecksum) ChecksumAlgorithm {
 	if len(checksums) == 0 {
 		return ""
 	}
 
-	// Check for SHA-512 first (strongest)
-	for _, c := range checksums {
-		if c.Algorithm == ChecksumSHA512 {
-			return ChecksumSHA512
+	for _, algo := range checksumAlgorithms {
+		for _, c := range checksums {
+			if c.Algorithm == algo {
+				return algo
+			}
 		}
 	}
 
-	// Check for SHA-256 next
-	for _, c := range checksums {
-		if c.Algorithm == ChecksumSHA256 {
-			return ChecksumSHA256
+	// Return first algorithm if none of the above matched
+	return checksums[0].Algorithm
+}
+
+// MultiHasher computes the checksums of several algorithms in a single
+// pass over the data.
+type MultiHasher struct {
+	algos  []ChecksumAlgorithm
+	hashes []hash.Hash
+}
+
+// NewMultiHasher returns a MultiHasher of the given algorithms, each
+// hashed once.
+func NewMultiHasher(algos ...ChecksumAlgorithm) (*MultiHasher, error) {
+	m := &MultiHasher{}
+	for _, algo := range algos {
+		if m.Has(algo) {
+			continue
+		}
+		h, err := NewHasher(algo)
+		if err != nil {
+			return nil, err
 		}
+		m.algos = append(m.algos, algo)
+		m.hashes = append(m.hashes, h)
 	}
+	return m, nil
+}
 
-	// Fall back to MD5 or first available
-	for _, c := range checksums {
-		if c.Algorithm == ChecksumMD5 {
-			return ChecksumMD5
-		}
+// Write adds p to all the hashes.
+func (m *MultiHasher) Write(p []byte) (int, error) {
+	for _, h := range m.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// Reset resets all the hashes.
+func (m *MultiHasher) Reset() {
+	for _, h := range m.hashes {
+		h.Reset()
 	}
+}
 
-	// Return first algorithm if none of the above matched
-	return checksums[0].Algorithm
+// Has reports whether algo is hashed.
+func (m *MultiHasher) Has(algo ChecksumAlgorithm) bool {
+	return m.index(algo) >= 0
+}
+
+// Algorithms returns the algorithms hashed.
+func (m *MultiHasher) Algorithms() []ChecksumAlgorithm {
+	return m.algos
+}
+
+// Sum returns the hash of algo of the data written so far, nil if algo
+// isn't hashed.
+func (m *MultiHasher) Sum(algo ChecksumAlgorithm) []byte {
+	i := m.index(algo)
+	if i < 0 {
+		return nil
+	}
+	return m.hashes[i].Sum(nil)
+}
+
+// Sums returns the checksums of the data written so far, one per
+// algorithm.
+func (m *MultiHasher) Sums() []ExpectedChecksum {
+	sums := make([]ExpectedChecksum, len(m.hashes))
+	for i, h := range m.hashes {
+		sums[i] = ExpectedChecksum{Algorithm: m.algos[i], Value: h.Sum(nil)}
+	}
+	return sums
+}
+
+// String returns the algorithms hashed, comma-separated.
+func (m *MultiHasher) String() string {
+	names := make([]string, len(m.algos))
+	for i, a := range m.algos {
+		names[i] = string(a)
+	}
+	return strings.Join(names, ", ")
+}
+
+// index returns the position of algo in the hashes, -1 if not hashed.
+func (m *MultiHasher) index(algo ChecksumAlgorithm) int {
+	for i, a := range m.algos {
+		if a == algo {
+			return i
+		}
+	}
+	return -1
 }
@@ -0,0 +1,220 @@
+package warplib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ChecksumAuto, given in place of a checksum, looks the expected checksum
+// up in the checksum files published next to the download.
+const ChecksumAuto = "auto"
+
+// maxChecksumFileSize is the size of the checksum files read at most.
+const maxChecksumFileSize = 1 * MB
+
+// DefaultChecksumSidecars are the checksum files looked for next to a
+// download with ChecksumAuto, in order. {url} is the URL of the download
+// without its query, {dir} the URL of its directory and {name} its file
+// name.
+var DefaultChecksumSidecars = []string{
+	"{url}.sha512",
+	"{url}.sha256",
+	"{url}.md5",
+	"{url}.sha256sum",
+	"{url}.md5sum",
+	"{dir}/SHA512SUMS",
+	"{dir}/SHA256SUMS",
+	"{dir}/MD5SUMS",
+	"{dir}/sha256sums.txt",
+	"{dir}/checksums.txt",
+}
+
+// ParseChecksumArgs parses checksums given as "algorithm:hex", reporting
+// whether ChecksumAuto was given among them.
+func ParseChecksumArgs(ss []string) (checksums []ExpectedChecksum, auto bool, err error) {
+	var explicit []string
+	for _, s := range ss {
+		if strings.EqualFold(strings.TrimSpace(s), ChecksumAuto) {
+			auto = true
+			continue
+		}
+		explicit = append(explicit, s)
+	}
+	checksums, err = ParseChecksums(explicit)
+	return
+}
+
+// ParseChecksumFile returns the checksum of the file called name in a
+// checksum file. It reads the GNU coreutils format ("HEX  name", "HEX
+// *name") and the BSD one ("SHA256 (name) = HEX"). A file holding a
+// single checksum without a name, as sidecar files often do, matches any
+// name. The algorithm is told by the BSD tag or the length of the hash.
+func ParseChecksumFile(data []byte, name string) (ExpectedChecksum, bool) {
+	var (
+		found   ExpectedChecksum
+		ok      bool
+		entries int
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		algo, sum, file := parseChecksumLine(line)
+		if sum == "" {
+			continue
+		}
+		entries++
+		cs, valid := newExpectedChecksum(algo, sum)
+		if !valid {
+			continue
+		}
+		if file == "" {
+			if !ok {
+				found, ok = cs, true
+			}
+			continue
+		}
+		if checksumFileName(file) == name {
+			return cs, true
+		}
+	}
+	// a nameless checksum only counts when it is the only entry
+	if ok && entries == 1 {
+		return found, true
+	}
+	return ExpectedChecksum{}, false
+}
+
+// parseChecksumLine splits a checksum file line into its algorithm, if
+// the BSD format tells it, its hex hash and its file name.
+func parseChecksumLine(line string) (algo ChecksumAlgorithm, sum, file string) {
+	// BSD: "SHA256 (name) = HEX"
+	if tag, rest, found := strings.Cut(line, " ("); found {
+		if name, hash, found := strings.Cut(rest, ") = "); found && !strings.ContainsAny(tag, " \t") {
+			algo = ChecksumAlgorithm(strings.ToLower(strings.ReplaceAll(tag, "-", "")))
+			return algo, strings.TrimSpace(hash), name
+		}
+	}
+	// GNU: "HEX  name" or "HEX *name", or the hash alone
+	sum, file, _ = strings.Cut(line, " ")
+	sum = strings.TrimPrefix(sum, "\\")
+	file = strings.TrimPrefix(strings.TrimLeft(file, " "), "*")
+	return "", sum, file
+}
+
+// newExpectedChecksum decodes a hex hash of the algorithm, told by its
+// length when empty. Unsupported algorithms are rejected.
+func newExpectedChecksum(algo ChecksumAlgorithm, sum string) (ExpectedChecksum, bool) {
+	value, err := hex.DecodeString(sum)
+	if err != nil {
+		return ExpectedChecksum{}, false
+	}
+	if algo == "" {
+		switch len(value) {
+		case 16:
+			algo = ChecksumMD5
+		case 20:
+			algo = ChecksumSHA1
+		case 32:
+			algo = ChecksumSHA256
+		case 48:
+			algo = ChecksumSHA384
+		case 64:
+			algo = ChecksumSHA512
+		}
+	}
+	h, err := NewHasher(algo)
+	if err != nil || h.Size() != len(value) {
+		return ExpectedChecksum{}, false
+	}
+	return ExpectedChecksum{Algorithm: algo, Value: value}, true
+}
+
+// checksumFileName returns the base name of a file listed in a checksum
+// file, which may be a relative path.
+func checksumFileName(file string) string {
+	return path.Base(strings.ReplaceAll(strings.TrimSpace(file), "\\", "/"))
+}
+
+// sidecarURLs expands the checksum file patterns for the download at
+// rawURL saved as name.
+func sidecarURLs(patterns []string, rawURL, name string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	u.RawQuery, u.Fragment, u.RawFragment = "", "", ""
+	file := u.String()
+	dir := strings.TrimSuffix(file, "/")
+	if i := strings.LastIndex(dir, "/"); i > len(u.Scheme)+len("://") {
+		dir = dir[:i]
+	}
+	r := strings.NewReplacer("{url}", file, "{dir}", dir, "{name}", url.PathEscape(name))
+	urls := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		urls = append(urls, r.Replace(p))
+	}
+	return urls
+}
+
+// findChecksums looks for the checksum of the file at rawURL in the
+// checksum files published next to it, trying the configured patterns
+// before the built-in ones. It returns the checksum found, if any, and
+// the URL of the checksum file.
+func (d *Downloader) findChecksums(rawURL string) ([]ExpectedChecksum, string) {
+	patterns := DefaultChecksumSidecars
+	if d.checksumConfig != nil && len(d.checksumConfig.Sidecars) > 0 {
+		patterns = append(append([]string{}, d.checksumConfig.Sidecars...), DefaultChecksumSidecars...)
+	}
+	names := []string{d.fileName}
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := path.Base(u.Path); base != d.fileName && base != "/" && base != "." {
+			names = append(names, base)
+		}
+	}
+	for _, sidecar := range sidecarURLs(patterns, rawURL, d.fileName) {
+		data, err := d.fetchSidecar(rawURL, sidecar, maxChecksumFileSize)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if cs, ok := ParseChecksumFile(data, name); ok {
+				return []ExpectedChecksum{cs}, sidecar
+			}
+		}
+	}
+	return nil, ""
+}
+
+// fetchSidecar downloads the file at sidecar published next to the
+// download at rawURL, up to limit bytes, sending the headers of the
+// download only to its origin.
+func (d *Downloader) fetchSidecar(rawURL, sidecar string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodGet, sidecar, nil)
+	if err != nil {
+		return nil, err
+	}
+	headers := d.headers
+	if orig, err := url.Parse(rawURL); err != nil || isCrossOrigin(orig, req.URL) {
+		headers = StripUnsafeFromHeaders(headers)
+	}
+	headers.Set(req.Header)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", sidecar, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
@@ -0,0 +1,132 @@
+package warplib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksumArgs(t *testing.T) {
+	cs, auto, err := ParseChecksumArgs([]string{"AUTO", "md5:5d41402abc4b2a76b9719d911017c592"})
+	if err != nil || !auto || len(cs) != 1 || cs[0].Algorithm != ChecksumMD5 {
+		t.Errorf("ParseChecksumArgs = %v, %v, %v", cs, auto, err)
+	}
+	if _, _, err := ParseChecksumArgs([]string{"auto", "crc64:1234"}); err == nil {
+		t.Error("ParseChecksumArgs(crc64) succeeded")
+	}
+}
+
+func TestParseChecksumFile(t *testing.T) {
+	sha := strings.Repeat("ab", 32)
+	md5 := strings.Repeat("cd", 16)
+	tests := []struct {
+		name, data string
+		want       string
+		ok         bool
+	}{
+		{"gnu", "# release\n" + strings.Repeat("11", 32) + "  other.iso\n" + sha + "  file.iso\n", "sha256:" + sha, true},
+		{"gnu binary", sha + " *dist/file.iso\n", "sha256:" + sha, true},
+		{"bsd", "SHA256 (other.iso) = " + strings.Repeat("11", 32) + "\nMD5 (file.iso) = " + md5 + "\n", "md5:" + md5, true},
+		{"bsd dash", "SHA-256 (file.iso) = " + sha, "sha256:" + sha, true},
+		{"bare", sha + "\n", "sha256:" + sha, true},
+		{"not listed", sha + "  other.iso\n", "", false},
+		{"bad length", strings.Repeat("ab", 24) + "  file.iso\n", "", false},
+		{"html", "<html><body>Not Found</body></html>", "", false},
+	}
+	for _, tt := range tests {
+		cs, ok := ParseChecksumFile([]byte(tt.data), "file.iso")
+		if ok != tt.ok || (ok && cs.String() != tt.want) {
+			t.Errorf("%s: ParseChecksumFile = %v, %v, want %s", tt.name, cs, ok, tt.want)
+		}
+	}
+}
+
+func TestSidecarURLs(t *testing.T) {
+	got := sidecarURLs([]string{"{url}.sha256", "{dir}/SHA256SUMS", "{dir}/{name}.md5"}, "https://example.com/pub/v1/file.iso?token=x#top", "file.iso")
+	want := []string{
+		"https://example.com/pub/v1/file.iso.sha256",
+		"https://example.com/pub/v1/SHA256SUMS",
+		"https://example.com/pub/v1/file.iso.md5",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("sidecarURLs = %q, want %q", got, want)
+	}
+}
+
+func TestManagerDiscoversChecksum(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	content := bytes.Repeat([]byte("release"), 8*1024)
+	sum := sha256.Sum256(content)
+	files := newRangeServer(t, content)
+	defer files.Close()
+	var sums string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pub/SHA256SUMS":
+			_, _ = w.Write([]byte(sums))
+		case "/pub/CUSTOM":
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte("SHA256 (app.bin) = " + hex.EncodeToString(sum[:]) + "\n"))
+		case "/pub/app.bin", "/pub/bad.bin", "/pub/plain.bin":
+			files.Config.Handler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	sums = hex.EncodeToString(sum[:]) + "  app.bin\n" + strings.Repeat("00", 32) + "  bad.bin\n"
+
+	dir := t.TempDir()
+	add := func(name string, headers Headers) *Downloader {
+		t.Helper()
+		d, err := NewDownloader(&http.Client{}, srv.URL+"/pub/"+name, &DownloaderOpts{
+			DownloadDirectory: dir,
+			FileName:          name,
+			Headers:           headers,
+			DiscoverChecksums: true,
+			ChecksumConfig:    m.GetChecksumConfig(),
+			Handlers:          &Handlers{},
+		})
+		if err != nil {
+			t.Fatalf("NewDownloader: %v", err)
+		}
+		if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir}); err != nil {
+			t.Fatalf("AddDownload: %v", err)
+		}
+		return d
+	}
+
+	d := add("app.bin", nil)
+	if d.checksumSource != srv.URL+"/pub/SHA256SUMS" {
+		t.Errorf("checksum source = %q", d.checksumSource)
+	}
+	if item := m.GetItem(d.GetHash()); len(item.Checksums) != 1 || !bytes.Equal(item.Checksums[0].Value, sum[:]) {
+		t.Errorf("item checksums = %v, want the published one", item.Checksums)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if d := add("bad.bin", nil); !errors.Is(d.Start(), ErrChecksumMismatch) {
+		t.Error("download not matching its published checksum succeeded")
+	}
+	if d := add("plain.bin", nil); len(d.expectedChecksums) != 0 || d.checksumSource != "" {
+		t.Errorf("unlisted file got checksums %v from %q", d.expectedChecksums, d.checksumSource)
+	}
+
+	// configured patterns come first and get the download's headers
+	m.SetChecksumConfig(&ChecksumConfig{Enabled: true, FailOnMismatch: true, Sidecars: []string{"{dir}/CUSTOM"}})
+	sums = ""
+	d = add("app.bin", Headers{{Key: "Authorization", Value: "Bearer x"}})
+	if d.checksumSource != srv.URL+"/pub/CUSTOM" {
+		t.Errorf("checksum source = %q, want the configured pattern", d.checksumSource)
+	}
+}
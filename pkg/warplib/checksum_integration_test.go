@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -757,3 +758,133 @@ func TestDownloaderChecksumValidation_MultipartDownload(t *testing.T) {
 		t.Error("downloaded content mismatch in multipart download")
 	}
 }
+
+func TestManagerUserChecksum(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	content := bytes.Repeat([]byte("published"), 8*1024)
+	srv := newRangeServer(t, content)
+	defer srv.Close()
+	sum := sha256.Sum256(content)
+	good := ExpectedChecksum{Algorithm: ChecksumSHA256, Value: sum[:]}
+	bad := ExpectedChecksum{Algorithm: ChecksumSHA256, Value: make([]byte, sha256.Size)}
+
+	dir := t.TempDir()
+	add := func(name string, cs ExpectedChecksum) *Downloader {
+		t.Helper()
+		d, err := NewDownloader(&http.Client{}, srv.URL+"/"+name, &DownloaderOpts{
+			DownloadDirectory: dir,
+			FileName:          name,
+			Checksums:         []ExpectedChecksum{cs},
+			Handlers:          &Handlers{},
+		})
+		if err != nil {
+			t.Fatalf("NewDownloader: %v", err)
+		}
+		if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir}); err != nil {
+			t.Fatalf("AddDownload: %v", err)
+		}
+		return d
+	}
+
+	m.SetChecksumConfig(&ChecksumConfig{Enabled: true, FailOnMismatch: true, OnMismatch: ChecksumMismatchQuarantine})
+	d := add("bad.bin", bad)
+	if item := m.GetItem(d.GetHash()); len(item.Checksums) != 1 || item.Checksums[0].String() != bad.String() {
+		t.Errorf("item checksums = %v, want the given one", item.Checksums)
+	}
+	if err := d.Start(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Start = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(d.GetSavePath()); !os.IsNotExist(err) {
+		t.Errorf("corrupt file left in place: %v", err)
+	}
+	quarantined, err := os.ReadFile(filepath.Join(QuarantineDir, d.GetHash()+"_bad.bin"))
+	if err != nil || !bytes.Equal(quarantined, content) {
+		t.Errorf("quarantined file = %d bytes, %v", len(quarantined), err)
+	}
+
+	m.SetChecksumConfig(&ChecksumConfig{Enabled: true, FailOnMismatch: true, OnMismatch: ChecksumMismatchDelete})
+	d = add("bad2.bin", bad)
+	if err := d.Start(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Start = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(d.GetSavePath()); !os.IsNotExist(err) {
+		t.Errorf("corrupt file not deleted: %v", err)
+	}
+
+	d = add("good.bin", good)
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+}
+
+func TestManagerResumeValidatesUserChecksum(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	cs, err := ParseChecksum("sha512:" + strings.Repeat("ab", sha512.Size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	item := &Item{
+		Hash:             "user-checksum",
+		Name:             "file.bin",
+		Url:              "http://127.0.0.1:1/file.bin",
+		TotalSize:        100,
+		Downloaded:       10,
+		DownloadLocation: dir,
+		AbsoluteLocation: dir,
+		Resumable:        true,
+		Checksums:        []ExpectedChecksum{cs},
+		Parts:            map[int64]*ItemPart{0: {Hash: "aa01", FinalOffset: 99}},
+		mu:               m.mu,
+		memPart:          make(map[string]int64),
+	}
+	m.UpdateItem(item)
+	dlPath := filepath.Join(DlDataDir, item.Hash)
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(getFileName(dlPath, "aa01"), make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ResumeDownload(&http.Client{}, item.Hash, nil); err != nil {
+		t.Fatalf("ResumeDownload: %v", err)
+	}
+	d := item.getDAlloc().(*httpProtocolDownloader).inner
+	if d.activeAlgorithm != ChecksumSHA512 || d.activeHasher == nil {
+		t.Errorf("resumed download validates with %q, want sha512", d.activeAlgorithm)
+	}
+}
+
+func TestDownloaderValidatesAllServerChecksums(t *testing.T) {
+	content := bytes.Repeat([]byte("cloud"), 16*1024)
+	sum := md5.Sum(content)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the MD5 is right, the CRC32C isn't
+		w.Header().Set("X-Goog-Hash", "crc32c=AAAAAA==,md5="+base64.StdEncoding.EncodeToString(sum[:]))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	var result ChecksumResult
+	d, err := NewDownloader(srv.Client(), srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: t.TempDir(),
+		Handlers: &Handlers{
+			ChecksumValidationHandler: func(r ChecksumResult) { result = r },
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if got := d.activeHasher.String(); got != "crc32c, md5" {
+		t.Errorf("hashing %s, want crc32c and md5 in one pass", got)
+	}
+	if err := d.Start(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Start = %v, want a checksum mismatch", err)
+	}
+	if result.Match || result.Algorithm != ChecksumCRC32C {
+		t.Errorf("reported %+v, want the crc32c mismatch", result)
+	}
+}
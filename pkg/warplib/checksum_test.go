@@ -3,6 +3,7 @@ package warplib
 import (
 	"encoding/hex"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -375,3 +376,131 @@ func bytesEqual(a, b []byte) bool {
 	}
 	return true
 }
+
+func TestParseChecksum(t *testing.T) {
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	cs, err := ParseChecksum(" SHA256:" + sum)
+	if err != nil {
+		t.Fatalf("ParseChecksum: %v", err)
+	}
+	if cs.Algorithm != ChecksumSHA256 || hex.EncodeToString(cs.Value) != sum {
+		t.Errorf("ParseChecksum = %+v", cs)
+	}
+	if cs.String() != "sha256:"+sum {
+		t.Errorf("String() = %s", cs)
+	}
+	for _, bad := range []string{sum, "sha1:" + sum, "sha256:" + sum[:62], "md5:" + sum, "sha256:zz" + sum[2:]} {
+		if _, err := ParseChecksum(bad); err == nil {
+			t.Errorf("ParseChecksum(%s) succeeded", bad)
+		}
+	}
+	if _, err := ParseChecksums([]string{"md5:5d41402abc4b2a76b9719d911017c592", "sha256"}); err == nil {
+		t.Error("ParseChecksums with an invalid entry succeeded")
+	}
+}
+
+func TestParseChecksumMismatchAction(t *testing.T) {
+	if a, err := ParseChecksumMismatchAction(""); err != nil || a != ChecksumMismatchFail {
+		t.Errorf("ParseChecksumMismatchAction(\"\") = %q, %v", a, err)
+	}
+	if a, err := ParseChecksumMismatchAction(" Quarantine"); err != nil || a != ChecksumMismatchQuarantine {
+		t.Errorf("ParseChecksumMismatchAction(Quarantine) = %q, %v", a, err)
+	}
+	if _, err := ParseChecksumMismatchAction("ignore"); err == nil {
+		t.Error("ParseChecksumMismatchAction(ignore) succeeded")
+	}
+}
+
+func TestNewHasher_MoreAlgorithms(t *testing.T) {
+	tests := map[ChecksumAlgorithm]string{
+		ChecksumSHA1:    "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d",
+		ChecksumSHA384:  "59e1748777448c69de6b800d7a33bbfb9ff1b463e44354c3553bcdb9c666fa90125a3c79f90397bdf5f6a13de828684f",
+		ChecksumBLAKE2b: "e4cfa39a3d37be31c59609e807970799caa68a19bfaa15135f165085e01d41a65ba1e1b146aeb6bd0092b49eac214c103ccfa3a365954bbbe52f74a2b3620c94",
+		ChecksumBLAKE3:  "ea8f163db38682925e4491c5e58d4bb3506ef8c14eb78a86e908c5624a67200f",
+		ChecksumCRC32:   "3610a686",
+		ChecksumCRC32C:  "9a71bb4c",
+	}
+	for algo, want := range tests {
+		h, err := NewHasher(algo)
+		if err != nil {
+			t.Fatalf("NewHasher(%s): %v", algo, err)
+		}
+		h.Write([]byte("hello"))
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			t.Errorf("%s(hello) = %s, want %s", algo, got, want)
+		}
+	}
+}
+
+func TestParseStructuredDigestHeader(t *testing.T) {
+	checksums, err := ParseStructuredDigestHeader("unixsum=:AAA=:, sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:")
+	if err != nil || len(checksums) != 1 || checksums[0].Algorithm != ChecksumSHA256 {
+		t.Fatalf("ParseStructuredDigestHeader = %v, %v", checksums, err)
+	}
+	for _, bad := range []string{"", "sha-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=", "sha-256=:!!:", "unixsum=:AAA=:"} {
+		if _, err := ParseStructuredDigestHeader(bad); err == nil {
+			t.Errorf("ParseStructuredDigestHeader(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseGoogHashHeader(t *testing.T) {
+	checksums, err := ParseGoogHashHeader([]string{"crc32c=mnG7TA==", "md5=XUFAKrxLKna5cZ2REBfFkg=="})
+	if err != nil || len(checksums) != 2 {
+		t.Fatalf("ParseGoogHashHeader = %v, %v", checksums, err)
+	}
+	if checksums[0].String() != "crc32c:9a71bb4c" || checksums[1].Algorithm != ChecksumMD5 {
+		t.Errorf("ParseGoogHashHeader = %v", checksums)
+	}
+}
+
+func TestExtractChecksums_CloudHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Repr-Digest", "sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:")
+	headers.Set("Digest", "sha-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=")
+	headers.Set("X-Goog-Hash", "crc32c=mnG7TA==")
+	headers.Set("X-Amz-Checksum-Sha1", "qvTGHdzF6KLavt4PO0gs2a6pQ00=")
+	headers.Set("X-Amz-Checksum-Crc32", "NhCmhg==-3")
+
+	var got []string
+	for _, cs := range ExtractChecksums(headers) {
+		got = append(got, string(cs.Algorithm))
+	}
+	if want := "sha256 crc32c sha1"; strings.Join(got, " ") != want {
+		t.Errorf("ExtractChecksums = %v, want %s", got, want)
+	}
+
+	// RFC 9530 digests are of the encoded content
+	headers = http.Header{}
+	headers.Set("Content-Encoding", "gzip")
+	headers.Set("Content-Digest", "sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:")
+	if checksums := ExtractChecksums(headers); len(checksums) != 0 {
+		t.Errorf("ExtractChecksums(gzip) = %v, want none", checksums)
+	}
+}
+
+func TestSelectBestAlgorithm_Ranking(t *testing.T) {
+	checksums := []ExpectedChecksum{{Algorithm: ChecksumCRC32C}, {Algorithm: ChecksumMD5}, {Algorithm: ChecksumBLAKE3}, {Algorithm: ChecksumSHA1}}
+	if got := SelectBestAlgorithm(checksums); got != ChecksumBLAKE3 {
+		t.Errorf("SelectBestAlgorithm = %s, want blake3", got)
+	}
+}
+
+func TestMultiHasher(t *testing.T) {
+	m, err := NewMultiHasher(ChecksumMD5, ChecksumSHA256, ChecksumMD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Write([]byte("hel"))
+	m.Write([]byte("lo"))
+	sums := m.Sums()
+	if len(sums) != 2 || sums[0].String() != "md5:5d41402abc4b2a76b9719d911017c592" || m.String() != "md5, sha256" {
+		t.Errorf("Sums = %v", sums)
+	}
+	if m.Sum(ChecksumSHA1) != nil || !m.Has(ChecksumSHA256) {
+		t.Error("MultiHasher reports algorithms it doesn't hash")
+	}
+	if _, err := NewMultiHasher("crc64"); err == nil {
+		t.Error("NewMultiHasher(crc64) succeeded")
+	}
+}
@@ -0,0 +1,96 @@
+package warplib
+
+import (
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+)
+
+// partProgressSize is the size of a part file in direct write mode, which
+// only holds the number of bytes the part has written into the main file.
+const partProgressSize = 8
+
+// initDirectWrite switches the download to direct write mode: the main file
+// is preallocated and parts write their data at their offsets in it, with no
+// part data files and no compile phase.
+// Downloads of unknown size keep using part files.
+func (d *Downloader) initDirectWrite() {
+	if d.contentLength.v() <= 0 {
+		d.Log("Direct write needs a known content length, using part files")
+		return
+	}
+	d.directWrite = true
+}
+
+// preallocate reserves the full size of the main file for a direct write
+// download, so a full disk shows up before downloading rather than midway.
+func (d *Downloader) preallocate() error {
+	if !d.directWrite {
+		return nil
+	}
+	size := d.contentLength.v()
+	if stat, err := d.f.Stat(); err == nil && stat.Size() == size {
+		// resumed: already preallocated
+		return nil
+	}
+	if err := preallocateFile(d.f, size); err != nil {
+		d.Log("Failed to preallocate %d bytes: %v", size, err)
+		return err
+	}
+	d.Log("Preallocated %d bytes for direct write", size)
+	return nil
+}
+
+// finishDirectPart completes a part in direct write mode. Its data is
+// already in the main file, so instead of compiling it only marks the part
+// as compiled and removes its progress file.
+func (d *Downloader) finishDirectPart(part *Part) {
+	read := part.getRead()
+	atomic.AddInt64(&d.nread, read)
+	d.handlers.CompileCompleteHandler(part.hash, read)
+	d.journalDone(part)
+	d.Log("%s: part written in place: %d bytes", part.hash, read)
+	if err := WarpRemove(part.getFileName()); err != nil {
+		d.Log("%s: remove: %v", part.hash, err)
+	}
+}
+
+// directWriter writes the data of a part at its position in the main file
+// and records the part's progress in its part file after every write.
+type directWriter struct {
+	p    *Part
+	mark [partProgressSize]byte
+}
+
+func (w *directWriter) Write(b []byte) (int, error) {
+	read := w.p.getRead()
+	n, err := w.p.f.WriteAt(b, w.p.offset+read)
+	if n > 0 {
+		// The data is written before the progress, so a crash in between
+		// only downloads these bytes again.
+		binary.LittleEndian.PutUint64(w.mark[:], uint64(read+int64(n)))
+		if _, er := w.p.pf.WriteAt(w.mark[:], 0); er != nil && err == nil {
+			err = er
+		}
+	}
+	return n, err
+}
+
+// loadProgress reads the progress of a direct write part from its part file.
+// A missing or torn record counts as no progress.
+func (p *Part) loadProgress(rpFunc ResumeProgressHandlerFunc) error {
+	var mark [partProgressSize]byte
+	_, err := p.pf.ReadAt(mark[:], 0)
+	switch err {
+	case nil:
+		p.read = int64(binary.LittleEndian.Uint64(mark[:]))
+	case io.EOF:
+		p.read = 0
+	default:
+		return err
+	}
+	if p.read > 0 {
+		rpFunc(p.hash, int(p.read))
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package warplib
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloader_DirectWrite(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("direct-write"), 200*int(KB)/12)
+	srv := newRangeServer(t, content)
+	defer srv.Close()
+
+	var compileStarts, compileCompletes int32
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: base,
+		MaxConnections:    4,
+		MaxSegments:       8,
+		NumBaseParts:      4,
+		DirectWrite:       true,
+		Handlers: &Handlers{
+			CompileStartHandler: func(string) {
+				atomic.AddInt32(&compileStarts, 1)
+			},
+			CompileCompleteHandler: func(string, int64) {
+				atomic.AddInt32(&compileCompletes, 1)
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	defer d.Close()
+	if !d.directWrite {
+		t.Fatal("direct write not enabled")
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	got, err := os.ReadFile(d.GetSavePath())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("downloaded content mismatch")
+	}
+	if compileStarts != 0 {
+		t.Errorf("compile started %d times, want none", compileStarts)
+	}
+	if compileCompletes < 4 {
+		t.Errorf("parts marked complete = %d, want at least 4", compileCompletes)
+	}
+	warps, _ := filepath.Glob(filepath.Join(d.dlPath, "*.warp"))
+	if len(warps) != 0 {
+		t.Errorf("part files left behind: %v", warps)
+	}
+}
+
+func TestDownloader_DirectWrite_UnknownSize(t *testing.T) {
+	d := &Downloader{contentLength: -1, l: log.New(io.Discard, "", 0)}
+	d.initDirectWrite()
+	if d.directWrite {
+		t.Error("direct write enabled for unknown content length")
+	}
+}
+
+func TestPart_DirectWriteProgress(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer f.Close()
+	if err := preallocateFile(f, 64); err != nil {
+		t.Fatalf("preallocateFile: %v", err)
+	}
+	pf, err := os.Create(filepath.Join(dir, "part.warp"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer pf.Close()
+
+	data := []byte("0123456789abcdefghij")
+	p := &Part{
+		hash:   "p1",
+		offset: 16,
+		chunk:  8,
+		f:      f,
+		pf:     pf,
+		direct: true,
+		pfunc:  func(string, int) {},
+		ofunc:  func(string, int64) {},
+		l:      log.New(io.Discard, "", 0),
+	}
+	if _, err := p.copyBuffer(io.NopCloser(bytes.NewReader(data)), 16+int64(len(data))-1, true); err != nil {
+		t.Fatalf("copyBuffer: %v", err)
+	}
+
+	got := make([]byte, len(data))
+	if _, err := f.ReadAt(got, 16); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("main file = %q, want %q", got, data)
+	}
+	if stat, _ := pf.Stat(); stat.Size() != partProgressSize {
+		t.Errorf("part file size = %d, want %d", stat.Size(), partProgressSize)
+	}
+
+	var resumed int
+	r := &Part{hash: "p1", pf: pf, direct: true}
+	if err := r.seek(func(_ string, n int) { resumed += n }); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	if r.getRead() != int64(len(data)) || resumed != len(data) {
+		t.Errorf("resumed read=%d reported=%d, want %d", r.getRead(), resumed, len(data))
+	}
+
+	// A torn progress record counts as no progress.
+	if err := pf.Truncate(3); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	r = &Part{hash: "p1", pf: pf, direct: true}
+	if err := r.seek(func(string, int) {}); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	if r.getRead() != 0 {
+		t.Errorf("read from torn record = %d, want 0", r.getRead())
+	}
+}
+
+func TestManager_ResumeDirectWrite(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	m, err := InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	defer m.Close()
+
+	content := bytes.Repeat([]byte("resume-direct"), 10000)
+	half := int64(len(content) / 2)
+	const partRead = 1000
+
+	var minStart int64 = -1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := strings.TrimPrefix(r.Header.Get("Range"), "bytes=")
+		bounds := strings.SplitN(rng, "-", 2)
+		start, _ := strconv.ParseInt(bounds[0], 10, 64)
+		end := int64(len(content) - 1)
+		if len(bounds) == 2 && bounds[1] != "" {
+			end, _ = strconv.ParseInt(bounds[1], 10, 64)
+		}
+		if minStart == -1 || start < minStart {
+			minStart = start
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[start : end+1])
+	}))
+	defer srv.Close()
+
+	// An interrupted direct write download: the first half is complete, the
+	// second half's part wrote partRead bytes before it stopped.
+	item := &Item{
+		Hash:             "direct-resume",
+		Name:             "file.bin",
+		Url:              srv.URL + "/file.bin",
+		TotalSize:        ContentLength(len(content)),
+		Downloaded:       ContentLength(half + partRead),
+		DownloadLocation: base,
+		AbsoluteLocation: base,
+		Resumable:        true,
+		DirectWrite:      true,
+		Parts: map[int64]*ItemPart{
+			0:    {Hash: "aa01", FinalOffset: half - 1, Compiled: true},
+			half: {Hash: "aa02", FinalOffset: int64(len(content)) - 1},
+		},
+		mu:      m.mu,
+		memPart: make(map[string]int64),
+	}
+	m.UpdateItem(item)
+	dlPath := filepath.Join(DlDataDir, item.Hash)
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	main := make([]byte, len(content))
+	copy(main, content[:half+partRead])
+	if err := os.WriteFile(item.GetAbsolutePath(), main, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	mark := make([]byte, partProgressSize)
+	mark[0], mark[1] = byte(partRead&0xff), byte(partRead>>8)
+	if err := os.WriteFile(getFileName(dlPath, "aa02"), mark, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	resumed, err := m.ResumeDownload(&http.Client{}, item.Hash, nil)
+	if err != nil {
+		t.Fatalf("ResumeDownload: %v", err)
+	}
+	if err := resumed.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+
+	got, err := os.ReadFile(item.GetAbsolutePath())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("resumed content mismatch")
+	}
+	if minStart != half+partRead {
+		t.Errorf("first requested byte = %d, want %d", minStart, half+partRead)
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
@@ -39,13 +39,19 @@ type Downloader struct {
 	fileName string
 	// Size of file, wrapped inside ContentLength
 	contentLength ContentLength
+	// Media type of the file sent by the server, without parameters
+	contentType string
 	// Download location (directory) of the file.
 	dlLoc string
 	// Size of 1 chunk of bytes to download during
 	// a single copy cycle
 	chunk int
-	// Max connections and number of curr connections
+	// Max connections and number of curr connections.
+	// maxConn can be changed live via SetMaxConnections.
 	maxConn, numConn int32
+	// numParked is the number of parts waiting for a free connection
+	// slot after the connection limit was lowered.
+	numParked int32
 	// Max spawnable parts and number of curr parts
 	maxParts, numParts int32
 	// Initial number of parts to be spawned
@@ -85,15 +91,45 @@ type Downloader struct {
 	maxFileSize int64
 	// checksumConfig holds configuration for checksum validation
 	checksumConfig *ChecksumConfig
-	// expectedChecksums holds the checksums extracted from server headers
+	// expectedChecksums holds the checksums given by the user, or else
+	// those discovered or extracted from server headers
 	expectedChecksums []ExpectedChecksum
-	// activeHasher is the hash.Hash instance used for validation
-	activeHasher hash.Hash
-	// activeAlgorithm is the algorithm being used for validation
+	// discoverChecksums looks the checksums up in the checksum files
+	// published next to the file, see ChecksumAuto.
+	discoverChecksums bool
+	// checksumSource is the URL of the checksum file the checksums were
+	// discovered in, if any.
+	checksumSource string
+	// signatureURL is the URL of the detached signature the file is
+	// verified against once downloaded, SignatureAuto until found.
+	signatureURL string
+	// signatureData is the fetched detached signature.
+	signatureData []byte
+	// signature is the result of the signature verification.
+	signature *SignatureResult
+	// keyring holds the keys trusted to sign downloads.
+	keyring *Keyring
+	// pieces are the hashes of the pieces of the file, known before
+	// downloading when published in a Metalink file, else recorded
+	// while downloading.
+	pieces *PieceHashes
+	// pieceRecorder hashes the pieces while downloading, nil when
+	// their hashes are known.
+	pieceRecorder *pieceRecorder
+	// activeHasher hashes the file with all the algorithms of the
+	// expected checksums in a single pass
+	activeHasher *MultiHasher
+	// activeAlgorithm is the strongest algorithm being used for validation
 	activeAlgorithm ChecksumAlgorithm
 	// speedLimit is the maximum download speed in bytes per second.
-	// If zero, no limit is applied.
+	// If zero, no limit is applied. Accessed atomically, see SetSpeedLimit.
 	speedLimit int64
+	// bandwidth is the daemon-wide limiter shared with other downloads.
+	// Nil means no global cap is applied.
+	bandwidth *BandwidthLimiter
+	// hosts limits the connections to a host across all downloads.
+	// Nil means no per-host limit is applied.
+	hosts *HostLimiter
 
 	// enableWorkStealing controls whether completed parts can steal
 	// work from slower adjacent parts. Enabled by default.
@@ -101,6 +137,33 @@ type Downloader struct {
 	// activeParts tracks currently downloading parts for work stealing lookup.
 	// Maps part hash to *activePartInfo for O(1) access.
 	activeParts VMap[string, *activePartInfo]
+
+	// received is the number of bytes received from the network so far,
+	// used to measure the aggregate throughput.
+	received int64
+	// tuner adapts maxConn to the host while downloading.
+	// Nil unless AutoConnections is set.
+	tuner *connTuner
+	// directWrite makes parts write into the preallocated main file
+	// instead of part files that are compiled afterwards.
+	directWrite bool
+	// journalCfg is the daemon-wide progress journal config.
+	// Nil means no journal.
+	journalCfg *JournalConfig
+	// cache serves the file instead of the network when it holds it,
+	// nil if disabled.
+	cache *Cache
+	// cached is set once the file was served from the cache.
+	cached bool
+	// etag is the strong ETag of the file, empty if none or weak.
+	etag string
+	// journal records the durably written ranges, nil if disabled.
+	journal *progressJournal
+	// stream receives the file in order instead of a file on disk,
+	// nil unless streaming.
+	stream io.Writer
+	// streamWindow is the memory used to fetch ahead while streaming.
+	streamWindow int64
 }
 
 // DownloaderOptsFunc is a functional option for configuring a Downloader.
@@ -166,6 +229,25 @@ type DownloaderOpts struct {
 	// Set Enabled=false to disable validation entirely.
 	ChecksumConfig *ChecksumConfig
 
+	// Checksums are the expected checksums of the file given by the user.
+	// They replace those announced by the server.
+	Checksums []ExpectedChecksum
+
+	// DiscoverChecksums looks the expected checksum up in the checksum
+	// files published next to the file when no Checksums are given,
+	// before falling back to those announced by the server.
+	DiscoverChecksums bool
+
+	// Signature is the URL of the detached signature the file is verified
+	// against once downloaded, or SignatureAuto to look it up next to the
+	// file. A failed verification is handled like a checksum mismatch.
+	Signature string
+
+	// Pieces are the known hashes of the pieces of the file, such as
+	// those published in a Metalink file. If nil, they are recorded
+	// while downloading.
+	Pieces *PieceHashes
+
 	// SpeedLimit specifies the maximum download speed in bytes per second.
 	// If zero or negative, no limit is applied.
 	// The limit is distributed equally among active download parts.
@@ -180,6 +262,27 @@ type DownloaderOpts struct {
 	// If empty, default paths (~/.ssh/id_ed25519, ~/.ssh/id_rsa) are tried.
 	// Not used for HTTP or FTP protocols.
 	SSHKeyPath string
+
+	// AutoConnections lets the downloader find the best number of
+	// connections by itself: it starts small and adds connections while
+	// the throughput improves, backing off when the server throttles.
+	// MaxConnections is used as the upper bound.
+	AutoConnections bool
+
+	// DirectWrite preallocates the target file and writes every part at
+	// its offset in it, instead of writing parts to separate files and
+	// compiling them into the target at the end. This halves the disk I/O
+	// and the disk space needed. Ignored if the content length is unknown.
+	DirectWrite bool
+
+	// Stream makes Start write the file to Stream strictly in order
+	// instead of saving it, e.g. to stdout or a named pipe. Parts fetch
+	// ahead within StreamWindow bytes of memory and a slow consumer slows
+	// them down. A streamed download can't be resumed.
+	Stream io.Writer
+	// StreamWindow is the memory a stream may use to fetch ahead.
+	// If zero, DEF_STREAM_WINDOW is used.
+	StreamWindow int64
 }
 
 // NewDownloader creates a new downloader with provided arguments.
@@ -244,6 +347,9 @@ func NewDownloader(client *http.Client, url string, opts *DownloaderOpts, optFun
 		requestTimeout:     opts.RequestTimeout,
 		maxFileSize:        opts.MaxFileSize,
 		checksumConfig:     opts.ChecksumConfig,
+		expectedChecksums:  opts.Checksums,
+		discoverChecksums:  opts.DiscoverChecksums,
+		signatureURL:       opts.Signature,
 		speedLimit:         opts.SpeedLimit,
 		enableWorkStealing: !opts.DisableWorkStealing,
 	}
@@ -273,6 +379,9 @@ func NewDownloader(client *http.Client, url string, opts *DownloaderOpts, optFun
 	d.l.Println("GET:", d.url)
 	d.l.Println("CONTENT-LENGTH:", d.contentLength.v(), "(", d.contentLength, ")")
 	d.l.Println("FILE-NAME:", d.fileName)
+	if d.checksumSource != "" {
+		d.l.Println("CHECKSUM:", d.checksumSource)
+	}
 	d.handlers.setDefault(d.l)
 	if opts.NumBaseParts != 0 {
 		d.numBaseParts = opts.NumBaseParts
@@ -284,6 +393,17 @@ func NewDownloader(client *http.Client, url string, opts *DownloaderOpts, optFun
 	if d.maxParts != 0 && d.maxConn > d.maxParts {
 		d.maxConn = d.maxParts
 	}
+	if opts.AutoConnections {
+		d.initConnTuner()
+	}
+	if opts.DirectWrite {
+		d.initDirectWrite()
+	}
+	if opts.Stream != nil {
+		d.stream = opts.Stream
+		d.streamWindow = opts.StreamWindow
+		d.directWrite = false
+	}
 	if d.numBaseParts > d.maxConn {
 		d.numBaseParts = d.maxConn
 	}
@@ -346,12 +466,15 @@ func initDownloader(client *http.Client, hash, url string, cLength ContentLength
 		contentLength:  cLength,
 		hash:           hash,
 		dlPath:         filepath.Join(DlDataDir, hash),
+		resumable:      true,
 		retryConfig:    retryConfig,
 		overwrite:      opts.Overwrite,
 		requestTimeout: opts.RequestTimeout,
 		maxFileSize:    opts.MaxFileSize,
 		checksumConfig: opts.ChecksumConfig,
 		speedLimit:     opts.SpeedLimit,
+		signatureURL:   opts.Signature,
+		pieces:         opts.Pieces,
 	}
 
 	// Apply functional options
@@ -367,17 +490,30 @@ func initDownloader(client *http.Client, hash, url string, cLength ContentLength
 	if err != nil {
 		return
 	}
+	d.setChecksums(opts.Checksums)
 	d.handlers.setDefault(d.l)
 	if d.maxParts != 0 && d.maxConn > d.maxParts {
 		d.maxConn = d.maxParts
 	}
+	if opts.AutoConnections {
+		d.initConnTuner()
+	}
+	if opts.DirectWrite {
+		d.initDirectWrite()
+	}
 	return
 }
 
 // Start downloads the file and blocks current goroutine
 // until the downloading is complete.
 func (d *Downloader) Start() (err error) {
+	if d.stream != nil {
+		return d.startStream()
+	}
 	defer d.lw.Close()
+	if ok, er := d.fromCache(); ok || er != nil {
+		return er
+	}
 	err = d.openFile()
 	if err != nil {
 		return
@@ -394,9 +530,20 @@ func (d *Downloader) Start() (err error) {
 		d.Log("Insufficient disk space: %v", err)
 		return
 	}
+	if err = d.preallocate(); err != nil {
+		return
+	}
+	if err = d.openJournal(true); err != nil {
+		return
+	}
+	defer func() {
+		d.closeJournal(err == nil && atomic.LoadInt32(&d.stopped) == 0)
+	}()
 	d.Log("Starting download...")
+	d.initPieces()
 	d.ohmap.Make()
 	d.activeParts.Make() // Initialize work stealing map
+	d.fitBasePartsToHost()
 	partSize, rpartSize := d.getPartSize()
 	if partSize == -1 {
 		d.wg.Add(1)
@@ -410,7 +557,7 @@ func (d *Downloader) Start() (err error) {
 					d.cancel()
 				}
 			}()
-			d.downloadUnknownSizeFile()
+			d.downloadUnknownSizeFile(d.f)
 		}()
 	} else {
 		for i := int32(0); i < d.numBaseParts; i++ {
@@ -436,7 +583,11 @@ func (d *Downloader) Start() (err error) {
 			}(ioffCapture, foffCapture)
 		}
 	}
+	stopTuner := d.startConnTuner()
+	stopJournal := d.startJournalSync()
 	d.wg.Wait()
+	stopJournal()
+	stopTuner()
 	if atomic.LoadInt32(&d.stopped) == 1 {
 		d.Log("Download stopped")
 		d.handlers.DownloadStoppedHandler()
@@ -444,8 +595,12 @@ func (d *Downloader) Start() (err error) {
 	}
 	// Validate checksum before declaring completion
 	if atomic.LoadInt32(&d.stopped) == 0 {
+		d.finishPieces()
 		if err = d.validateChecksum(); err != nil {
-			return
+			return d.checksumFailed(err)
+		}
+		if err = d.verifySignature(); err != nil {
+			return d.checksumFailed(err)
 		}
 	}
 	if v := d.contentLength.v(); v != -1 && v != d.nread {
@@ -500,9 +655,27 @@ func (d *Downloader) Resume(parts map[int64]*ItemPart) (err error) {
 		d.Log("Insufficient disk space: %v", err)
 		return
 	}
+	if err = d.preallocate(); err != nil {
+		return
+	}
+	if err = d.openJournal(false); err != nil {
+		return
+	}
+	defer func() {
+		d.closeJournal(err == nil && atomic.LoadInt32(&d.stopped) == 0)
+	}()
 	d.Log("Resuming download...")
+	d.initPieces()
 	d.ohmap.Make()
 	d.activeParts.Make() // Initialize work stealing map
+	// the parts left to download are the base parts of a resume
+	d.numBaseParts = 0
+	for _, ip := range partsSnapshot {
+		if !ip.Compiled {
+			d.numBaseParts++
+		}
+	}
+	d.fitBasePartsToHost()
 	espeed := 4 * MB / int64(len(partsSnapshot))
 	for ioff, ip := range partsSnapshot {
 		if ip.Compiled {
@@ -528,7 +701,11 @@ func (d *Downloader) Resume(parts map[int64]*ItemPart) (err error) {
 			d.resumePartDownload(hash, ioff, foff, espeed)
 		}(hashCapture, ioffCapture, foffCapture, espeedCapture)
 	}
+	stopTuner := d.startConnTuner()
+	stopJournal := d.startJournalSync()
 	d.wg.Wait()
+	stopJournal()
+	stopTuner()
 	if atomic.LoadInt32(&d.stopped) == 1 {
 		d.Log("Download stopped")
 		d.handlers.DownloadStoppedHandler()
@@ -536,8 +713,12 @@ func (d *Downloader) Resume(parts map[int64]*ItemPart) (err error) {
 	}
 	// Validate checksum before declaring completion
 	if atomic.LoadInt32(&d.stopped) == 0 {
+		d.finishPieces()
 		if err = d.validateChecksum(); err != nil {
-			return
+			return d.checksumFailed(err)
+		}
+		if err = d.verifySignature(); err != nil {
+			return d.checksumFailed(err)
 		}
 	}
 	if d.contentLength.v() != d.nread {
@@ -554,6 +735,9 @@ func (d *Downloader) Resume(parts map[int64]*ItemPart) (err error) {
 
 // validateChecksum performs checksum validation on the completed download.
 // It reads through the entire file, computes the hash, and compares with expected value.
+// The checksums computed are reported to FileHashedHandler to be kept. A
+// file without an expected checksum isn't read, it is hashed on its first
+// verification.
 func (d *Downloader) validateChecksum() error {
 	// Skip if explicitly disabled
 	if d.checksumConfig != nil && !d.checksumConfig.Enabled {
@@ -562,18 +746,12 @@ func (d *Downloader) validateChecksum() error {
 	if len(d.expectedChecksums) == 0 {
 		return nil // Silent skip when no checksum provided
 	}
-	if d.activeHasher == nil {
+	hasher := d.activeHasher
+	if hasher == nil {
 		return nil
 	}
 
-	// Use default config if nil
-	config := d.checksumConfig
-	if config == nil {
-		defaultConfig := DefaultChecksumConfig()
-		config = &defaultConfig
-	}
-
-	d.Log("Starting checksum validation (%s)...", d.activeAlgorithm)
+	d.Log("Starting checksum validation (%s)...", hasher)
 
 	// Open and read through the completed file
 	f, err := WarpOpen(d.GetSavePath())
@@ -587,7 +765,7 @@ func (d *Downloader) validateChecksum() error {
 	for {
 		n, err := f.Read(buf)
 		if n > 0 {
-			d.activeHasher.Write(buf[:n])
+			hasher.Write(buf[:n])
 			totalHashed += int64(n)
 			d.handlers.ChecksumProgressHandler(totalHashed)
 		}
@@ -598,25 +776,50 @@ func (d *Downloader) validateChecksum() error {
 			return fmt.Errorf("checksum validation: read: %w", err)
 		}
 	}
+	if err := d.matchChecksum(); err != nil {
+		return err
+	}
+	d.handlers.FileHashedHandler(hasher.Sums())
+	return nil
+}
 
-	actual := d.activeHasher.Sum(nil)
+// matchChecksum compares the hash of the downloaded data with the
+// expected checksum and reports the result.
+func (d *Downloader) matchChecksum() error {
+	if d.checksumConfig != nil && !d.checksumConfig.Enabled {
+		return nil
+	}
+	if d.activeHasher == nil {
+		return nil
+	}
+	config := d.checksumConfig
+	if config == nil {
+		defaultConfig := DefaultChecksumConfig()
+		config = &defaultConfig
+	}
 
-	// Find expected checksum for our algorithm
-	var expected []byte
+	// Every expected checksum must match, the strongest is reported
+	// unless another one fails
+	var result ChecksumResult
 	for _, cs := range d.expectedChecksums {
-		if cs.Algorithm == d.activeAlgorithm {
-			expected = cs.Value
+		actual := d.activeHasher.Sum(cs.Algorithm)
+		if actual == nil {
+			continue
+		}
+		r := ChecksumResult{
+			Algorithm: cs.Algorithm,
+			Expected:  cs.Value,
+			Actual:    actual,
+			Match:     bytes.Equal(cs.Value, actual),
+		}
+		if !r.Match || (result.Algorithm == "" && cs.Algorithm == d.activeAlgorithm) {
+			result = r
+		}
+		if !r.Match {
 			break
 		}
 	}
-
-	match := bytes.Equal(expected, actual)
-	result := ChecksumResult{
-		Algorithm: d.activeAlgorithm,
-		Expected:  expected,
-		Actual:    actual,
-		Match:     match,
-	}
+	match, expected, actual := result.Match, result.Expected, result.Actual
 
 	d.handlers.ChecksumValidationHandler(result)
 
@@ -626,7 +829,7 @@ func (d *Downloader) validateChecksum() error {
 		}
 		d.Log("Checksum mismatch (not failing): expected %x, got %x", expected, actual)
 	} else {
-		d.Log("Checksum validation passed (%s)", d.activeAlgorithm)
+		d.Log("Checksum validation passed (%s)", d.activeHasher)
 	}
 
 	return nil
@@ -678,11 +881,7 @@ func (d *Downloader) closeMainFile() error {
 }
 
 func (d *Downloader) spawnPart(ioff, foff int64) (part *Part, err error) {
-	// Calculate per-part speed limit: total limit / number of parts
-	partSpeedLimit := d.speedLimit
-	if partSpeedLimit > 0 && d.numBaseParts > 1 {
-		partSpeedLimit = d.speedLimit / int64(d.numBaseParts)
-	}
+	partSpeedLimit := d.partSpeedLimit()
 	part, err = newPart(
 		d.ctx,
 		d.client,
@@ -691,13 +890,17 @@ func (d *Downloader) spawnPart(ioff, foff int64) (part *Part, err error) {
 			copyChunk:  int64(d.chunk),
 			preName:    d.dlPath,
 			rpHandler:  d.handlers.ResumeProgressHandler,
-			pHandler:   d.handlers.DownloadProgressHandler,
+			pHandler:   d.progressHandler,
 			oHandler:   d.handlers.DownloadCompleteHandler,
 			cpHandler:  d.handlers.CompileProgressHandler,
 			logger:     d.l,
 			offset:     ioff,
 			f:          d.f,
 			speedLimit: partSpeedLimit,
+			bandwidth:  d.bandwidth,
+			direct:     d.directWrite,
+			journal:    d.journal,
+			pieces:     d.pieceRecorder,
 		},
 	)
 	if err != nil {
@@ -709,15 +912,12 @@ func (d *Downloader) spawnPart(ioff, foff int64) (part *Part, err error) {
 	atomic.AddInt32(&d.numParts, 1)
 	d.Log("%s: created new part | %d => %d", part.hash, ioff, foff)
 	d.handlers.SpawnPartHandler(part.hash, ioff, foff)
+	d.journalRange(journalSpawn, part.hash, ioff, foff)
 	return
 }
 
 func (d *Downloader) initPart(hash string, ioff, foff int64) (part *Part, err error) {
-	// Calculate per-part speed limit: total limit / number of parts
-	partSpeedLimit := d.speedLimit
-	if partSpeedLimit > 0 && d.numBaseParts > 1 {
-		partSpeedLimit = d.speedLimit / int64(d.numBaseParts)
-	}
+	partSpeedLimit := d.partSpeedLimit()
 	part, err = initPart(
 		d.ctx,
 		d.client,
@@ -727,13 +927,17 @@ func (d *Downloader) initPart(hash string, ioff, foff int64) (part *Part, err er
 			copyChunk:  int64(d.chunk),
 			preName:    d.dlPath,
 			rpHandler:  d.handlers.ResumeProgressHandler,
-			pHandler:   d.handlers.DownloadProgressHandler,
+			pHandler:   d.progressHandler,
 			oHandler:   d.handlers.DownloadCompleteHandler,
 			cpHandler:  d.handlers.CompileProgressHandler,
 			logger:     d.l,
 			offset:     ioff,
 			f:          d.f,
 			speedLimit: partSpeedLimit,
+			bandwidth:  d.bandwidth,
+			direct:     d.directWrite,
+			journal:    d.journal,
+			pieces:     d.pieceRecorder,
 		},
 	)
 	if err != nil {
@@ -744,6 +948,7 @@ func (d *Downloader) initPart(hash string, ioff, foff int64) (part *Part, err er
 	atomic.AddInt32(&d.numParts, 1)
 	d.Log("%s: Resumed part", hash)
 	d.handlers.SpawnPartHandler(hash, ioff, foff)
+	d.journalRange(journalSpawn, hash, ioff, foff)
 	return
 }
 
@@ -751,6 +956,11 @@ func (d *Downloader) resumePartDownload(hash string, ioff, foff, espeed int64) {
 	// d.numConn++
 	atomic.AddInt32(&d.numConn, 1)
 	defer func() { atomic.AddInt32(&d.numConn, -1); d.wg.Done() }()
+	if err := d.acquireHostSlot(); err != nil {
+		// stopped while waiting for a slot
+		return
+	}
+	defer d.releaseHostSlot()
 	part, err := d.initPart(hash, ioff, foff)
 	if err != nil {
 		d.Log("%s: init: %s", hash, err.Error())
@@ -761,6 +971,10 @@ func (d *Downloader) resumePartDownload(hash string, ioff, foff, espeed int64) {
 	poff := part.offset + part.getRead()
 	if poff >= foff {
 		d.Log("%s: part offset (%d) greater than final offset (%d)", hash, poff, foff)
+		if part.direct {
+			d.finishDirectPart(part)
+			return
+		}
 		d.handlers.CompileStartHandler(part.hash)
 		var written int64
 		_, written, err = part.compile()
@@ -770,11 +984,17 @@ func (d *Downloader) resumePartDownload(hash string, ioff, foff, espeed int64) {
 		}
 		atomic.AddInt64(&d.nread, written)
 		d.handlers.CompileCompleteHandler(part.hash, part.getRead())
+		d.journalDone(part)
 		return
 	}
 	// CHANGE IMPL
 	err = d.runPart(part, poff, foff, espeed, false, nil)
-	if err != nil {
+	if err != nil || part.unfinished {
+		d.journalProgress(part)
+		return
+	}
+	if part.direct {
+		d.finishDirectPart(part)
 		return
 	}
 	d.handlers.CompileStartHandler(part.hash)
@@ -791,6 +1011,7 @@ func (d *Downloader) resumePartDownload(hash string, ioff, foff, espeed int64) {
 		return
 	}
 	d.handlers.CompileCompleteHandler(part.hash, readCapture)
+	d.journalDone(part)
 	d.Log("%s: compilation complete: read %d bytes and wrote %d bytes", hash, read, written)
 
 	fName := getFileName(
@@ -811,6 +1032,11 @@ func (d *Downloader) newPartDownload(ioff, foff, espeed int64) {
 		atomic.AddInt32(&d.numConn, -1)
 		d.wg.Done()
 	}()
+	if err := d.acquireHostSlot(); err != nil {
+		// stopped while waiting for a slot
+		return
+	}
+	defer d.releaseHostSlot()
 	part, err := d.spawnPart(ioff, foff)
 	if err != nil {
 		d.Log("failed to spawn new part: %v", err)
@@ -823,7 +1049,12 @@ func (d *Downloader) newPartDownload(ioff, foff, espeed int64) {
 	defer part.close()
 	// CHANGE IMPL
 	err = d.runPart(part, ioff, foff, espeed, false, nil)
-	if err != nil {
+	if err != nil || part.unfinished {
+		d.journalProgress(part)
+		return
+	}
+	if part.direct {
+		d.finishDirectPart(part)
 		return
 	}
 
@@ -841,6 +1072,7 @@ func (d *Downloader) newPartDownload(ioff, foff, espeed int64) {
 		return
 	}
 	d.handlers.CompileCompleteHandler(part.hash, readCapture)
+	d.journalDone(part)
 	d.Log("%s: compilation complete: read %d bytes and wrote %d bytes", hash, read, written)
 
 	fName := getFileName(
@@ -882,7 +1114,7 @@ func (d *Downloader) runPart(part *Part, ioff, foff, espeed int64, repeated bool
 			slow bool
 		)
 
-		force := d.maxConn < 2
+		force := atomic.LoadInt32(&d.maxConn) < 2
 
 		if body == nil {
 			// start downloading the content in provided
@@ -893,6 +1125,19 @@ func (d *Downloader) runPart(part *Part, ioff, foff, espeed int64, repeated bool
 			slow, err = part.copyBuffer(body, foff, force)
 		}
 
+		if errors.Is(err, errPartParked) {
+			// The connection limit was lowered: the body is already
+			// closed, reconnect from the current offset once a slot is free.
+			body = nil
+			if err = d.parkPart(part); err != nil {
+				d.handlers.ErrorHandler(hash, err)
+				break
+			}
+			ioff = part.offset + part.getRead()
+			repeated = false
+			continue
+		}
+
 		if err != nil {
 			category := ClassifyError(err)
 
@@ -901,6 +1146,9 @@ func (d *Downloader) runPart(part *Part, ioff, foff, espeed int64, repeated bool
 				d.handlers.ErrorHandler(hash, err)
 				break
 			}
+			if category == ErrCategoryThrottled && d.tuner != nil {
+				d.tuner.markThrottled()
+			}
 
 			retryState.Attempts++
 			retryState.LastError = err
@@ -957,6 +1205,30 @@ func (d *Downloader) runPart(part *Part, ioff, foff, espeed int64, repeated bool
 			break
 		}
 
+		if at := part.takePriority(); at > 0 {
+			// a reader is waiting for the bytes at 'at'
+			if d.splitPartAt(part, &foff, espeed, at) {
+				// the new part took this part's connection
+				body.Close()
+				body = nil
+				if err = d.parkPart(part); err != nil {
+					d.handlers.ErrorHandler(hash, err)
+					break
+				}
+				ioff = part.offset + part.getRead()
+			}
+			repeated = false
+			continue
+		}
+
+		if n := part.takeSplit(); n > 0 {
+			// SetMaxConnections asked this part to make room for
+			// more connections.
+			espeed = d.splitPart(part, &foff, espeed, n)
+			repeated = false
+			continue
+		}
+
 		// add read bytes to part offset to determine
 		// starting offset for a respawned part.
 		poff := part.offset + part.getRead()
@@ -966,9 +1238,11 @@ func (d *Downloader) runPart(part *Part, ioff, foff, espeed int64, repeated bool
 			// Min part size has been reached and hence
 			// don't spawn new part out of the current part.
 			d.Log("%s: Min part size reached, continuing as slow part...", hash)
+			atomic.StoreInt32(&part.ctl, partCtlPinned)
 			_, err = part.copyBuffer(body, foff, true)
 			if err != nil {
 				d.handlers.ErrorHandler(hash, err)
+				part.unfinished = true
 			}
 			// return to prevent spawning further parts
 			err = nil
@@ -981,16 +1255,18 @@ func (d *Downloader) runPart(part *Part, ioff, foff, espeed int64, repeated bool
 			// don't spawn new parts and forcefully download
 			// rest of the content in slow part.
 			d.Log("%s: Max part limit reached, continuing slow part...", hash)
+			atomic.StoreInt32(&part.ctl, partCtlPinned)
 			_, err = part.copyBuffer(body, foff, true)
 			if err != nil {
 				d.handlers.ErrorHandler(hash, err)
+				part.unfinished = true
 			}
 			// return to prevent spawning further parts
 			err = nil
 			break
 		}
 
-		if d.maxConn != 0 && d.numConn >= d.maxConn {
+		if d.connLimitReached() {
 			// It waits until a connection is
 			// freed and spawns a new part once
 			// a slot is available.
@@ -1030,10 +1306,11 @@ func (d *Downloader) runPart(part *Part, ioff, foff, espeed int64, repeated bool
 
 		// current part will download the first half
 		// of pending bytes.
-		foff = poff + div - 1
+		atomic.StoreInt64(&foff, poff+div-1)
 
 		d.Log("%s: part respawned", hash)
 		d.handlers.RespawnPartHandler(hash, part.offset, poff, foff)
+		d.journalRange(journalResize, hash, part.offset, foff)
 		d.Log("%s: slow | %d | %d => %d", part.hash, part.getRead(), part.offset, foff)
 		repeated = false
 		espeed /= 2
@@ -1042,6 +1319,13 @@ func (d *Downloader) runPart(part *Part, ioff, foff, espeed int64, repeated bool
 	// return d.runPart(part, poff, foff, espeed/2, false, body)
 }
 
+// progressHandler counts the received bytes before passing them on
+// to the DownloadProgressHandler.
+func (d *Downloader) progressHandler(hash string, nread int) {
+	atomic.AddInt64(&d.received, int64(nread))
+	d.handlers.DownloadProgressHandler(hash, nread)
+}
+
 // Stop stops the download process.
 // Note: This only signals stop and cancels context. It does NOT wait for
 // goroutines to finish because Stop() may be called from within a callback
@@ -1079,7 +1363,7 @@ func (d *Downloader) Close() error {
 
 // GetMaxConnections returns the maximum number of possible connections.
 func (d *Downloader) GetMaxConnections() int32 {
-	return d.maxConn
+	return atomic.LoadInt32(&d.maxConn)
 }
 
 // GetMaxParts returns the maximum number of possible parts.
@@ -1108,6 +1392,12 @@ func (d *Downloader) GetContentLength() ContentLength {
 	return d.contentLength
 }
 
+// GetContentType returns the media type the server sent for the file,
+// empty if it sent none.
+func (d *Downloader) GetContentType() string {
+	return d.contentType
+}
+
 // GetContentLengthAsInt returns the content length as int64.
 func (d *Downloader) GetContentLengthAsInt() int64 {
 	return d.GetContentLength().v()
@@ -1126,7 +1416,7 @@ func (d *Downloader) GetHash() string {
 // NumConnections returns the number of connections
 // running currently.
 func (d *Downloader) NumConnections() int32 {
-	return d.numConn
+	return atomic.LoadInt32(&d.numConn)
 }
 
 // IsStopped returns true if the download was intentionally stopped.
@@ -1250,6 +1540,9 @@ func (d *Downloader) checkContentType(h *http.Header) (err error) {
 	if ct == "" {
 		return
 	}
+	if mt, _, er := mime.ParseMediaType(ct); er == nil {
+		d.contentType = mt
+	}
 	return
 }
 
@@ -1259,6 +1552,7 @@ func (d *Downloader) checkContentType(h *http.Header) (err error) {
 // to the final resolved URL so all subsequent parallel segment requests
 // use the final URL instead of re-triggering the redirect chain.
 func (d *Downloader) fetchInfo() (err error) {
+	rawURL := d.url
 	resp, er := d.makeRequest(http.MethodGet)
 	if er != nil {
 		err = er
@@ -1297,29 +1591,108 @@ func (d *Downloader) fetchInfo() (err error) {
 		return
 	}
 
-	// Extract checksums from response headers
-	d.expectedChecksums = ExtractChecksums(h)
-	// Enable validation if config is nil (use defaults) or if explicitly enabled
-	if len(d.expectedChecksums) > 0 && (d.checksumConfig == nil || d.checksumConfig.Enabled) {
-		// Select best algorithm
-		d.activeAlgorithm = SelectBestAlgorithm(d.expectedChecksums)
-		// Create hasher
-		d.activeHasher, err = NewHasher(d.activeAlgorithm)
+	if etag := h.Get("ETag"); !isWeakETag(etag) {
+		d.etag = etag
+	}
+
+	checksums := d.expectedChecksums
+	if d.discoverChecksums {
+		// sidecars sit next to the URL given, not where it redirects to
+		metaChecksums, pieces, metaSource := d.findMetalink(rawURL)
+		d.pieces = pieces
+		if len(checksums) == 0 {
+			checksums, d.checksumSource = d.findChecksums(rawURL)
+		}
+		if len(checksums) == 0 && len(metaChecksums) > 0 {
+			checksums, d.checksumSource = metaChecksums, metaSource
+		}
+	}
+	if len(checksums) == 0 {
+		checksums = ExtractChecksums(h)
+	}
+	d.setChecksums(checksums)
+
+	if d.signatureURL != "" {
+		d.signatureURL, d.signatureData, err = d.findSignature(rawURL)
 		if err != nil {
+			return
+		}
+	}
+
+	return d.prepareDownloader()
+}
+
+// setChecksums sets the checksums the file is validated against, hashing
+// it with all of their algorithms unless validation is disabled.
+func (d *Downloader) setChecksums(checksums []ExpectedChecksum) {
+	d.expectedChecksums = checksums
+	d.activeHasher = nil
+	d.activeAlgorithm = ""
+	if len(checksums) == 0 || (d.checksumConfig != nil && !d.checksumConfig.Enabled) {
+		return
+	}
+	var algos []ChecksumAlgorithm
+	for _, cs := range checksums {
+		if _, err := NewHasher(cs.Algorithm); err != nil {
 			// Log but don't fail - checksum is optional
 			if d.l != nil {
-				d.Log("Failed to create hasher for %s: %v", d.activeAlgorithm, err)
-			}
-			d.activeHasher = nil
-			d.activeAlgorithm = ""
-		} else {
-			if d.l != nil {
-				d.Log("Checksum validation enabled using %s", d.activeAlgorithm)
+				d.Log("Failed to create hasher for %s: %v", cs.Algorithm, err)
 			}
+			continue
 		}
+		algos = append(algos, cs.Algorithm)
+	}
+	if len(algos) == 0 {
+		return
+	}
+	h, err := NewMultiHasher(algos...)
+	if err != nil {
+		return
+	}
+	algo := SelectBestAlgorithm(checksums)
+	if !h.Has(algo) {
+		algo = algos[0]
 	}
+	d.activeAlgorithm, d.activeHasher = algo, h
+	if d.l != nil {
+		d.Log("Checksum validation enabled using %s", h)
+	}
+}
 
-	return d.prepareDownloader()
+// checksumFailed closes the saved file and quarantines or deletes it as
+// configured when err is a checksum mismatch or a failed signature
+// verification, returning err.
+func (d *Downloader) checksumFailed(err error) error {
+	if !(errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrSignatureInvalid)) || d.checksumConfig == nil {
+		return err
+	}
+	action := d.checksumConfig.OnMismatch
+	if action == "" || action == ChecksumMismatchFail {
+		return err
+	}
+	if cerr := d.closeMainFile(); cerr != nil {
+		return errors.Join(err, cerr)
+	}
+	savePath := d.GetSavePath()
+	switch action {
+	case ChecksumMismatchQuarantine:
+		dst := filepath.Join(QuarantineDir, d.hash+"_"+d.fileName)
+		if merr := WarpMkdirAll(QuarantineDir, 0755); merr != nil {
+			return errors.Join(err, merr)
+		}
+		if merr := moveFile(savePath, dst); merr != nil {
+			return errors.Join(err, merr)
+		}
+		d.Log("Quarantined the corrupt file to %s", dst)
+		return fmt.Errorf("%w (quarantined to %s)", err, dst)
+	case ChecksumMismatchDelete:
+		if rerr := WarpRemove(savePath); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		d.Log("Deleted the corrupt file")
+		return fmt.Errorf("%w (file deleted)", err)
+	}
+	return err
 }
 
 // makeRequest makes a new http request with provided method and headers.
@@ -1414,9 +1787,14 @@ func (d *Downloader) prepareDownloader() (err error) {
 }
 
 // downloadUnknownSizeFile is a fallback download handler in case the file
-// to be downloaded doesn't support multipart.
-func (d *Downloader) downloadUnknownSizeFile() error {
+// to be downloaded doesn't support multipart. It copies the response to dst.
+func (d *Downloader) downloadUnknownSizeFile(dst io.Writer) error {
 	defer d.wg.Done()
+	if err := d.acquireHostSlot(); err != nil {
+		// stopped while waiting for a slot
+		return err
+	}
+	defer d.releaseHostSlot()
 	req, err := http.NewRequestWithContext(d.ctx, http.MethodGet, d.url, nil)
 	if err != nil {
 		return err
@@ -1428,11 +1806,11 @@ func (d *Downloader) downloadUnknownSizeFile() error {
 		return err
 	}
 	defer resp.Body.Close()
-	proxiedBody := NewCallbackProxyReader(resp.Body, func(n int) {
+	proxiedBody := NewCallbackProxyReader(d.bandwidth.Wrap(resp.Body), func(n int) {
 		atomic.AddInt64(&d.nread, int64(n))
 		d.handlers.DownloadProgressHandler(MAIN_HASH, n)
 	})
-	_, err = io.Copy(d.f, proxiedBody)
+	_, err = io.Copy(dst, proxiedBody)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,191 @@
+package warplib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// DuplicatePolicy is what AddDownload does with a download that is
+// already known by its URL, its target path or its checksum.
+type DuplicatePolicy string
+
+const (
+	// DuplicateAllow adds the download regardless.
+	DuplicateAllow DuplicatePolicy = "allow"
+	// DuplicateReturn returns the existing download instead.
+	DuplicateReturn DuplicatePolicy = "return"
+	// DuplicateRefuse fails with a DuplicateError.
+	DuplicateRefuse DuplicatePolicy = "refuse"
+	// DuplicateAttach attaches the caller to the existing download if it
+	// is running, and returns it otherwise.
+	DuplicateAttach DuplicatePolicy = "attach"
+)
+
+// ParseDuplicatePolicy parses a duplicate policy name, empty meaning the
+// default of the manager.
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch p := DuplicatePolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "", DuplicateAllow, DuplicateReturn, DuplicateRefuse, DuplicateAttach:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid duplicate policy %q (want allow, return, refuse or attach)", s)
+}
+
+// DuplicateMatch is what a download has in common with its duplicate.
+type DuplicateMatch string
+
+const (
+	DuplicateURL      DuplicateMatch = "url"
+	DuplicatePath     DuplicateMatch = "path"
+	DuplicateChecksum DuplicateMatch = "checksum"
+)
+
+// DuplicateAction is what became of a duplicate download.
+type DuplicateAction string
+
+const (
+	// DuplicateReturned means the existing download was returned.
+	DuplicateReturned DuplicateAction = "returned"
+	// DuplicateAttached means the caller should follow the running
+	// existing download.
+	DuplicateAttached DuplicateAction = "attached"
+	// DuplicateRefused means the download was refused.
+	DuplicateRefused DuplicateAction = "refused"
+)
+
+// ErrDuplicateDownload matches every DuplicateError.
+var ErrDuplicateDownload = errors.New("duplicate download")
+
+// DuplicateError is returned by AddDownload and AddProtocolDownload when
+// the download duplicates Item. No new item is added whatever the Action.
+type DuplicateError struct {
+	Item   *Item
+	Match  DuplicateMatch
+	Action DuplicateAction
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s: same %s as download %s (%s)", ErrDuplicateDownload, e.Match, e.Item.Hash, e.Action)
+}
+
+func (e *DuplicateError) Is(target error) bool {
+	return target == ErrDuplicateDownload
+}
+
+// SetDuplicatePolicy sets what is done with the downloads added from now
+// on that duplicate an existing one, unless they set their own policy.
+func (m *Manager) SetDuplicatePolicy(p DuplicatePolicy) {
+	m.duplicates = p
+}
+
+// checkDuplicate looks for a download duplicating the one being added,
+// returning a DuplicateError unless policy allows it. Completed downloads
+// count only while their file is on disk and isn't being overwritten.
+func (m *Manager) checkDuplicate(policy DuplicatePolicy, rawURL, path string, checksums []ExpectedChecksum, overwrite bool) error {
+	if policy == "" {
+		policy = m.duplicates
+	}
+	if policy == "" || policy == DuplicateAllow {
+		return nil
+	}
+	item, match := m.findDuplicate(rawURL, path, checksums, overwrite)
+	if item == nil {
+		return nil
+	}
+	action := DuplicateReturned
+	switch {
+	case policy == DuplicateRefuse:
+		action = DuplicateRefused
+	case policy == DuplicateAttach && !isComplete(item) && item.IsDownloading():
+		action = DuplicateAttached
+	}
+	return &DuplicateError{Item: item, Match: match, Action: action}
+}
+
+// findDuplicate returns the first download with the same normalized URL,
+// target path or a common checksum, in that order of precedence.
+func (m *Manager) findDuplicate(rawURL, path string, checksums []ExpectedChecksum, overwrite bool) (*Item, DuplicateMatch) {
+	u := normalizeURL(rawURL)
+	var byPath, byChecksum *Item
+	for _, item := range m.GetItems() {
+		if item.Children {
+			continue
+		}
+		if isComplete(item) {
+			if _, err := WarpStat(item.GetAbsolutePath()); overwrite || err != nil {
+				continue
+			}
+		}
+		if normalizeURL(item.Url) == u {
+			return item, DuplicateURL
+		}
+		if byPath == nil && filepath.Clean(item.GetAbsolutePath()) == filepath.Clean(path) {
+			byPath = item
+		}
+		if byChecksum == nil && sameChecksum(item.Checksums, checksums) {
+			byChecksum = item
+		}
+	}
+	if byPath != nil {
+		return byPath, DuplicatePath
+	}
+	if byChecksum != nil {
+		return byChecksum, DuplicateChecksum
+	}
+	return nil, ""
+}
+
+// isComplete reports whether all of the item is downloaded.
+func isComplete(item *Item) bool {
+	return item.GetTotalSize() > 0 && item.GetDownloaded() >= item.GetTotalSize()
+}
+
+// sameChecksum reports whether a and b hold a checksum of the same
+// algorithm and value.
+func sameChecksum(a, b []ExpectedChecksum) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Algorithm == y.Algorithm && len(x.Value) > 0 && bytes.Equal(x.Value, y.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeURL returns rawURL without credentials, fragment, default port
+// and case differences in the scheme and host, its query sorted, so that
+// spellings of the same URL compare equal.
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	switch {
+	case port == "80" && u.Scheme == "http",
+		port == "443" && u.Scheme == "https",
+		port == "21" && (u.Scheme == "ftp" || u.Scheme == "ftps"),
+		port == "22" && u.Scheme == "sftp":
+		port = ""
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = u.Query().Encode()
+	return u.String()
+}
@@ -62,6 +62,10 @@ var (
 	// does not match the expected checksum from the server.
 	ErrChecksumMismatch = errors.New("checksum mismatch")
 
+	// ErrChecksumNotSupported is returned when expected checksums are given
+	// for a download whose protocol doesn't validate them.
+	ErrChecksumNotSupported = errors.New("checksums are only validated for http and https downloads")
+
 	// ErrChecksumUnavailable is returned when checksum validation is requested
 	// but no checksum is provided by the server.
 	ErrChecksumUnavailable = errors.New("no checksum available from server")
@@ -70,6 +74,42 @@ var (
 	// a checksum algorithm that is not supported.
 	ErrChecksumAlgorithmUnsupported = errors.New("unsupported checksum algorithm")
 
+	// ErrSignatureInvalid is returned when the detached signature of a
+	// download can't be found or isn't a valid signature of the file by a
+	// trusted key.
+	ErrSignatureInvalid = errors.New("signature verification failed")
+
+	// ErrSignatureNotSupported is returned when signature verification is
+	// asked for a download whose protocol doesn't verify signatures.
+	ErrSignatureNotSupported = errors.New("signatures are only verified for http and https downloads")
+
+	// ErrKeyNotFound is returned when a key isn't in the keyring.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrKeyExists is returned when a key of the same name is already in
+	// the keyring.
+	ErrKeyExists = errors.New("key already exists")
+
+	// ErrNoPieceHashes is returned when repairing a download without
+	// piece hashes.
+	ErrNoPieceHashes = errors.New("download has no piece hashes to repair it with")
+
+	// ErrRepairNotSupported is returned when repairing a download of
+	// another protocol than http and https.
+	ErrRepairNotSupported = errors.New("only http and https downloads can be repaired")
+
+	// ErrRepairItemDownloading is returned when repairing a download which
+	// is running.
+	ErrRepairItemDownloading = errors.New("item you are trying to repair is currently downloading")
+
+	// ErrRepairFailed is returned when corrupt pieces couldn't be
+	// downloaded again.
+	ErrRepairFailed = errors.New("repair failed")
+
+	// ErrVerifyIncomplete is returned when verifying a download which
+	// isn't completely downloaded.
+	ErrVerifyIncomplete = errors.New("item you are trying to verify is not completely downloaded")
+
 	// ErrDirectoryNotFound is returned when the specified download directory does not exist.
 	ErrDirectoryNotFound = errors.New("download directory does not exist")
 
@@ -84,4 +124,15 @@ var (
 
 	// ErrCannotMoveActive is returned when attempting to move an active download in the queue.
 	ErrCannotMoveActive = errors.New("cannot move active download, only waiting downloads can be moved")
+
+	// ErrLiveChangeUnsupported is returned when options of a running download
+	// cannot be changed, e.g. for FTP/SFTP or single-connection HTTP downloads.
+	ErrLiveChangeUnsupported = errors.New("download does not support changing this option while running")
+
+	// ErrInvalidMaxConnections is returned when a connection limit below 1 is requested.
+	ErrInvalidMaxConnections = errors.New("max connections must be at least 1")
+
+	// ErrServerThrottled is returned when the server answers a part request
+	// with 429 Too Many Requests or 503 Service Unavailable.
+	ErrServerThrottled = errors.New("server throttled the request")
 )
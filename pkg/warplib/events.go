@@ -0,0 +1,179 @@
+package warplib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ItemEvent is a point in the life of a download that the handlers added
+// with Manager.AddEventHandler are told about.
+type ItemEvent string
+
+const (
+	// EventAdded is sent when a download has been added to the manager.
+	EventAdded ItemEvent = "added"
+	// EventStarted is sent when the first bytes of a run of a download,
+	// started or resumed, have been received.
+	EventStarted ItemEvent = "started"
+	// EventProgress is sent each time a download passes a multiple of
+	// ProgressMilestone percent, 100 excluded.
+	EventProgress ItemEvent = "progress"
+	// EventComplete is sent when a download has finished.
+	EventComplete ItemEvent = "complete"
+	// EventError is sent when a download ended because of an error.
+	EventError ItemEvent = "error"
+	// EventStopped is sent when a download was stopped before finishing.
+	EventStopped ItemEvent = "stopped"
+	// EventChecksumFail is sent when the downloaded file doesn't match
+	// its expected checksum.
+	EventChecksumFail ItemEvent = "checksum-fail"
+)
+
+// ProgressMilestone is the step, in percent, between two EventProgress
+// events of a download.
+const ProgressMilestone = 25
+
+// ItemEventHandlerFunc handles an event of a download. err is the error
+// behind EventError and EventChecksumFail, nil for the other events.
+type ItemEventHandlerFunc func(item *Item, ev ItemEvent, err error)
+
+// AddEventHandler adds a handler called on the events of every download
+// added or resumed from now on. Handlers are called on the download's
+// goroutine, so anything slow has to run on its own.
+func (m *Manager) AddEventHandler(fn ItemEventHandlerFunc) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	m.events = append(m.events, fn)
+}
+
+// emit calls the event handlers with an event of item.
+func (m *Manager) emit(item *Item, ev ItemEvent, err error) {
+	m.eventsMu.RLock()
+	handlers := m.events
+	m.eventsMu.RUnlock()
+	for _, fn := range handlers {
+		fn(item, ev, err)
+	}
+}
+
+// recordRun keeps the error and the average speed of the latest run of a
+// download. The manager handles the events with it before any other
+// handler, so they see the download up to date.
+func (m *Manager) recordRun(item *Item, ev ItemEvent, err error) {
+	item.mu.Lock()
+	switch ev {
+	case EventStarted:
+		item.Error = ""
+		item.runStart, item.runFrom = time.Now(), item.Downloaded
+		item.mu.Unlock()
+		return
+	case EventError, EventChecksumFail:
+		if err != nil {
+			item.Error = err.Error()
+		}
+	case EventComplete, EventStopped:
+	default:
+		item.mu.Unlock()
+		return
+	}
+	if !item.runStart.IsZero() {
+		if elapsed := time.Since(item.runStart); elapsed > 0 {
+			item.Speed = int64(item.Downloaded-item.runFrom) * int64(time.Second) / int64(elapsed)
+		}
+		item.runStart = time.Time{}
+	}
+	item.mu.Unlock()
+	m.UpdateItem(item)
+}
+
+// patchEventHandlers wraps the handlers of one run of a download to emit
+// its events. The error, stop, checksum and progress handlers may be nil.
+// Milestones already passed before a resume are not sent again.
+// A download that ends after an error, stopped or not, ends with
+// EventError instead of EventStopped or EventComplete.
+func (m *Manager) patchEventHandlers(h *Handlers, item *Item) {
+	var (
+		mu        sync.Mutex
+		runErr    error
+		started   bool
+		milestone = item.GetPercentage() / ProgressMilestone * ProgressMilestone
+	)
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return runErr
+	}
+	oEH := h.ErrorHandler
+	h.ErrorHandler = func(hash string, err error) {
+		// cancellation is how a stop reaches the parts
+		if !errors.Is(err, context.Canceled) {
+			mu.Lock()
+			if runErr == nil {
+				runErr = err
+			}
+			mu.Unlock()
+		}
+		if oEH != nil {
+			oEH(hash, err)
+		}
+	}
+	oPH := h.DownloadProgressHandler
+	h.DownloadProgressHandler = func(hash string, nread int) {
+		if oPH != nil {
+			oPH(hash, nread)
+		}
+		reached := item.GetPercentage() / ProgressMilestone * ProgressMilestone
+		mu.Lock()
+		first := !started
+		started = true
+		passed := reached > milestone && reached < 100
+		if passed {
+			milestone = reached
+		}
+		mu.Unlock()
+		if first {
+			m.emit(item, EventStarted, nil)
+		}
+		if passed {
+			m.emit(item, EventProgress, nil)
+		}
+	}
+	oDSH := h.DownloadStoppedHandler
+	h.DownloadStoppedHandler = func() {
+		if oDSH != nil {
+			oDSH()
+		}
+		if err := failed(); err != nil {
+			m.emit(item, EventError, err)
+			return
+		}
+		m.emit(item, EventStopped, nil)
+	}
+	oCVH := h.ChecksumValidationHandler
+	h.ChecksumValidationHandler = func(result ChecksumResult) {
+		if oCVH != nil {
+			oCVH(result)
+		}
+		if !result.Match {
+			m.emit(item, EventChecksumFail, fmt.Errorf("%w: %s expected %x, got %x",
+				ErrChecksumMismatch, result.Algorithm, result.Expected, result.Actual))
+		}
+	}
+	oDCH := h.DownloadCompleteHandler
+	h.DownloadCompleteHandler = func(hash string, tread int64) {
+		if oDCH != nil {
+			oDCH(hash, tread)
+		}
+		if hash != MAIN_HASH {
+			return
+		}
+		if err := failed(); err != nil {
+			m.emit(item, EventError, err)
+			return
+		}
+		m.emit(item, EventComplete, nil)
+	}
+}
@@ -0,0 +1,110 @@
+package warplib
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type recordedEvent struct {
+	ev  ItemEvent
+	err error
+}
+
+// newEventTestHandlers returns handlers patched to emit the events of
+// item, and the events emitted so far.
+func newEventTestHandlers(t *testing.T) (*Handlers, *[]recordedEvent) {
+	t.Helper()
+	return newEventTestItemHandlers(t, &Item{Hash: "h"})
+}
+
+func newEventTestItemHandlers(t *testing.T, item *Item) (*Handlers, *[]recordedEvent) {
+	t.Helper()
+	m := &Manager{}
+	var got []recordedEvent
+	m.AddEventHandler(func(i *Item, ev ItemEvent, err error) {
+		if i != item {
+			t.Errorf("event of item %v, want %v", i, item)
+		}
+		got = append(got, recordedEvent{ev, err})
+	})
+	h := &Handlers{}
+	m.patchEventHandlers(h, item)
+	return h, &got
+}
+
+func TestManagerEvents_Complete(t *testing.T) {
+	h, got := newEventTestHandlers(t)
+	h.DownloadCompleteHandler("part", 10)
+	h.DownloadCompleteHandler(MAIN_HASH, 100)
+	if len(*got) != 1 || (*got)[0].ev != EventComplete {
+		t.Fatalf("events = %+v, want one complete", *got)
+	}
+}
+
+func TestManagerEvents_StopAfterErrorIsError(t *testing.T) {
+	h, got := newEventTestHandlers(t)
+	boom := errors.New("boom")
+	h.ErrorHandler("part", boom)
+	h.DownloadStoppedHandler()
+	if len(*got) != 1 || (*got)[0].ev != EventError || !errors.Is((*got)[0].err, boom) {
+		t.Fatalf("events = %+v, want error with boom", *got)
+	}
+}
+
+func TestManagerEvents_StopIgnoresCancellation(t *testing.T) {
+	h, got := newEventTestHandlers(t)
+	h.ErrorHandler("part", context.Canceled)
+	h.DownloadStoppedHandler()
+	if len(*got) != 1 || (*got)[0].ev != EventStopped || (*got)[0].err != nil {
+		t.Fatalf("events = %+v, want stopped", *got)
+	}
+}
+
+func TestManagerEvents_ChecksumFail(t *testing.T) {
+	h, got := newEventTestHandlers(t)
+	h.ChecksumValidationHandler(ChecksumResult{Algorithm: ChecksumSHA256, Match: true})
+	h.ChecksumValidationHandler(ChecksumResult{Algorithm: ChecksumSHA256, Expected: []byte{1}, Actual: []byte{2}})
+	if len(*got) != 1 || (*got)[0].ev != EventChecksumFail || !errors.Is((*got)[0].err, ErrChecksumMismatch) {
+		t.Fatalf("events = %+v, want checksum-fail", *got)
+	}
+}
+
+func TestManagerEvents_ProgressMilestones(t *testing.T) {
+	// resumed at 30%: the 25% milestone was already passed
+	item := &Item{Hash: "h", TotalSize: 100, Downloaded: 30}
+	h, got := newEventTestItemHandlers(t, item)
+	for _, n := range []int{10, 5, 20, 34, 1} {
+		item.Downloaded += ContentLength(n)
+		h.DownloadProgressHandler("part", n)
+	}
+	var evs []ItemEvent
+	for _, e := range *got {
+		evs = append(evs, e.ev)
+	}
+	// 40 (started), 45, 65 (50%), 99 (75%), 100 (not a milestone)
+	want := []ItemEvent{EventStarted, EventProgress, EventProgress}
+	if len(evs) != len(want) {
+		t.Fatalf("events = %v, want %v", evs, want)
+	}
+	for i := range want {
+		if evs[i] != want[i] {
+			t.Fatalf("events = %v, want %v", evs, want)
+		}
+	}
+}
+
+func TestHooks_Command(t *testing.T) {
+	h := &Hooks{OnComplete: "a", OnError: "b", OnStopped: "c", OnChecksumFail: "d"}
+	for ev, want := range map[ItemEvent]string{
+		EventComplete: "a", EventError: "b", EventStopped: "c", EventChecksumFail: "d", "other": "",
+	} {
+		if got := h.Command(ev); got != want {
+			t.Errorf("Command(%s) = %q, want %q", ev, got, want)
+		}
+	}
+	var none *Hooks
+	if none.Command(EventComplete) != "" || !none.IsEmpty() {
+		t.Error("nil hooks should be empty")
+	}
+}
@@ -0,0 +1,746 @@
+package warplib
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// EXTRACT_HASH is the hash the compile handlers are called with while the
+// archive of a completed download is extracted. Progress is in bytes of
+// the archive.
+const EXTRACT_HASH = "extract"
+
+// ExtractFileName is the name of the archive extraction rules file inside
+// the config directory.
+const ExtractFileName = "extract.json"
+
+// Default limits of an extraction.
+const (
+	DEF_EXTRACT_MAX_SIZE  = 100 * GB
+	DEF_EXTRACT_MAX_FILES = 100000
+	DEF_EXTRACT_MAX_RATIO = 200
+)
+
+// extractRatioFloor is the size up to which any archive may expand,
+// whatever its compression ratio, so small archives of sparse data
+// aren't refused.
+const extractRatioFloor = 1 * GB
+
+var (
+	// ErrNotArchive is returned when extracting a file of an unsupported format.
+	ErrNotArchive = errors.New("not a supported archive")
+	// ErrUnsafeArchivePath is returned for archive entries that would be
+	// written outside of the extraction directory.
+	ErrUnsafeArchivePath = errors.New("unsafe path in archive")
+	// ErrExtractLimit is returned when an archive expands beyond the
+	// extraction limits, as zip bombs do.
+	ErrExtractLimit = errors.New("archive exceeds extraction limits")
+	// ErrExtractExists is returned for archive entries that would replace
+	// a file already in the extraction directory.
+	ErrExtractExists = errors.New("file already exists")
+)
+
+// maxExtractSymlinks bounds the symlinks followed to resolve one path, as
+// operating systems do, so symlink loops fail.
+const maxExtractSymlinks = 40
+
+// ExtractOpts asks for the archive of a download to be extracted once it
+// has completed and its checksum, if any, matched.
+type ExtractOpts struct {
+	// Dir is the extraction directory, relative to the download directory
+	// if not absolute. Empty means DefaultExtractDir.
+	Dir string `json:"dir,omitempty"`
+	// DeleteArchive removes the archive after a successful extraction.
+	DeleteArchive bool `json:"delete_archive,omitempty"`
+}
+
+// ExtractLimits bound what an archive may expand to. Zero values mean the
+// defaults.
+type ExtractLimits struct {
+	// MaxSize is the total size of the extracted files, in bytes.
+	MaxSize int64 `json:"max_size,omitempty"`
+	// MaxFiles is the number of extracted entries.
+	MaxFiles int `json:"max_files,omitempty"`
+	// MaxRatio is the extracted size divided by the archive size, only
+	// checked beyond 1GB of extracted data.
+	MaxRatio int64 `json:"max_ratio,omitempty"`
+}
+
+func (l *ExtractLimits) withDefaults() ExtractLimits {
+	var res ExtractLimits
+	if l != nil {
+		res = *l
+	}
+	if res.MaxSize <= 0 {
+		res.MaxSize = DEF_EXTRACT_MAX_SIZE
+	}
+	if res.MaxFiles <= 0 {
+		res.MaxFiles = DEF_EXTRACT_MAX_FILES
+	}
+	if res.MaxRatio <= 0 {
+		res.MaxRatio = DEF_EXTRACT_MAX_RATIO
+	}
+	return res
+}
+
+// ExtractRule extracts the downloads matching it automatically.
+type ExtractRule struct {
+	// Match is a glob of the file name, such as "*.tar.gz". Empty matches
+	// any archive.
+	Match string `json:"match,omitempty"`
+	// Host restricts the rule to downloads from this host or its subdomains.
+	Host string `json:"host,omitempty"`
+	ExtractOpts
+}
+
+// matches reports whether the rule applies to a download of name from rawURL.
+func (r *ExtractRule) matches(name, rawURL string) bool {
+	if r.Match != "" {
+		if ok, _ := filepath.Match(strings.ToLower(r.Match), strings.ToLower(name)); !ok {
+			return false
+		}
+	}
+	if r.Host != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return false
+		}
+		host, want := strings.ToLower(u.Hostname()), strings.ToLower(r.Host)
+		if host != want && !strings.HasSuffix(host, "."+want) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExtractConfig is the extraction rules file:
+//
+//	{
+//	  "limits": {"max_size": 53687091200, "max_files": 50000},
+//	  "rules": [
+//	    {"match": "*.tar.gz", "host": "github.com", "dir": "src"},
+//	    {"match": "*.zip", "delete_archive": true}
+//	  ]
+//	}
+//
+// The first rule matching a download applies. Rules only apply to archives
+// and not to downloads with their own extraction options.
+type ExtractConfig struct {
+	Limits ExtractLimits `json:"limits"`
+	Rules  []ExtractRule `json:"rules,omitempty"`
+}
+
+// LoadExtractConfig reads the extraction rules from path.
+// A missing file results in no rules and the default limits.
+func LoadExtractConfig(path string) (*ExtractConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &ExtractConfig{}, nil
+		}
+		return nil, err
+	}
+	var cfg ExtractConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse extract file %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the limits and the globs of the rules.
+func (c *ExtractConfig) Validate() error {
+	if c.Limits.MaxSize < 0 || c.Limits.MaxFiles < 0 || c.Limits.MaxRatio < 0 {
+		return errors.New("extract limits must not be negative")
+	}
+	for i, r := range c.Rules {
+		if _, err := filepath.Match(r.Match, ""); err != nil {
+			return fmt.Errorf("extract rule %d: invalid match %q: %w", i+1, r.Match, err)
+		}
+	}
+	return nil
+}
+
+// match returns the options of the first rule matching an archive, nil if
+// none does or name is not an archive.
+func (c *ExtractConfig) match(name, rawURL string) *ExtractOpts {
+	if c == nil || !IsArchive(name) {
+		return nil
+	}
+	for _, r := range c.Rules {
+		if r.matches(name, rawURL) {
+			opts := r.ExtractOpts
+			return &opts
+		}
+	}
+	return nil
+}
+
+// SetExtractConfig sets the extraction rules and limits of the downloads
+// added or completed from now on.
+func (m *Manager) SetExtractConfig(cfg *ExtractConfig) {
+	m.extract = cfg
+}
+
+// archiveFormat is an archive format known by its file name suffix.
+type archiveFormat struct {
+	suffix string
+	// tar is set for tarballs, unset for a single compressed file.
+	tar bool
+	// decompress is nil for uncompressed tarballs.
+	decompress func(io.Reader) (io.ReadCloser, error)
+}
+
+func gzipReader(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+
+func bzip2Reader(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(bzip2.NewReader(r)), nil }
+
+func xzReader(r io.Reader) (io.ReadCloser, error) {
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(xr), nil
+}
+
+func zstdReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// archiveFormats are the formats extracted besides zip, longest suffixes
+// first.
+var archiveFormats = []archiveFormat{
+	{".tar.gz", true, gzipReader},
+	{".tgz", true, gzipReader},
+	{".tar.bz2", true, bzip2Reader},
+	{".tbz2", true, bzip2Reader},
+	{".tbz", true, bzip2Reader},
+	{".tar.xz", true, xzReader},
+	{".txz", true, xzReader},
+	{".tar.zst", true, zstdReader},
+	{".tzst", true, zstdReader},
+	{".tar", true, nil},
+	{".gz", false, gzipReader},
+	{".bz2", false, bzip2Reader},
+	{".xz", false, xzReader},
+	{".zst", false, zstdReader},
+}
+
+// formatOf returns the format of the archive name, nil for zip and for
+// unsupported files.
+func formatOf(name string) *archiveFormat {
+	lower := strings.ToLower(name)
+	for i := range archiveFormats {
+		if strings.HasSuffix(lower, archiveFormats[i].suffix) {
+			return &archiveFormats[i]
+		}
+	}
+	return nil
+}
+
+func isZip(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".zip")
+}
+
+// IsArchive reports whether the file name is of an archive that can be
+// extracted: zip, tar, or a tarball or single file compressed with gzip,
+// bzip2, xz or zstd.
+func IsArchive(name string) bool {
+	return isZip(name) || formatOf(name) != nil
+}
+
+// archiveBaseName returns name without its archive suffix.
+func archiveBaseName(name string) string {
+	suffix := filepath.Ext(name)
+	if f := formatOf(name); f != nil {
+		suffix = f.suffix
+	}
+	return name[:len(name)-len(suffix)]
+}
+
+// DefaultExtractDir returns where the archive name downloaded to dir is
+// extracted by default: a directory named after a zip or tarball, dir
+// itself for a single compressed file.
+func DefaultExtractDir(dir, name string) string {
+	if f := formatOf(name); f != nil && !f.tar {
+		return dir
+	}
+	return filepath.Join(dir, archiveBaseName(name))
+}
+
+// ExtractArchive extracts the archive at path into dest, created if
+// missing. Entries that would land outside of dest, symlinks followed, or
+// replace an existing file are refused and extraction stops once the
+// archive exceeds limits, nil meaning the defaults. progress, if not nil, is called with the number of bytes of
+// the archive processed.
+func ExtractArchive(path, dest string, limits *ExtractLimits, progress func(n int)) error {
+	f, err := WarpOpen(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	dest, err = filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	if err := WarpMkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	// entries are checked against the real dest, symlinks resolved
+	dest, err = filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	x := &extractor{dest: dest, limits: limits.withDefaults(), archiveSize: fi.Size()}
+	name := filepath.Base(path)
+	if isZip(name) {
+		err = x.zip(f, fi.Size(), progress)
+	} else if format := formatOf(name); format != nil {
+		err = x.stream(f, name, format, progress)
+	} else {
+		return fmt.Errorf("%w: %s", ErrNotArchive, name)
+	}
+	if err != nil {
+		return err
+	}
+	return x.finish()
+}
+
+// progressReader calls progress with the bytes read through it.
+type progressReader struct {
+	r        io.Reader
+	progress func(n int)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 && p.progress != nil {
+		p.progress(n)
+	}
+	return n, err
+}
+
+// extractor writes the entries of one archive, keeping them inside dest
+// and within limits.
+type extractor struct {
+	dest        string
+	limits      ExtractLimits
+	archiveSize int64
+	written     int64
+	files       int
+	// symlinks are created last, so no entry is written through one.
+	symlinks []pendingSymlink
+}
+
+type pendingSymlink struct {
+	name, target string
+}
+
+// stream extracts a tarball or a single compressed file.
+func (x *extractor) stream(f io.Reader, name string, format *archiveFormat, progress func(n int)) error {
+	var r io.Reader = &progressReader{r: f, progress: progress}
+	if format.decompress != nil {
+		dr, err := format.decompress(r)
+		if err != nil {
+			return err
+		}
+		defer dr.Close()
+		r = dr
+	}
+	if !format.tar {
+		return x.writeFile(archiveBaseName(name), r, 0644)
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(hdr.Name)
+		case tar.TypeReg:
+			err = x.writeFile(hdr.Name, tr, hdr.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = x.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			err = x.link(hdr.Name, hdr.Linkname)
+		default:
+			// devices, fifos and extended headers are not extracted
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// zip extracts a zip archive.
+func (x *extractor) zip(f io.ReaderAt, size int64, progress func(n int)) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if err := x.zipEntry(zf); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(int(zf.CompressedSize64))
+		}
+	}
+	return nil
+}
+
+func (x *extractor) zipEntry(zf *zip.File) error {
+	mode := zf.Mode()
+	switch {
+	case mode.IsDir():
+		return x.mkdir(zf.Name)
+	case mode&os.ModeSymlink != 0:
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		return x.symlink(zf.Name, string(target))
+	case mode.IsRegular():
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return x.writeFile(zf.Name, rc, mode)
+	default:
+		return nil
+	}
+}
+
+// path returns where the entry name is extracted, refusing absolute names
+// and names with ".." elements.
+func (x *extractor) path(name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || filepath.VolumeName(filepath.FromSlash(slashed)) != "" {
+		return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+	}
+	for _, elem := range strings.Split(slashed, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+		}
+	}
+	p := filepath.Join(x.dest, filepath.FromSlash(slashed))
+	if !x.inside(p) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+	}
+	return p, nil
+}
+
+// inside reports whether p is dest or under it.
+func (x *extractor) inside(p string) bool {
+	rel, err := filepath.Rel(x.dest, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// real returns where the entry name is written: its parent directory with
+// the symlinks on disk resolved, which must stay inside dest, joined with
+// its base name. Nothing is then written through a symlink.
+func (x *extractor) real(name string) (string, error) {
+	p, err := x.path(name)
+	if err != nil {
+		return "", err
+	}
+	if p == x.dest {
+		return p, nil
+	}
+	rel, err := filepath.Rel(x.dest, filepath.Dir(p))
+	if err != nil {
+		return "", err
+	}
+	var links int
+	dir, err := x.resolve(x.dest, rel, &links)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, name)
+	}
+	return filepath.Join(dir, filepath.Base(p)), nil
+}
+
+// resolve returns the real path of rel, relative to the real directory
+// dir, following the symlinks on disk. It fails with ErrUnsafeArchivePath
+// as soon as the path leaves dest. The elements which don't exist are
+// kept as they are.
+func (x *extractor) resolve(dir, rel string, links *int) (string, error) {
+	cur := dir
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, elem)
+			fi, err := os.Lstat(cur)
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			if fi.Mode()&os.ModeSymlink == 0 {
+				break
+			}
+			if *links++; *links > maxExtractSymlinks {
+				return "", fmt.Errorf("%w: too many levels of symlinks", ErrUnsafeArchivePath)
+			}
+			target, err := os.Readlink(cur)
+			if err != nil {
+				return "", err
+			}
+			if filepath.IsAbs(target) {
+				return "", ErrUnsafeArchivePath
+			}
+			if cur, err = x.resolve(filepath.Dir(cur), target, links); err != nil {
+				return "", err
+			}
+		}
+		if !x.inside(cur) {
+			return "", ErrUnsafeArchivePath
+		}
+	}
+	return cur, nil
+}
+
+// exists turns the error of creating the entry name over an existing file
+// into ErrExtractExists.
+func exists(name string, err error) error {
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrExtractExists, name)
+	}
+	return err
+}
+
+// entry counts an entry against the file limit.
+func (x *extractor) entry(name string) error {
+	x.files++
+	if x.files > x.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrExtractLimit, x.limits.MaxFiles)
+	}
+	return nil
+}
+
+// budget returns how many more bytes may be extracted.
+func (x *extractor) budget() int64 {
+	allowed := x.archiveSize * x.limits.MaxRatio
+	if allowed < extractRatioFloor {
+		allowed = extractRatioFloor
+	}
+	if allowed > x.limits.MaxSize {
+		allowed = x.limits.MaxSize
+	}
+	return allowed - x.written
+}
+
+func (x *extractor) mkdir(name string) error {
+	p, err := x.real(name)
+	if err != nil {
+		return err
+	}
+	if err := x.entry(name); err != nil {
+		return err
+	}
+	return WarpMkdirAll(p, 0755)
+}
+
+// writeFile extracts a regular file. An existing file is neither replaced
+// nor written through, in case it is unrelated or a symlink.
+func (x *extractor) writeFile(name string, r io.Reader, mode os.FileMode) error {
+	p, err := x.real(name)
+	if err != nil {
+		return err
+	}
+	if err := x.entry(name); err != nil {
+		return err
+	}
+	if err := WarpMkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := WarpOpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0600)
+	if err != nil {
+		return exists(name, err)
+	}
+	budget := x.budget()
+	n, err := io.Copy(f, io.LimitReader(r, budget+1))
+	x.written += n
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if n > budget {
+		return fmt.Errorf("%w: %s expands beyond %s", ErrExtractLimit, filepath.Base(p), ContentLength(x.written).String())
+	}
+	return nil
+}
+
+// symlink records a symlink to create once the files are extracted. Its
+// target must stay inside dest.
+func (x *extractor) symlink(name, target string) error {
+	p, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	if err := x.entry(name); err != nil {
+		return err
+	}
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") || strings.HasPrefix(target, `\`) ||
+		!x.inside(filepath.Join(filepath.Dir(p), filepath.FromSlash(target))) {
+		return fmt.Errorf("%w: %s links to %s", ErrUnsafeArchivePath, name, target)
+	}
+	x.symlinks = append(x.symlinks, pendingSymlink{name, target})
+	return nil
+}
+
+// link creates a hard link to a regular file extracted before, found
+// through its real path.
+func (x *extractor) link(name, target string) error {
+	p, err := x.real(name)
+	if err != nil {
+		return err
+	}
+	if _, err := x.path(target); err != nil {
+		return err
+	}
+	var links int
+	src, err := x.resolve(x.dest, target, &links)
+	if err != nil {
+		return fmt.Errorf("%w: %s links to %s", err, name, target)
+	}
+	if fi, err := os.Lstat(src); err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s links to %s, not an extracted file", ErrUnsafeArchivePath, name, target)
+	}
+	if err := x.entry(name); err != nil {
+		return err
+	}
+	if err := WarpMkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return exists(name, os.Link(src, p))
+}
+
+// finish creates the symlinks, each in the real directory of its entry,
+// then checks them all again as a symlink created later may change where
+// an earlier one points. The symlinks of a failed check are removed.
+func (x *extractor) finish() error {
+	created := make([]string, 0, len(x.symlinks))
+	var err error
+	defer func() {
+		if err != nil {
+			for _, p := range created {
+				_ = WarpRemove(p)
+			}
+		}
+	}()
+	for _, l := range x.symlinks {
+		var p string
+		if p, err = x.real(l.name); err != nil {
+			return err
+		}
+		if err = x.checkSymlink(p, l); err != nil {
+			return err
+		}
+		if err = WarpMkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err = exists(l.name, os.Symlink(l.target, p)); err != nil {
+			return err
+		}
+		created = append(created, p)
+	}
+	for i, p := range created {
+		if err = x.checkSymlink(p, x.symlinks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSymlink checks that the symlink l at p resolves inside dest.
+func (x *extractor) checkSymlink(p string, l pendingSymlink) error {
+	var links int
+	if _, err := x.resolve(filepath.Dir(p), l.target, &links); err != nil {
+		return fmt.Errorf("%w: %s links to %s", err, l.name, l.target)
+	}
+	return nil
+}
+
+// extractDownload extracts the archive of a completed download if its item
+// asks for it, reporting progress through the compile handlers with
+// EXTRACT_HASH. The handlers may be nil.
+func (m *Manager) extractDownload(item *Item, start CompileStartHandlerFunc, progress CompileProgressHandlerFunc, complete CompileCompleteHandlerFunc) error {
+	opts := item.Extract
+	if opts == nil {
+		return nil
+	}
+	archive := item.GetAbsolutePath()
+	dest := opts.Dir
+	if dest == "" {
+		dest = DefaultExtractDir(item.AbsoluteLocation, item.Name)
+	} else if !filepath.IsAbs(dest) {
+		dest = filepath.Join(item.AbsoluteLocation, dest)
+	}
+	var limits *ExtractLimits
+	if m.extract != nil {
+		limits = &m.extract.Limits
+	}
+	if start != nil {
+		start(EXTRACT_HASH)
+	}
+	var read int64
+	err := ExtractArchive(archive, dest, limits, func(n int) {
+		read += int64(n)
+		if progress != nil {
+			progress(EXTRACT_HASH, n)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("extract %s: %w", item.Name, err)
+	}
+	if complete != nil {
+		complete(EXTRACT_HASH, read)
+	}
+	if opts.DeleteArchive {
+		if err := WarpRemove(archive); err != nil {
+			return fmt.Errorf("extract %s: delete archive: %w", item.Name, err)
+		}
+	}
+	return nil
+}
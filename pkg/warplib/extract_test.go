@@ -0,0 +1,369 @@
+package warplib
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// tarEntry is an entry of a test tarball: a file with body, a directory
+// if name ends with "/", or a symlink to link.
+type tarEntry struct {
+	name, body, link string
+	hard             bool
+}
+
+func makeTar(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case e.link != "" && e.hard:
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, e.link, 0
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		case e.name[len(e.name)-1] == '/':
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compress(t *testing.T, data []byte, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipWriter(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+func xzWriter(w io.Writer) (io.WriteCloser, error)   { return xz.NewWriter(w) }
+func zstdWriter(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// bzip2Tar is a tarball of docs/readme.txt ("hello bzip2\n") compressed
+// with bzip2, which the standard library can't write.
+const bzip2Tar = "QlpoOTFBWSZTWfOp89sAAHJ7gMqQAQBAAfUAIAB+Zt5QCAggAHQgkND1MgPUANPTUElENNANAAAPuqBqEEsaEIs5g8ZO9yBDAg0406g4UjBCOEEoylCnAHk9wHmcN0lp4zGvxEp+rNulmjbCIgH4u5IpwoSHnU+e2A=="
+
+func writeArchive(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read extracted file: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("%s = %q, want %q", path, got, want)
+	}
+}
+
+func TestExtractArchive_Formats(t *testing.T) {
+	tarball := makeTar(t, tarEntry{name: "docs/"}, tarEntry{name: "docs/readme.txt", body: "hello bzip2\n"})
+	bz2, err := base64.StdEncoding.DecodeString(bzip2Tar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archives := map[string][]byte{
+		"a.tar":     tarball,
+		"a.tar.gz":  compress(t, tarball, gzipWriter),
+		"a.tgz":     compress(t, tarball, gzipWriter),
+		"a.tar.bz2": bz2,
+		"a.tar.xz":  compress(t, tarball, xzWriter),
+		"a.tar.zst": compress(t, tarball, zstdWriter),
+		"a.zip":     makeZip(t, map[string]string{"docs/readme.txt": "hello bzip2\n"}),
+	}
+	for name, data := range archives {
+		t.Run(name, func(t *testing.T) {
+			archive := writeArchive(t, name, data)
+			dest := t.TempDir()
+			var read int
+			if err := ExtractArchive(archive, dest, nil, func(n int) { read += n }); err != nil {
+				t.Fatalf("ExtractArchive: %v", err)
+			}
+			assertFile(t, filepath.Join(dest, "docs", "readme.txt"), "hello bzip2\n")
+			if read == 0 {
+				t.Error("no progress reported")
+			}
+		})
+	}
+}
+
+func TestExtractArchive_SingleCompressedFile(t *testing.T) {
+	archive := writeArchive(t, "notes.txt.gz", compress(t, []byte("plain notes"), gzipWriter))
+	dir := filepath.Dir(archive)
+	if got := DefaultExtractDir(dir, "notes.txt.gz"); got != dir {
+		t.Fatalf("DefaultExtractDir = %s, want %s", got, dir)
+	}
+	if err := ExtractArchive(archive, dir, nil, nil); err != nil {
+		t.Fatalf("ExtractArchive: %v", err)
+	}
+	assertFile(t, filepath.Join(dir, "notes.txt"), "plain notes")
+}
+
+func TestExtractArchive_KeepsExistingFiles(t *testing.T) {
+	archive := writeArchive(t, "notes.txt.gz", compress(t, []byte("plain notes"), gzipWriter))
+	dir := filepath.Dir(archive)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractArchive(archive, dir, nil, nil); !errors.Is(err, ErrExtractExists) {
+		t.Fatalf("ExtractArchive = %v, want ErrExtractExists", err)
+	}
+	assertFile(t, filepath.Join(dir, "notes.txt"), "mine")
+}
+
+func TestExtractArchive_RefusesSymlinkedParents(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archives := map[string][]byte{
+		"write.tar":    makeTar(t, tarEntry{name: "out/evil.txt", body: "x"}),
+		"hardlink.tar": makeTar(t, tarEntry{name: "copy", link: "out/secret", hard: true}),
+	}
+	for name, data := range archives {
+		t.Run(name, func(t *testing.T) {
+			archive := writeArchive(t, name, data)
+			dest := t.TempDir()
+			if err := os.Symlink(outside, filepath.Join(dest, "out")); err != nil {
+				t.Skip("symlinks not permitted")
+			}
+			err := ExtractArchive(archive, dest, nil, nil)
+			if !errors.Is(err, ErrUnsafeArchivePath) {
+				t.Fatalf("ExtractArchive = %v, want ErrUnsafeArchivePath", err)
+			}
+			if _, err := os.Lstat(filepath.Join(outside, "evil.txt")); err == nil {
+				t.Fatal("file written outside of the extraction directory")
+			}
+			if _, err := os.Lstat(filepath.Join(dest, "copy")); err == nil {
+				t.Fatal("file outside of the extraction directory linked")
+			}
+		})
+	}
+}
+
+func TestExtractArchive_HardLinkInside(t *testing.T) {
+	archive := writeArchive(t, "hard.tar", makeTar(t,
+		tarEntry{name: "data/file.txt", body: "linked"},
+		tarEntry{name: "copy.txt", link: "data/file.txt", hard: true},
+	))
+	dest := t.TempDir()
+	if err := ExtractArchive(archive, dest, nil, nil); err != nil {
+		t.Fatalf("ExtractArchive: %v", err)
+	}
+	assertFile(t, filepath.Join(dest, "copy.txt"), "linked")
+}
+
+func TestExtractArchive_RefusesUnsafePaths(t *testing.T) {
+	archives := map[string][]byte{
+		"parent.tar":    makeTar(t, tarEntry{name: "../evil.txt", body: "x"}),
+		"nested.tar":    makeTar(t, tarEntry{name: "a/../../evil.txt", body: "x"}),
+		"absolute.tar":  makeTar(t, tarEntry{name: "/tmp/evil.txt", body: "x"}),
+		"symlink.tar":   makeTar(t, tarEntry{name: "link", link: "../../etc"}),
+		"abslink.tar":   makeTar(t, tarEntry{name: "link", link: "/etc/passwd"}),
+		"chained.tar":   makeTar(t, tarEntry{name: "a", link: "."}, tarEntry{name: "a/b", link: ".."}),
+		"reordered.tar": makeTar(t, tarEntry{name: "d", link: "c/.."}, tarEntry{name: "c", link: "."}),
+		"parent.zip":    makeZip(t, map[string]string{"../evil.txt": "x"}),
+		"backslash.zip": makeZip(t, map[string]string{`..\evil.txt`: "x"}),
+	}
+	for name, data := range archives {
+		t.Run(name, func(t *testing.T) {
+			archive := writeArchive(t, name, data)
+			dest := filepath.Join(t.TempDir(), "out")
+			err := ExtractArchive(archive, dest, nil, nil)
+			if !errors.Is(err, ErrUnsafeArchivePath) {
+				t.Fatalf("ExtractArchive = %v, want ErrUnsafeArchivePath", err)
+			}
+			if _, err := os.Lstat(filepath.Join(filepath.Dir(dest), "evil.txt")); err == nil {
+				t.Fatal("file written outside of the extraction directory")
+			}
+		})
+	}
+}
+
+func TestExtractArchive_SymlinkInside(t *testing.T) {
+	archive := writeArchive(t, "links.tar", makeTar(t,
+		tarEntry{name: "link.txt", link: "data/file.txt"},
+		tarEntry{name: "data/file.txt", body: "linked"},
+	))
+	dest := t.TempDir()
+	if err := ExtractArchive(archive, dest, nil, nil); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skip("symlinks not permitted")
+		}
+		t.Fatalf("ExtractArchive: %v", err)
+	}
+	assertFile(t, filepath.Join(dest, "link.txt"), "linked")
+}
+
+func TestExtractArchive_Limits(t *testing.T) {
+	// 4MB of zeros compress to a few KB
+	bomb := writeArchive(t, "zeros.bin.gz", compress(t, make([]byte, 4*MB), gzipWriter))
+	err := ExtractArchive(bomb, t.TempDir(), &ExtractLimits{MaxSize: MB}, nil)
+	if !errors.Is(err, ErrExtractLimit) {
+		t.Fatalf("ExtractArchive(size) = %v, want ErrExtractLimit", err)
+	}
+
+	many := writeArchive(t, "many.zip", makeZip(t, map[string]string{"a": "1", "b": "2", "c": "3"}))
+	err = ExtractArchive(many, t.TempDir(), &ExtractLimits{MaxFiles: 2}, nil)
+	if !errors.Is(err, ErrExtractLimit) {
+		t.Fatalf("ExtractArchive(files) = %v, want ErrExtractLimit", err)
+	}
+
+	if err := ExtractArchive(writeArchive(t, "a.txt", []byte("x")), t.TempDir(), nil, nil); !errors.Is(err, ErrNotArchive) {
+		t.Fatalf("ExtractArchive(txt) = %v, want ErrNotArchive", err)
+	}
+}
+
+func TestLoadExtractConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ExtractFileName)
+	cfg, err := LoadExtractConfig(path)
+	if err != nil || len(cfg.Rules) != 0 {
+		t.Fatalf("LoadExtractConfig(missing) = %+v, %v", cfg, err)
+	}
+	data := `{"rules":[{"match":"*.TAR.GZ","host":"example.com","dir":"src"},{"match":"*.zip","delete_archive":true}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = LoadExtractConfig(path); err != nil {
+		t.Fatalf("LoadExtractConfig: %v", err)
+	}
+	tests := []struct {
+		name, url string
+		want      *ExtractOpts
+	}{
+		{"src.tar.gz", "https://dl.example.com/src.tar.gz", &ExtractOpts{Dir: "src"}},
+		{"src.tar.gz", "https://other.org/src.tar.gz", nil},
+		{"a.zip", "https://other.org/a.zip", &ExtractOpts{DeleteArchive: true}},
+		{"a.iso", "https://example.com/a.iso", nil},
+	}
+	for _, tt := range tests {
+		got := cfg.match(tt.name, tt.url)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("match(%s, %s) = %+v, want %+v", tt.name, tt.url, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`{`, `{"limits":{"max_files":-1}}`, `{"rules":[{"match":"[a"}]}`} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadExtractConfig(path); err == nil {
+			t.Errorf("LoadExtractConfig(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestManagerExtractsCompletedDownload(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	archive := compress(t, makeTar(t, tarEntry{name: "pkg/bin.txt", body: "binary"}), gzipWriter)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+		_, _ = w.Write(archive)
+	}))
+	defer srv.Close()
+
+	var (
+		mu        sync.Mutex
+		started   bool
+		extracted int64
+	)
+	dir := t.TempDir()
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/tool.tar.gz", &DownloaderOpts{
+		DownloadDirectory: dir,
+		Handlers: &Handlers{
+			CompileStartHandler: func(hash string) {
+				mu.Lock()
+				defer mu.Unlock()
+				started = started || hash == EXTRACT_HASH
+			},
+			CompileCompleteHandler: func(hash string, tread int64) {
+				mu.Lock()
+				defer mu.Unlock()
+				if hash == EXTRACT_HASH {
+					extracted = tread
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir, Extract: &ExtractOpts{DeleteArchive: true}}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	assertFile(t, filepath.Join(dir, "tool", "pkg", "bin.txt"), "binary")
+	if _, err := os.Stat(filepath.Join(dir, "tool.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("archive not deleted: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !started || extracted != int64(len(archive)) {
+		t.Errorf("extraction progress: started %v, completed with %d, want %d", started, extracted, len(archive))
+	}
+}
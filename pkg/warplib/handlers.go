@@ -55,6 +55,14 @@ type (
 	// bytesHashed is the total number of bytes hashed so far.
 	ChecksumProgressHandlerFunc func(bytesHashed int64)
 
+	// PiecesHashedHandlerFunc is called once the pieces of a completed
+	// download are hashed, before its checksum is validated.
+	PiecesHashedHandlerFunc func(pieces *PieceHashes)
+
+	// FileHashedHandlerFunc is called with the checksums of a completed
+	// download once its file is hashed and validated.
+	FileHashedHandlerFunc func(hashes []ExpectedChecksum)
+
 	// WorkStealHandlerFunc is called when a fast part steals work from a slower part.
 	// Parameters:
 	//   - stealerHash: the hash of the part that finished fast and is stealing work
@@ -62,6 +70,14 @@ type (
 	//   - stolenIoff: the starting offset of the stolen byte range
 	//   - stolenFoff: the ending offset of the stolen byte range (inclusive)
 	WorkStealHandlerFunc func(stealerHash, victimHash string, stolenIoff, stolenFoff int64)
+
+	// ConnTuneHandlerFunc is called when adaptive connection tuning changes
+	// the number of connections of a download.
+	// Parameters:
+	//   - oldConns: the connection count before the change
+	//   - newConns: the connection count after the change
+	//   - reason: a short human readable reason for the change
+	ConnTuneHandlerFunc func(oldConns, newConns int32, reason string)
 )
 
 // Handlers holds callback functions for various download lifecycle events.
@@ -84,9 +100,14 @@ type Handlers struct {
 
 	ChecksumValidationHandler ChecksumValidationHandlerFunc
 	ChecksumProgressHandler   ChecksumProgressHandlerFunc
+	PiecesHashedHandler       PiecesHashedHandlerFunc
+	FileHashedHandler         FileHashedHandlerFunc
 
 	// WorkStealHandler is called when work stealing occurs between parts.
 	WorkStealHandler WorkStealHandlerFunc
+
+	// ConnTuneHandler is called when auto connections changes the connection count.
+	ConnTuneHandler ConnTuneHandlerFunc
 }
 
 func (h *Handlers) setDefault(l *log.Logger) {
@@ -145,7 +166,16 @@ func (h *Handlers) setDefault(l *log.Logger) {
 	if h.ChecksumProgressHandler == nil {
 		h.ChecksumProgressHandler = func(bytesHashed int64) {}
 	}
+	if h.PiecesHashedHandler == nil {
+		h.PiecesHashedHandler = func(pieces *PieceHashes) {}
+	}
+	if h.FileHashedHandler == nil {
+		h.FileHashedHandler = func(hashes []ExpectedChecksum) {}
+	}
 	if h.WorkStealHandler == nil {
 		h.WorkStealHandler = func(stealerHash, victimHash string, stolenIoff, stolenFoff int64) {}
 	}
+	if h.ConnTuneHandler == nil {
+		h.ConnTuneHandler = func(oldConns, newConns int32, reason string) {}
+	}
 }
@@ -0,0 +1,354 @@
+package warplib
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// HistoryVersion is the version of the history format written by
+// Manager.ExportHistory.
+const HistoryVersion = 1
+
+// History is the exported history of the downloads of a manager, and the
+// order of its queue.
+type History struct {
+	// Version is the version of the format, HistoryVersion.
+	Version int `json:"version"`
+	// Exported is the time the history was exported at.
+	Exported time.Time `json:"exported"`
+	// Items are the downloads, oldest first.
+	Items []*Item `json:"items"`
+	// Queue holds the downloads waiting in the queue, in order.
+	Queue []QueuedItemState `json:"queue,omitempty"`
+}
+
+// ExportOpts are the options of Manager.ExportHistory.
+type ExportOpts struct {
+	// Secrets keeps the credentials of the downloads: the headers which
+	// aren't safe to send to another origin, and the passwords in URLs.
+	Secrets bool
+}
+
+// ImportOpts are the options of Manager.ImportHistory.
+type ImportOpts struct {
+	// DownloadDirectory moves the downloads imported to this directory.
+	// If empty, they keep the directory they were exported with.
+	DownloadDirectory string
+}
+
+// ImportResult is the outcome of Manager.ImportHistory.
+type ImportResult struct {
+	// Imported is the number of downloads imported.
+	Imported int `json:"imported"`
+	// Skipped is the number of downloads already known to the manager.
+	Skipped int `json:"skipped"`
+	// Resumable is the number of incomplete downloads imported along
+	// with the data of their parts, which resume where they stopped.
+	Resumable int `json:"resumable"`
+	// Reset is the number of incomplete downloads whose part data wasn't
+	// found, which start over.
+	Reset int `json:"reset"`
+}
+
+// ExportHistory returns the history of the downloads of the manager,
+// without their credentials unless asked for.
+func (m *Manager) ExportHistory(opts *ExportOpts) (*History, error) {
+	if opts == nil {
+		opts = &ExportOpts{}
+	}
+	m.mu.RLock()
+	// a round trip through JSON copies the items without their locks
+	b, err := json.Marshal(m.items)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("export history: %w", err)
+	}
+	var items ItemsMap
+	if err := json.Unmarshal(b, &items); err != nil {
+		return nil, fmt.Errorf("export history: %w", err)
+	}
+	h := &History{Version: HistoryVersion, Exported: time.Now()}
+	for _, item := range items {
+		if !opts.Secrets {
+			item.Headers = StripUnsafeFromHeaders(item.Headers)
+			item.Url = stripPassword(item.Url)
+			item.SignatureURL = stripPassword(item.SignatureURL)
+		}
+		h.Items = append(h.Items, item)
+	}
+	sort.Slice(h.Items, func(i, j int) bool {
+		return h.Items[i].DateAdded.Before(h.Items[j].DateAdded)
+	})
+	if m.queue != nil {
+		h.Queue = m.queue.GetState().Waiting
+	}
+	return h, nil
+}
+
+// stripPassword removes the password from the user info of rawURL.
+func stripPassword(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); !ok {
+		return rawURL
+	}
+	u.User = url.User(u.User.Username())
+	return u.String()
+}
+
+// ImportHistory adds the downloads of h the manager doesn't know yet. The
+// incomplete ones resume where they stopped if the data of their parts is
+// in DlDataDir, and start over from new empty parts otherwise. The downloads which were waiting
+// in the queue are queued again, in order, if the queue is enabled.
+//
+// A history is untrusted: the hashes must be those the manager generates
+// and the names are reduced to their base. The hooks, hook runs,
+// signature, verification time and error of the downloads are left out,
+// they only apply on the machine they were recorded on.
+func (m *Manager) ImportHistory(h *History, opts *ImportOpts) (*ImportResult, error) {
+	if h == nil {
+		return nil, errors.New("import history: no history")
+	}
+	if h.Version > HistoryVersion {
+		return nil, fmt.Errorf("import history: unsupported version %d", h.Version)
+	}
+	if opts == nil {
+		opts = &ImportOpts{}
+	}
+	dir := opts.DownloadDirectory
+	if dir != "" {
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return nil, fmt.Errorf("import history: %w", err)
+		}
+	}
+	for _, item := range h.Items {
+		if item == nil || item.Hash == "" || item.Name == "" || item.Url == "" {
+			return nil, errors.New("import history: download without hash, name or url")
+		}
+		if !isHexHash(item.Hash, itemHashLen) {
+			return nil, fmt.Errorf("import history: invalid download hash %q", item.Hash)
+		}
+		item.Name = filepath.Base(item.Name)
+		if item.Name == "." || item.Name == ".." || item.Name == string(filepath.Separator) {
+			return nil, fmt.Errorf("import history: %s: invalid file name", item.Hash)
+		}
+		if err := ValidateItemParts(item.Parts); err != nil {
+			return nil, fmt.Errorf("import history: %s: %w", item.Hash, err)
+		}
+		for _, part := range item.Parts {
+			if !isHexHash(part.Hash, partHashLen) {
+				return nil, fmt.Errorf("import history: %s: invalid part hash %q", item.Hash, part.Hash)
+			}
+		}
+	}
+
+	res := &ImportResult{}
+	imported := make(map[string]bool)
+	for _, item := range h.Items {
+		if m.GetItem(item.Hash) != nil || imported[item.Hash] {
+			res.Skipped++
+			continue
+		}
+		item.mu = m.mu
+		item.Hooks, item.HookRuns = nil, nil
+		item.Signature, item.VerifiedAt, item.Error = nil, time.Time{}, ""
+		if item.Parts == nil {
+			item.Parts = make(map[int64]*ItemPart)
+		}
+		item.memPart = make(map[string]int64)
+		for ioff, part := range item.Parts {
+			item.memPart[part.Hash] = ioff
+		}
+		if dir != "" {
+			item.DownloadLocation, item.AbsoluteLocation = dir, dir
+		}
+		if !isComplete(item) {
+			if item.Downloaded > 0 || len(item.Parts) > 0 {
+				if err := validateDownloadIntegrity(item); err != nil {
+					item.Parts = make(map[int64]*ItemPart)
+					item.memPart = make(map[string]int64)
+					item.Downloaded, item.DirectWrite = 0, false
+					res.Reset++
+				} else {
+					res.Resumable++
+				}
+			}
+			if err := WarpMkdirAll(filepath.Join(DlDataDir, item.Hash), 0755); err != nil {
+				return res, fmt.Errorf("import history: %s: %w", item.Hash, err)
+			}
+			if err := layoutParts(item); err != nil {
+				return res, fmt.Errorf("import history: %s: %w", item.Hash, err)
+			}
+		}
+		m.UpdateItem(item)
+		imported[item.Hash] = true
+		res.Imported++
+	}
+
+	if m.queue != nil {
+		for _, q := range h.Queue {
+			if imported[q.Hash] {
+				m.queue.Add(q.Hash, q.Priority)
+			}
+		}
+	}
+	return res, nil
+}
+
+// importParts is the number of parts an imported download with nothing
+// downloaded is split into, the fewest a new download starts with.
+const importParts = 4
+
+// layoutParts splits a download of known size without parts into new
+// parts with empty files, which it resumes from as a download stopped
+// before any data arrived would.
+func layoutParts(item *Item) error {
+	size := item.TotalSize.v()
+	if len(item.Parts) > 0 || size <= 0 {
+		return nil
+	}
+	n := int64(importParts)
+	if n > size {
+		n = size
+	}
+	dlPath := filepath.Join(DlDataDir, item.Hash)
+	for i := int64(0); i < n; i++ {
+		ioff, foff := i*(size/n), (i+1)*(size/n)-1
+		if i == n-1 {
+			foff = size - 1
+		}
+		hash := newPartHash()
+		for _, ok := item.memPart[hash]; ok; _, ok = item.memPart[hash] {
+			hash = newPartHash()
+		}
+		f, err := WarpCreate(getFileName(dlPath, hash))
+		if err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		item.Parts[ioff] = &ItemPart{Hash: hash, FinalOffset: foff}
+		item.memPart[hash] = ioff
+	}
+	return nil
+}
+
+const (
+	// itemHashLen is the length of the hashes of downloads.
+	itemHashLen = 8
+	// partHashLen is the length of the hashes of parts.
+	partHashLen = 4
+)
+
+// isHexHash reports whether h is n lowercase hex digits, the format of the
+// hashes of downloads and parts, which name their files.
+func isHexHash(h string, n int) bool {
+	if len(h) != n {
+		return false
+	}
+	for _, c := range h {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// historyCSVHeader are the columns of the history written by
+// History.WriteCSV.
+var historyCSVHeader = []string{
+	"hash", "name", "url", "status", "total_size", "downloaded",
+	"date_added", "location", "category", "checksum",
+}
+
+// WriteCSV writes a row per download of the history to w, for
+// spreadsheets. It can't be imported back.
+func (h *History) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(historyCSVHeader); err != nil {
+		return err
+	}
+	for _, item := range h.Items {
+		status := "incomplete"
+		if isComplete(item) {
+			status = "complete"
+		}
+		var checksum string
+		if cs := item.Hashes; len(cs) > 0 {
+			checksum = cs[0].String()
+		} else if cs := item.Checksums; len(cs) > 0 {
+			checksum = cs[0].String()
+		}
+		err := cw.Write([]string{
+			item.Hash,
+			item.Name,
+			item.Url,
+			status,
+			strconv.FormatInt(item.TotalSize.v(), 10),
+			strconv.FormatInt(item.Downloaded.v(), 10),
+			item.DateAdded.Format(time.RFC3339),
+			item.AbsoluteLocation,
+			item.Category,
+			checksum,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// aria2Algorithms maps the checksum algorithms to their names in aria2.
+var aria2Algorithms = map[ChecksumAlgorithm]string{
+	ChecksumMD5:    "md5",
+	ChecksumSHA1:   "sha-1",
+	ChecksumSHA256: "sha-256",
+	ChecksumSHA384: "sha-384",
+	ChecksumSHA512: "sha-512",
+}
+
+// WriteAria2Session writes the incomplete downloads of the history to w as
+// an aria2 input file, which aria2c reads with --input-file.
+func (h *History) WriteAria2Session(w io.Writer) error {
+	for _, item := range h.Items {
+		if isComplete(item) {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", item.Url); err != nil {
+			return err
+		}
+		opts := []string{
+			"dir=" + item.AbsoluteLocation,
+			"out=" + item.Name,
+		}
+		for _, hdr := range item.Headers {
+			opts = append(opts, "header="+hdr.Key+": "+hdr.Value)
+		}
+		for _, cs := range item.Checksums {
+			if algo, ok := aria2Algorithms[cs.Algorithm]; ok {
+				opts = append(opts, "checksum="+algo+"="+hex.EncodeToString(cs.Value))
+				break
+			}
+		}
+		for _, opt := range opts {
+			if _, err := fmt.Fprintf(w, " %s\n", opt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
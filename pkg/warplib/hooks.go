@@ -0,0 +1,74 @@
+package warplib
+
+import "time"
+
+// MaxHookRuns is the number of hook runs kept on an item, the oldest
+// runs are dropped first.
+const MaxHookRuns = 20
+
+// Hooks are the commands run when a download reaches an event.
+// An empty command runs nothing.
+type Hooks struct {
+	OnComplete     string `json:"on_complete,omitempty"`
+	OnError        string `json:"on_error,omitempty"`
+	OnStopped      string `json:"on_stopped,omitempty"`
+	OnChecksumFail string `json:"on_checksum_fail,omitempty"`
+}
+
+// Command returns the command run at ev, "" if none.
+func (h *Hooks) Command(ev ItemEvent) string {
+	if h == nil {
+		return ""
+	}
+	switch ev {
+	case EventComplete:
+		return h.OnComplete
+	case EventError:
+		return h.OnError
+	case EventStopped:
+		return h.OnStopped
+	case EventChecksumFail:
+		return h.OnChecksumFail
+	}
+	return ""
+}
+
+// IsEmpty reports whether no command is set.
+func (h *Hooks) IsEmpty() bool {
+	return h == nil || *h == Hooks{}
+}
+
+// HookRun records one run of a hook command.
+type HookRun struct {
+	// Event is the event the hook ran at.
+	Event ItemEvent `json:"event"`
+	// Command is the command as run, with its variables expanded.
+	Command   string        `json:"command"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	// ExitCode is the exit status of the command, -1 if it didn't exit
+	// on its own, e.g. it couldn't start or timed out.
+	ExitCode int `json:"exit_code"`
+	// Output is the start of the combined stdout and stderr.
+	Output string `json:"output,omitempty"`
+	// Error says why the command failed to run, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// AddHookRun records a run of a hook of the item, keeping the latest
+// MaxHookRuns runs.
+func (i *Item) AddHookRun(run HookRun) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.HookRuns = append(i.HookRuns, run)
+	if n := len(i.HookRuns) - MaxHookRuns; n > 0 {
+		i.HookRuns = append([]HookRun(nil), i.HookRuns[n:]...)
+	}
+}
+
+// GetHookRuns returns a copy of the recorded hook runs, oldest first.
+func (i *Item) GetHookRuns() []HookRun {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return append([]HookRun(nil), i.HookRuns...)
+}
@@ -0,0 +1,261 @@
+package warplib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// HostLimitsFileName is the name of the per-host connection limits file
+// inside the config directory.
+const HostLimitsFileName = "hostlimits.json"
+
+// HostLimits configures how many connections all downloads together may
+// open to a single host.
+type HostLimits struct {
+	// Default is the limit for hosts without an override.
+	// 0 means unlimited.
+	Default int32 `json:"default"`
+	// Hosts maps a host name to its own limit, overriding Default.
+	// 0 means unlimited for that host.
+	Hosts map[string]int32 `json:"hosts,omitempty"`
+}
+
+// LoadHostLimits reads per-host connection limits from path.
+// A missing file results in no limits.
+func LoadHostLimits(path string) (*HostLimits, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &HostLimits{}, nil
+		}
+		return nil, err
+	}
+	var hl HostLimits
+	if err := json.Unmarshal(b, &hl); err != nil {
+		return nil, fmt.Errorf("parse host limits file %s: %w", path, err)
+	}
+	if err := hl.Validate(); err != nil {
+		return nil, err
+	}
+	return &hl, nil
+}
+
+// Validate checks that no limit is negative.
+func (hl *HostLimits) Validate() error {
+	if hl.Default < 0 {
+		return fmt.Errorf("default host connection limit must not be negative, got %d", hl.Default)
+	}
+	for host, n := range hl.Hosts {
+		if n < 0 {
+			return fmt.Errorf("connection limit of %s must not be negative, got %d", host, n)
+		}
+	}
+	return nil
+}
+
+// HostLimiter is a daemon-wide connection semaphore per host shared by
+// every part of every download, so parallel downloads from one host can't
+// open more connections than the host allows in total.
+//
+// A nil HostLimiter or a limit of 0 means unlimited.
+type HostLimiter struct {
+	mu     sync.Mutex
+	limits HostLimits
+	used   map[string]int32
+	// freed is closed and replaced whenever a slot is released
+	// or the limits change, waking up waiting acquirers.
+	freed chan struct{}
+}
+
+// NewHostLimiter creates a host limiter with the given limits.
+// A nil limits means unlimited.
+func NewHostLimiter(limits *HostLimits) *HostLimiter {
+	h := &HostLimiter{
+		used:  make(map[string]int32),
+		freed: make(chan struct{}),
+	}
+	h.SetLimits(limits)
+	return h
+}
+
+// SetLimits replaces the limits. Connections already open are kept even if
+// they exceed the new limit, new ones wait until the host is under it.
+func (h *HostLimiter) SetLimits(limits *HostLimits) {
+	if h == nil {
+		return
+	}
+	var hl HostLimits
+	if limits != nil {
+		hl.Default = limits.Default
+		hl.Hosts = make(map[string]int32, len(limits.Hosts))
+		for host, n := range limits.Hosts {
+			hl.Hosts[strings.ToLower(host)] = n
+		}
+	}
+	h.mu.Lock()
+	h.limits = hl
+	h.wakeLocked()
+	h.mu.Unlock()
+}
+
+// Limit returns the connection limit of host. 0 means unlimited.
+func (h *HostLimiter) Limit(host string) int32 {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.limitLocked(strings.ToLower(host))
+}
+
+// Available returns the number of free connection slots of host,
+// or -1 if the host is unlimited.
+func (h *HostLimiter) Available(host string) int32 {
+	if h == nil {
+		return -1
+	}
+	host = strings.ToLower(host)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	limit := h.limitLocked(host)
+	if limit == 0 {
+		return -1
+	}
+	if free := limit - h.used[host]; free > 0 {
+		return free
+	}
+	return 0
+}
+
+// TryAcquire takes a connection slot of host if one is free.
+func (h *HostLimiter) TryAcquire(host string) bool {
+	if h == nil {
+		return true
+	}
+	host = strings.ToLower(host)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.tryAcquireLocked(host)
+}
+
+// Acquire takes a connection slot of host, waiting until one is free
+// or ctx is done.
+func (h *HostLimiter) Acquire(ctx context.Context, host string) error {
+	if h == nil {
+		return nil
+	}
+	host = strings.ToLower(host)
+	for {
+		h.mu.Lock()
+		if h.tryAcquireLocked(host) {
+			h.mu.Unlock()
+			return nil
+		}
+		freed := h.freed
+		h.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-freed:
+		}
+	}
+}
+
+// forceAcquire takes a connection slot of host even if the host is at its
+// limit. It is used to balance a Release that will happen regardless.
+func (h *HostLimiter) forceAcquire(host string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.used[strings.ToLower(host)]++
+	h.mu.Unlock()
+}
+
+// Release gives back a connection slot taken with Acquire or TryAcquire.
+func (h *HostLimiter) Release(host string) {
+	if h == nil {
+		return
+	}
+	host = strings.ToLower(host)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.used[host] <= 1 {
+		delete(h.used, host)
+	} else {
+		h.used[host]--
+	}
+	h.wakeLocked()
+}
+
+// InUse returns the number of connections currently open to host.
+func (h *HostLimiter) InUse(host string) int32 {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.used[strings.ToLower(host)]
+}
+
+func (h *HostLimiter) limitLocked(host string) int32 {
+	if n, ok := h.limits.Hosts[host]; ok {
+		return n
+	}
+	return h.limits.Default
+}
+
+func (h *HostLimiter) tryAcquireLocked(host string) bool {
+	if limit := h.limitLocked(host); limit != 0 && h.used[host] >= limit {
+		return false
+	}
+	h.used[host]++
+	return true
+}
+
+func (h *HostLimiter) wakeLocked() {
+	close(h.freed)
+	h.freed = make(chan struct{})
+}
+
+// acquireHostSlot takes a connection slot of the download's host,
+// waiting for other downloads to free one if needed.
+func (d *Downloader) acquireHostSlot() error {
+	host := urlHost(d.url)
+	if d.hosts.TryAcquire(host) {
+		return nil
+	}
+	d.Log("Waiting for a free connection to %s (limit %d)", host, d.hosts.Limit(host))
+	return d.hosts.Acquire(d.ctx, host)
+}
+
+// releaseHostSlot gives back a slot taken with acquireHostSlot.
+func (d *Downloader) releaseHostSlot() {
+	d.hosts.Release(urlHost(d.url))
+}
+
+// hostSlotsLeft returns the number of parts that can still connect to the
+// download's host, or -1 if the host is unlimited.
+func (d *Downloader) hostSlotsLeft() int32 {
+	return d.hosts.Available(urlHost(d.url))
+}
+
+// fitBasePartsToHost lowers the number of base parts to the free
+// connection slots of the host, so the download starts with fewer parts
+// instead of waiting for slots held by other downloads.
+func (d *Downloader) fitBasePartsToHost() {
+	free := d.hostSlotsLeft()
+	if free < 0 || free >= d.numBaseParts {
+		return
+	}
+	if free < 1 {
+		free = 1
+	}
+	d.Log("Host connection limit reached, starting with %d parts instead of %d", free, d.numBaseParts)
+	d.numBaseParts = free
+}
@@ -0,0 +1,348 @@
+package warplib
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadHostLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, HostLimitsFileName)
+
+	hl, err := LoadHostLimits(path)
+	if err != nil {
+		t.Fatalf("LoadHostLimits on missing file: %v", err)
+	}
+	if hl.Default != 0 || len(hl.Hosts) != 0 {
+		t.Errorf("missing file should mean no limits, got %+v", hl)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"default":4,"hosts":{"Example.com":2,"free.org":0}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if hl, err = LoadHostLimits(path); err != nil {
+		t.Fatalf("LoadHostLimits: %v", err)
+	}
+	if hl.Default != 4 || hl.Hosts["Example.com"] != 2 {
+		t.Errorf("unexpected limits: %+v", hl)
+	}
+
+	for _, bad := range []string{`{`, `{"default":-1}`, `{"hosts":{"a.com":-2}}`} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadHostLimits(path); err == nil {
+			t.Errorf("LoadHostLimits(%s) should fail", bad)
+		}
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	h := NewHostLimiter(&HostLimits{Default: 2, Hosts: map[string]int32{"Example.com": 1, "free.org": 0}})
+
+	if h.Limit("example.com") != 1 || h.Limit("other.net") != 2 || h.Limit("free.org") != 0 {
+		t.Fatalf("unexpected limits: %d %d %d", h.Limit("example.com"), h.Limit("other.net"), h.Limit("free.org"))
+	}
+	if !h.TryAcquire("EXAMPLE.com") {
+		t.Fatal("first slot should be free")
+	}
+	if h.TryAcquire("example.com") {
+		t.Fatal("example.com is limited to 1 connection")
+	}
+	if h.Available("example.com") != 0 || h.InUse("example.com") != 1 {
+		t.Errorf("available=%d inUse=%d, want 0 and 1", h.Available("example.com"), h.InUse("example.com"))
+	}
+	for i := 0; i < 10; i++ {
+		if !h.TryAcquire("free.org") {
+			t.Fatal("free.org is unlimited")
+		}
+	}
+	if h.Available("free.org") != -1 {
+		t.Errorf("unlimited host Available() = %d, want -1", h.Available("free.org"))
+	}
+
+	// A waiting acquire gets the slot once it is released.
+	acquired := make(chan error, 1)
+	go func() { acquired <- h.Acquire(context.Background(), "example.com") }()
+	select {
+	case <-acquired:
+		t.Fatal("Acquire should wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	h.Release("example.com")
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire did not get the released slot")
+	}
+
+	// Raising the limit wakes up waiters as well.
+	go func() { acquired <- h.Acquire(context.Background(), "example.com") }()
+	time.Sleep(20 * time.Millisecond)
+	h.SetLimits(&HostLimits{Default: 2})
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire did not get a slot after raising the limit")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Acquire(ctx, "example.com"); err != context.Canceled {
+		t.Errorf("Acquire with cancelled ctx = %v, want context.Canceled", err)
+	}
+}
+
+func TestHostLimiter_Nil(t *testing.T) {
+	var h *HostLimiter
+	if !h.TryAcquire("a.com") || h.Acquire(context.Background(), "a.com") != nil {
+		t.Fatal("nil limiter should never block")
+	}
+	h.Release("a.com")
+	h.SetLimits(&HostLimits{Default: 1})
+	if h.Available("a.com") != -1 || h.Limit("a.com") != 0 || h.InUse("a.com") != 0 {
+		t.Error("nil limiter should be unlimited")
+	}
+}
+
+func TestDownloader_FitBasePartsToHost(t *testing.T) {
+	d, _ := newLiveTestDownloader()
+	d.url = "http://example.com/file"
+	d.numBaseParts = 8
+	d.hosts = NewHostLimiter(&HostLimits{Default: 3})
+
+	d.hosts.TryAcquire("example.com")
+	d.fitBasePartsToHost()
+	if d.numBaseParts != 2 {
+		t.Errorf("numBaseParts = %d, want 2", d.numBaseParts)
+	}
+
+	// Without free slots the download still starts with one part.
+	d.hosts.TryAcquire("example.com")
+	d.hosts.TryAcquire("example.com")
+	d.fitBasePartsToHost()
+	if d.numBaseParts != 1 {
+		t.Errorf("numBaseParts = %d, want 1", d.numBaseParts)
+	}
+	if !d.connLimitReached() {
+		t.Error("a full host should count as connection limit reached")
+	}
+}
+
+// TestDownloader_HostLimitShared runs two downloads from the same host with
+// more connections each than the host allows in total.
+func TestDownloader_HostLimitShared(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("host-limit-test!"), 2*int(MB)/16)
+
+	// count the requests the server is serving at the same time
+	var open, peak int64
+	inner := newDelayedRangeServer(t, content, time.Millisecond)
+	defer inner.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&open, 1)
+		defer atomic.AddInt64(&open, -1)
+		for p := atomic.LoadInt64(&peak); n > p && !atomic.CompareAndSwapInt64(&peak, p, n); p = atomic.LoadInt64(&peak) {
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	hosts := NewHostLimiter(&HostLimits{Default: 3})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		dir := filepath.Join(base, string(rune('a'+i)))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+			DownloadDirectory: dir,
+			MaxConnections:    4,
+			MaxSegments:       8,
+			NumBaseParts:      4,
+		})
+		if err != nil {
+			t.Fatalf("NewDownloader: %v", err)
+		}
+		defer d.Close()
+		d.hosts = hosts
+		atomic.StoreInt64(&peak, 0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.Start(); err != nil {
+				errs <- err
+				return
+			}
+			got, err := os.ReadFile(d.GetSavePath())
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(got, content) {
+				t.Error("downloaded content mismatch")
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("downloads did not finish")
+	}
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Start: %v", err)
+	}
+	if p := atomic.LoadInt64(&peak); p > 3 {
+		t.Errorf("peak concurrent requests = %d, want at most 3", p)
+	}
+	if n := hosts.InUse("127.0.0.1"); n != 0 {
+		t.Errorf("slots in use after downloads = %d, want 0", n)
+	}
+}
+
+// newPeakServer serves content like newDelayedRangeServer and counts the
+// requests it serves at the same time in peak. Without ranges it omits the
+// length, as a server of a file of unknown size would.
+func newPeakServer(t *testing.T, content []byte, ranged bool) (*httptest.Server, *int64) {
+	t.Helper()
+	var open, peak int64
+	inner := newDelayedRangeServer(t, content, time.Millisecond)
+	t.Cleanup(inner.Close)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&open, 1)
+		defer atomic.AddInt64(&open, -1)
+		for p := atomic.LoadInt64(&peak); n > p && !atomic.CompareAndSwapInt64(&peak, p, n); p = atomic.LoadInt64(&peak) {
+		}
+		if !ranged {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			_, _ = w.Write(content)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &peak
+}
+
+// TestDownloader_HostLimitResume resumes a download of more parts than the
+// host allows connections.
+func TestDownloader_HostLimitResume(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("host-limit-test!"), int(MB)/16)
+	srv, peak := newPeakServer(t, content, true)
+	hash := "resume-host"
+	if err := os.MkdirAll(filepath.Join(DlDataDir, hash), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d, err := initDownloader(&http.Client{}, hash, srv.URL+"/file.bin", ContentLength(len(content)), &DownloaderOpts{
+		DownloadDirectory: base,
+		FileName:          "file.bin",
+		MaxConnections:    4,
+		MaxSegments:       4,
+		NumBaseParts:      4,
+	})
+	if err != nil {
+		t.Fatalf("initDownloader: %v", err)
+	}
+	defer d.Close()
+	d.hosts = NewHostLimiter(&HostLimits{Default: 2})
+
+	quarter := int64(len(content)) / 4
+	parts := map[int64]*ItemPart{}
+	for i := int64(0); i < 4; i++ {
+		ph := "part" + string(rune('a'+i))
+		parts[i*quarter] = &ItemPart{Hash: ph, FinalOffset: (i+1)*quarter - 1}
+		if err := os.WriteFile(getFileName(d.dlPath, ph), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Resume(parts); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if got, err := os.ReadFile(d.GetSavePath()); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("resumed content mismatch: %v", err)
+	}
+	if d.numBaseParts != 2 {
+		t.Errorf("numBaseParts = %d, want 2", d.numBaseParts)
+	}
+	if p := atomic.LoadInt64(peak); p > 2 {
+		t.Errorf("peak concurrent requests = %d, want at most 2", p)
+	}
+	if n := d.hosts.InUse("127.0.0.1"); n != 0 {
+		t.Errorf("slots in use after resume = %d, want 0", n)
+	}
+}
+
+// TestDownloader_HostLimitUnknownSize waits for a slot of the host before
+// downloading a file of unknown size.
+func TestDownloader_HostLimitUnknownSize(t *testing.T) {
+	d, _ := newLiveTestDownloader()
+	content := []byte("unknown size content")
+	srv, peak := newPeakServer(t, content, false)
+	d.url = srv.URL + "/file.bin"
+	d.client = &http.Client{}
+	d.ctx = context.Background()
+	d.handlers = &Handlers{}
+	d.handlers.setDefault(d.l)
+	d.wg = &sync.WaitGroup{}
+	d.hosts = NewHostLimiter(&HostLimits{Default: 1})
+	d.hosts.TryAcquire("127.0.0.1")
+
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	d.wg.Add(1)
+	go func() { done <- d.downloadUnknownSizeFile(&buf) }()
+	select {
+	case err := <-done:
+		t.Fatalf("download ran without a free slot: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if atomic.LoadInt64(peak) != 0 {
+		t.Fatal("request sent without a free slot")
+	}
+
+	d.hosts.Release("127.0.0.1")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("downloadUnknownSizeFile: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("download did not start once the slot was freed")
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Errorf("content = %q", buf.Bytes())
+	}
+	if n := d.hosts.InUse("127.0.0.1"); n != 0 {
+		t.Errorf("slots in use = %d, want 0", n)
+	}
+}
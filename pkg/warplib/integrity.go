@@ -10,7 +10,7 @@ import (
 // It verifies:
 // 1. Download data directory exists ({DlDataDir}/{hash}/)
 // 2. Part files exist for all non-compiled parts ({dlPath}/{part.Hash}.warp)
-// 3. Main file exists if any part was already compiled into it ({item.AbsolutePath})
+// 3. Main file exists if any part was compiled or directly written into it ({item.AbsolutePath})
 //
 // Raw download progress can live entirely inside part files, so Downloaded > 0
 // does not by itself require a non-empty destination file yet.
@@ -48,7 +48,8 @@ func validateDownloadIntegrity(item *Item) error {
 		return fmt.Errorf("%w: download has progress but no part state: %s", ErrDownloadDataMissing, item.Hash)
 	}
 
-	if hasCompiledPart {
+	// Direct write downloads keep all their data in the main file.
+	if hasCompiledPart || item.DirectWrite {
 		mainFile := item.GetAbsolutePath()
 		stat, err := os.Stat(mainFile)
 		if err != nil {
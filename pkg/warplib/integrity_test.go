@@ -101,6 +101,31 @@ func TestValidateDownloadIntegrity_MissingMainFile_CompiledPart(t *testing.T) {
 	}
 }
 
+func TestValidateDownloadIntegrity_MissingMainFile_DirectWrite(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+
+	item := newTestItem(t, "missing-main-direct")
+	item.DirectWrite = true
+	dlPath := filepath.Join(DlDataDir, item.Hash)
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+
+	// The part file only holds progress, the data is in the missing main file.
+	item.Parts[0] = &ItemPart{Hash: "part1", FinalOffset: 99}
+	if err := os.WriteFile(getFileName(dlPath, "part1"), make([]byte, partProgressSize), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	err := validateDownloadIntegrity(item)
+	if !errors.Is(err, ErrDownloadDataMissing) {
+		t.Fatalf("expected ErrDownloadDataMissing, got %v", err)
+	}
+}
+
 func TestValidateDownloadIntegrity_MissingMainFile_DownloadedWithoutParts(t *testing.T) {
 	base := t.TempDir()
 	if err := SetConfigDir(base); err != nil {
@@ -88,6 +88,49 @@ type Item struct {
 	// Cookie VALUES are never persisted (FR-023). Empty means no cookies.
 	// GOB backward-compatible: missing field decodes as empty string (zero value).
 	CookieSourcePath string `json:"cookie_source_path,omitempty"`
+	// DirectWrite marks a download whose parts write straight into the
+	// preallocated main file, with part files that only hold the progress.
+	// GOB backward-compatible: missing field decodes as false (zero value).
+	DirectWrite bool `json:"direct_write,omitempty"`
+	// Hooks are the commands run at the events of this download, after
+	// the daemon's global hooks. nil means none.
+	Hooks *Hooks `json:"hooks,omitempty"`
+	// HookRuns records the latest runs of hook commands, oldest first.
+	HookRuns []HookRun `json:"hook_runs,omitempty"`
+	// Extract asks for the archive to be extracted once downloaded.
+	// nil means no extraction.
+	Extract *ExtractOpts `json:"extract,omitempty"`
+	// Category is the name of the category of the download, empty if it
+	// matched none.
+	Category string `json:"category,omitempty"`
+	// Checksums are the checksums the file is expected to have, as
+	// announced by the server. They identify duplicate downloads.
+	Checksums []ExpectedChecksum `json:"checksums,omitempty"`
+	// SignatureURL is the URL of the detached signature the file is
+	// verified against once downloaded, empty if none.
+	SignatureURL string `json:"signature_url,omitempty"`
+	// Signature is the result of the signature verification, nil until
+	// the file is verified.
+	Signature *SignatureResult `json:"signature,omitempty"`
+	// Pieces are the hashes of the pieces of the file, used to repair
+	// it. They are left out of JSON to keep listings small.
+	Pieces *PieceHashes `json:"-"`
+	// Hashes are the checksums computed from the file once downloaded,
+	// against which it is verified later on.
+	Hashes []ExpectedChecksum `json:"hashes,omitempty"`
+	// VerifiedAt is the last time the file was verified intact, zero if
+	// it never was.
+	VerifiedAt time.Time `json:"verified_at,omitempty"`
+	// Error is the error the latest run of the download ended with,
+	// cleared when it runs again. Empty if it didn't fail.
+	Error string `json:"error,omitempty"`
+	// Speed is the average speed, in bytes per second, of the latest
+	// run of the download.
+	Speed int64 `json:"speed,omitempty"`
+	// runStart and runFrom are when the current run of the download
+	// started and how much was downloaded then, to measure its speed.
+	runStart time.Time
+	runFrom  ContentLength
 	// mu is a mutex for synchronizing access to the item's fields.
 	mu *sync.RWMutex
 	// dAllocMu protects access to dAlloc field (value type, not pointer, for GOB serialization)
@@ -306,6 +349,92 @@ func (i *Item) GetMaxParts() (int32, error) {
 	return i.dAlloc.GetMaxParts(), nil
 }
 
+// liveConfigurable is implemented by protocol downloaders whose options
+// can be changed while the download is running.
+type liveConfigurable interface {
+	SetSpeedLimit(limit int64) error
+	GetSpeedLimit() int64
+	SetMaxConnections(n int32) error
+}
+
+// getLiveConfigurable returns the running downloader if it supports live option changes.
+func (i *Item) getLiveConfigurable() (liveConfigurable, error) {
+	i.dAllocMu.RLock()
+	defer i.dAllocMu.RUnlock()
+	if i.dAlloc == nil {
+		return nil, ErrItemDownloaderNotFound
+	}
+	lc, ok := i.dAlloc.(liveConfigurable)
+	if !ok {
+		return nil, ErrLiveChangeUnsupported
+	}
+	return lc, nil
+}
+
+// partPrioritizer is implemented by protocol downloaders that can move a
+// waiting reader's offset to the front, see ItemReader.
+type partPrioritizer interface {
+	prioritize(off int64) bool
+	partRead(hash string) (int64, bool)
+}
+
+// getPrioritizer returns the running downloader if it can prioritize
+// ranges, or nil.
+func (i *Item) getPrioritizer() partPrioritizer {
+	i.dAllocMu.RLock()
+	defer i.dAllocMu.RUnlock()
+	p, _ := i.dAlloc.(partPrioritizer)
+	return p
+}
+
+// SetSpeedLimit changes the speed limit of the running download in bytes per second.
+// 0 removes the limit.
+func (i *Item) SetSpeedLimit(limit int64) error {
+	lc, err := i.getLiveConfigurable()
+	if err != nil {
+		return err
+	}
+	return lc.SetSpeedLimit(limit)
+}
+
+// GetSpeedLimit returns the speed limit of the running download in bytes per second.
+func (i *Item) GetSpeedLimit() (int64, error) {
+	lc, err := i.getLiveConfigurable()
+	if err != nil {
+		return 0, err
+	}
+	return lc.GetSpeedLimit(), nil
+}
+
+// SetMaxConnections changes the number of parallel connections of the running download.
+func (i *Item) SetMaxConnections(n int32) error {
+	lc, err := i.getLiveConfigurable()
+	if err != nil {
+		return err
+	}
+	return lc.SetMaxConnections(n)
+}
+
+// ResumeOpts returns the options the running download uses, to resume it
+// later with the same connections and speed limit. Downloaders that don't
+// report their options only keep the connection and segment counts.
+func (i *Item) ResumeOpts() (*ResumeDownloadOpts, error) {
+	i.dAllocMu.RLock()
+	defer i.dAllocMu.RUnlock()
+	if i.dAlloc == nil {
+		return nil, ErrItemDownloaderNotFound
+	}
+	if r, ok := i.dAlloc.(interface{ resumeOpts() *ResumeDownloadOpts }); ok {
+		if opts := r.resumeOpts(); opts != nil {
+			return opts, nil
+		}
+	}
+	return &ResumeDownloadOpts{
+		MaxConnections: i.dAlloc.GetMaxConnections(),
+		MaxSegments:    i.dAlloc.GetMaxParts(),
+	}, nil
+}
+
 // Resume resumes the download of the item.
 // Fixed Race 2: Takes snapshot of Parts under Item lock before calling Resume.
 // For FTP/SFTP: passes stored resumeHandlers to ProtocolDownloader.Resume().
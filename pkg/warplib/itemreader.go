@@ -0,0 +1,254 @@
+package warplib
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// readPollInterval is how often a blocked ItemReader checks whether the
+// bytes it waits for have arrived.
+const readPollInterval = 50 * time.Millisecond
+
+// ErrItemSizeUnknown is returned by NewItemReader for downloads of unknown
+// size, which can't be read at arbitrary offsets.
+var ErrItemSizeUnknown = errors.New("item size is unknown")
+
+// ItemReader reads the file of a download while it is still downloading,
+// e.g. to play a video before it is complete. A read of bytes that aren't
+// downloaded yet asks the downloader to fetch them next and blocks until
+// they arrive, the download stops or the context ends.
+// It implements io.ReadSeekCloser.
+type ItemReader struct {
+	ctx  context.Context
+	item *Item
+	size int64
+	off  int64
+	// main is the main file, opened on the first read from it.
+	main *os.File
+	// waiting is the offset a read is blocked on, -1 if none, so the
+	// downloader is asked only once per gap.
+	waiting int64
+}
+
+// NewItemReader returns a reader of the file of item. ctx ends reads that
+// are waiting for bytes to arrive.
+func NewItemReader(ctx context.Context, item *Item) (*ItemReader, error) {
+	size := item.GetTotalSize().v()
+	if size <= 0 {
+		return nil, ErrItemSizeUnknown
+	}
+	return &ItemReader{ctx: ctx, item: item, size: size, waiting: -1}, nil
+}
+
+// Size returns the size of the file.
+func (r *ItemReader) Size() int64 {
+	return r.size
+}
+
+// Read reads the next downloaded bytes, waiting for them if needed.
+// It returns fewer bytes than len(p) when the downloaded range ends.
+func (r *ItemReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if left := r.size - r.off; int64(len(p)) > left {
+		p = p[:left]
+	}
+	for {
+		n, err := r.readAvailable(p)
+		if n > 0 || err != nil {
+			r.off += int64(n)
+			return n, err
+		}
+		if err := r.wait(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Seek implements io.Seeker.
+func (r *ItemReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("seek: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// Close closes the files opened by the reader.
+func (r *ItemReader) Close() error {
+	if r.main == nil {
+		return nil
+	}
+	err := r.main.Close()
+	r.main = nil
+	return err
+}
+
+// wait blocks until it's time to look for the bytes at r.off again.
+// The downloader is asked to fetch them next until a running part took
+// the request; before its parts start none of them covers the offset.
+func (r *ItemReader) wait() error {
+	p := r.item.getPrioritizer()
+	if p == nil {
+		return ErrItemDownloaderNotFound
+	}
+	if r.waiting != r.off && p.prioritize(r.off) {
+		r.waiting = r.off
+	}
+	select {
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	case <-time.After(readPollInterval):
+		return nil
+	}
+}
+
+// readAvailable reads the downloaded bytes at r.off into p. It returns
+// 0 and no error if the byte at r.off isn't downloaded yet.
+func (r *ItemReader) readAvailable(p []byte) (int, error) {
+	span := r.locate(r.off)
+	if span.n <= 0 {
+		return 0, nil
+	}
+	if int64(len(p)) > span.n {
+		p = p[:span.n]
+	}
+	if span.part == "" {
+		if r.main == nil {
+			f, err := WarpOpen(span.path)
+			if err != nil {
+				return 0, err
+			}
+			r.main = f
+		}
+		return readFull(r.main, p, span.off)
+	}
+	// Part files are opened for each read: they are removed once
+	// compiled, and an open handle would keep that from working on Windows.
+	f, err := WarpOpen(span.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// compiled in the meantime, the next look finds it in the main file
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return readFull(f, p, span.off)
+}
+
+// readFull reads len(p) bytes at off, which are known to be there.
+func readFull(f *os.File, p []byte, off int64) (int, error) {
+	n, err := f.ReadAt(p, off)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// itemSpan is where the downloaded bytes at an offset are kept.
+type itemSpan struct {
+	// path is the file holding the bytes, and part the hash of the part
+	// if it's a part file.
+	path string
+	part string
+	// off is the position of the bytes in path.
+	off int64
+	// n is the number of bytes available from there, 0 if none.
+	n int64
+}
+
+// locate returns where the downloaded bytes at off are kept.
+func (r *ItemReader) locate(off int64) itemSpan {
+	i := r.item
+	i.mu.RLock()
+	var (
+		main     = i.GetSavePath()
+		proto    = i.Protocol
+		complete = i.Downloaded >= i.TotalSize
+		total    = i.TotalSize.v()
+		direct   = i.DirectWrite
+		hash     = i.Hash
+		ioff     int64
+		part     *ItemPart
+	)
+	for o, p := range i.Parts {
+		if o <= off && off <= p.FinalOffset {
+			ioff, part = o, &ItemPart{Hash: p.Hash, FinalOffset: p.FinalOffset, Compiled: p.Compiled}
+			break
+		}
+	}
+	downloaded := i.Downloaded.v()
+	i.mu.RUnlock()
+
+	switch {
+	case proto != ProtoHTTP:
+		// FTP and SFTP write a single stream into the destination file
+		return itemSpan{path: i.GetAbsolutePath(), off: off, n: downloaded - off}
+	case part == nil && complete:
+		return itemSpan{path: main, off: off, n: total - off}
+	case part == nil:
+		return itemSpan{}
+	case part.Compiled:
+		return itemSpan{path: main, off: off, n: part.FinalOffset - off + 1}
+	}
+
+	partFile := getFileName(filepath.Join(DlDataDir, hash), part.Hash)
+	read, ok := int64(0), false
+	if p := i.getPrioritizer(); p != nil {
+		read, ok = p.partRead(part.Hash)
+	}
+	if !ok {
+		// not running: its progress is in the part file
+		read = storedPartRead(partFile, direct)
+	}
+	n := ioff + read - off
+	if max := part.FinalOffset - off + 1; n > max {
+		n = max
+	}
+	if n <= 0 {
+		return itemSpan{}
+	}
+	if direct {
+		return itemSpan{path: main, off: off, n: n}
+	}
+	return itemSpan{path: partFile, part: part.Hash, off: off - ioff, n: n}
+}
+
+// storedPartRead returns the progress of a part that isn't running from
+// its part file: the data in it, or the progress mark in direct write mode.
+func storedPartRead(partFile string, direct bool) int64 {
+	if !direct {
+		stat, err := WarpStat(partFile)
+		if err != nil {
+			return 0
+		}
+		return stat.Size()
+	}
+	f, err := WarpOpen(partFile)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	var mark [partProgressSize]byte
+	if _, err := f.ReadAt(mark[:], 0); err != nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(mark[:]))
+}
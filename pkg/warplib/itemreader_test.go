@@ -0,0 +1,126 @@
+package warplib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestItemReader_UnknownSize(t *testing.T) {
+	item := &Item{Hash: "h", TotalSize: 0}
+	if _, err := NewItemReader(context.Background(), item); !errors.Is(err, ErrItemSizeUnknown) {
+		t.Fatalf("NewItemReader err = %v, want ErrItemSizeUnknown", err)
+	}
+}
+
+func TestItemReader_CompleteFile(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("hello, partial world")
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	item := &Item{
+		Hash:             "h",
+		Name:             "a.txt",
+		DownloadLocation: dir,
+		TotalSize:        ContentLength(len(content)),
+		Downloaded:       ContentLength(len(content)),
+		mu:               &sync.RWMutex{},
+	}
+	r, err := NewItemReader(context.Background(), item)
+	if err != nil {
+		t.Fatalf("NewItemReader: %v", err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(7, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, content[7:]) {
+		t.Fatalf("read %q, want %q", got, content[7:])
+	}
+}
+
+func TestItemReader_NotDownloading(t *testing.T) {
+	item := &Item{
+		Hash:             "h",
+		Name:             "a.bin",
+		TotalSize:        100,
+		Parts:            map[int64]*ItemPart{0: {Hash: "p", FinalOffset: 99}},
+		mu:               &sync.RWMutex{},
+		DownloadLocation: t.TempDir(),
+	}
+	r, err := NewItemReader(context.Background(), item)
+	if err != nil {
+		t.Fatalf("NewItemReader: %v", err)
+	}
+	if _, err := r.Read(make([]byte, 10)); !errors.Is(err, ErrItemDownloaderNotFound) {
+		t.Fatalf("Read err = %v, want ErrItemDownloaderNotFound", err)
+	}
+}
+
+// TestItemReader_ReadsAheadOfDownload reads the tail of a file while a
+// single connection is still at its start: the read has to make the
+// downloader fetch the tail first.
+func TestItemReader_ReadsAheadOfDownload(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	m := newTestManager(t)
+	defer m.Close()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 8*int(MB)/16)
+	srv := newDelayedRangeServer(t, content, time.Millisecond)
+	defer srv.Close()
+
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: t.TempDir(),
+		MaxConnections:    2,
+		NumBaseParts:      1,
+		Handlers:          &Handlers{},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: d.dlLoc}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- d.Start() }()
+	defer func() {
+		d.Stop()
+		<-done
+	}()
+
+	item := m.GetItem(d.hash)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	r, err := NewItemReader(ctx, item)
+	if err != nil {
+		t.Fatalf("NewItemReader: %v", err)
+	}
+	defer r.Close()
+	tail := int64(len(content)) - 64*KB
+	if _, err := r.Seek(tail, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, content[tail:]) {
+		t.Fatal("tail content mismatch")
+	}
+	if item.GetPercentage() == 100 {
+		t.Error("download finished before the tail was served, want the tail fetched first")
+	}
+}
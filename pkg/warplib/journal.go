@@ -0,0 +1,623 @@
+package warplib
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// JournalConfigFileName is the name of the progress journal config file
+	// inside the config directory.
+	JournalConfigFileName = "journal.json"
+	// DEF_JOURNAL_SYNC_INTERVAL is how often written data is synced and
+	// journaled with the "interval" sync policy.
+	DEF_JOURNAL_SYNC_INTERVAL = time.Second
+
+	// journalFileName is the name of the journal inside DlDataDir/{hash}.
+	journalFileName = "journal"
+	// journalMagic starts every journal file.
+	journalMagic = "WARPJNL1"
+	// journalTailSize is the number of bytes at the end of a part's durable
+	// data whose checksum is journaled and verified on recovery.
+	journalTailSize = 4 * KB
+	// journalRecordSize is the encoded size of a journalRecord:
+	// kind(1) hash(8) a(8) b(8) tail(4) crc(4).
+	journalRecordSize = 33
+)
+
+// JournalSync is the fsync policy of the progress journal.
+type JournalSync string
+
+const (
+	// JournalSyncOff disables the journal. A crash falls back to the
+	// last saved download state.
+	JournalSyncOff JournalSync = "off"
+	// JournalSyncInterval syncs the written data and journals it
+	// periodically, losing at most one interval of data on a crash.
+	JournalSyncInterval JournalSync = "interval"
+	// JournalSyncAlways syncs and journals every written chunk.
+	// Nothing written is lost, at the cost of a lot of fsync calls.
+	JournalSyncAlways JournalSync = "always"
+)
+
+// JournalConfig configures the crash-safe progress journal.
+type JournalConfig struct {
+	// Sync is the fsync policy. Empty means JournalSyncOff.
+	Sync JournalSync `json:"sync"`
+	// Interval is the sync period of JournalSyncInterval as a Go
+	// duration (e.g. "500ms"). Empty means DEF_JOURNAL_SYNC_INTERVAL.
+	Interval string `json:"interval,omitempty"`
+}
+
+// LoadJournalConfig reads the journal config from path.
+// A missing file results in the journal being off.
+func LoadJournalConfig(path string) (*JournalConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &JournalConfig{}, nil
+		}
+		return nil, err
+	}
+	var jc JournalConfig
+	if err := json.Unmarshal(b, &jc); err != nil {
+		return nil, fmt.Errorf("parse journal config file %s: %w", path, err)
+	}
+	if err := jc.Validate(); err != nil {
+		return nil, err
+	}
+	return &jc, nil
+}
+
+// Validate checks the sync policy and interval.
+func (jc *JournalConfig) Validate() error {
+	switch jc.Sync {
+	case "", JournalSyncOff, JournalSyncInterval, JournalSyncAlways:
+	default:
+		return fmt.Errorf("invalid journal sync policy %q: must be off, interval or always", jc.Sync)
+	}
+	if jc.Interval != "" {
+		d, err := time.ParseDuration(jc.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid journal interval %q: %w", jc.Interval, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("journal interval must be positive, got %s", jc.Interval)
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether the journal is on.
+func (jc *JournalConfig) Enabled() bool {
+	return jc != nil && jc.Sync != "" && jc.Sync != JournalSyncOff
+}
+
+// SyncInterval returns the sync period of JournalSyncInterval.
+func (jc *JournalConfig) SyncInterval() time.Duration {
+	if d, err := time.ParseDuration(jc.Interval); err == nil && d > 0 {
+		return d
+	}
+	return DEF_JOURNAL_SYNC_INTERVAL
+}
+
+// journalKind is the type of a journal record.
+type journalKind byte
+
+const (
+	// journalSpawn records a new part: a is its initial and b its final offset.
+	journalSpawn journalKind = iota + 1
+	// journalResize records a new final offset b of the part at offset a.
+	journalResize
+	// journalProgress records that the first a bytes of the part are on
+	// disk, tail being the checksum of the last journalTailSize of them.
+	journalProgress
+	// journalDone records that all a bytes of the part are in the main file.
+	journalDone
+)
+
+// journalRecord is one entry of the progress journal.
+type journalRecord struct {
+	kind journalKind
+	hash string
+	a, b int64
+	tail uint32
+}
+
+func (r *journalRecord) encode(buf []byte) {
+	buf[0] = byte(r.kind)
+	clear(buf[1:9])
+	copy(buf[1:9], r.hash)
+	binary.LittleEndian.PutUint64(buf[9:17], uint64(r.a))
+	binary.LittleEndian.PutUint64(buf[17:25], uint64(r.b))
+	binary.LittleEndian.PutUint32(buf[25:29], r.tail)
+	binary.LittleEndian.PutUint32(buf[29:33], crc32.ChecksumIEEE(buf[:29]))
+}
+
+// decode reads a record from buf and reports whether its checksum is valid.
+func (r *journalRecord) decode(buf []byte) bool {
+	if binary.LittleEndian.Uint32(buf[29:33]) != crc32.ChecksumIEEE(buf[:29]) {
+		return false
+	}
+	hash := buf[1:9]
+	for i, c := range hash {
+		if c == 0 {
+			hash = hash[:i]
+			break
+		}
+	}
+	r.kind = journalKind(buf[0])
+	r.hash = string(hash)
+	r.a = int64(binary.LittleEndian.Uint64(buf[9:17]))
+	r.b = int64(binary.LittleEndian.Uint64(buf[17:25]))
+	r.tail = binary.LittleEndian.Uint32(buf[25:29])
+	return true
+}
+
+// progressJournal is an append-only log of the byte ranges of a download
+// that are durably on disk. Every record is checksummed, so a record torn by
+// a crash ends the replay instead of corrupting it.
+//
+// A nil progressJournal ignores all records.
+type progressJournal struct {
+	mu     sync.Mutex
+	f      *os.File
+	always bool
+	// last is the last journaled progress per part hash.
+	last map[string]int64
+	buf  [journalRecordSize]byte
+}
+
+// openJournal opens the journal at path for appending.
+// If fresh is set, an existing journal is discarded.
+func openJournal(path string, fresh, always bool) (*progressJournal, error) {
+	flag := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if fresh {
+		flag |= os.O_TRUNC
+	}
+	f, err := WarpOpenFile(path, flag, DefaultFileMode)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		if _, err := f.Write([]byte(journalMagic)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &progressJournal{f: f, always: always, last: make(map[string]int64)}, nil
+}
+
+// append writes the records and syncs the journal.
+func (j *progressJournal) append(recs ...journalRecord) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range recs {
+		recs[i].encode(j.buf[:])
+		if _, err := j.f.Write(j.buf[:]); err != nil {
+			return err
+		}
+	}
+	return j.f.Sync()
+}
+
+func (j *progressJournal) spawn(hash string, ioff, foff int64) error {
+	return j.append(journalRecord{kind: journalSpawn, hash: hash, a: ioff, b: foff})
+}
+
+func (j *progressJournal) resize(hash string, ioff, foff int64) error {
+	return j.append(journalRecord{kind: journalResize, hash: hash, a: ioff, b: foff})
+}
+
+// progress syncs the data the part has written so far and journals it.
+func (j *progressJournal) progress(p *Part) error {
+	if j == nil {
+		return nil
+	}
+	read := p.getRead()
+	j.mu.Lock()
+	last, ok := j.last[p.hash]
+	j.mu.Unlock()
+	if ok && last == read {
+		return nil
+	}
+	f, end := p.pf, read
+	if p.direct {
+		f, end = p.f, p.offset+read
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	tail, err := tailSum(f, end, read)
+	if err != nil {
+		return err
+	}
+	if err := j.append(journalRecord{kind: journalProgress, hash: p.hash, a: read, tail: tail}); err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.last[p.hash] = read
+	j.mu.Unlock()
+	return nil
+}
+
+// done syncs the main file holding the part's data and journals the part
+// as complete.
+func (j *progressJournal) done(p *Part) error {
+	if j == nil {
+		return nil
+	}
+	if err := p.f.Sync(); err != nil {
+		return err
+	}
+	return j.append(journalRecord{kind: journalDone, hash: p.hash, a: p.getRead()})
+}
+
+func (j *progressJournal) close() error {
+	if j == nil {
+		return nil
+	}
+	return j.f.Close()
+}
+
+// tailSum returns the checksum of the up to journalTailSize bytes of f
+// ending at offset end, given that size bytes of the part end there.
+func tailSum(f *os.File, end, size int64) (uint32, error) {
+	n := size
+	if n > journalTailSize {
+		n = journalTailSize
+	}
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, end-n); err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+// openJournal sets up the journal of the download according to its journal
+// config. A fresh journal is started for a new download, a resumed one
+// appends to the journal recovered by the manager. A journal left over from
+// a run with the journal on is removed when it is off, so it can't replay
+// outdated progress later.
+func (d *Downloader) openJournal(fresh bool) error {
+	path := filepath.Join(d.dlPath, journalFileName)
+	if !d.journalCfg.Enabled() {
+		if err := WarpRemove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			d.Log("Failed to remove stale journal: %v", err)
+		}
+		return nil
+	}
+	j, err := openJournal(path, fresh, d.journalCfg.Sync == JournalSyncAlways)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	d.journal = j
+	d.Log("Progress journal enabled (sync: %s)", d.journalCfg.Sync)
+	return nil
+}
+
+// closeJournal closes the journal, removing it if the download is complete.
+func (d *Downloader) closeJournal(complete bool) {
+	if d.journal == nil {
+		return
+	}
+	if err := d.journal.close(); err != nil {
+		d.Log("Failed to close journal: %v", err)
+	}
+	d.journal = nil
+	if complete {
+		_ = WarpRemove(filepath.Join(d.dlPath, journalFileName))
+	}
+}
+
+// startJournalSync periodically journals the progress of the running parts
+// with the "interval" sync policy. The returned function stops it.
+func (d *Downloader) startJournalSync() (stop func()) {
+	if d.journal == nil || d.journal.always {
+		return func() {}
+	}
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(d.journalCfg.SyncInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				_, parts := d.activeParts.Dump()
+				for _, info := range parts {
+					d.journalProgress(info.part)
+				}
+			}
+		}
+	}()
+	// wait for the last sync, the journal is closed right after
+	return func() { close(done); <-exited }
+}
+
+// journalProgress journals the progress of part, logging failures.
+func (d *Downloader) journalProgress(part *Part) {
+	if err := d.journal.progress(part); err != nil && !errors.Is(err, os.ErrClosed) {
+		d.Log("%s: journal progress: %v", part.hash, err)
+	}
+}
+
+// journalDone journals part as complete, logging failures.
+func (d *Downloader) journalDone(part *Part) {
+	if err := d.journal.done(part); err != nil {
+		d.Log("%s: journal done: %v", part.hash, err)
+	}
+}
+
+// journalRange journals a new or resized part range, logging failures.
+func (d *Downloader) journalRange(kind journalKind, hash string, ioff, foff int64) {
+	var err error
+	if kind == journalSpawn {
+		err = d.journal.spawn(hash, ioff, foff)
+	} else {
+		err = d.journal.resize(hash, ioff, foff)
+	}
+	if err != nil {
+		d.Log("%s: journal range: %v", hash, err)
+	}
+}
+
+// journalPart is the state of a part rebuilt from a journal.
+type journalPart struct {
+	hash       string
+	ioff, foff int64
+	done       bool
+	// progress holds the journaled progress records, oldest first.
+	progress []journalRecord
+	// durable is the verified number of bytes on disk.
+	durable int64
+}
+
+// readJournal replays the journal at path. Records after the first torn
+// or corrupt one are ignored.
+func readJournal(path string) (map[string]*journalPart, error) {
+	f, err := WarpOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(journalMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != journalMagic {
+		return nil, fmt.Errorf("%s: not a progress journal", path)
+	}
+	parts := make(map[string]*journalPart)
+	buf := make([]byte, journalRecordSize)
+	for {
+		if _, err := io.ReadFull(f, buf); err != nil {
+			// EOF or a torn last record
+			break
+		}
+		var r journalRecord
+		if !r.decode(buf) {
+			break
+		}
+		switch r.kind {
+		case journalSpawn:
+			if p := parts[r.hash]; p != nil {
+				// a resumed part, keep its progress
+				p.ioff, p.foff = r.a, r.b
+				continue
+			}
+			parts[r.hash] = &journalPart{hash: r.hash, ioff: r.a, foff: r.b}
+		case journalResize:
+			if p := parts[r.hash]; p != nil {
+				p.foff = r.b
+			}
+		case journalProgress:
+			if p := parts[r.hash]; p != nil {
+				p.progress = append(p.progress, r)
+			}
+		case journalDone:
+			if p := parts[r.hash]; p != nil {
+				p.done = true
+			}
+		}
+	}
+	return parts, nil
+}
+
+// recoverFromJournal rebuilds the parts and progress of item from its
+// journal. The tail bytes of every part are checked against the journal,
+// going back to older records until they match, and the part files are cut
+// to the verified size. Ranges not covered by any part get new empty parts.
+// The journal is then rewritten with the recovered state.
+// It reports false if the item has no journal.
+func recoverFromJournal(item *Item) (bool, error) {
+	dlPath := filepath.Join(DlDataDir, item.Hash)
+	path := filepath.Join(dlPath, journalFileName)
+	if !fileExists(path) {
+		return false, nil
+	}
+	jparts, err := readJournal(path)
+	if err != nil {
+		return true, err
+	}
+	var main *os.File
+	if item.DirectWrite {
+		if main, err = WarpOpen(item.GetAbsolutePath()); err != nil {
+			return true, fmt.Errorf("open main file: %w", err)
+		}
+		defer main.Close()
+	}
+
+	parts := make([]*journalPart, 0, len(jparts))
+	for _, p := range jparts {
+		parts = append(parts, p)
+	}
+	sort.Slice(parts, func(i, k int) bool { return parts[i].ioff < parts[k].ioff })
+	// Missing resize records can leave parts overlapping their successor.
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i].foff >= parts[i+1].ioff {
+			parts[i].foff = parts[i+1].ioff - 1
+		}
+	}
+	parts = fillJournalGaps(parts, int64(item.TotalSize))
+
+	var downloaded int64
+	for _, p := range parts {
+		if p.done {
+			downloaded += p.foff - p.ioff + 1
+			continue
+		}
+		if err := p.verify(dlPath, main); err != nil {
+			return true, fmt.Errorf("part %s: %w", p.hash, err)
+		}
+		downloaded += p.durable
+	}
+
+	item.Parts = make(map[int64]*ItemPart, len(parts))
+	item.memPart = make(map[string]int64, len(parts))
+	for _, p := range parts {
+		item.Parts[p.ioff] = &ItemPart{Hash: p.hash, FinalOffset: p.foff, Compiled: p.done}
+		item.memPart[p.hash] = p.ioff
+	}
+	item.Downloaded = ContentLength(downloaded)
+	return true, rewriteJournal(path, parts)
+}
+
+// fillJournalGaps adds empty parts for the ranges of [0, size) that no
+// part covers, e.g. because a spawn record was lost.
+func fillJournalGaps(parts []*journalPart, size int64) []*journalPart {
+	var (
+		filled []*journalPart
+		next   int64
+	)
+	gap := func(end int64) {
+		if end >= next {
+			filled = append(filled, &journalPart{hash: newPartHash(), ioff: next, foff: end})
+		}
+	}
+	for _, p := range parts {
+		gap(p.ioff - 1)
+		filled = append(filled, p)
+		next = p.foff + 1
+	}
+	if size > 0 {
+		gap(size - 1)
+	}
+	return filled
+}
+
+// verify finds the newest journaled progress of the part whose tail bytes
+// match the data on disk and cuts the part's progress back to it.
+// main is the main file of a direct write download, nil otherwise.
+func (p *journalPart) verify(dlPath string, main *os.File) error {
+	partFile := getFileName(dlPath, p.hash)
+	var data *os.File
+	if main == nil {
+		f, err := WarpOpenFile(partFile, os.O_RDWR|os.O_CREATE, DefaultFileMode)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data = f
+	}
+	size := p.foff - p.ioff + 1
+	p.durable = 0
+	for i := len(p.progress) - 1; i >= 0; i-- {
+		r := p.progress[i]
+		if r.a <= 0 || r.a > size {
+			continue
+		}
+		f, end := data, r.a
+		if main != nil {
+			f, end = main, p.ioff+r.a
+		}
+		if sum, err := tailSum(f, end, r.a); err == nil && sum == r.tail {
+			p.durable = r.a
+			break
+		}
+	}
+	if main == nil {
+		return data.Truncate(p.durable)
+	}
+	var mark [partProgressSize]byte
+	binary.LittleEndian.PutUint64(mark[:], uint64(p.durable))
+	return os.WriteFile(partFile, mark[:], DefaultFileMode)
+}
+
+// rewriteJournal replaces the journal at path with one holding only the
+// recovered state of parts.
+func rewriteJournal(path string, parts []*journalPart) error {
+	tmp := path + ".tmp"
+	j, err := openJournal(tmp, true, false)
+	if err != nil {
+		return err
+	}
+	var recs []journalRecord
+	for _, p := range parts {
+		recs = append(recs, journalRecord{kind: journalSpawn, hash: p.hash, a: p.ioff, b: p.foff})
+		switch {
+		case p.done:
+			recs = append(recs, journalRecord{kind: journalDone, hash: p.hash, a: p.foff - p.ioff + 1})
+		case p.durable > 0:
+			for _, r := range p.progress {
+				if r.a == p.durable {
+					recs = append(recs, r)
+					break
+				}
+			}
+		}
+	}
+	err = j.append(recs...)
+	if cerr := j.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return WarpRename(tmp, path)
+}
+
+// recoverJournals replays the journals of downloads that didn't finish,
+// e.g. because of a crash or power loss.
+func (m *Manager) recoverJournals() {
+	recovered := false
+	for _, item := range m.items {
+		if item == nil || item.Protocol != ProtoHTTP {
+			continue
+		}
+		if len(item.Parts) == 0 && item.TotalSize > 0 && item.Downloaded >= item.TotalSize {
+			// complete, the journal was about to be removed
+			continue
+		}
+		ok, err := recoverFromJournal(item)
+		if err != nil {
+			log.Printf("warplib: warning: failed to recover %s from its journal: %v", item.Hash, err)
+			continue
+		}
+		recovered = recovered || ok
+	}
+	if recovered {
+		if err := m.encode(); err != nil {
+			log.Printf("warplib: warning: failed to save recovered downloads: %v", err)
+		}
+	}
+}
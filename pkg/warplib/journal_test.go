@@ -0,0 +1,252 @@
+package warplib
+
+import (
+	"bytes"
+	"hash/crc32"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalRecord_EncodeDecode(t *testing.T) {
+	in := journalRecord{kind: journalProgress, hash: "ab12", a: 123456789, b: -1, tail: 0xdeadbeef}
+	buf := make([]byte, journalRecordSize)
+	in.encode(buf)
+
+	var out journalRecord
+	if !out.decode(buf) {
+		t.Fatal("decode rejected a valid record")
+	}
+	if out != in {
+		t.Fatalf("decoded %+v, want %+v", out, in)
+	}
+
+	buf[10] ^= 0xff
+	if out.decode(buf) {
+		t.Fatal("decode accepted a corrupt record")
+	}
+}
+
+func TestJournalConfig_Validate(t *testing.T) {
+	valid := []JournalConfig{
+		{},
+		{Sync: JournalSyncOff},
+		{Sync: JournalSyncAlways},
+		{Sync: JournalSyncInterval, Interval: "200ms"},
+	}
+	for _, jc := range valid {
+		if err := jc.Validate(); err != nil {
+			t.Errorf("Validate(%+v): %v", jc, err)
+		}
+	}
+	invalid := []JournalConfig{
+		{Sync: "sometimes"},
+		{Sync: JournalSyncInterval, Interval: "soon"},
+		{Sync: JournalSyncInterval, Interval: "-1s"},
+	}
+	for _, jc := range invalid {
+		if err := jc.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", jc)
+		}
+	}
+	if (&JournalConfig{}).Enabled() || (*JournalConfig)(nil).Enabled() {
+		t.Error("empty config should be disabled")
+	}
+	if d := (&JournalConfig{Sync: JournalSyncInterval}).SyncInterval(); d != DEF_JOURNAL_SYNC_INTERVAL {
+		t.Errorf("default interval = %v, want %v", d, DEF_JOURNAL_SYNC_INTERVAL)
+	}
+}
+
+func TestRecoverFromJournal(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("journal-recovery"), 20000/16)
+	item := newTestItem(t, "journaled")
+	item.TotalSize = ContentLength(len(content))
+	item.Downloaded = ContentLength(len(content) - 1)
+
+	dlPath := filepath.Join(DlDataDir, item.Hash)
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	// aa02 holds 7000 bytes, one of which got corrupted before it was synced.
+	partData := append([]byte(nil), content[10000:17000]...)
+	partData[5990] ^= 0xff
+	if err := os.WriteFile(getFileName(dlPath, "aa02"), partData, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	sum := func(end, size int64) uint32 {
+		n := size
+		if n > journalTailSize {
+			n = journalTailSize
+		}
+		return crc32.ChecksumIEEE(content[end-n : end])
+	}
+	path := filepath.Join(dlPath, journalFileName)
+	j, err := openJournal(path, true, false)
+	if err != nil {
+		t.Fatalf("openJournal: %v", err)
+	}
+	err = j.append(
+		journalRecord{kind: journalSpawn, hash: "aa01", a: 0, b: 9999},
+		journalRecord{kind: journalDone, hash: "aa01", a: 10000},
+		journalRecord{kind: journalSpawn, hash: "aa02", a: 10000, b: 19999},
+		journalRecord{kind: journalProgress, hash: "aa02", a: 3000, tail: sum(13000, 3000)},
+		journalRecord{kind: journalProgress, hash: "aa02", a: 6000, tail: sum(16000, 6000)},
+		journalRecord{kind: journalProgress, hash: "aa02", a: 8000, tail: sum(18000, 8000)},
+		// work was stolen from aa02, but the new part's spawn record was lost
+		journalRecord{kind: journalResize, hash: "aa02", a: 10000, b: 14999},
+	)
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	j.close()
+	// a record torn by the crash
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{byte(journalProgress), 'a', 'a'})
+	f.Close()
+
+	ok, err := recoverFromJournal(item)
+	if err != nil || !ok {
+		t.Fatalf("recoverFromJournal = %v, %v", ok, err)
+	}
+
+	if len(item.Parts) != 3 {
+		t.Fatalf("recovered %d parts, want 3: %+v", len(item.Parts), item.Parts)
+	}
+	if p := item.Parts[0]; p.Hash != "aa01" || p.FinalOffset != 9999 || !p.Compiled {
+		t.Errorf("part 0 = %+v", p)
+	}
+	if p := item.Parts[10000]; p.Hash != "aa02" || p.FinalOffset != 14999 || p.Compiled {
+		t.Errorf("part 10000 = %+v", p)
+	}
+	gap := item.Parts[15000]
+	if gap == nil || gap.FinalOffset != 19999 || gap.Compiled {
+		t.Fatalf("gap part = %+v", gap)
+	}
+	// 8000 can't be verified (short file) and 6000 doesn't match (corrupt),
+	// so aa02 goes back to 3000 bytes.
+	if item.Downloaded != 10000+3000 {
+		t.Errorf("Downloaded = %d, want %d", item.Downloaded, 10000+3000)
+	}
+	if stat, err := os.Stat(getFileName(dlPath, "aa02")); err != nil || stat.Size() != 3000 {
+		t.Errorf("aa02 part file not cut to 3000 bytes: %v %v", stat, err)
+	}
+	if !fileExists(getFileName(dlPath, gap.Hash)) {
+		t.Error("no part file created for the gap")
+	}
+	if err := validateDownloadIntegrity(item); err == nil {
+		// aa01 is compiled but there is no main file in this test
+		t.Error("expected missing main file to be reported")
+	}
+
+	// The journal is rewritten with the recovered state.
+	parts, err := readJournal(path)
+	if err != nil {
+		t.Fatalf("readJournal: %v", err)
+	}
+	if len(parts) != 3 || !parts["aa01"].done || len(parts["aa02"].progress) != 1 || parts["aa02"].progress[0].a != 3000 {
+		t.Errorf("rewritten journal = %+v", parts)
+	}
+}
+
+func TestManager_RecoverJournalOnInit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("crash-safe"), 60000)
+	srv := newDelayedRangeServer(t, content, 2*time.Millisecond)
+	defer srv.Close()
+	cfg := &JournalConfig{Sync: JournalSyncInterval, Interval: "20ms"}
+
+	m, err := InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	m.SetJournalConfig(cfg)
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: base,
+		MaxConnections:    2,
+		MaxSegments:       2,
+		NumBaseParts:      2,
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: base}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	hash := d.GetHash()
+	item := m.GetItem(hash)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Start()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for item.GetDownloaded() < ContentLength(100*KB) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	item.StopDownload()
+	<-done
+
+	// Simulate a crash: the saved state is stale and the part files got
+	// bytes that were never synced.
+	item.mu.Lock()
+	item.Parts = nil
+	item.Downloaded = 0
+	item.mu.Unlock()
+	m.UpdateItem(item)
+	m.Close()
+	warps, _ := filepath.Glob(filepath.Join(DlDataDir, hash, "*.warp"))
+	if len(warps) == 0 {
+		t.Fatal("no part files left after stopping")
+	}
+	for _, w := range warps {
+		f, err := os.OpenFile(w, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatalf("OpenFile: %v", err)
+		}
+		f.Write(bytes.Repeat([]byte{0xff}, 100))
+		f.Close()
+	}
+
+	m, err = InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	defer m.Close()
+	m.SetJournalConfig(cfg)
+	item = m.GetItem(hash)
+	if len(item.Parts) == 0 || item.GetDownloaded() == 0 {
+		t.Fatalf("state not recovered: parts=%d downloaded=%d", len(item.Parts), item.GetDownloaded())
+	}
+
+	resumed, err := m.ResumeDownload(&http.Client{}, hash, nil)
+	if err != nil {
+		t.Fatalf("ResumeDownload: %v", err)
+	}
+	if err := resumed.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(base, d.fileName))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("resumed content mismatch")
+	}
+	if fileExists(filepath.Join(DlDataDir, hash, journalFileName)) {
+		t.Error("journal not removed after completion")
+	}
+}
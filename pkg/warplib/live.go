@@ -0,0 +1,357 @@
+package warplib
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// parkPollInterval is how often a parked part checks for a free connection slot.
+const parkPollInterval = 100 * time.Millisecond
+
+// SetSpeedLimit changes the speed limit of the download in bytes per second
+// while it is running. 0 removes the limit. The limit is shared evenly
+// between the parts that are currently downloading.
+func (d *Downloader) SetSpeedLimit(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	atomic.StoreInt64(&d.speedLimit, limit)
+	if limit > 0 {
+		d.Log("Speed limit changed to %s/s", ContentLength(limit))
+	} else {
+		d.Log("Speed limit removed")
+	}
+	d.rebalanceSpeedLimit()
+}
+
+// GetSpeedLimit returns the speed limit of the download in bytes per second.
+func (d *Downloader) GetSpeedLimit() int64 {
+	return atomic.LoadInt64(&d.speedLimit)
+}
+
+// partSpeedLimit returns the initial speed limit for a new part:
+// total limit / number of base parts. It is rebalanced across the
+// running parts once the part starts downloading.
+func (d *Downloader) partSpeedLimit() int64 {
+	limit := atomic.LoadInt64(&d.speedLimit)
+	if limit > 0 && d.numBaseParts > 1 {
+		limit /= int64(d.numBaseParts)
+	}
+	return limit
+}
+
+// rebalanceSpeedLimit splits the speed limit evenly between the running parts.
+func (d *Downloader) rebalanceSpeedLimit() {
+	var parts []*Part
+	d.activeParts.Range(func(_ string, info *activePartInfo) bool {
+		if info.part != nil {
+			parts = append(parts, info.part)
+		}
+		return true
+	})
+	if len(parts) == 0 {
+		return
+	}
+	limit := atomic.LoadInt64(&d.speedLimit)
+	if limit > 0 {
+		// never round down to 0, which would mean unlimited
+		limit /= int64(len(parts))
+		if limit < 1 {
+			limit = 1
+		}
+	}
+	for _, p := range parts {
+		p.setSpeedLimit(limit)
+	}
+}
+
+// SetMaxConnections changes the number of parallel connections while the
+// download is running. Raising it splits the running parts with the most
+// remaining bytes into new parts; lowering it parks parts, closing their
+// connections until a slot is free again. Downloaded bytes are kept either way.
+func (d *Downloader) SetMaxConnections(n int32) error {
+	if n < 1 {
+		return ErrInvalidMaxConnections
+	}
+	if !d.resumable || d.contentLength.v() <= 0 {
+		return ErrLiveChangeUnsupported
+	}
+	if d.maxParts != 0 && n > d.maxParts {
+		n = d.maxParts
+	}
+	old := atomic.SwapInt32(&d.maxConn, n)
+	d.Log("Max connections changed from %d to %d", old, n)
+
+	// Parts that are parked (or about to be) reconnect by themselves
+	// once the limit allows it, so only connected parts are adjusted.
+	var connected []*activePartInfo
+	var parked int32
+	for _, info := range d.activePartsByRemaining() {
+		if atomic.LoadInt32(&info.part.ctl) == partCtlPark {
+			parked++
+			continue
+		}
+		// drop split requests of an earlier call
+		if atomic.LoadInt32(&info.part.ctl) > 0 {
+			info.part.request(partCtlNone)
+		}
+		connected = append(connected, info)
+	}
+
+	switch excess := int32(len(connected)) - n; {
+	case excess > 0:
+		for _, info := range connected {
+			if excess == 0 {
+				break
+			}
+			if info.part.request(partCtlPark) {
+				excess--
+			}
+		}
+	case excess+parked < 0:
+		d.requestSplits(connected, -(excess + parked))
+	}
+	return nil
+}
+
+// activePartsByRemaining returns the running parts, most remaining bytes first.
+func (d *Downloader) activePartsByRemaining() []*activePartInfo {
+	var infos []*activePartInfo
+	d.activeParts.Range(func(_ string, info *activePartInfo) bool {
+		if info.part != nil {
+			infos = append(infos, info)
+		}
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].getRemaining() > infos[j].getRemaining()
+	})
+	return infos
+}
+
+// requestSplits asks the given parts to split off want new parts in total.
+// Extra parts go to whichever part leaves the largest pieces, and no piece
+// is made smaller than the minimum part size.
+func (d *Downloader) requestSplits(infos []*activePartInfo, want int32) {
+	minSize := d.getMinPartSize()
+	extra := make([]int32, len(infos))
+	for ; want > 0; want-- {
+		best, bestPiece := -1, int64(0)
+		for i, info := range infos {
+			piece := info.getRemaining() / int64(extra[i]+2)
+			if piece >= minSize && piece > bestPiece {
+				best, bestPiece = i, piece
+			}
+		}
+		if best == -1 {
+			break
+		}
+		extra[best]++
+	}
+	for i, info := range infos {
+		if extra[i] > 0 {
+			info.part.request(extra[i])
+		}
+	}
+}
+
+// connLimitReached reports whether all connection slots are taken,
+// counting parked parts that are waiting to reconnect, or the host has
+// no free connection left.
+func (d *Downloader) connLimitReached() bool {
+	maxConn := atomic.LoadInt32(&d.maxConn)
+	if maxConn != 0 &&
+		atomic.LoadInt32(&d.numConn)+atomic.LoadInt32(&d.numParked) >= maxConn {
+		return true
+	}
+	return d.hostSlotsLeft() == 0
+}
+
+// parkPart releases the connection slot of a part, along with its host
+// slot, and blocks until both are free again under the current limits,
+// or the download stops.
+func (d *Downloader) parkPart(part *Part) error {
+	hash := part.hash
+	atomic.AddInt32(&d.numConn, -1)
+	atomic.AddInt32(&d.numParked, 1)
+	defer atomic.AddInt32(&d.numParked, -1)
+	d.releaseHostSlot()
+	d.Log("%s: parked, waiting for a free connection", hash)
+
+	host := urlHost(d.url)
+	ticker := time.NewTicker(parkPollInterval)
+	defer ticker.Stop()
+	for {
+		n := atomic.LoadInt32(&d.numConn)
+		if maxConn := atomic.LoadInt32(&d.maxConn); maxConn == 0 || n < maxConn {
+			if atomic.CompareAndSwapInt32(&d.numConn, n, n+1) {
+				if d.hosts.TryAcquire(host) {
+					atomic.CompareAndSwapInt32(&part.ctl, partCtlPark, partCtlNone)
+					d.Log("%s: unparked", hash)
+					return nil
+				}
+				// the host is full, give the slot back and keep waiting
+				atomic.AddInt32(&d.numConn, -1)
+			} else {
+				continue
+			}
+		}
+		select {
+		case <-d.ctx.Done():
+			// keep the counts balanced for the caller's deferred release
+			atomic.AddInt32(&d.numConn, 1)
+			d.hosts.forceAcquire(host)
+			return d.ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// splitPart splits the remaining range of a running part into n+1 equal
+// pieces: the part keeps the first one and a new part is spawned for each
+// of the others. foff is lowered to the new end of the part. It returns the
+// expected speed for the part after the split.
+func (d *Downloader) splitPart(part *Part, foff *int64, espeed int64, n int32) int64 {
+	hash := part.hash
+	poff := part.offset + part.getRead()
+	end := atomic.LoadInt64(foff)
+	if d.maxParts != 0 {
+		if left := d.maxParts - atomic.LoadInt32(&d.numParts); n > left {
+			n = left
+		}
+	}
+	if left := d.hostSlotsLeft(); left >= 0 && n > left {
+		n = left
+	}
+	minSize := d.getMinPartSize()
+	for n > 0 && (end-poff+1)/int64(n+1) < minSize {
+		n--
+	}
+	if n <= 0 {
+		d.Log("%s: split skipped, not enough bytes left", hash)
+		return espeed
+	}
+
+	size := (end - poff + 1) / int64(n+1)
+	espeed /= int64(n + 1)
+	for i := int64(1); i <= int64(n); i++ {
+		ioff := poff + i*size
+		pend := ioff + size - 1
+		if i == int64(n) {
+			pend = end
+		}
+		d.wg.Add(1)
+		go func(ioff, foff int64) {
+			defer func() {
+				if r := recover(); r != nil {
+					d.l.Printf("PANIC in newPartDownload (split): %v\n%s", r, debug.Stack())
+					d.handlers.ErrorHandler("split-part", fmt.Errorf("panic: %v", r))
+					atomic.StoreInt32(&d.stopped, 1)
+					d.cancel()
+				}
+			}()
+			d.newPartDownload(ioff, foff, espeed)
+		}(ioff, pend)
+	}
+	atomic.StoreInt64(foff, poff+size-1)
+
+	d.Log("%s: split into %d parts for more connections", hash, n+1)
+	d.handlers.RespawnPartHandler(hash, part.offset, poff, poff+size-1)
+	d.journalRange(journalResize, hash, part.offset, poff+size-1)
+	return espeed
+}
+
+// prioritize asks for the byte at off to be downloaded next, for a reader
+// waiting on it. If the running part that covers off is at least the
+// minimum part size away from it, the part splits at off. It returns false
+// if no running part covers off.
+func (d *Downloader) prioritize(off int64) bool {
+	var found bool
+	d.activeParts.Range(func(_ string, info *activePartInfo) bool {
+		if info.part == nil {
+			return true
+		}
+		pos := info.getCurrentPos()
+		if off < pos || off > atomic.LoadInt64(info.foff) {
+			return true
+		}
+		found = true
+		if off-pos >= d.getMinPartSize() {
+			info.part.prioritize(off)
+		}
+		return false
+	})
+	return found
+}
+
+// splitPartAt splits a running part at the offset a reader waits for: a
+// new part downloads from at to the end of the part's range and the part
+// stops before at. It reports whether the part has to give its connection
+// to the new part, as all connection slots are taken.
+func (d *Downloader) splitPartAt(part *Part, foff *int64, espeed, at int64) (park bool) {
+	hash := part.hash
+	poff := part.offset + part.getRead()
+	end := atomic.LoadInt64(foff)
+	if at-poff < d.getMinPartSize() || at > end {
+		// it arrives soon anyway, or was already split off
+		return false
+	}
+	if d.maxParts != 0 && atomic.LoadInt32(&d.numParts) >= d.maxParts {
+		d.Log("%s: priority split at %d skipped, max parts reached", hash, at)
+		return false
+	}
+	park = d.connLimitReached()
+	d.wg.Add(1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				d.l.Printf("PANIC in newPartDownload (priority): %v\n%s", r, debug.Stack())
+				d.handlers.ErrorHandler("priority-part", fmt.Errorf("panic: %v", r))
+				atomic.StoreInt32(&d.stopped, 1)
+				d.cancel()
+			}
+		}()
+		d.newPartDownload(at, end, espeed)
+	}()
+	atomic.StoreInt64(foff, at-1)
+
+	d.Log("%s: split at %d for a waiting reader", hash, at)
+	d.handlers.RespawnPartHandler(hash, part.offset, poff, at-1)
+	d.journalRange(journalResize, hash, part.offset, at-1)
+	return park
+}
+
+// partRead returns the number of bytes the running part hash has
+// downloaded, or false if it isn't running.
+func (d *Downloader) partRead(hash string) (int64, bool) {
+	info := d.activeParts.Get(hash)
+	if info == nil || info.part == nil {
+		return 0, false
+	}
+	return info.part.getRead(), true
+}
+
+// resumeOpts returns the options the download is running with, so it
+// can be resumed later the way it was running. With automatic tuning
+// the connection count it was started with is kept, not the tuned one.
+func (d *Downloader) resumeOpts() *ResumeDownloadOpts {
+	opts := &ResumeDownloadOpts{
+		ForceParts:      d.force,
+		MaxConnections:  atomic.LoadInt32(&d.maxConn),
+		MaxSegments:     d.maxParts,
+		RequestTimeout:  d.requestTimeout,
+		SpeedLimit:      d.GetSpeedLimit(),
+		AutoConnections: d.tuner != nil,
+	}
+	if d.tuner != nil {
+		opts.MaxConnections = d.tuner.limit
+	}
+	if d.retryConfig != nil {
+		retryConfig := *d.retryConfig
+		opts.RetryConfig = &retryConfig
+	}
+	return opts
+}
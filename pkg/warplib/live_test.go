@@ -0,0 +1,277 @@
+package warplib
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLiveTestDownloader returns a downloader with the given parts registered
+// as running, each with remaining bytes left to download.
+func newLiveTestDownloader(remaining ...int64) (*Downloader, []*Part) {
+	d := &Downloader{
+		resumable:     true,
+		contentLength: ContentLength(100 * MB),
+		maxConn:       int32(len(remaining)),
+		l:             log.New(io.Discard, "", 0),
+	}
+	var parts []*Part
+	var offset int64
+	for i, rem := range remaining {
+		p := &Part{hash: string(rune('a' + i)), offset: offset}
+		foff := offset + rem - 1
+		d.registerActivePart(p, &foff)
+		parts = append(parts, p)
+		offset += rem
+	}
+	return d, parts
+}
+
+func TestDownloader_SetSpeedLimit(t *testing.T) {
+	d, parts := newLiveTestDownloader(MB, MB)
+
+	d.SetSpeedLimit(1000)
+	if got := d.GetSpeedLimit(); got != 1000 {
+		t.Fatalf("GetSpeedLimit() = %d, want 1000", got)
+	}
+	for _, p := range parts {
+		if p.speedLimit != 500 {
+			t.Errorf("part %s limit = %d, want 500", p.hash, p.speedLimit)
+		}
+	}
+
+	// A finished part hands its share to the remaining ones.
+	d.unregisterActivePart(parts[1].hash)
+	if parts[0].speedLimit != 1000 {
+		t.Errorf("remaining part limit = %d, want 1000", parts[0].speedLimit)
+	}
+
+	d.SetSpeedLimit(0)
+	if parts[0].speedLimit != 0 {
+		t.Errorf("part limit after removal = %d, want 0", parts[0].speedLimit)
+	}
+}
+
+func TestPart_SetSpeedLimitUpdatesLimiter(t *testing.T) {
+	p := &Part{}
+	p.limiter = NewRateLimitedReader(bytes.NewReader(nil), 0)
+	p.setSpeedLimit(2 * KB)
+	if got := p.limiter.GetLimit(); got != 2*KB {
+		t.Errorf("limiter limit = %d, want %d", got, 2*KB)
+	}
+}
+
+func TestDownloader_SetMaxConnections_Errors(t *testing.T) {
+	d, _ := newLiveTestDownloader(MB)
+	if err := d.SetMaxConnections(0); err != ErrInvalidMaxConnections {
+		t.Errorf("SetMaxConnections(0) = %v, want ErrInvalidMaxConnections", err)
+	}
+	d.resumable = false
+	if err := d.SetMaxConnections(4); err != ErrLiveChangeUnsupported {
+		t.Errorf("SetMaxConnections on non-resumable = %v, want ErrLiveChangeUnsupported", err)
+	}
+}
+
+func TestDownloader_SetMaxConnections_Requests(t *testing.T) {
+	d, parts := newLiveTestDownloader(40*MB, 10*MB, 20*MB)
+
+	// Lowering parks the parts with the most remaining bytes.
+	if err := d.SetMaxConnections(1); err != nil {
+		t.Fatalf("SetMaxConnections(1): %v", err)
+	}
+	if d.GetMaxConnections() != 1 {
+		t.Fatalf("GetMaxConnections() = %d, want 1", d.GetMaxConnections())
+	}
+	want := []int32{partCtlPark, partCtlNone, partCtlPark}
+	for i, p := range parts {
+		if p.ctl != want[i] {
+			t.Errorf("part %s ctl = %d, want %d", p.hash, p.ctl, want[i])
+		}
+	}
+
+	// Raising splits the largest parts; parked parts reconnect by themselves.
+	for _, p := range parts {
+		p.ctl = partCtlNone
+	}
+	parts[1].ctl = partCtlPinned
+	if err := d.SetMaxConnections(8); err != nil {
+		t.Fatalf("SetMaxConnections(8): %v", err)
+	}
+	var extra int32
+	for _, p := range parts {
+		if p.ctl > 0 {
+			extra += p.ctl
+		}
+	}
+	if extra != 5 {
+		t.Errorf("requested %d extra parts, want 5", extra)
+	}
+	if parts[0].ctl <= parts[2].ctl {
+		t.Errorf("largest part should get most splits: %d vs %d", parts[0].ctl, parts[2].ctl)
+	}
+	if parts[1].ctl != partCtlPinned {
+		t.Errorf("pinned part ctl = %d, want pinned", parts[1].ctl)
+	}
+}
+
+func TestDownloader_ParkPart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Downloader{ctx: ctx, maxConn: 1, numConn: 2, l: log.New(io.Discard, "", 0)}
+	p := &Part{hash: "p", ctl: partCtlPark}
+
+	done := make(chan error, 1)
+	go func() { done <- d.parkPart(p) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&d.numConn); got != 1 {
+		t.Fatalf("numConn while parked = %d, want 1", got)
+	}
+	if !d.connLimitReached() {
+		t.Fatal("parked part should count against the connection limit")
+	}
+	// Another part finishing frees the slot.
+	atomic.AddInt32(&d.numConn, -1)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("parkPart: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("part was not unparked")
+	}
+	if atomic.LoadInt32(&p.ctl) != partCtlNone || atomic.LoadInt32(&d.numConn) != 1 {
+		t.Errorf("after unpark: ctl=%d numConn=%d", p.ctl, d.numConn)
+	}
+
+	// A stopped download ends the wait with the context error.
+	atomic.StoreInt32(&d.numConn, 2)
+	cancel()
+	if err := d.parkPart(p); err != context.Canceled {
+		t.Errorf("parkPart after cancel = %v, want context.Canceled", err)
+	}
+	if atomic.LoadInt32(&d.numConn) != 2 {
+		t.Errorf("numConn after cancelled park = %d, want 2", d.numConn)
+	}
+}
+
+// runLiveDownload starts a download of content over a slow range server and
+// calls change once some bytes have arrived. It returns the downloaded file
+// and the highest number of concurrent connections seen after the change.
+func runLiveDownload(t *testing.T, content []byte, opts *DownloaderOpts, change func(d *Downloader)) ([]byte, int32) {
+	t.Helper()
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	srv := newDelayedRangeServer(t, content, time.Millisecond)
+	defer srv.Close()
+
+	var read, peak int64
+	var changed atomic.Bool
+	trigger := make(chan struct{})
+	opts.DownloadDirectory = base
+	opts.Handlers = &Handlers{
+		DownloadProgressHandler: func(_ string, n int) {
+			if atomic.AddInt64(&read, int64(n)) > 256*KB && changed.CompareAndSwap(false, true) {
+				close(trigger)
+			}
+		},
+	}
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", opts)
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	defer d.Close()
+
+	var startErr error
+	finished := make(chan struct{})
+	go func() {
+		startErr = d.Start()
+		close(finished)
+	}()
+	go func() {
+		select {
+		case <-trigger:
+		case <-finished:
+			return
+		}
+		change(d)
+		for {
+			select {
+			case <-finished:
+				return
+			case <-time.After(10 * time.Millisecond):
+				// connections are counted only after the change
+				if n := int64(d.NumConnections()); n > atomic.LoadInt64(&peak) {
+					atomic.StoreInt64(&peak, n)
+				}
+			}
+		}
+	}()
+
+	select {
+	case <-finished:
+		if startErr != nil {
+			t.Fatalf("Start: %v", startErr)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("download did not finish")
+	}
+	got, err := os.ReadFile(d.GetSavePath())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return got, int32(atomic.LoadInt64(&peak))
+}
+
+func TestDownloader_SetMaxConnections_RaiseWhileRunning(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	content := bytes.Repeat([]byte("0123456789abcdef"), 3*int(MB)/16)
+	got, peak := runLiveDownload(t, content, &DownloaderOpts{
+		MaxConnections: 1,
+		NumBaseParts:   1,
+	}, func(d *Downloader) {
+		if err := d.SetMaxConnections(4); err != nil {
+			t.Errorf("SetMaxConnections: %v", err)
+		}
+	})
+	if !bytes.Equal(got, content) {
+		t.Fatal("downloaded content mismatch")
+	}
+	if peak < 2 {
+		t.Errorf("peak connections after raising = %d, want more than 1", peak)
+	}
+}
+
+func TestDownloader_SetMaxConnections_LowerWhileRunning(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	content := bytes.Repeat([]byte("fedcba9876543210"), 2*int(MB)/16)
+	var lowered atomic.Bool
+	got, peak := runLiveDownload(t, content, &DownloaderOpts{
+		MaxConnections: 4,
+		NumBaseParts:   4,
+	}, func(d *Downloader) {
+		if err := d.SetMaxConnections(1); err != nil {
+			t.Errorf("SetMaxConnections: %v", err)
+		}
+		// give running parts a chunk boundary to park at
+		time.Sleep(200 * time.Millisecond)
+		lowered.Store(true)
+	})
+	if !bytes.Equal(got, content) {
+		t.Fatal("downloaded content mismatch")
+	}
+	if lowered.Load() && peak > 1 {
+		t.Errorf("peak connections after lowering = %d, want 1", peak)
+	}
+}
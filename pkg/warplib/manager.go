@@ -1,23 +1,23 @@
 package warplib
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
-// Default download data directory
-var __USERDATA_FILE_NAME string
+// Userdata database, and the GOB encoded file it replaced
+var (
+	__USERDATA_DB_FILE_NAME string
+	__USERDATA_FILE_NAME    string
+)
 
-// ManagerData is the persistent state of the Manager.
-// It wraps items and optional queue state for GOB encoding.
+// ManagerData is the legacy persistent state of the Manager, GOB encoded
+// in userdata.warp. It is only read to import it into the userdata database.
 type ManagerData struct {
 	Items      ItemsMap
 	QueueState *QueueState
@@ -28,7 +28,7 @@ type ManagerData struct {
 type Manager struct {
 	// items is a map of download items
 	items ItemsMap
-	f     *os.File
+	store *itemStore
 	mu    *sync.RWMutex
 	// queue manages concurrent download limits (nil if disabled)
 	queue *QueueManager
@@ -36,6 +36,30 @@ type Manager struct {
 	queueState *QueueState
 	// schemeRouter dispatches URL schemes to protocol factories during resume.
 	schemeRouter *SchemeRouter
+	// bandwidth is the daemon-wide speed limit shared by all HTTP downloads.
+	bandwidth *BandwidthLimiter
+	// hosts is the daemon-wide per-host connection limit shared by all HTTP downloads.
+	hosts *HostLimiter
+	// journal is the progress journal config of all HTTP downloads.
+	journal *JournalConfig
+	// extract are the archive extraction rules and limits.
+	extract *ExtractConfig
+	// categories sort completed downloads into directories.
+	categories *CategoryConfig
+	// duplicates is the default policy for duplicate downloads.
+	duplicates DuplicatePolicy
+	// cache serves and stores downloads by content, nil if disabled.
+	cache *Cache
+	// checksum is the checksum validation config of downloads that don't
+	// set their own.
+	checksum *ChecksumConfig
+	// keyring holds the keys trusted to sign downloads, nil if none.
+	keyring *Keyring
+	// addMu serializes the duplicate check and the insert of new downloads.
+	addMu sync.Mutex
+	// events are the handlers of the events of all downloads.
+	events   []ItemEventHandlerFunc
+	eventsMu sync.RWMutex
 }
 
 // SetSchemeRouter sets the scheme router for protocol dispatch during resume.
@@ -47,57 +71,36 @@ func (m *Manager) SetSchemeRouter(r *SchemeRouter) {
 // InitManager creates a new manager instance.
 func InitManager() (m *Manager, err error) {
 	m = &Manager{
-		items: make(ItemsMap),
-		mu:    new(sync.RWMutex),
+		items:     make(ItemsMap),
+		mu:        new(sync.RWMutex),
+		bandwidth: NewBandwidthLimiter(0),
+		hosts:     NewHostLimiter(nil),
 	}
-	m.f, err = WarpOpenFile(
-		__USERDATA_FILE_NAME,
-		os.O_RDWR|os.O_CREATE,
-		DefaultFileMode,
-	)
+	m.events = []ItemEventHandlerFunc{m.recordRun}
+	m.store, err = openItemStore(__USERDATA_DB_FILE_NAME)
 	if err != nil {
 		m = nil
 		return
 	}
-	// Attempt to decode existing data. Try new format first, fall back to legacy.
-	var data ManagerData
-	if decErr := gob.NewDecoder(m.f).Decode(&data); decErr != nil {
-		if decErr != io.EOF {
-			// Try legacy format (ItemsMap only)
-			if _, seekErr := m.f.Seek(0, 0); seekErr != nil {
-				log.Printf("warplib: warning: failed to seek for legacy decode: %v", seekErr)
-			} else if legacyErr := gob.NewDecoder(m.f).Decode(&m.items); legacyErr != nil {
-				if legacyErr != io.EOF {
-					// Log warning for non-empty but corrupt file
-					log.Printf("warplib: warning: failed to decode userdata, starting fresh: %v", legacyErr)
-				}
-				// Reset to empty map (already initialized, but be explicit)
-				m.items = make(ItemsMap)
-			}
-		} else {
-			// Empty file - start fresh
-			m.items = make(ItemsMap)
-		}
-	} else {
-		// New format decoded successfully
-		m.items = data.Items
-		if m.items == nil {
-			m.items = make(ItemsMap)
-		}
-		m.queueState = data.QueueState
-		// Validate protocol values for all decoded items.
-		// Unknown values indicate the file was created by a newer warpdl version.
-		for hash, item := range m.items {
-			if item == nil {
-				continue
-			}
-			if err := ValidateProtocol(item.Protocol); err != nil {
-				m.f.Close()
-				return nil, fmt.Errorf("item %s: %w", hash, err)
-			}
+	if err = m.store.importLegacy(__USERDATA_FILE_NAME); err != nil {
+		m.store.close()
+		return nil, err
+	}
+	m.items, m.queueState, err = m.store.load()
+	if err != nil {
+		m.store.close()
+		return nil, fmt.Errorf("load userdata: %w", err)
+	}
+	// Validate protocol values for all loaded items.
+	// Unknown values indicate the database was written by a newer warpdl version.
+	for hash, item := range m.items {
+		if err := ValidateProtocol(item.Protocol); err != nil {
+			m.store.close()
+			return nil, fmt.Errorf("item %s: %w", hash, err)
 		}
 	}
 	m.populateMemPart()
+	m.recoverJournals()
 	return
 }
 
@@ -141,6 +144,45 @@ func (m *Manager) SetMaxConcurrentDownloads(maxConcurrent int, onStartDownload f
 	}
 }
 
+// SetGlobalSpeedLimit sets the daemon-wide speed limit in bytes per second
+// shared by all HTTP downloads, including ones already in progress.
+// 0 or negative means unlimited.
+func (m *Manager) SetGlobalSpeedLimit(limit int64) {
+	if m.bandwidth == nil {
+		m.bandwidth = NewBandwidthLimiter(limit)
+		return
+	}
+	m.bandwidth.SetLimit(limit)
+}
+
+// GetGlobalSpeedLimit returns the daemon-wide speed limit in bytes per second.
+// 0 means unlimited.
+func (m *Manager) GetGlobalSpeedLimit() int64 {
+	return m.bandwidth.GetLimit()
+}
+
+// SetHostLimits sets the daemon-wide connection limits per host shared by
+// all HTTP downloads, including ones already in progress.
+// A nil limits removes all limits.
+func (m *Manager) SetHostLimits(limits *HostLimits) {
+	if m.hosts == nil {
+		m.hosts = NewHostLimiter(limits)
+		return
+	}
+	m.hosts.SetLimits(limits)
+}
+
+// GetHostLimiter returns the daemon-wide per-host connection limiter.
+func (m *Manager) GetHostLimiter() *HostLimiter {
+	return m.hosts
+}
+
+// SetJournalConfig sets the progress journal config of the downloads
+// added or resumed from now on.
+func (m *Manager) SetJournalConfig(cfg *JournalConfig) {
+	m.journal = cfg
+}
+
 // GetQueue returns the QueueManager if enabled, or nil if disabled.
 func (m *Manager) GetQueue() *QueueManager {
 	return m.queue
@@ -157,6 +199,14 @@ type AddDownloadOpts struct {
 	// SSHKeyPath is the SSH key path to persist in Item for SFTP resume.
 	// Empty means default key paths are tried on resume.
 	SSHKeyPath string
+	// Hooks are the commands run at the events of the download.
+	Hooks *Hooks
+	// Extract asks for the archive to be extracted once downloaded.
+	// nil applies the first matching extraction rule, if any.
+	Extract *ExtractOpts
+	// OnDuplicate is the policy for a download duplicating an existing
+	// one. Empty uses the policy of the manager.
+	OnDuplicate DuplicatePolicy
 }
 
 // AddDownload adds a new download item entry.
@@ -169,6 +219,15 @@ func (m *Manager) AddDownload(d *Downloader, opts *AddDownloadOpts) (err error)
 	if opts == nil {
 		opts = &AddDownloadOpts{}
 	}
+	m.addMu.Lock()
+	defer m.addMu.Unlock()
+	path, err := filepath.Abs(filepath.Join(opts.AbsoluteLocation, d.fileName))
+	if err != nil {
+		return err
+	}
+	if err := m.checkDuplicate(opts.OnDuplicate, d.url, path, d.expectedChecksums, d.overwrite); err != nil {
+		return err
+	}
 	item, err := newItem(
 		m.mu,
 		d.fileName,
@@ -191,7 +250,25 @@ func (m *Manager) AddDownload(d *Downloader, opts *AddDownloadOpts) (err error)
 	// Wrap the concrete *Downloader in an httpProtocolDownloader adapter.
 	// patchHandlers operates on the concrete *Downloader directly, so we
 	// patch first, then wrap.
+	item.DirectWrite = d.directWrite
+	item.Hooks = opts.Hooks
+	item.Extract = opts.Extract
+	if item.Extract == nil {
+		item.Extract = m.extract.match(item.Name, item.Url)
+	}
+	item.Category = m.categories.match(item.Name, item.Url, d.contentType)
+	item.Checksums = d.expectedChecksums
+	item.SignatureURL = d.signatureURL
+	item.Pieces = d.pieces
 	m.patchHandlers(d, item)
+	d.bandwidth = m.bandwidth
+	d.hosts = m.hosts
+	d.journalCfg = m.journal
+	d.cache = m.cache
+	d.keyring = m.keyring
+	if d.checksumConfig == nil {
+		d.checksumConfig = m.checksum
+	}
 
 	adapter := &httpProtocolDownloader{
 		inner:  d,
@@ -200,6 +277,7 @@ func (m *Manager) AddDownload(d *Downloader, opts *AddDownloadOpts) (err error)
 	}
 	item.setDAlloc(adapter)
 	m.UpdateItem(item)
+	m.emit(item, EventAdded, nil)
 
 	// Register with queue if enabled
 	if m.queue != nil && !opts.SkipQueue {
@@ -210,6 +288,7 @@ func (m *Manager) AddDownload(d *Downloader, opts *AddDownloadOpts) (err error)
 
 // patchHandlers patches the handlers of the downloader to update the item.
 func (m *Manager) patchHandlers(d *Downloader, item *Item) {
+	m.patchEventHandlers(d.handlers, item)
 	oSPH := d.handlers.SpawnPartHandler
 	d.handlers.SpawnPartHandler = func(hash string, ioff, foff int64) {
 		item.addPart(hash, ioff, foff)
@@ -249,6 +328,22 @@ func (m *Manager) patchHandlers(d *Downloader, item *Item) {
 		item.savePart(off, part)
 		oCCH(hash, tread)
 	}
+	oPHH := d.handlers.PiecesHashedHandler
+	d.handlers.PiecesHashedHandler = func(pieces *PieceHashes) {
+		item.mu.Lock()
+		item.Pieces = pieces
+		item.mu.Unlock()
+		m.UpdateItem(item)
+		oPHH(pieces)
+	}
+	oFHH := d.handlers.FileHashedHandler
+	d.handlers.FileHashedHandler = func(hashes []ExpectedChecksum) {
+		item.mu.Lock()
+		item.Hashes = hashes
+		item.mu.Unlock()
+		m.UpdateItem(item)
+		oFHH(hashes)
+	}
 	oDCH := d.handlers.DownloadCompleteHandler
 	d.handlers.DownloadCompleteHandler = func(hash string, tread int64) {
 		if hash != MAIN_HASH {
@@ -257,6 +352,9 @@ func (m *Manager) patchHandlers(d *Downloader, item *Item) {
 		item.mu.Lock()
 		item.Parts = nil
 		item.Downloaded = item.TotalSize
+		if d.signature != nil {
+			item.Signature = d.signature
+		}
 		item.mu.Unlock()
 		m.UpdateItem(item)
 
@@ -265,6 +363,23 @@ func (m *Manager) patchHandlers(d *Downloader, item *Item) {
 			m.queue.OnComplete(item.Hash)
 		}
 
+		// Cache the file where it was saved, before the category move
+		// below.
+		if !d.cached {
+			m.cacheDownload(item, d.etag)
+		}
+
+		// Move the file to its category before extracting it there. The
+		// compile complete handler is patched to look up parts, so the
+		// extraction reports to the one it wraps.
+		err := m.categorizeDownload(item)
+		if err == nil {
+			err = m.extractDownload(item, d.handlers.CompileStartHandler, d.handlers.CompileProgressHandler, oCCH)
+		}
+		if err != nil {
+			d.handlers.ErrorHandler(MAIN_HASH, err)
+		}
+
 		oDCH(hash, tread)
 	}
 }
@@ -276,6 +391,15 @@ func (m *Manager) AddProtocolDownload(pd ProtocolDownloader, probe ProbeResult,
 	if opts == nil {
 		opts = &AddDownloadOpts{}
 	}
+	m.addMu.Lock()
+	defer m.addMu.Unlock()
+	path, err := filepath.Abs(filepath.Join(opts.AbsoluteLocation, pd.GetFileName()))
+	if err != nil {
+		return err
+	}
+	if err := m.checkDuplicate(opts.OnDuplicate, cleanURL, path, nil, false); err != nil {
+		return err
+	}
 	item, err := newItem(
 		m.mu,
 		pd.GetFileName(),
@@ -296,12 +420,19 @@ func (m *Manager) AddProtocolDownload(pd ProtocolDownloader, probe ProbeResult,
 	}
 	item.Protocol = proto
 	item.SSHKeyPath = opts.SSHKeyPath
+	item.Hooks = opts.Hooks
+	item.Extract = opts.Extract
+	if item.Extract == nil {
+		item.Extract = m.extract.match(item.Name, item.Url)
+	}
+	item.Category = m.categories.match(item.Name, item.Url, "")
 
 	// Wrap handlers with item-update callbacks
 	m.patchProtocolHandlers(handlers, item)
 
 	item.setDAlloc(pd)
 	m.UpdateItem(item)
+	m.emit(item, EventAdded, nil)
 
 	if m.queue != nil && !opts.SkipQueue {
 		m.queue.Add(pd.GetHash(), opts.Priority)
@@ -325,6 +456,7 @@ func (m *Manager) patchProtocolHandlers(h *Handlers, item *Item) {
 	if h == nil {
 		return
 	}
+	m.patchEventHandlers(h, item)
 	oSPH := h.SpawnPartHandler
 	h.SpawnPartHandler = func(hash string, ioff, foff int64) {
 		item.addPart(hash, ioff, foff)
@@ -389,51 +521,59 @@ func (m *Manager) patchProtocolHandlers(h *Handlers, item *Item) {
 		if m.queue != nil {
 			m.queue.OnComplete(item.Hash)
 		}
+		m.cacheDownload(item, "")
+		err := m.categorizeDownload(item)
+		if err == nil {
+			err = m.extractDownload(item, h.CompileStartHandler, h.CompileProgressHandler, oCCH)
+		}
+		if err != nil && h.ErrorHandler != nil {
+			h.ErrorHandler(MAIN_HASH, err)
+		}
 		if oDCH != nil {
 			oDCH(hash, tread)
 		}
 	}
 }
 
-// persistItems writes items to disk using buffer-first approach.
-// Called by encode() which handles locking, or directly by Flush()/Close()
+// persistItems writes all items and the queue state to the userdata
+// database in a single transaction, dropping items no longer in the map.
+// Called by encode() which handles locking, or directly by Close()
 // which must hold m.mu write lock.
-// Does NOT call Sync() - caller decides if durability is needed.
 func (m *Manager) persistItems() error {
-	data := ManagerData{
-		Items: m.items,
-	}
-	// Include queue state if queue is enabled
-	if m.queue != nil {
-		state := m.queue.GetState()
-		data.QueueState = &state
+	if err := m.store.saveAll(m.items, m.queueSnapshot()); err != nil {
+		return fmt.Errorf("persist items: %w", err)
 	}
+	return nil
+}
 
-	var buf bytes.Buffer
-	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
-		return fmt.Errorf("encode items: %w", err)
+// queueSnapshot returns the queue state to persist, nil if the queue is disabled.
+func (m *Manager) queueSnapshot() *QueueState {
+	if m.queue == nil {
+		return nil
 	}
-	if err := m.f.Truncate(0); err != nil {
-		return fmt.Errorf("truncate: %w", err)
-	}
-	if _, err := m.f.Seek(0, 0); err != nil {
-		return fmt.Errorf("seek: %w", err)
-	}
-	if _, err := m.f.Write(buf.Bytes()); err != nil {
-		return fmt.Errorf("write: %w", err)
-	}
-	return nil
+	state := m.queue.GetState()
+	return &state
 }
 
-// encode persists items to disk.
-// This is a high-frequency operation (called on every progress update),
-// so it does NOT call Sync() for performance reasons.
+// encode persists all items to disk.
 func (m *Manager) encode() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.persistItems()
 }
 
+// saveItem persists a single item in its own transaction.
+// This is a high-frequency operation (called on every progress update),
+// so it leaves syncing the write-ahead log to SQLite.
+func (m *Manager) saveItem(item *Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.store.saveItem(item, m.queueSnapshot()); err != nil {
+		return fmt.Errorf("save item %s: %w", item.Hash, err)
+	}
+	return nil
+}
+
 // mapItem maps the item to the manager's items map.
 func (m *Manager) mapItem(item *Item) {
 	m.mu.Lock()
@@ -451,7 +591,7 @@ func (m *Manager) deleteItem(hash string) {
 // UpdateItem updates the item in the manager's items map.
 func (m *Manager) UpdateItem(item *Item) {
 	m.mapItem(item)
-	m.encode()
+	m.saveItem(item)
 }
 
 // GetScheduledItems returns all items with ScheduleState == "scheduled".
@@ -558,6 +698,9 @@ type ResumeDownloadOpts struct {
 	// SpeedLimit specifies the maximum download speed in bytes per second.
 	// If zero, no limit is applied.
 	SpeedLimit int64
+	// AutoConnections tunes the number of connections automatically,
+	// using MaxConnections as the upper bound.
+	AutoConnections bool
 }
 
 // ResumeDownload resumes a download item.
@@ -652,11 +795,21 @@ func (m *Manager) ResumeDownload(client *http.Client, hash string, opts *ResumeD
 			RetryConfig:       opts.RetryConfig,
 			RequestTimeout:    opts.RequestTimeout,
 			SpeedLimit:        opts.SpeedLimit,
+			AutoConnections:   opts.AutoConnections,
+			DirectWrite:       item.DirectWrite,
+			ChecksumConfig:    m.checksum,
+			Checksums:         item.Checksums,
+			Signature:         item.SignatureURL,
+			Pieces:            publishedPieces(item.Pieces),
 		})
 		if err != nil {
 			return
 		}
 		m.patchHandlers(d, item)
+		d.bandwidth = m.bandwidth
+		d.hosts = m.hosts
+		d.journalCfg = m.journal
+		d.keyring = m.keyring
 		// Wrap the concrete *Downloader in an httpProtocolDownloader adapter.
 		adapter := &httpProtocolDownloader{
 			inner:  d,
@@ -669,11 +822,21 @@ func (m *Manager) ResumeDownload(client *http.Client, hash string, opts *ResumeD
 	return
 }
 
+// publishedPieces returns the piece hashes of a download if they were
+// published with it, recorded ones are recorded again on resume.
+func publishedPieces(p *PieceHashes) *PieceHashes {
+	if p == nil || p.Source == "" {
+		return nil
+	}
+	return p
+}
+
 // Flush flushes away all the inactive download items.
 func (m *Manager) Flush() error {
 	// add a write lock to prevent data modification while flushing
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	var hashes []string
 	for hash, item := range m.items {
 		// Since item.mu == m.mu, we already hold the lock.
 		// Read fields directly without additional locking.
@@ -686,14 +849,17 @@ func (m *Manager) Flush() error {
 		if totalSize != downloaded && dAlloc != nil {
 			continue
 		}
-		delete(m.items, hash)
-		_ = WarpRemoveAll(GetPath(DlDataDir, hash))
+		hashes = append(hashes, hash)
 	}
-	if err := m.persistItems(); err != nil {
+	if err := m.store.deleteItems(hashes...); err != nil {
 		return fmt.Errorf("flush persist: %w", err)
 	}
+	for _, hash := range hashes {
+		delete(m.items, hash)
+		_ = WarpRemoveAll(GetPath(DlDataDir, hash))
+	}
 	// Sync to ensure durability - Flush is an explicit user action
-	if err := m.f.Sync(); err != nil {
+	if err := m.store.sync(); err != nil {
 		return fmt.Errorf("flush sync: %w", err)
 	}
 	return nil
@@ -715,16 +881,12 @@ func (m *Manager) FlushOne(hash string) error {
 		return ErrFlushItemDownloading
 	}
 
-	// Delete from map while holding lock
-	delete(m.items, hash)
-
-	if err := m.persistItems(); err != nil {
-		// Restore on error
-		m.items[hash] = item
+	if err := m.store.deleteItems(hash); err != nil {
 		return fmt.Errorf("flush one persist: %w", err)
 	}
+	delete(m.items, hash)
 
-	if err := m.f.Sync(); err != nil {
+	if err := m.store.sync(); err != nil {
 		return fmt.Errorf("flush one sync: %w", err)
 	}
 
@@ -739,11 +901,11 @@ func (m *Manager) Close() error {
 
 	// Final persist and sync before closing
 	if err := m.persistItems(); err != nil {
-		// Log but don't fail - still need to close file
+		// Log but don't fail - still need to close the database
 		log.Printf("warplib: warning: failed to persist on close: %v", err)
 	}
-	if err := m.f.Sync(); err != nil {
+	if err := m.store.sync(); err != nil {
 		log.Printf("warplib: warning: failed to sync on close: %v", err)
 	}
-	return m.f.Close()
+	return m.store.close()
 }
@@ -356,9 +356,9 @@ func TestInitManagerInvalidUserDataPath(t *testing.T) {
 	if err := SetConfigDir(base); err != nil {
 		t.Fatalf("SetConfigDir: %v", err)
 	}
-	oldPath := __USERDATA_FILE_NAME
-	__USERDATA_FILE_NAME = filepath.Join(base, "missing", "userdata.warp")
-	defer func() { __USERDATA_FILE_NAME = oldPath }()
+	oldPath := __USERDATA_DB_FILE_NAME
+	__USERDATA_DB_FILE_NAME = filepath.Join(base, "missing", "userdata.db")
+	defer func() { __USERDATA_DB_FILE_NAME = oldPath }()
 
 	if _, err := InitManager(); err == nil {
 		t.Fatalf("expected error for invalid userdata path")
@@ -555,33 +555,22 @@ func TestManager_TruncateBeforeEncode(t *testing.T) {
 	}
 	m.Close()
 
-	// Record large file size
-	userdataPath := filepath.Join(base, "userdata.warp")
-	largeInfo, err := os.Stat(userdataPath)
-	if err != nil {
-		t.Fatalf("stat large file: %v", err)
-	}
-	largeSize := largeInfo.Size()
-
 	// Phase 2: Reopen and flush all (removes completed items)
 	m, err = InitManager()
 	if err != nil {
 		t.Fatalf("InitManager after large: %v", err)
 	}
+	if n := countStoredItems(t, m); n != 20 {
+		t.Fatalf("stored items before flush = %d, want 20", n)
+	}
 	if err := m.Flush(); err != nil {
 		t.Fatalf("Flush: %v", err)
 	}
-	m.Close()
-
-	// File should be smaller
-	smallInfo, err := os.Stat(userdataPath)
-	if err != nil {
-		t.Fatalf("stat small file: %v", err)
-	}
-	smallSize := smallInfo.Size()
-	if smallSize >= largeSize {
-		t.Fatalf("file not truncated: large=%d, small=%d", largeSize, smallSize)
+	// No rows should be left behind
+	if n := countStoredItems(t, m); n != 0 {
+		t.Fatalf("stored items after flush = %d, want 0", n)
 	}
+	m.Close()
 
 	// Phase 3: Reopen and verify no garbage
 	m, err = InitManager()
@@ -675,14 +664,6 @@ func TestManager_FlushProperlyTruncates(t *testing.T) {
 	}
 	m.Close()
 
-	// Record file size before flush
-	userdataPath := filepath.Join(base, "userdata.warp")
-	beforeInfo, err := os.Stat(userdataPath)
-	if err != nil {
-		t.Fatalf("stat before flush: %v", err)
-	}
-	beforeSize := beforeInfo.Size()
-
 	// Reopen and flush
 	m, err = InitManager()
 	if err != nil {
@@ -691,17 +672,11 @@ func TestManager_FlushProperlyTruncates(t *testing.T) {
 	if err := m.Flush(); err != nil {
 		t.Fatalf("Flush: %v", err)
 	}
-	m.Close()
-
-	// File should be smaller after flush (all items removed)
-	afterInfo, err := os.Stat(userdataPath)
-	if err != nil {
-		t.Fatalf("stat after flush: %v", err)
-	}
-	afterSize := afterInfo.Size()
-	if afterSize >= beforeSize {
-		t.Errorf("file not truncated after flush: before=%d, after=%d", beforeSize, afterSize)
+	// All rows should be removed after flush
+	if n := countStoredItems(t, m); n != 0 {
+		t.Errorf("stored items after flush = %d, want 0", n)
 	}
+	m.Close()
 
 	// Verify we can reload without corruption
 	m, err = InitManager()
@@ -89,6 +89,10 @@ var (
 	ConfigDir string
 	// DlDataDir is the absolute path to the download data directory where segment files are stored.
 	DlDataDir string
+	// QuarantineDir is the absolute path to the directory files failing their checksum are moved to.
+	QuarantineDir string
+	// KeyringDir is the absolute path to the directory of the keys trusted to sign downloads.
+	KeyringDir string
 )
 
 func init() {
@@ -151,9 +155,12 @@ func setConfigDir(dir string) error {
 	}
 	ConfigDir = abs
 	DlDataDir = filepath.Join(abs, "dldata")
+	QuarantineDir = filepath.Join(abs, "quarantine")
+	KeyringDir = filepath.Join(abs, "keys")
 	if err := WarpMkdirAll(DlDataDir, 0755); err != nil {
 		return err
 	}
+	__USERDATA_DB_FILE_NAME = filepath.Join(abs, "userdata.db")
 	__USERDATA_FILE_NAME = filepath.Join(abs, "userdata.warp")
 	return nil
 }
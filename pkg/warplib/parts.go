@@ -49,10 +49,51 @@ type Part struct {
 	// main download file
 	f *os.File
 	// speedLimit is the maximum download speed for this part in bytes per second.
-	// If zero, no limit is applied.
+	// If zero, no limit is applied. Guarded by lmu since it can change live.
 	speedLimit int64
+	// limiter throttles the current response body, nil before the first request.
+	limiter *RateLimitedReader
+	lmu     sync.Mutex
+	// bandwidth is the shared daemon-wide limiter, nil if disabled.
+	bandwidth *BandwidthLimiter
+	// ctl is a pending connection-count request, see partCtlNone.
+	// Positive values ask the part to split off that many new parts.
+	ctl int32
+	// prio is an offset in the part's range a reader is waiting for,
+	// the part splits there at its next chunk boundary. 0 means none.
+	prio int64
+	// direct makes the part write its data straight into the main file,
+	// its part file then only holds the progress, see directWriter.
+	direct bool
+	// journal records the durable progress of the part, nil if disabled.
+	journal *progressJournal
+	// stream takes the data of the part instead of a file in streaming
+	// mode, see streamWriter.
+	stream *streamWindow
+	// pieces hashes the pieces of the file from the written data, nil
+	// if they aren't recorded.
+	pieces *pieceRecorder
+	// unfinished is set when a slow part handled the error that stopped
+	// it short of its range, the part is then kept to be resumed rather
+	// than compiled.
+	unfinished bool
 }
 
+// Connection-count requests a Part picks up at its next chunk boundary.
+const (
+	// partCtlNone means no request is pending.
+	partCtlNone int32 = 0
+	// partCtlPark asks the part to drop its connection until a slot is free.
+	partCtlPark int32 = -1
+	// partCtlPinned marks a part that finishes its range in place and
+	// ignores further requests.
+	partCtlPinned int32 = -2
+)
+
+// errPartParked is returned by copyBuffer when the part released its
+// connection because of a lowered connection limit.
+var errPartParked = errors.New("part parked")
+
 type partArgs struct {
 	copyChunk  int64
 	preName    string
@@ -64,6 +105,10 @@ type partArgs struct {
 	offset     int64
 	f          *os.File
 	speedLimit int64
+	bandwidth  *BandwidthLimiter
+	direct     bool
+	journal    *progressJournal
+	pieces     *pieceRecorder
 }
 
 func initPart(ctx context.Context, client *http.Client, hash, url string, args partArgs) (*Part, error) {
@@ -81,6 +126,10 @@ func initPart(ctx context.Context, client *http.Client, hash, url string, args p
 		hash:       hash,
 		f:          args.f,
 		speedLimit: args.speedLimit,
+		bandwidth:  args.bandwidth,
+		direct:     args.direct,
+		journal:    args.journal,
+		pieces:     args.pieces,
 	}
 	err := p.openPartFile()
 	if err != nil {
@@ -108,6 +157,10 @@ func newPart(ctx context.Context, client *http.Client, url string, args partArgs
 		offset:     args.offset,
 		f:          args.f,
 		speedLimit: args.speedLimit,
+		bandwidth:  args.bandwidth,
+		direct:     args.direct,
+		journal:    args.journal,
+		pieces:     args.pieces,
 	}
 	p.setHash()
 	return &p, p.createPartFile()
@@ -117,6 +170,61 @@ func (p *Part) setEpeed(espeed int64) {
 	p.etime = getDownloadTime(espeed, p.chunk)
 }
 
+// setSpeedLimit changes the part's speed limit, including for the
+// response body currently being read.
+func (p *Part) setSpeedLimit(limit int64) {
+	p.lmu.Lock()
+	defer p.lmu.Unlock()
+	p.speedLimit = limit
+	if p.limiter != nil {
+		p.limiter.SetLimit(limit)
+	}
+}
+
+// request sets a pending connection-count request.
+// It returns false if the part is pinned.
+func (p *Part) request(ctl int32) bool {
+	for {
+		c := atomic.LoadInt32(&p.ctl)
+		if c == partCtlPinned {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&p.ctl, c, ctl) {
+			return true
+		}
+	}
+}
+
+// takeSplit consumes a pending split request and returns the number
+// of parts to split off, or 0 if none was requested.
+func (p *Part) takeSplit() int32 {
+	for {
+		c := atomic.LoadInt32(&p.ctl)
+		if c <= 0 {
+			return 0
+		}
+		if atomic.CompareAndSwapInt32(&p.ctl, c, partCtlNone) {
+			return c
+		}
+	}
+}
+
+// prioritize asks the part to split at off so a new part downloads
+// from there. It returns false if the part is pinned.
+func (p *Part) prioritize(off int64) bool {
+	if atomic.LoadInt32(&p.ctl) == partCtlPinned {
+		return false
+	}
+	atomic.StoreInt64(&p.prio, off)
+	return true
+}
+
+// takePriority consumes a pending priority request and returns its
+// offset, or 0 if none was requested.
+func (p *Part) takePriority() int64 {
+	return atomic.SwapInt64(&p.prio, 0)
+}
+
 // getRead returns the current read count atomically.
 // RACE FIX: This ensures part.read is always accessed atomically.
 func (p *Part) getRead() int64 {
@@ -178,15 +286,31 @@ func (p *Part) download(headers Headers, ioff, foff int64, force bool, requestTi
 		return
 	}
 
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		// Don't write the error page into the part, retry it as throttled.
+		resp.Body.Close()
+		if sr != nil {
+			sr.timer.Stop()
+		}
+		if cancel != nil {
+			cancel()
+		}
+		err = fmt.Errorf("%w: %s", ErrServerThrottled, resp.Status)
+		return
+	}
+
 	// Connection established — reset stall timer for body transfer phase
 	if sr != nil {
 		sr.timer.Reset(requestTimeout)
 	}
 
-	var reader io.ReadCloser = resp.Body
-	if p.speedLimit > 0 {
-		reader = NewRateLimitedReadCloser(resp.Body, p.speedLimit)
-	}
+	// Always wrap the body so the limit can be changed while downloading;
+	// an unlimited RateLimitedReader passes reads through.
+	p.lmu.Lock()
+	rl := NewRateLimitedReadCloser(resp.Body, p.speedLimit)
+	p.limiter = rl.RateLimitedReader
+	p.lmu.Unlock()
+	reader := p.bandwidth.Wrap(rl)
 
 	// Wrap reader with stall detection
 	if sr != nil {
@@ -202,7 +326,7 @@ func (p *Part) download(headers Headers, ioff, foff int64, force bool, requestTi
 		sr.resetTimer()
 		body = sr
 	} else {
-		body = resp.Body
+		body = reader
 	}
 	return
 }
@@ -219,14 +343,20 @@ func (p *Part) copyBuffer(src io.ReadCloser, foff int64, force bool) (slow bool,
 	}
 	var (
 		buf = make([]byte, chunk)
+		dst = p.writer()
 		n   int
 	)
 	for {
 		n++
-		slow, err = p.copyBufferChunkWithTime(src, p.pf, buf, !force && n%10 == 0)
+		slow, err = p.copyBufferChunkWithTime(src, dst, buf, !force && n%10 == 0)
 		if err != nil {
 			break
 		}
+		if p.journal != nil && p.journal.always {
+			if jerr := p.journal.progress(p); jerr != nil {
+				p.log("%s: journal progress: %v", p.hash, jerr)
+			}
+		}
 		if slow {
 			return
 		}
@@ -239,6 +369,14 @@ func (p *Part) copyBuffer(src io.ReadCloser, foff int64, force bool) (slow bool,
 			p.log("corruption detected: lchunk=%d, tread=%d, p.read=%d", lchunk, tread, p.getRead())
 			return false, fmt.Errorf("corruption detected: lchunk=%d (report: github.com/warpdl/warpdl)", lchunk)
 		}
+		if c := atomic.LoadInt32(&p.ctl); c > 0 || (c != partCtlPinned && atomic.LoadInt64(&p.prio) > 0) {
+			// a split was requested: hand over to runPart like a slow part
+			return true, nil
+		} else if c == partCtlPark {
+			// runPart clears the request once the part reconnects
+			err = errPartParked
+			break
+		}
 		if lchunk < chunk {
 			buf = make([]byte, lchunk)
 		}
@@ -269,7 +407,7 @@ func (p *Part) copyBufferChunkWithTime(src io.Reader, dst io.Writer, buf []byte,
 	}
 	var te time.Duration
 	te, err = getSpeed(func() error {
-		return p.copyBufferChunk(src, p.pf, buf)
+		return p.copyBufferChunk(src, dst, buf)
 	})
 	if err != nil {
 		return
@@ -290,7 +428,10 @@ func (p *Part) copyBufferChunk(src io.Reader, dst io.Writer, buf []byte) (err er
 				ew = errors.New("invalid write results")
 			}
 		}
-		atomic.AddInt64(&p.read, int64(nw))
+		read := atomic.AddInt64(&p.read, int64(nw))
+		if p.pieces != nil {
+			p.pieces.write(p.offset+read-int64(nw), buf[:nw])
+		}
 		p.pwg.Add(1)
 		safeGo(p.l, &p.pwg, "part-progress-callback", nil, func() {
 			p.pfunc(p.hash, nw)
@@ -308,6 +449,17 @@ func (p *Part) copyBufferChunk(src io.Reader, dst io.Writer, buf []byte) (err er
 	return
 }
 
+// writer returns where the downloaded data of the part goes.
+func (p *Part) writer() io.Writer {
+	if p.stream != nil {
+		return &streamWriter{p: p}
+	}
+	if p.direct {
+		return &directWriter{p: p}
+	}
+	return p.pf
+}
+
 func (p *Part) compile() (read, written int64, err error) {
 	// take the reader to origin from end
 	p.pf.Seek(0, 0)
@@ -366,9 +518,14 @@ func setRange(header http.Header, ioff, foff int64) {
 }
 
 func (p *Part) setHash() {
+	p.hash = newPartHash()
+}
+
+// newPartHash returns a random part hash.
+func newPartHash() string {
 	t := make([]byte, 2)
 	rand.Read(t)
-	p.hash = hex.EncodeToString(t)
+	return hex.EncodeToString(t)
 }
 
 func (p *Part) createPartFile() (err error) {
@@ -382,6 +539,9 @@ func (p *Part) openPartFile() (err error) {
 }
 
 func (p *Part) seek(rpFunc ResumeProgressHandlerFunc) (err error) {
+	if p.direct {
+		return p.loadProgress(rpFunc)
+	}
 	pReader := NewAsyncCallbackProxyReader(p.pf, func(n int) {
 		rpFunc(p.hash, n)
 	}, p.l)
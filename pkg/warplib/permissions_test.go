@@ -327,7 +327,7 @@ func TestOverwriteFilePermissions(t *testing.T) {
 	}
 }
 
-// TestInitManagerPermissions verifies that InitManager() creates userdata.warp with 0644 permissions.
+// TestInitManagerPermissions verifies that InitManager() creates userdata.db with 0644 permissions.
 func TestInitManagerPermissions(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("File permission tests are not applicable on Windows")
@@ -348,8 +348,8 @@ func TestInitManagerPermissions(t *testing.T) {
 	}
 	m.Close()
 
-	// Verify userdata.warp permissions (with umask 0, we see the actual mode used)
-	info, err := os.Stat(__USERDATA_FILE_NAME)
+	// Verify userdata.db permissions (with umask 0, we see the actual mode used)
+	info, err := os.Stat(__USERDATA_DB_FILE_NAME)
 	if err != nil {
 		t.Fatalf("Stat: %v", err)
 	}
@@ -358,6 +358,6 @@ func TestInitManagerPermissions(t *testing.T) {
 	wantPerm := os.FileMode(0644)
 
 	if gotPerm != wantPerm {
-		t.Errorf("userdata.warp permissions = %o, want %o", gotPerm, wantPerm)
+		t.Errorf("userdata.db permissions = %o, want %o", gotPerm, wantPerm)
 	}
 }
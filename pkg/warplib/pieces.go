@@ -0,0 +1,526 @@
+package warplib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Pieces split a file into fixed-size ranges hashed on their own, so a
+// corrupted file can be repaired by downloading the bad pieces again
+// instead of the whole file.
+const (
+	// minPieceSize is the size of the pieces of files up to
+	// maxPieces MB, larger files get larger pieces.
+	minPieceSize = 1 * MB
+	// maxPieces is the number of pieces a file is split into at most.
+	maxPieces = 1024
+	// pieceAlgorithm hashes the pieces recorded while downloading.
+	pieceAlgorithm = ChecksumSHA256
+)
+
+// DefaultMetalinkSidecars are the Metalink files looked for next to a
+// download with ChecksumAuto for the hashes of its pieces, in order.
+var DefaultMetalinkSidecars = []string{
+	"{url}.meta4",
+	"{url}.metalink",
+}
+
+// PieceHashes are the hashes of the fixed-size pieces of a file.
+type PieceHashes struct {
+	// Algorithm hashes the pieces.
+	Algorithm ChecksumAlgorithm `json:"algorithm"`
+	// Size is the size of a piece, the last one may be shorter.
+	Size int64 `json:"size"`
+	// Hashes are the hashes of the pieces, in order.
+	Hashes [][]byte `json:"hashes"`
+	// Source is the URL of the Metalink file the hashes come from, empty
+	// if they were recorded while downloading.
+	Source string `json:"source,omitempty"`
+}
+
+// Range returns the first and last offset of piece i of a file of the
+// given size.
+func (p *PieceHashes) Range(i int, size int64) (ioff, foff int64) {
+	ioff = int64(i) * p.Size
+	foff = ioff + p.Size - 1
+	if foff >= size {
+		foff = size - 1
+	}
+	return
+}
+
+// valid reports whether the pieces cover a file of the given size.
+func (p *PieceHashes) valid(size int64) bool {
+	if p == nil || p.Size <= 0 || size <= 0 {
+		return false
+	}
+	h, err := NewHasher(p.Algorithm)
+	if err != nil || int64(len(p.Hashes)) != (size+p.Size-1)/p.Size {
+		return false
+	}
+	for _, sum := range p.Hashes {
+		if len(sum) != h.Size() {
+			return false
+		}
+	}
+	return true
+}
+
+// Corrupt hashes the pieces of the file read from r and returns those
+// which don't match, in order. progress is called with the number of
+// bytes hashed so far, it may be nil.
+func (p *PieceHashes) Corrupt(r io.ReaderAt, size int64, progress func(hashed int64)) ([]int, error) {
+	h, err := NewHasher(p.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		bad    []int
+		hashed int64
+		buf    = make([]byte, 32*KB)
+	)
+	for i, want := range p.Hashes {
+		ioff, foff := p.Range(i, size)
+		h.Reset()
+		n, err := io.CopyBuffer(h, io.NewSectionReader(r, ioff, foff-ioff+1), buf)
+		if err != nil {
+			return nil, fmt.Errorf("piece %d: %w", i, err)
+		}
+		if n != foff-ioff+1 || !bytes.Equal(h.Sum(nil), want) {
+			bad = append(bad, i)
+		}
+		hashed += n
+		if progress != nil {
+			progress(hashed)
+		}
+	}
+	return bad, nil
+}
+
+// pieceSizeFor returns the size of the pieces of a file of the given size.
+func pieceSizeFor(size int64) int64 {
+	ps := int64(minPieceSize)
+	for (size+ps-1)/ps > maxPieces {
+		ps *= 2
+	}
+	return ps
+}
+
+// pieceRecorder hashes the pieces of a file from the data the parts
+// write. A piece is hashed on the fly while it is written in order from
+// its start, as a single part does; the others, such as those split
+// between parts or downloaded before a resume, are hashed from the file
+// once the download is complete.
+type pieceRecorder struct {
+	size   int64
+	pieces *PieceHashes
+	states []pieceState
+}
+
+// pieceState is the hashing state of a piece.
+type pieceState struct {
+	mu sync.Mutex
+	h  hash.Hash
+	// next is the number of bytes of the piece hashed so far, -1 once
+	// the piece was written out of order.
+	next int64
+}
+
+func newPieceRecorder(size int64) *pieceRecorder {
+	ps := pieceSizeFor(size)
+	n := (size + ps - 1) / ps
+	return &pieceRecorder{
+		size: size,
+		pieces: &PieceHashes{
+			Algorithm: pieceAlgorithm,
+			Size:      ps,
+			Hashes:    make([][]byte, n),
+		},
+		states: make([]pieceState, n),
+	}
+}
+
+// write hashes b, written at offset off of the file.
+func (r *pieceRecorder) write(off int64, b []byte) {
+	for len(b) > 0 && off < r.size {
+		i := int(off / r.pieces.Size)
+		ioff, foff := r.pieces.Range(i, r.size)
+		n := foff - off + 1
+		if n > int64(len(b)) {
+			n = int64(len(b))
+		}
+		s := &r.states[i]
+		s.mu.Lock()
+		switch {
+		case s.next < 0 || r.pieces.Hashes[i] != nil:
+		case s.next != off-ioff:
+			s.next, s.h = -1, nil
+		default:
+			if s.h == nil {
+				s.h, _ = NewHasher(r.pieces.Algorithm)
+			}
+			s.h.Write(b[:n])
+			s.next += n
+			if ioff+s.next > foff {
+				r.pieces.Hashes[i] = s.h.Sum(nil)
+				s.h = nil
+			}
+		}
+		s.mu.Unlock()
+		off += n
+		b = b[n:]
+	}
+}
+
+// finish hashes the pieces not hashed while downloading from the file
+// and returns the hashes of all the pieces.
+func (r *pieceRecorder) finish(f io.ReaderAt) (*PieceHashes, error) {
+	h, err := NewHasher(r.pieces.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	for i := range r.pieces.Hashes {
+		if r.pieces.Hashes[i] != nil {
+			continue
+		}
+		ioff, foff := r.pieces.Range(i, r.size)
+		h.Reset()
+		if _, err := io.Copy(h, io.NewSectionReader(f, ioff, foff-ioff+1)); err != nil {
+			return nil, fmt.Errorf("piece %d: %w", i, err)
+		}
+		r.pieces.Hashes[i] = h.Sum(nil)
+	}
+	return r.pieces, nil
+}
+
+// initPieces starts recording the hashes of the pieces of the file unless
+// they are known already.
+func (d *Downloader) initPieces() {
+	if d.pieces != nil || d.contentLength.v() <= 0 {
+		return
+	}
+	d.pieceRecorder = newPieceRecorder(d.contentLength.v())
+}
+
+// finishPieces completes the hashes of the pieces of the downloaded file
+// and reports them. Pieces are only an aid to repair the file, so a
+// failure is logged and leaves the download without them.
+func (d *Downloader) finishPieces() {
+	if d.pieceRecorder != nil {
+		pieces, err := d.pieceRecorder.finish(d.f)
+		d.pieceRecorder = nil
+		if err != nil {
+			d.Log("Failed to hash the pieces: %v", err)
+			return
+		}
+		d.pieces = pieces
+	}
+	if d.pieces == nil {
+		return
+	}
+	d.Log("Recorded %d piece hashes (%s, %s each)", len(d.pieces.Hashes), d.pieces.Algorithm, ContentLength(d.pieces.Size))
+	d.handlers.PiecesHashedHandler(d.pieces)
+}
+
+// metalinkFile is a file described by a Metalink file.
+type metalinkFile struct {
+	name      string
+	size      int64
+	checksums []ExpectedChecksum
+	pieces    *PieceHashes
+}
+
+// parseMetalink reads the files of a Metalink file, in either the RFC
+// 5854 (.meta4) or the older 3.0 (.metalink) format. Both describe a
+// file with <file name>, holding <size>, <hash type> and <pieces length
+// type> elements; the 3.0 format nests the hashes in <verification>.
+func parseMetalink(data []byte) ([]metalinkFile, error) {
+	var (
+		files  []metalinkFile
+		file   *metalinkFile
+		pieces *PieceHashes
+		text   strings.Builder
+		algo   ChecksumAlgorithm
+	)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			text.Reset()
+			switch {
+			case t.Name.Local == "file":
+				files = append(files, metalinkFile{name: xmlAttr(t, "name")})
+				file = &files[len(files)-1]
+			case t.Name.Local == "pieces" && file != nil:
+				size, _ := strconv.ParseInt(xmlAttr(t, "length"), 10, 64)
+				pieces = &PieceHashes{Algorithm: metalinkAlgorithm(xmlAttr(t, "type")), Size: size}
+			case t.Name.Local == "hash":
+				algo = metalinkAlgorithm(xmlAttr(t, "type"))
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if file == nil {
+				continue
+			}
+			value := strings.TrimSpace(text.String())
+			switch t.Name.Local {
+			case "file":
+				file = nil
+			case "size":
+				file.size, _ = strconv.ParseInt(value, 10, 64)
+			case "pieces":
+				file.pieces, pieces = pieces, nil
+			case "hash":
+				if pieces != nil {
+					sum, _ := hex.DecodeString(value)
+					pieces.Hashes = append(pieces.Hashes, sum)
+				} else if cs, ok := newExpectedChecksum(algo, value); ok && algo != "" {
+					file.checksums = append(file.checksums, cs)
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// metalinkAlgorithm converts a Metalink hash type, such as "sha-256", to
+// a checksum algorithm.
+func metalinkAlgorithm(typ string) ChecksumAlgorithm {
+	return ChecksumAlgorithm(strings.ToLower(strings.ReplaceAll(typ, "-", "")))
+}
+
+func xmlAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// findMetalink looks for a Metalink file published next to the file at
+// rawURL and returns the checksums and piece hashes it gives for the
+// file, with the URL of the Metalink file.
+func (d *Downloader) findMetalink(rawURL string) ([]ExpectedChecksum, *PieceHashes, string) {
+	size := d.contentLength.v()
+	for _, sidecar := range sidecarURLs(DefaultMetalinkSidecars, rawURL, d.fileName) {
+		data, err := d.fetchSidecar(rawURL, sidecar, maxChecksumFileSize)
+		if err != nil {
+			continue
+		}
+		files, err := parseMetalink(data)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if filepath.Base(f.name) != d.fileName || (f.size != 0 && f.size != size) {
+				continue
+			}
+			if f.pieces != nil {
+				f.pieces.Source = sidecar
+				if !f.pieces.valid(size) {
+					f.pieces = nil
+				}
+			}
+			return f.checksums, f.pieces, sidecar
+		}
+	}
+	return nil, nil, ""
+}
+
+// RepairOpts are the options of Manager.RepairDownload.
+type RepairOpts struct {
+	// Handlers report the progress of the repair: ChecksumProgressHandler
+	// while the file is rehashed and DownloadProgressHandler while the
+	// corrupted pieces are downloaded again.
+	Handlers *Handlers
+	// MaxConnections is the number of connections used to download the
+	// corrupted pieces. If zero, DEF_MAX_CONNS is used.
+	MaxConnections int32
+}
+
+// RepairResult is the outcome of a repair.
+type RepairResult struct {
+	// Pieces is the number of pieces of the file.
+	Pieces int `json:"pieces"`
+	// Corrupt is the number of pieces which didn't match their hash.
+	Corrupt int `json:"corrupt"`
+	// Refetched is the number of bytes downloaded again.
+	Refetched int64 `json:"refetched"`
+	// Verified is set when the repaired file matched the checksum of the
+	// download.
+	Verified bool `json:"verified"`
+}
+
+// RepairDownload repairs the file of a completed download: it hashes its
+// pieces, downloads the corrupted ones again through the regular parts
+// and validates the checksum of the file, if it has one. A missing or
+// truncated file is repaired too. It blocks until the repair is done.
+func (m *Manager) RepairDownload(client *http.Client, hash string, opts *RepairOpts) (*RepairResult, error) {
+	if opts == nil {
+		opts = &RepairOpts{}
+	}
+	item := m.GetItem(hash)
+	if item == nil {
+		return nil, ErrDownloadNotFound
+	}
+	if item.GetDownloaded() != item.TotalSize && item.IsDownloading() {
+		return nil, ErrRepairItemDownloading
+	}
+	if item.Protocol != ProtoHTTP {
+		return nil, ErrRepairNotSupported
+	}
+	item.mu.RLock()
+	pieces, size, checksums := item.Pieces, item.TotalSize.v(), item.Checksums
+	item.mu.RUnlock()
+	if !pieces.valid(size) {
+		return nil, ErrNoPieceHashes
+	}
+
+	handlers := opts.Handlers
+	if handlers == nil {
+		handlers = &Handlers{}
+	}
+	// a repaired file not matching its checksum is a failed repair,
+	// whatever the daemon does with mismatching downloads
+	cfg := DefaultChecksumConfig()
+	if m.checksum != nil && !m.checksum.Enabled {
+		checksums = nil
+	}
+	// the part files of the repair go with the download's data
+	if err := WarpMkdirAll(filepath.Join(DlDataDir, hash), 0755); err != nil {
+		return nil, err
+	}
+	d, err := initDownloader(client, hash, item.Url, item.TotalSize, &DownloaderOpts{
+		FileName:          item.Name,
+		DownloadDirectory: item.AbsoluteLocation,
+		Headers:           item.Headers,
+		Handlers:          handlers,
+		MaxConnections:    opts.MaxConnections,
+		ChecksumConfig:    &cfg,
+		Checksums:         checksums,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer d.lw.Close()
+	d.handlers.setDefault(d.l)
+	d.bandwidth = m.bandwidth
+	d.hosts = m.hosts
+	d.directWrite = true
+	res, err := d.repair(pieces)
+	if err != nil {
+		return res, err
+	}
+
+	item.mu.Lock()
+	item.Parts = nil
+	item.Downloaded = item.TotalSize
+	item.mu.Unlock()
+	m.UpdateItem(item)
+	return res, nil
+}
+
+// repair hashes the pieces of the saved file and downloads the corrupted
+// ones again.
+func (d *Downloader) repair(pieces *PieceHashes) (*RepairResult, error) {
+	size := d.contentLength.v()
+	if err := d.openResumeFile(); err != nil {
+		return nil, err
+	}
+	defer d.closeMainFile()
+	if stat, err := d.f.Stat(); err != nil {
+		return nil, err
+	} else if stat.Size() != size {
+		d.Log("Repair: file size is %d, expected %d", stat.Size(), size)
+		if err := d.f.Truncate(size); err != nil {
+			return nil, err
+		}
+	}
+
+	d.Log("Repair: hashing %d pieces...", len(pieces.Hashes))
+	bad, err := pieces.Corrupt(d.f, size, d.handlers.ChecksumProgressHandler)
+	if err != nil {
+		return nil, err
+	}
+	res := &RepairResult{Pieces: len(pieces.Hashes), Corrupt: len(bad)}
+	d.Log("Repair: %d corrupt pieces", len(bad))
+	if len(bad) > 0 {
+		if res.Refetched, err = d.refetchPieces(pieces, bad); err != nil {
+			return res, err
+		}
+		still, err := pieces.Corrupt(d.f, size, nil)
+		if err != nil {
+			return res, err
+		}
+		if len(still) > 0 {
+			return res, fmt.Errorf("%w: %d pieces still corrupt", ErrRepairFailed, len(still))
+		}
+	}
+
+	if d.activeHasher != nil {
+		if err := d.validateChecksum(); err != nil {
+			return res, err
+		}
+		res.Verified = true
+	}
+	return res, nil
+}
+
+// refetchPieces downloads the given pieces again, merging neighbours into
+// a single range. Each range is downloaded by a part writing directly
+// into the file, which splits like any part when it runs slow.
+func (d *Downloader) refetchPieces(pieces *PieceHashes, bad []int) (int64, error) {
+	size := d.contentLength.v()
+	var ranges [][2]int64
+	for _, i := range bad {
+		ioff, foff := pieces.Range(i, size)
+		if n := len(ranges); n > 0 && ranges[n-1][1]+1 == ioff {
+			ranges[n-1][1] = foff
+			continue
+		}
+		ranges = append(ranges, [2]int64{ioff, foff})
+	}
+
+	var want int64
+	d.ohmap.Make()
+	d.activeParts.Make()
+	for _, r := range ranges {
+		want += r[1] - r[0] + 1
+		d.wg.Add(1)
+		go func(ioff, foff int64) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					d.handlers.ErrorHandler("repair-part", fmt.Errorf("panic: %v", rec))
+					atomic.StoreInt32(&d.stopped, 1)
+					d.cancel()
+				}
+			}()
+			d.newPartDownload(ioff, foff, 4*MB)
+		}(r[0], r[1])
+	}
+	d.wg.Wait()
+	got := atomic.LoadInt64(&d.nread)
+	if got != want {
+		return got, fmt.Errorf("%w: downloaded %d of %d bytes", ErrRepairFailed, got, want)
+	}
+	return got, d.f.Sync()
+}
@@ -0,0 +1,239 @@
+package warplib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPieceSizeFor(t *testing.T) {
+	tests := map[int64]int64{
+		1:                   MB,
+		maxPieces * MB:      MB,
+		maxPieces*MB + 1:    2 * MB,
+		10 * maxPieces * MB: 16 * MB,
+	}
+	for size, want := range tests {
+		if got := pieceSizeFor(size); got != want {
+			t.Errorf("pieceSizeFor(%d) = %d, want %d", size, got, want)
+		}
+	}
+}
+
+func TestPieceRecorder(t *testing.T) {
+	content := make([]byte, 2*MB+MB/2)
+	rand.New(rand.NewSource(1)).Read(content)
+	r := newPieceRecorder(int64(len(content)))
+
+	// a part writing the first piece and the start of the second, split
+	// in the middle of the second piece by a part writing the rest
+	write := func(from, to, chunk int64) {
+		for off := from; off < to; off += chunk {
+			r.write(off, content[off:min64(off+chunk, to)])
+		}
+	}
+	split := int64(MB + MB/2)
+	write(0, MB+1000, 4096)
+	write(split, int64(len(content)), 3000)
+	write(MB+1000, split, 4096)
+	if r.pieces.Hashes[0] == nil || r.pieces.Hashes[1] != nil || r.pieces.Hashes[2] == nil {
+		t.Fatalf("hashed while downloading: %v, %v, %v", r.pieces.Hashes[0] != nil, r.pieces.Hashes[1] != nil, r.pieces.Hashes[2] != nil)
+	}
+
+	pieces, err := r.finish(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	for i, sum := range pieces.Hashes {
+		ioff, foff := pieces.Range(i, int64(len(content)))
+		want := sha256.Sum256(content[ioff : foff+1])
+		if !bytes.Equal(sum, want[:]) {
+			t.Errorf("piece %d: hash %x, want %x", i, sum, want)
+		}
+	}
+	if !pieces.valid(int64(len(content))) || pieces.valid(int64(len(content))+MB) {
+		t.Error("valid() doesn't check the number of pieces")
+	}
+
+	bad, err := pieces.Corrupt(bytes.NewReader(content), int64(len(content)), nil)
+	if err != nil || len(bad) != 0 {
+		t.Errorf("Corrupt = %v, %v, want none", bad, err)
+	}
+	content[2*MB+10] ^= 0xff
+	var hashed int64
+	bad, err = pieces.Corrupt(bytes.NewReader(content[:MB+5]), int64(len(content)), func(n int64) { hashed = n })
+	if err != nil || len(bad) != 2 || bad[0] != 1 || bad[1] != 2 || hashed != MB+5 {
+		t.Errorf("Corrupt(truncated, modified) = %v, %v after %d bytes", bad, err, hashed)
+	}
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestParseMetalink(t *testing.T) {
+	sha := strings.Repeat("ab", 32)
+	meta4 := `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="other.iso"><size>1</size></file>
+  <file name="distro.iso">
+    <size>3145728</size>
+    <hash type="sha-256">` + sha + `</hash>
+    <pieces length="2097152" type="sha-1">
+      <hash>` + strings.Repeat("11", 20) + `</hash>
+      <hash>` + strings.Repeat("22", 20) + `</hash>
+    </pieces>
+    <url>https://mirror.example.com/distro.iso</url>
+  </file>
+</metalink>`
+	files, err := parseMetalink([]byte(meta4))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("parseMetalink = %+v, %v", files, err)
+	}
+	f := files[1]
+	if f.name != "distro.iso" || f.size != 3145728 || len(f.checksums) != 1 || f.checksums[0].String() != "sha256:"+sha {
+		t.Errorf("file = %+v", f)
+	}
+	if f.pieces == nil || f.pieces.Algorithm != ChecksumSHA1 || !f.pieces.valid(f.size) {
+		t.Errorf("pieces = %+v", f.pieces)
+	}
+
+	v3 := `<metalink version="3.0" xmlns="http://www.metalinker.org/"><files>
+  <file name="distro.iso"><size>1048576</size><verification>
+    <hash type="md5">` + strings.Repeat("cd", 16) + `</hash>
+    <pieces length="1048576" type="sha1"><hash piece="0">` + strings.Repeat("33", 20) + `</hash></pieces>
+  </verification></file></files></metalink>`
+	files, err = parseMetalink([]byte(v3))
+	if err != nil || len(files) != 1 || len(files[0].checksums) != 1 || !files[0].pieces.valid(1048576) {
+		t.Errorf("parseMetalink(3.0) = %+v, %v", files, err)
+	}
+	if _, err := parseMetalink([]byte("<metalink><file")); err == nil {
+		t.Error("parseMetalink accepted a truncated file")
+	}
+}
+
+func TestManagerRepairDownload(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	content := make([]byte, 3*MB+MB/4)
+	rand.New(rand.NewSource(2)).Read(content)
+	sum := sha256.Sum256(content)
+	srv := newRangeServer(t, content)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: dir,
+		FileName:          "file.bin",
+		MaxConnections:    4,
+		Checksums:         []ExpectedChecksum{{Algorithm: ChecksumSHA256, Value: sum[:]}},
+		Handlers:          &Handlers{},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	hash := d.GetHash()
+	item := m.GetItem(hash)
+	if item.Pieces == nil || len(item.Pieces.Hashes) != 4 || item.Pieces.Source != "" {
+		t.Fatalf("item pieces = %+v", item.Pieces)
+	}
+	res, err := m.RepairDownload(&http.Client{}, hash, nil)
+	if err != nil || res.Pieces != 4 || res.Corrupt != 0 || res.Refetched != 0 || !res.Verified {
+		t.Fatalf("RepairDownload(intact) = %+v, %v", res, err)
+	}
+
+	path := d.GetSavePath()
+	corrupt := append([]byte{}, content...)
+	corrupt[10] ^= 0xff
+	corrupt[2*MB+5] ^= 0xff
+	if err := os.WriteFile(path, corrupt[:3*MB], 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err = m.RepairDownload(&http.Client{}, hash, nil)
+	if err != nil {
+		t.Fatalf("RepairDownload: %v", err)
+	}
+	if res.Corrupt != 3 || res.Refetched != MB+MB+MB/4 || !res.Verified {
+		t.Errorf("RepairDownload = %+v, want pieces 0, 2 and the missing 3 downloaded again", res)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, content) {
+		t.Error("repaired file differs from the original")
+	}
+
+	// a repair can't fix a file the pieces were recorded from
+	item.Checksums = []ExpectedChecksum{{Algorithm: ChecksumSHA256, Value: make([]byte, 32)}}
+	if _, err := m.RepairDownload(&http.Client{}, hash, nil); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("RepairDownload(wrong checksum) = %v, want a mismatch", err)
+	}
+	item.Pieces = nil
+	if _, err := m.RepairDownload(&http.Client{}, hash, nil); !errors.Is(err, ErrNoPieceHashes) {
+		t.Errorf("RepairDownload(no pieces) = %v", err)
+	}
+	if _, err := m.RepairDownload(&http.Client{}, "nope", nil); !errors.Is(err, ErrDownloadNotFound) {
+		t.Errorf("RepairDownload(unknown) = %v", err)
+	}
+}
+
+func TestManagerUsesMetalinkPieces(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	content := bytes.Repeat([]byte("metalink"), int(MB/4))
+	var hashes strings.Builder
+	for off := 0; off < len(content); off += int(MB / 2) {
+		sum := sha256.Sum256(content[off : off+int(MB/2)])
+		hashes.WriteString("<hash>" + hex.EncodeToString(sum[:]) + "</hash>")
+	}
+	files := newRangeServer(t, content)
+	defer files.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pub/app.bin.meta4":
+			_, _ = w.Write([]byte(`<metalink><file name="app.bin"><pieces length="524288" type="sha-256">` + hashes.String() + `</pieces></file></metalink>`))
+		case "/pub/app.bin":
+			files.Config.Handler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/pub/app.bin", &DownloaderOpts{
+		DownloadDirectory: dir,
+		FileName:          "app.bin",
+		DiscoverChecksums: true,
+		Handlers:          &Handlers{},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	item := m.GetItem(d.GetHash())
+	if item.Pieces == nil || item.Pieces.Source != srv.URL+"/pub/app.bin.meta4" || len(item.Pieces.Hashes) != 4 {
+		t.Fatalf("item pieces = %+v", item.Pieces)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if d.pieceRecorder != nil || item.Pieces.Source == "" {
+		t.Error("published pieces were recorded again")
+	}
+}
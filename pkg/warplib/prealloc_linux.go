@@ -0,0 +1,20 @@
+//go:build linux
+
+package warplib
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocateFile reserves size bytes for f with fallocate, falling back to
+// a sparse file on filesystems that don't support it.
+func preallocateFile(f *os.File, size int64) error {
+	err := unix.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return f.Truncate(size)
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package warplib
+
+import "os"
+
+// preallocateFile extends f to size bytes as a sparse file.
+func preallocateFile(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
@@ -5,8 +5,14 @@ import (
 	"net/http"
 )
 
-// Compile-time interface check: httpProtocolDownloader must implement ProtocolDownloader.
-var _ ProtocolDownloader = (*httpProtocolDownloader)(nil)
+// Compile-time interface checks: httpProtocolDownloader must implement
+// ProtocolDownloader, support live option changes and serve reads
+// of the file while it is downloading.
+var (
+	_ ProtocolDownloader = (*httpProtocolDownloader)(nil)
+	_ liveConfigurable   = (*httpProtocolDownloader)(nil)
+	_ partPrioritizer    = (*httpProtocolDownloader)(nil)
+)
 
 // httpProtocolDownloader wraps the existing *Downloader to satisfy ProtocolDownloader.
 // It uses the adapter pattern: no logic changes to Downloader, just wrapping.
@@ -83,7 +89,7 @@ func (h *httpProtocolDownloader) Capabilities() DownloadCapabilities {
 		return DownloadCapabilities{}
 	}
 	return DownloadCapabilities{
-		SupportsParallel: h.inner.resumable && h.inner.maxConn > 1,
+		SupportsParallel: h.inner.resumable && h.inner.GetMaxConnections() > 1,
 		SupportsResume:   h.inner.resumable,
 	}
 }
@@ -127,6 +133,55 @@ func (h *httpProtocolDownloader) GetMaxParts() int32 {
 	return h.inner.GetMaxParts()
 }
 
+// SetSpeedLimit delegates to the inner downloader.
+func (h *httpProtocolDownloader) SetSpeedLimit(limit int64) error {
+	if h.inner == nil {
+		return ErrProbeRequired
+	}
+	h.inner.SetSpeedLimit(limit)
+	return nil
+}
+
+// GetSpeedLimit delegates to the inner downloader.
+func (h *httpProtocolDownloader) GetSpeedLimit() int64 {
+	if h.inner == nil {
+		return 0
+	}
+	return h.inner.GetSpeedLimit()
+}
+
+// SetMaxConnections delegates to the inner downloader.
+func (h *httpProtocolDownloader) SetMaxConnections(n int32) error {
+	if h.inner == nil {
+		return ErrProbeRequired
+	}
+	return h.inner.SetMaxConnections(n)
+}
+
+// prioritize delegates to the inner downloader.
+func (h *httpProtocolDownloader) prioritize(off int64) bool {
+	if h.inner == nil {
+		return false
+	}
+	return h.inner.prioritize(off)
+}
+
+// partRead delegates to the inner downloader.
+func (h *httpProtocolDownloader) partRead(hash string) (int64, bool) {
+	if h.inner == nil {
+		return 0, false
+	}
+	return h.inner.partRead(hash)
+}
+
+// resumeOpts delegates to the inner downloader.
+func (h *httpProtocolDownloader) resumeOpts() *ResumeDownloadOpts {
+	if h.inner == nil {
+		return nil
+	}
+	return h.inner.resumeOpts()
+}
+
 // GetHash delegates to the inner downloader.
 func (h *httpProtocolDownloader) GetHash() string {
 	if h.inner == nil {
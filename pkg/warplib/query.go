@@ -0,0 +1,205 @@
+package warplib
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ItemStatus is the state a download is listed in.
+type ItemStatus string
+
+const (
+	// StatusActive is a download running now.
+	StatusActive ItemStatus = "active"
+	// StatusPending is an incomplete download which isn't running,
+	// scheduled or failed.
+	StatusPending ItemStatus = "pending"
+	// StatusCompleted is a download completely downloaded.
+	StatusCompleted ItemStatus = "completed"
+	// StatusFailed is a download whose latest run ended with an error,
+	// or whose file failed its checksum.
+	StatusFailed ItemStatus = "failed"
+	// StatusScheduled is a download waiting for its scheduled time.
+	StatusScheduled ItemStatus = "scheduled"
+)
+
+// ParseItemStatus parses the name of a status.
+func ParseItemStatus(s string) (ItemStatus, error) {
+	switch st := ItemStatus(strings.ToLower(strings.TrimSpace(s))); st {
+	case StatusActive, StatusPending, StatusCompleted, StatusFailed, StatusScheduled:
+		return st, nil
+	}
+	return "", fmt.Errorf("invalid status %q: use active, pending, completed, failed or scheduled", s)
+}
+
+// Status returns the state of the download.
+func (i *Item) Status() ItemStatus {
+	running := i.IsDownloading() && !i.IsStopped()
+	if i.mu != nil {
+		i.mu.RLock()
+		defer i.mu.RUnlock()
+	}
+	complete := i.TotalSize > 0 && i.Downloaded >= i.TotalSize
+	switch {
+	case i.Error != "":
+		return StatusFailed
+	case complete:
+		return StatusCompleted
+	case running:
+		return StatusActive
+	case i.ScheduleState == ScheduleStateScheduled:
+		return StatusScheduled
+	}
+	return StatusPending
+}
+
+// ItemSort is the order downloads are listed in.
+type ItemSort string
+
+const (
+	// SortDate lists the oldest downloads first.
+	SortDate ItemSort = "date"
+	// SortSize lists the largest downloads first.
+	SortSize ItemSort = "size"
+	// SortSpeed lists the fastest downloads first, by the average speed
+	// of their latest run.
+	SortSpeed ItemSort = "speed"
+)
+
+// ParseItemSort parses the name of an order, SortDate if empty.
+func ParseItemSort(s string) (ItemSort, error) {
+	switch so := ItemSort(strings.ToLower(strings.TrimSpace(s))); so {
+	case "":
+		return SortDate, nil
+	case SortDate, SortSize, SortSpeed:
+		return so, nil
+	}
+	return "", fmt.Errorf("invalid sort %q: use date, size or speed", s)
+}
+
+// ItemQuery selects, orders and pages downloads for Manager.QueryItems.
+// The zero value lists all the visible downloads, oldest first.
+type ItemQuery struct {
+	// Statuses are the states of the downloads listed, all if empty.
+	Statuses []ItemStatus
+	// Hidden includes the hidden and child downloads.
+	Hidden bool
+	// Category is the category of the downloads listed, any if empty.
+	Category string
+	// Search is a text the name or the URL of the downloads contain,
+	// regardless of case.
+	Search string
+	// Host is the host the downloads are from, its subdomains included.
+	Host string
+	// Since and Until bound the time the downloads were added at. Zero
+	// means no bound.
+	Since, Until time.Time
+	// MinSize is the smallest size of the downloads listed.
+	MinSize int64
+	// Sort is the order of the downloads, SortDate if empty.
+	Sort ItemSort
+	// Offset skips as many downloads of the result, and Limit caps its
+	// length if positive.
+	Offset, Limit int
+}
+
+// QueryItems returns the downloads matching q in its order, along with
+// the number of them before the offset and limit are applied.
+func (m *Manager) QueryItems(q *ItemQuery) (items []*Item, total int) {
+	if q == nil {
+		q = &ItemQuery{}
+	}
+	search := strings.ToLower(q.Search)
+	host := strings.ToLower(strings.TrimPrefix(q.Host, "."))
+	items = []*Item{}
+	for _, item := range m.GetItems() {
+		if !q.matches(item, search, host) {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	m.mu.RLock()
+	var less func(a, b *Item) bool
+	switch q.Sort {
+	case SortSize:
+		less = func(a, b *Item) bool { return a.TotalSize > b.TotalSize }
+	case SortSpeed:
+		less = func(a, b *Item) bool { return a.Speed > b.Speed }
+	default:
+		less = func(a, b *Item) bool { return a.DateAdded.Before(b.DateAdded) }
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if less(items[i], items[j]) {
+			return true
+		}
+		if less(items[j], items[i]) {
+			return false
+		}
+		return items[i].Hash < items[j].Hash
+	})
+	m.mu.RUnlock()
+
+	total = len(items)
+	if q.Offset > 0 {
+		if q.Offset >= len(items) {
+			return []*Item{}, total
+		}
+		items = items[q.Offset:]
+	}
+	if q.Limit > 0 && q.Limit < len(items) {
+		items = items[:q.Limit]
+	}
+	return items, total
+}
+
+// matches reports whether the download is selected by the query, search
+// and host being lowercased already.
+func (q *ItemQuery) matches(item *Item, search, host string) bool {
+	if len(q.Statuses) > 0 {
+		status, found := item.Status(), false
+		for _, st := range q.Statuses {
+			if st == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if item.mu != nil {
+		item.mu.RLock()
+		defer item.mu.RUnlock()
+	}
+	if !q.Hidden && (item.Hidden || item.Children) {
+		return false
+	}
+	if q.Category != "" && !strings.EqualFold(item.Category, q.Category) {
+		return false
+	}
+	if search != "" && !strings.Contains(strings.ToLower(item.Name), search) &&
+		!strings.Contains(strings.ToLower(item.Url), search) {
+		return false
+	}
+	if host != "" {
+		u, err := url.Parse(item.Url)
+		if err != nil {
+			return false
+		}
+		h := strings.ToLower(u.Hostname())
+		if h != host && !strings.HasSuffix(h, "."+host) {
+			return false
+		}
+	}
+	if !q.Since.IsZero() && item.DateAdded.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && item.DateAdded.After(q.Until) {
+		return false
+	}
+	return item.TotalSize.v() >= q.MinSize
+}
@@ -0,0 +1,111 @@
+package warplib
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestManagerQueryItems(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	now := time.Now()
+	add := func(hash, rawURL string, size, downloaded ContentLength, added time.Time, edit func(*Item)) {
+		item := &Item{
+			Hash: hash, Name: hash + ".iso", Url: rawURL, DateAdded: added,
+			TotalSize: size, Downloaded: downloaded,
+			Parts: map[int64]*ItemPart{}, mu: m.mu, memPart: map[string]int64{},
+		}
+		if edit != nil {
+			edit(item)
+		}
+		m.UpdateItem(item)
+	}
+	add("done", "https://cdn.example.com/done.iso", 300, 300, now.Add(-3*time.Hour), func(i *Item) { i.Speed = 10 })
+	add("broken", "https://example.org/broken.iso", 200, 50, now.Add(-2*time.Hour), func(i *Item) { i.Error = "connection reset" })
+	add("later", "https://example.com/later.iso", 100, 0, now.Add(-time.Hour), func(i *Item) {
+		i.ScheduleState, i.ScheduledAt = ScheduleStateScheduled, now.Add(time.Hour)
+	})
+	add("fresh", "https://example.com/Fresh.iso", 50, 10, now, func(i *Item) { i.Speed = 30 })
+	add("child", "https://example.com/child.iso", 10, 0, now, func(i *Item) { i.Children = true })
+
+	hashes := func(q *ItemQuery) []string {
+		t.Helper()
+		items, _ := m.QueryItems(q)
+		var out []string
+		for _, item := range items {
+			out = append(out, item.Hash)
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		q    *ItemQuery
+		want []string
+	}{
+		{"all", nil, []string{"done", "broken", "later", "fresh"}},
+		{"hidden", &ItemQuery{Hidden: true, Since: now.Add(-time.Minute)}, []string{"child", "fresh"}},
+		{"failed", &ItemQuery{Statuses: []ItemStatus{StatusFailed}}, []string{"broken"}},
+		{"scheduled", &ItemQuery{Statuses: []ItemStatus{StatusScheduled}}, []string{"later"}},
+		{"pending", &ItemQuery{Statuses: []ItemStatus{StatusPending, StatusCompleted}}, []string{"done", "fresh"}},
+		{"search", &ItemQuery{Search: "FRESH"}, []string{"fresh"}},
+		{"search url", &ItemQuery{Search: "example.org"}, []string{"broken"}},
+		{"host", &ItemQuery{Host: "example.com"}, []string{"done", "later", "fresh"}},
+		{"until", &ItemQuery{Until: now.Add(-90 * time.Minute)}, []string{"done", "broken"}},
+		{"min size", &ItemQuery{MinSize: 150}, []string{"done", "broken"}},
+		{"size", &ItemQuery{Sort: SortSize}, []string{"done", "broken", "later", "fresh"}},
+		{"speed", &ItemQuery{Sort: SortSpeed, Limit: 2}, []string{"fresh", "done"}},
+		{"page", &ItemQuery{Offset: 1, Limit: 2}, []string{"broken", "later"}},
+		{"past the end", &ItemQuery{Offset: 10}, nil},
+	}
+	for _, tt := range tests {
+		got := hashes(tt.q)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+	if _, total := m.QueryItems(&ItemQuery{Limit: 1}); total != 4 {
+		t.Errorf("total = %d, want 4", total)
+	}
+}
+
+func TestParseItemStatusAndSort(t *testing.T) {
+	if st, err := ParseItemStatus(" Failed "); err != nil || st != StatusFailed {
+		t.Errorf("ParseItemStatus = %q, %v", st, err)
+	}
+	if _, err := ParseItemStatus("stuck"); err == nil {
+		t.Error("ParseItemStatus(stuck) succeeded")
+	}
+	if so, err := ParseItemSort(""); err != nil || so != SortDate {
+		t.Errorf("ParseItemSort(\"\") = %q, %v", so, err)
+	}
+	if _, err := ParseItemSort("name"); err == nil {
+		t.Error("ParseItemSort(name) succeeded")
+	}
+}
+
+func TestManagerRecordRun(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	item := &Item{Hash: "h", Name: "h.bin", Url: "https://example.com/h.bin", TotalSize: 100, Downloaded: 20,
+		Error: "old", Parts: map[int64]*ItemPart{}, mu: m.mu, memPart: map[string]int64{}}
+	m.UpdateItem(item)
+
+	m.emit(item, EventStarted, nil)
+	if item.Error != "" {
+		t.Errorf("error not cleared: %q", item.Error)
+	}
+	time.Sleep(10 * time.Millisecond)
+	item.Downloaded = 60
+	m.emit(item, EventError, errors.New("connection reset"))
+	if item.Error != "connection reset" || item.Speed <= 0 || item.Status() != StatusFailed {
+		t.Errorf("after error: error %q, speed %d, status %s", item.Error, item.Speed, item.Status())
+	}
+}
@@ -22,10 +22,10 @@ type queuedItem struct {
 	priority Priority
 }
 
-// QueuedItemState is the exported version of queuedItem for GOB persistence.
+// QueuedItemState is the exported version of queuedItem for persistence.
 type QueuedItemState struct {
-	Hash     string
-	Priority Priority
+	Hash     string   `json:"hash"`
+	Priority Priority `json:"priority"`
 }
 
 // QueueState holds the persistent state of the queue.
@@ -32,13 +32,15 @@ func NewRateLimitedReader(r io.Reader, limit int64) *RateLimitedReader {
 
 // Read implements io.Reader with rate limiting using a token bucket algorithm.
 func (r *RateLimitedReader) Read(b []byte) (n int, err error) {
-	// No limit - pass through directly
+	r.mu.Lock()
+
+	// No limit - pass through directly. The limit is read under the lock
+	// because SetLimit may change it while a download is running.
 	if r.limit <= 0 {
+		r.mu.Unlock()
 		return r.r.Read(b)
 	}
 
-	r.mu.Lock()
-
 	// Refill tokens based on elapsed time
 	now := time.Now()
 	elapsed := now.Sub(r.lastRead)
@@ -0,0 +1,309 @@
+package warplib
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// remoteZipTailSize is fetched from the end of a remote zip when it is
+	// opened. It holds the end of central directory record and, for most
+	// archives, the whole central directory.
+	remoteZipTailSize = 1 * MB
+	// remoteZipBlockSize is fetched at once for the reads of the central
+	// directory not covered by the tail.
+	remoteZipBlockSize = 256 * KB
+	// remoteZipCachedBlocks is the number of fetched blocks kept around.
+	remoteZipCachedBlocks = 8
+)
+
+// ErrRangeNotSupported is returned when the server ignores range requests.
+var ErrRangeNotSupported = errors.New("server does not support range requests")
+
+// RemoteZip reads a zip archive over HTTP with range requests, fetching
+// its central directory and the data of the opened files only.
+type RemoteZip struct {
+	client  *http.Client
+	url     string
+	headers Headers
+	size    int64
+	zr      *zip.Reader
+
+	mu sync.Mutex
+	// blocks are the fetched ranges of the archive, oldest first.
+	blocks []remoteZipBlock
+	// readAhead is the least fetched by ReadAt, 0 once the directory is
+	// read, as later reads are only the fixed size local file headers.
+	readAhead int64
+	requests  atomic.Int32
+}
+
+type remoteZipBlock struct {
+	off  int64
+	data []byte
+}
+
+// OpenRemoteZip reads the central directory of the zip archive at url.
+// The server must support range requests.
+func OpenRemoteZip(client *http.Client, url string, headers Headers) (*RemoteZip, error) {
+	z := &RemoteZip{
+		client:    client,
+		url:       url,
+		headers:   headers,
+		readAhead: remoteZipBlockSize,
+	}
+	if err := z.fetchTail(); err != nil {
+		return nil, err
+	}
+	// entries with unsafe names are still listed, it is up to the caller
+	// where their contents go
+	zr, err := zip.NewReader(z, z.size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return nil, err
+	}
+	z.zr = zr
+	z.mu.Lock()
+	z.readAhead = 0
+	z.blocks = nil
+	z.mu.Unlock()
+	return z, nil
+}
+
+// Size returns the size of the archive in bytes.
+func (z *RemoteZip) Size() int64 {
+	return z.size
+}
+
+// Files returns the entries of the archive in the order of its central
+// directory.
+func (z *RemoteZip) Files() []*zip.File {
+	return z.zr.File
+}
+
+// Requests returns the number of range requests made so far.
+func (z *RemoteZip) Requests() int {
+	return int(z.requests.Load())
+}
+
+// File returns the entry of the archive named name.
+func (z *RemoteZip) File(name string) (*zip.File, error) {
+	name = strings.TrimPrefix(name, "/")
+	for _, f := range z.zr.File {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+}
+
+// Open fetches the compressed data of f with a single range request and
+// returns its contents. Reading to the end fails with zip.ErrChecksum if
+// the contents don't match the CRC-32 and size of the central directory.
+func (z *RemoteZip) Open(f *zip.File) (io.ReadCloser, error) {
+	if f.Method != zip.Store && f.Method != zip.Deflate {
+		return nil, fmt.Errorf("%s: %w (method %d)", f.Name, zip.ErrAlgorithm, f.Method)
+	}
+	off, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	var body io.ReadCloser = io.NopCloser(strings.NewReader(""))
+	if f.CompressedSize64 > 0 {
+		body, err = z.get(off, off+int64(f.CompressedSize64)-1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var r io.Reader = io.LimitReader(body, int64(f.CompressedSize64))
+	if f.Method == zip.Deflate {
+		r = flate.NewReader(r)
+	}
+	return &remoteZipFile{
+		body: body,
+		r:    r,
+		hash: crc32.NewIEEE(),
+		f:    f,
+	}, nil
+}
+
+// ReadAt reads the archive through a cache of fetched blocks. It is used
+// by archive/zip to read the directory and the local file headers.
+func (z *RemoteZip) ReadAt(p []byte, off int64) (int, error) {
+	if off >= z.size {
+		return 0, io.EOF
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	n := 0
+	for n < len(p) && off < z.size {
+		b, err := z.block(off, int64(len(p)-n))
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], b.data[off-b.off:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns a cached or newly fetched block holding off, fetching at
+// least want bytes.
+func (z *RemoteZip) block(off, want int64) (*remoteZipBlock, error) {
+	for i := len(z.blocks) - 1; i >= 0; i-- {
+		b := &z.blocks[i]
+		if off >= b.off && off < b.off+int64(len(b.data)) {
+			return b, nil
+		}
+	}
+	if want < z.readAhead {
+		want = z.readAhead
+	}
+	end := off + want - 1
+	if end >= z.size {
+		end = z.size - 1
+	}
+	body, err := z.get(off, end)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data := make([]byte, end-off+1)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, err
+	}
+	if len(z.blocks) == remoteZipCachedBlocks {
+		z.blocks = z.blocks[1:]
+	}
+	z.blocks = append(z.blocks, remoteZipBlock{off, data})
+	return &z.blocks[len(z.blocks)-1], nil
+}
+
+// fetchTail fetches the end of the archive, learning its size from the
+// Content-Range of the response.
+func (z *RemoteZip) fetchTail() error {
+	resp, err := z.do("bytes=-" + strconv.FormatInt(remoteZipTailSize, 10))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, size-start))
+	if err != nil {
+		return err
+	}
+	if start+int64(len(data)) != size {
+		return fmt.Errorf("remote zip: %w", ErrPrematureEOF)
+	}
+	z.size = size
+	z.blocks = append(z.blocks, remoteZipBlock{start, data})
+	return nil
+}
+
+// get requests the bytes of the archive from ioff to foff inclusive.
+func (z *RemoteZip) get(ioff, foff int64) (io.ReadCloser, error) {
+	resp, err := z.do("bytes=" + strconv.FormatInt(ioff, 10) + "-" + strconv.FormatInt(foff, 10))
+	if err != nil {
+		return nil, err
+	}
+	if start, _, err := parseContentRange(resp.Header.Get("Content-Range")); err != nil || start != ioff {
+		resp.Body.Close()
+		return nil, fmt.Errorf("remote zip: unexpected range %q", resp.Header.Get("Content-Range"))
+	}
+	return resp.Body, nil
+}
+
+func (z *RemoteZip) do(rng string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, z.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	z.headers.Set(req.Header)
+	req.Header.Set("Range", rng)
+	// ranges of compressed content are of no use to archive/zip
+	req.Header.Set("Accept-Encoding", "identity")
+	z.requests.Add(1)
+	resp, err := z.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp, nil
+	case http.StatusOK:
+		resp.Body.Close()
+		return nil, ErrRangeNotSupported
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("remote zip: unexpected status %s", resp.Status)
+	}
+}
+
+// parseContentRange parses "bytes start-end/size" of a Content-Range header.
+func parseContentRange(v string) (start, size int64, err error) {
+	rng, total, ok := strings.Cut(strings.TrimPrefix(v, "bytes "), "/")
+	first, _, ok2 := strings.Cut(rng, "-")
+	if !ok || !ok2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	if size, err = strconv.ParseInt(total, 10, 64); err != nil || size <= start {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	return start, size, nil
+}
+
+// remoteZipFile is an opened remote zip entry, checking its CRC-32 and
+// size at the end of its contents.
+type remoteZipFile struct {
+	body io.ReadCloser
+	r    io.Reader
+	hash hash.Hash32
+	f    *zip.File
+	n    uint64
+	err  error
+}
+
+func (rf *remoteZipFile) Read(p []byte) (int, error) {
+	if rf.err != nil {
+		return 0, rf.err
+	}
+	n, err := rf.r.Read(p)
+	rf.hash.Write(p[:n])
+	rf.n += uint64(n)
+	if rf.n > rf.f.UncompressedSize64 {
+		err = zip.ErrFormat
+	} else if err == io.EOF {
+		if rf.n != rf.f.UncompressedSize64 || rf.hash.Sum32() != rf.f.CRC32 {
+			err = zip.ErrChecksum
+		}
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = ErrPrematureEOF
+	}
+	rf.err = err
+	return n, err
+}
+
+func (rf *remoteZipFile) Close() error {
+	return rf.body.Close()
+}
@@ -0,0 +1,151 @@
+package warplib
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newZipServer serves data with range support, counting the bytes sent.
+func newZipServer(t *testing.T, data []byte) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var sent atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(&countingWriter{w, &sent}, r, "big.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &sent
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
+
+// makeRemoteZip builds an archive of a large stored padding entry and two
+// small files, one deflated and one stored.
+func makeRemoteZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, method uint16, body []byte) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("padding.bin", zip.Store, bytes.Repeat([]byte{0xAB}, int(4*MB)))
+	add("docs/readme.txt", zip.Deflate, []byte(strings.Repeat("hello remote zip\n", 100)))
+	add("raw.txt", zip.Store, []byte("stored contents"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readRemoteFile(t *testing.T, z *RemoteZip, name string) ([]byte, error) {
+	t.Helper()
+	f, err := z.File(name)
+	if err != nil {
+		t.Fatalf("File(%s): %v", name, err)
+	}
+	rc, err := z.Open(f)
+	if err != nil {
+		t.Fatalf("Open(%s): %v", name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func TestRemoteZip_ListAndGet(t *testing.T) {
+	data := makeRemoteZip(t)
+	srv, sent := newZipServer(t, data)
+
+	z, err := OpenRemoteZip(&http.Client{}, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("OpenRemoteZip: %v", err)
+	}
+	if z.Size() != int64(len(data)) {
+		t.Errorf("Size = %d, want %d", z.Size(), len(data))
+	}
+	var names []string
+	for _, f := range z.Files() {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "padding.bin,docs/readme.txt,raw.txt" {
+		t.Errorf("files = %v", names)
+	}
+
+	got, err := readRemoteFile(t, z, "docs/readme.txt")
+	if err != nil || string(got) != strings.Repeat("hello remote zip\n", 100) {
+		t.Fatalf("read readme = %q, %v", got, err)
+	}
+	if got, err := readRemoteFile(t, z, "/raw.txt"); err != nil || string(got) != "stored contents" {
+		t.Fatalf("read raw = %q, %v", got, err)
+	}
+	// the tail, and a header and the data of each file
+	if z.Requests() != 5 {
+		t.Errorf("requests = %d, want 5", z.Requests())
+	}
+	if sent.Load() > 2*MB {
+		t.Errorf("sent %d bytes of a %d bytes archive", sent.Load(), len(data))
+	}
+
+	if _, err := z.File("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("File(missing) = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestRemoteZip_ChecksumMismatch(t *testing.T) {
+	data := makeRemoteZip(t)
+	i := bytes.Index(data, []byte("stored contents"))
+	data[i] = 'S'
+	srv, _ := newZipServer(t, data)
+
+	z, err := OpenRemoteZip(&http.Client{}, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("OpenRemoteZip: %v", err)
+	}
+	if _, err := readRemoteFile(t, z, "raw.txt"); !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("read corrupted = %v, want zip.ErrChecksum", err)
+	}
+}
+
+func TestRemoteZip_RangeNotSupported(t *testing.T) {
+	data := makeRemoteZip(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	if _, err := OpenRemoteZip(&http.Client{}, srv.URL, nil); !errors.Is(err, ErrRangeNotSupported) {
+		t.Fatalf("OpenRemoteZip = %v, want ErrRangeNotSupported", err)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	if start, size, err := parseContentRange("bytes 100-199/200"); err != nil || start != 100 || size != 200 {
+		t.Errorf("parseContentRange = %d, %d, %v", start, size, err)
+	}
+	for _, bad := range []string{"", "bytes */200", "bytes 0-1/*", "bytes 300-399/200"} {
+		if _, _, err := parseContentRange(bad); err == nil {
+			t.Errorf("parseContentRange(%q) succeeded", bad)
+		}
+	}
+}
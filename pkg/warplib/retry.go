@@ -70,6 +70,10 @@ func ClassifyError(err error) ErrorCategory {
 		return ErrCategoryFatal
 	}
 
+	if errors.Is(err, ErrServerThrottled) {
+		return ErrCategoryThrottled
+	}
+
 	// EOF errors are retryable (connection dropped mid-transfer)
 	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
 		return ErrCategoryRetryable
@@ -0,0 +1,620 @@
+package warplib
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/ssh"
+)
+
+// SignatureAuto, given as the signature URL, looks the detached signature
+// up next to the download.
+const SignatureAuto = "auto"
+
+// DefaultSignatureSidecars are the detached signatures looked for next to
+// a download with SignatureAuto, in order, with the placeholders of
+// DefaultChecksumSidecars.
+var DefaultSignatureSidecars = []string{
+	"{url}.asc",
+	"{url}.sig",
+	"{url}.minisig",
+}
+
+const (
+	// keyFileExt is the extension of the key files of the keyring.
+	keyFileExt = ".pub"
+	// maxSignatureSize is the size of the signature files read at most.
+	maxSignatureSize = 64 * KB
+	// maxLegacySignedSize is the size of the files verified at most against
+	// signify and legacy minisign signatures, which sign the whole file
+	// rather than its hash and so need it in memory.
+	maxLegacySignedSize = 256 * MB
+	// sshSigNamespace is the namespace of SSH file signatures, as made by
+	// ssh-keygen -Y sign -n file.
+	sshSigNamespace = "file"
+)
+
+// KeyFormat is the format of a trusted key and of the signatures it
+// verifies.
+type KeyFormat string
+
+const (
+	// KeyOpenPGP is an OpenPGP public key, verifying .asc and .sig files.
+	KeyOpenPGP KeyFormat = "openpgp"
+	// KeyMinisign is a minisign or signify public key, which share their
+	// format, verifying .minisig and .sig files.
+	KeyMinisign KeyFormat = "minisign"
+	// KeySSH is an SSH public key, verifying ssh-keygen -Y sign signatures.
+	KeySSH KeyFormat = "ssh"
+)
+
+// TrustedKey describes a public key of the keyring.
+type TrustedKey struct {
+	// Name is the name the key was added under.
+	Name string `json:"name"`
+	// Format is the format of the key.
+	Format KeyFormat `json:"format"`
+	// ID identifies the key: the fingerprint of OpenPGP and SSH keys, the
+	// key ID of minisign ones.
+	ID string `json:"id"`
+	// Comment is the user ID of OpenPGP keys and the comment of others.
+	Comment string `json:"comment,omitempty"`
+	// Added is when the key was added.
+	Added time.Time `json:"added"`
+}
+
+// SignatureResult is the outcome of a successful signature verification.
+type SignatureResult struct {
+	// URL is where the signature was fetched from.
+	URL string `json:"url"`
+	// Format is the format of the signature.
+	Format KeyFormat `json:"format"`
+	// Signer is the name of the trusted key that made the signature.
+	Signer string `json:"signer"`
+	// KeyID is the ID of that key.
+	KeyID string `json:"key_id"`
+	// Verified is when the signature was verified.
+	Verified time.Time `json:"verified"`
+}
+
+// publicKey is a parsed key of the keyring.
+type publicKey struct {
+	TrustedKey
+	pgp      openpgp.EntityList
+	ed       ed25519.PublicKey
+	edKeyID  []byte
+	sshKey   ssh.PublicKey
+	fileName string
+}
+
+// Keyring is the directory of the public keys trusted to sign downloads,
+// one file per key.
+type Keyring struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// keyNamePattern is what key names are made of, as they name files.
+var keyNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+// OpenKeyring opens the keyring in dir, creating the directory if needed.
+func OpenKeyring(dir string) (*Keyring, error) {
+	if err := WarpMkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	return &Keyring{dir: dir}, nil
+}
+
+// Dir returns the directory of the keyring.
+func (k *Keyring) Dir() string {
+	return k.dir
+}
+
+// Add adds the public key in data under name, which defaults to the name
+// or comment the key carries.
+func (k *Keyring) Add(name string, data []byte) (TrustedKey, error) {
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return TrustedKey{}, err
+	}
+	if name == "" {
+		name = defaultKeyName(key)
+	}
+	if !keyNamePattern.MatchString(name) {
+		return TrustedKey{}, fmt.Errorf("invalid key name %q: use letters, digits, '.', '_', '@' and '-'", name)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	path := filepath.Join(k.dir, name+keyFileExt)
+	f, err := WarpOpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return TrustedKey{}, fmt.Errorf("%w: %s", ErrKeyExists, name)
+		}
+		return TrustedKey{}, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		_ = WarpRemove(path)
+		return TrustedKey{}, err
+	}
+	if err := f.Close(); err != nil {
+		return TrustedKey{}, err
+	}
+	key.Name = name
+	key.Added = time.Now()
+	return key.TrustedKey, nil
+}
+
+// List returns the keys of the keyring sorted by name. Files that aren't
+// keys are skipped.
+func (k *Keyring) List() ([]TrustedKey, error) {
+	keys, err := k.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]TrustedKey, len(keys))
+	for i, key := range keys {
+		list[i] = key.TrustedKey
+	}
+	return list, nil
+}
+
+// Remove removes the key called name.
+func (k *Keyring) Remove(name string) error {
+	if !keyNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := WarpRemove(filepath.Join(k.dir, name+keyFileExt)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// load reads and parses the keys of the keyring.
+func (k *Keyring) load() ([]*publicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	var keys []*publicKey
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), keyFileExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		path := filepath.Join(k.dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		key, err := parsePublicKey(data)
+		if err != nil {
+			continue
+		}
+		key.Name, key.fileName = name, path
+		if info, err := e.Info(); err == nil {
+			key.Added = info.ModTime()
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+// Verify verifies the detached signature sig of the file at path against
+// the keys of the keyring. The format of the signature is told by its
+// content. It returns the result without its URL.
+func (k *Keyring) Verify(path string, sig []byte) (*SignatureResult, error) {
+	keys, err := k.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no trusted keys in %s", ErrSignatureInvalid, k.dir)
+	}
+	var key *publicKey
+	trimmed := bytes.TrimSpace(sig)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN SSH SIGNATURE-----")):
+		key, err = verifySSHSignature(keys, path, trimmed)
+	case bytes.HasPrefix(trimmed, []byte("untrusted comment:")):
+		key, err = verifyMinisignSignature(keys, path, trimmed)
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN PGP SIGNATURE-----")) || (len(sig) > 0 && sig[0]&0x80 != 0):
+		key, err = verifyOpenPGPSignature(keys, path, sig)
+	default:
+		err = fmt.Errorf("unrecognized signature format")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	return &SignatureResult{
+		Format:   key.Format,
+		Signer:   key.Name,
+		KeyID:    key.ID,
+		Verified: time.Now(),
+	}, nil
+}
+
+// parsePublicKey parses an armored or binary OpenPGP public key, a
+// minisign or signify public key, or an SSH public key.
+func parsePublicKey(data []byte) (*publicKey, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")),
+		len(trimmed) > 0 && trimmed[0]&0x80 != 0:
+		return parseOpenPGPKey(data)
+	case bytes.HasPrefix(trimmed, []byte("ssh-")), bytes.HasPrefix(trimmed, []byte("ecdsa-")), bytes.HasPrefix(trimmed, []byte("sk-")):
+		pub, comment, _, _, err := ssh.ParseAuthorizedKey(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH public key: %w", err)
+		}
+		return &publicKey{
+			TrustedKey: TrustedKey{Format: KeySSH, ID: ssh.FingerprintSHA256(pub), Comment: comment},
+			sshKey:     pub,
+		}, nil
+	}
+	if key, err := parseMinisignKey(trimmed); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unrecognized public key: want an OpenPGP, minisign, signify or SSH public key")
+}
+
+// parseOpenPGPKey parses an armored or binary OpenPGP public key.
+func parseOpenPGPKey(data []byte) (*publicKey, error) {
+	read := openpgp.ReadKeyRing
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		read = openpgp.ReadArmoredKeyRing
+	}
+	entities, err := read(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP public key: %w", err)
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("invalid OpenPGP public key: no key found")
+	}
+	key := &publicKey{
+		TrustedKey: TrustedKey{Format: KeyOpenPGP, ID: fmt.Sprintf("%X", entities[0].PrimaryKey.Fingerprint)},
+		pgp:        entities,
+	}
+	if id := entities[0].PrimaryIdentity(); id != nil {
+		key.Comment = id.Name
+	}
+	return key, nil
+}
+
+// parseMinisignKey parses a minisign or signify public key, with or
+// without its untrusted comment line.
+func parseMinisignKey(data []byte) (*publicKey, error) {
+	comment, encoded := splitMinisignComment(data)
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, fmt.Errorf("invalid minisign public key")
+	}
+	return &publicKey{
+		TrustedKey: TrustedKey{Format: KeyMinisign, ID: minisignKeyID(raw[2:10]), Comment: comment},
+		ed:         ed25519.PublicKey(raw[10:]),
+		edKeyID:    raw[2:10],
+	}, nil
+}
+
+// splitMinisignComment returns the untrusted comment and the base64 line
+// of a minisign or signify key.
+func splitMinisignComment(data []byte) (comment, encoded string) {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if c, ok := strings.CutPrefix(line, "untrusted comment:"); ok {
+			comment = strings.TrimSpace(c)
+		} else if line != "" {
+			encoded = line
+		}
+	}
+	return comment, encoded
+}
+
+// minisignKeyID formats a key ID as minisign does.
+func minisignKeyID(id []byte) string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(id))
+}
+
+// defaultKeyName returns the name a key is added under when none is
+// given: the name of its OpenPGP user ID or its comment, else its ID.
+func defaultKeyName(key *publicKey) string {
+	name := key.Comment
+	if i := strings.IndexAny(name, "<("); key.Format == KeyOpenPGP && i > 0 {
+		name = name[:i]
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '@', r == '-':
+			return r
+		case r == ' ':
+			return '-'
+		}
+		return -1
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, ".-_@")
+	if name == "" || strings.HasPrefix(name, "minisign") || strings.HasPrefix(name, "signify") {
+		name = strings.TrimPrefix(key.ID, "SHA256:")
+		name = strings.NewReplacer("/", "_", "+", "-").Replace(name)
+	}
+	return name
+}
+
+// verifyOpenPGPSignature verifies an armored or binary OpenPGP detached
+// signature of the file at path.
+func verifyOpenPGPSignature(keys []*publicKey, path string, sig []byte) (*publicKey, error) {
+	var keyring openpgp.EntityList
+	owners := make(map[*openpgp.Entity]*publicKey)
+	for _, key := range keys {
+		for _, e := range key.pgp {
+			keyring = append(keyring, e)
+			owners[e] = key
+		}
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("no trusted OpenPGP keys")
+	}
+	f, err := WarpOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	check := openpgp.CheckDetachedSignature
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN")) {
+		check = openpgp.CheckArmoredDetachedSignature
+	}
+	signer, err := check(keyring, f, bytes.NewReader(sig), nil)
+	if err != nil {
+		return nil, err
+	}
+	return owners[signer], nil
+}
+
+// verifyMinisignSignature verifies a minisign or signify signature of the
+// file at path.
+func verifyMinisignSignature(keys []*publicKey, path string, sig []byte) (*publicKey, error) {
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(sig))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 2 && len(lines) != 4 {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+	algo, keyID, signature := string(raw[:2]), raw[2:10], raw[10:]
+	var key *publicKey
+	for _, k := range keys {
+		if k.Format == KeyMinisign && bytes.Equal(k.edKeyID, keyID) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("signed by untrusted key %s", minisignKeyID(keyID))
+	}
+
+	var message []byte
+	switch algo {
+	case "ED":
+		// prehashed, the signature is of the BLAKE2b-512 of the file
+		h, _ := blake2b.New512(nil)
+		if message, err = hashFile(path, h); err != nil {
+			return nil, err
+		}
+	case "Ed":
+		if message, err = readLegacySigned(path); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported minisign signature algorithm %q", algo)
+	}
+	if !ed25519.Verify(key.ed, message, signature) {
+		return nil, fmt.Errorf("bad signature")
+	}
+
+	// minisign signs its trusted comment too, signify has none
+	if len(lines) == 4 {
+		comment, ok := strings.CutPrefix(lines[2], "trusted comment:")
+		global, err := base64.StdEncoding.DecodeString(lines[3])
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid minisign signature")
+		}
+		if !ed25519.Verify(key.ed, append(append([]byte{}, signature...), strings.TrimPrefix(comment, " ")...), global) {
+			return nil, fmt.Errorf("bad trusted comment signature")
+		}
+	}
+	return key, nil
+}
+
+// sshSignature is an SSH signature after its magic preamble, see
+// PROTOCOL.sshsig of OpenSSH.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// verifySSHSignature verifies an armored SSH signature of the file at
+// path, made with ssh-keygen -Y sign -n file.
+func verifySSHSignature(keys []*publicKey, path string, sig []byte) (*publicKey, error) {
+	body := string(sig)
+	body = strings.TrimPrefix(body, "-----BEGIN SSH SIGNATURE-----")
+	body, _, _ = strings.Cut(body, "-----END SSH SIGNATURE-----")
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil || !bytes.HasPrefix(blob, []byte("SSHSIG")) {
+		return nil, fmt.Errorf("invalid SSH signature")
+	}
+	var s sshSignature
+	if err := ssh.Unmarshal(blob[6:], &s); err != nil || s.Version != 1 {
+		return nil, fmt.Errorf("invalid SSH signature")
+	}
+	if s.Namespace != sshSigNamespace {
+		return nil, fmt.Errorf("SSH signature namespace %q, want %q", s.Namespace, sshSigNamespace)
+	}
+	pub, err := ssh.ParsePublicKey(s.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	var key *publicKey
+	for _, k := range keys {
+		if k.Format == KeySSH && bytes.Equal(k.sshKey.Marshal(), pub.Marshal()) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("signed by untrusted key %s", ssh.FingerprintSHA256(pub))
+	}
+
+	var h hash.Hash
+	switch s.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported SSH signature hash %q", s.HashAlgorithm)
+	}
+	digest, err := hashFile(path, h)
+	if err != nil {
+		return nil, err
+	}
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{s.Namespace, s.Reserved, s.HashAlgorithm, digest})...)
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(s.Signature, &signature); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	if err := pub.Verify(signed, &signature); err != nil {
+		return nil, fmt.Errorf("bad signature: %w", err)
+	}
+	return key, nil
+}
+
+// hashFile returns the hash h of the file at path.
+func hashFile(path string, h hash.Hash) ([]byte, error) {
+	f, err := WarpOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// readLegacySigned reads the file at path for a signature of its whole
+// content, refusing files over maxLegacySignedSize.
+func readLegacySigned(path string) ([]byte, error) {
+	info, err := WarpStat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxLegacySignedSize {
+		return nil, fmt.Errorf("file too large for a non-prehashed signature (%d bytes, at most %d)", info.Size(), int64(maxLegacySignedSize))
+	}
+	return os.ReadFile(path)
+}
+
+// SetKeyring sets the keyring the signatures of the downloads added or
+// resumed from now on are verified against.
+func (m *Manager) SetKeyring(k *Keyring) {
+	m.keyring = k
+}
+
+// GetKeyring returns the keyring of the manager, nil if none was set.
+func (m *Manager) GetKeyring() *Keyring {
+	return m.keyring
+}
+
+// findSignature fetches the detached signature of the file at rawURL, at
+// d.signatureURL or, with SignatureAuto, next to the file. It returns the
+// URL of the signature and its content.
+func (d *Downloader) findSignature(rawURL string) (string, []byte, error) {
+	urls := []string{d.signatureURL}
+	if d.signatureURL == SignatureAuto {
+		urls = sidecarURLs(DefaultSignatureSidecars, rawURL, d.fileName)
+	}
+	var lastErr error
+	for _, u := range urls {
+		data, err := d.fetchSidecar(rawURL, u, maxSignatureSize)
+		if err == nil {
+			return u, data, nil
+		}
+		lastErr = err
+	}
+	if d.signatureURL == SignatureAuto {
+		return "", nil, fmt.Errorf("%w: no signature found next to %s", ErrSignatureInvalid, rawURL)
+	}
+	return "", nil, fmt.Errorf("%w: fetch signature: %v", ErrSignatureInvalid, lastErr)
+}
+
+// verifySignature verifies the downloaded file against its detached
+// signature, fetching the signature again when resumed.
+func (d *Downloader) verifySignature() error {
+	if d.signatureURL == "" {
+		return nil
+	}
+	if d.keyring == nil {
+		return fmt.Errorf("%w: no keyring", ErrSignatureInvalid)
+	}
+	if d.signatureData == nil {
+		data, err := d.fetchSidecar(d.url, d.signatureURL, maxSignatureSize)
+		if err != nil {
+			return fmt.Errorf("%w: fetch signature: %v", ErrSignatureInvalid, err)
+		}
+		d.signatureData = data
+	}
+	d.Log("Verifying signature %s...", d.signatureURL)
+	res, err := d.keyring.Verify(d.GetSavePath(), d.signatureData)
+	if err != nil {
+		return err
+	}
+	res.URL = d.signatureURL
+	d.signature = res
+	d.Log("Signature verified: %s key %s (%s)", res.Format, res.Signer, res.KeyID)
+	return nil
+}
@@ -0,0 +1,235 @@
+package warplib
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// The OpenPGP and SSH fixtures of testdata/signature were made with gpg
+// and ssh-keygen -Y sign -n file.
+func readSignatureFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "signature", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// minisignKey is a minisign key pair made for tests.
+type minisignKey struct {
+	id   []byte
+	priv ed25519.PrivateKey
+}
+
+func newMinisignKey(t *testing.T) *minisignKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &minisignKey{id: []byte("warpdl01"), priv: priv}
+}
+
+func (k *minisignKey) public() []byte {
+	raw := append(append([]byte("Ed"), k.id...), k.priv.Public().(ed25519.PublicKey)...)
+	return []byte("untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n")
+}
+
+// sign returns a prehashed minisign signature of data, or a signify one
+// when signify is set.
+func (k *minisignKey) sign(data []byte, signify bool) []byte {
+	if signify {
+		raw := append(append([]byte("Ed"), k.id...), ed25519.Sign(k.priv, data)...)
+		return []byte("untrusted comment: verify with key.pub\n" + base64.StdEncoding.EncodeToString(raw) + "\n")
+	}
+	digest := blake2b.Sum512(data)
+	sig := ed25519.Sign(k.priv, digest[:])
+	raw := append(append([]byte("ED"), k.id...), sig...)
+	comment := "timestamp:1700000000\tfile:release.txt"
+	global := ed25519.Sign(k.priv, append(append([]byte{}, sig...), comment...))
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		"trusted comment: " + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func TestKeyringAddListRemove(t *testing.T) {
+	k, err := OpenKeyring(filepath.Join(t.TempDir(), "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pgp, err := k.Add("", readSignatureFixture(t, "openpgp.pub"))
+	if err != nil || pgp.Name != "Release-Signer" || pgp.Format != KeyOpenPGP || len(pgp.ID) != 40 {
+		t.Errorf("Add(openpgp) = %+v, %v", pgp, err)
+	}
+	if key, err := k.Add("", readSignatureFixture(t, "ssh.pub")); err != nil || key.Name != "ci@example.com" || !strings.HasPrefix(key.ID, "SHA256:") {
+		t.Errorf("Add(ssh) = %+v, %v", key, err)
+	}
+	if key, err := k.Add("release", newMinisignKey(t).public()); err != nil || key.Format != KeyMinisign || key.ID != "31306C6470726177" {
+		t.Errorf("Add(minisign) = %+v, %v", key, err)
+	}
+	if _, err := k.Add("release", readSignatureFixture(t, "ssh.pub")); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Add(existing name) = %v", err)
+	}
+	for name, data := range map[string]string{"junk": "not a key", "../escape": string(readSignatureFixture(t, "ssh.pub"))} {
+		if _, err := k.Add(name, []byte(data)); err == nil {
+			t.Errorf("Add(%s) succeeded", name)
+		}
+	}
+
+	keys, err := k.List()
+	if err != nil || len(keys) != 3 || keys[0].Name != "Release-Signer" || keys[2].Name != "release" {
+		t.Fatalf("List = %+v, %v", keys, err)
+	}
+	if err := k.Remove("release"); err != nil {
+		t.Errorf("Remove: %v", err)
+	}
+	if err := k.Remove("release"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Remove(removed) = %v", err)
+	}
+}
+
+func TestKeyringVerify(t *testing.T) {
+	dir := t.TempDir()
+	k, err := OpenKeyring(filepath.Join(dir, "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mk := newMinisignKey(t)
+	for name, data := range map[string][]byte{
+		"pgp":  readSignatureFixture(t, "openpgp.pub"),
+		"ssh":  readSignatureFixture(t, "ssh.pub"),
+		"mini": mk.public(),
+	} {
+		if _, err := k.Add(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := readSignatureFixture(t, "release.txt")
+	file := writeTestFile(t, dir, "release.txt", string(content))
+	tampered := writeTestFile(t, dir, "tampered.txt", strings.ToUpper(string(content)))
+
+	good := []struct {
+		name   string
+		sig    []byte
+		signer string
+		format KeyFormat
+	}{
+		{"openpgp", readSignatureFixture(t, "release.txt.asc"), "pgp", KeyOpenPGP},
+		{"ssh", readSignatureFixture(t, "release.txt.sshsig"), "ssh", KeySSH},
+		{"minisign", mk.sign(content, false), "mini", KeyMinisign},
+		{"signify", mk.sign(content, true), "mini", KeyMinisign},
+	}
+	for _, tt := range good {
+		res, err := k.Verify(file, tt.sig)
+		if err != nil {
+			t.Errorf("%s: Verify: %v", tt.name, err)
+			continue
+		}
+		if res.Signer != tt.signer || res.Format != tt.format || res.KeyID == "" {
+			t.Errorf("%s: Verify = %+v", tt.name, res)
+		}
+		if _, err := k.Verify(tampered, tt.sig); !errors.Is(err, ErrSignatureInvalid) {
+			t.Errorf("%s: Verify(tampered) = %v", tt.name, err)
+		}
+	}
+
+	forged := mk.sign(content, false)
+	forged = []byte(strings.Replace(string(forged), "file:release.txt", "file:other.txt", 1))
+	bad := map[string][]byte{
+		"untrusted openpgp key": readSignatureFixture(t, "release.txt.other.sig"),
+		"untrusted minisign":    newMinisignKey(t).sign(content, false),
+		"forged comment":        forged,
+		"garbage":               []byte("hello"),
+	}
+	for name, sig := range bad {
+		if _, err := k.Verify(file, sig); !errors.Is(err, ErrSignatureInvalid) {
+			t.Errorf("%s: Verify = %v, want a failed verification", name, err)
+		}
+	}
+}
+
+func TestManagerVerifiesSignature(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	k, err := OpenKeyring(filepath.Join(t.TempDir(), "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Add("release", readSignatureFixture(t, "openpgp.pub")); err != nil {
+		t.Fatal(err)
+	}
+	m.SetKeyring(k)
+	m.SetChecksumConfig(&ChecksumConfig{Enabled: true, FailOnMismatch: true, OnMismatch: ChecksumMismatchDelete})
+
+	content := readSignatureFixture(t, "release.txt")
+	sig := readSignatureFixture(t, "release.txt.asc")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/release.txt", "/mirror/release.txt", "/unsigned.txt":
+			_, _ = w.Write(content)
+		case "/release.txt.asc":
+			_, _ = w.Write(sig)
+		case "/mirror/release.txt.sig":
+			_, _ = w.Write(readSignatureFixture(t, "release.txt.other.sig"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	add := func(path, sigURL string) (*Downloader, error) {
+		t.Helper()
+		d, err := NewDownloader(&http.Client{}, srv.URL+path, &DownloaderOpts{
+			DownloadDirectory: dir,
+			FileName:          strings.ReplaceAll(strings.TrimPrefix(path, "/"), "/", "_"),
+			Signature:         sigURL,
+			Handlers:          &Handlers{},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return d, m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir})
+	}
+
+	d, err := add("/release.txt", SignatureAuto)
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	item := m.GetItem(d.GetHash())
+	if item.SignatureURL != srv.URL+"/release.txt.asc" || item.Signature == nil || item.Signature.Signer != "release" {
+		t.Errorf("item signature = %q, %+v", item.SignatureURL, item.Signature)
+	}
+
+	// a bad signature fails the download like a checksum mismatch
+	d, err = add("/mirror/release.txt", SignatureAuto)
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := d.Start(); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("Start = %v, want a failed verification", err)
+	}
+	if _, err := os.Stat(d.GetSavePath()); !os.IsNotExist(err) {
+		t.Errorf("unverified file not deleted: %v", err)
+	}
+
+	// no signature to find fails right away
+	if _, err := add("/unsigned.txt", SignatureAuto); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("add without a signature = %v", err)
+	}
+}
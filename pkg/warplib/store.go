@@ -0,0 +1,571 @@
+package warplib
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// storeMigrations are the schema migrations of the userdata database.
+// migration i brings the schema to version i+1, which is kept in
+// PRAGMA user_version. Append new migrations, never edit applied ones.
+var storeMigrations = []string{
+	`CREATE TABLE items (
+		hash               TEXT PRIMARY KEY,
+		name               TEXT NOT NULL,
+		url                TEXT NOT NULL,
+		headers            TEXT NOT NULL,
+		date_added         INTEGER NOT NULL,
+		total_size         INTEGER NOT NULL,
+		downloaded         INTEGER NOT NULL,
+		download_location  TEXT NOT NULL,
+		absolute_location  TEXT NOT NULL,
+		child_hash         TEXT NOT NULL,
+		hidden             INTEGER NOT NULL,
+		children           INTEGER NOT NULL,
+		resumable          INTEGER NOT NULL,
+		protocol           INTEGER NOT NULL,
+		ssh_key_path       TEXT NOT NULL,
+		scheduled_at       INTEGER NOT NULL,
+		cron_expr          TEXT NOT NULL,
+		schedule_state     TEXT NOT NULL,
+		cookie_source_path TEXT NOT NULL,
+		direct_write       INTEGER NOT NULL
+	);
+	CREATE INDEX items_date_added ON items(date_added);
+	CREATE INDEX items_schedule_state ON items(schedule_state);
+	CREATE TABLE parts (
+		item_hash    TEXT NOT NULL REFERENCES items(hash) ON DELETE CASCADE,
+		start_offset INTEGER NOT NULL,
+		hash         TEXT NOT NULL,
+		final_offset INTEGER NOT NULL,
+		compiled     INTEGER NOT NULL,
+		PRIMARY KEY (item_hash, start_offset)
+	);
+	CREATE TABLE queue_state (
+		id             INTEGER PRIMARY KEY CHECK (id = 1),
+		max_concurrent INTEGER NOT NULL,
+		paused         INTEGER NOT NULL
+	);
+	CREATE TABLE queue_waiting (
+		position INTEGER PRIMARY KEY,
+		hash     TEXT NOT NULL,
+		priority INTEGER NOT NULL
+	);`,
+	`ALTER TABLE items ADD COLUMN hooks TEXT NOT NULL DEFAULT '';
+	ALTER TABLE items ADD COLUMN hook_runs TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE items ADD COLUMN extract TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE items ADD COLUMN category TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE items ADD COLUMN checksums TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE items ADD COLUMN signature_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE items ADD COLUMN signature TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE items ADD COLUMN pieces TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE items ADD COLUMN hashes TEXT NOT NULL DEFAULT '';
+	ALTER TABLE items ADD COLUMN verified_at INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE items ADD COLUMN error TEXT NOT NULL DEFAULT '';
+	ALTER TABLE items ADD COLUMN speed INTEGER NOT NULL DEFAULT 0;`,
+}
+
+const itemColumns = `hash, name, url, headers, date_added, total_size, downloaded,
+	download_location, absolute_location, child_hash, hidden, children,
+	resumable, protocol, ssh_key_path, scheduled_at, cron_expr,
+	schedule_state, cookie_source_path, direct_write, hooks, hook_runs,
+	extract, category, checksums, signature_url, signature,
+	pieces, hashes, verified_at, error, speed`
+
+const upsertItemQuery = `INSERT INTO items (` + itemColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (hash) DO UPDATE SET
+		name = excluded.name,
+		url = excluded.url,
+		headers = excluded.headers,
+		date_added = excluded.date_added,
+		total_size = excluded.total_size,
+		downloaded = excluded.downloaded,
+		download_location = excluded.download_location,
+		absolute_location = excluded.absolute_location,
+		child_hash = excluded.child_hash,
+		hidden = excluded.hidden,
+		children = excluded.children,
+		resumable = excluded.resumable,
+		protocol = excluded.protocol,
+		ssh_key_path = excluded.ssh_key_path,
+		scheduled_at = excluded.scheduled_at,
+		cron_expr = excluded.cron_expr,
+		schedule_state = excluded.schedule_state,
+		cookie_source_path = excluded.cookie_source_path,
+		direct_write = excluded.direct_write,
+		hooks = excluded.hooks,
+		hook_runs = excluded.hook_runs,
+		extract = excluded.extract,
+		category = excluded.category,
+		checksums = excluded.checksums,
+		signature_url = excluded.signature_url,
+		signature = excluded.signature,
+		pieces = excluded.pieces,
+		hashes = excluded.hashes,
+		verified_at = excluded.verified_at,
+		error = excluded.error,
+		speed = excluded.speed`
+
+// itemStore persists download items, their parts and the queue state in a
+// SQLite database. Every change is written in its own transaction, so a
+// crash mid-write never loses more than that change.
+type itemStore struct {
+	db *sql.DB
+	// queue is the last saved queue state, to skip rewriting it when
+	// only an item changed.
+	queue *QueueState
+}
+
+// openItemStore opens the userdata database at path, creating it and
+// applying pending migrations as needed.
+func openItemStore(path string) (*itemStore, error) {
+	// create the file ourselves so it gets the usual permissions
+	f, err := WarpOpenFile(path, os.O_RDWR|os.O_CREATE, DefaultFileMode)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	dsn := "file:" + path +
+		"?_pragma=busy_timeout(5000)" +
+		"&_pragma=foreign_keys(1)" +
+		"&_pragma=journal_mode(WAL)" +
+		"&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	s := &itemStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate userdata: %w", err)
+	}
+	return s, nil
+}
+
+// migrate applies the migrations the database hasn't seen yet.
+func (s *itemStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(storeMigrations) {
+		return fmt.Errorf("schema version %d is newer than supported version %d", version, len(storeMigrations))
+	}
+	for i := version; i < len(storeMigrations); i++ {
+		err := s.tx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(storeMigrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("version %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// tx runs fn in a transaction, committing it if fn succeeds.
+func (s *itemStore) tx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// load reads all items and the saved queue state.
+func (s *itemStore) load() (ItemsMap, *QueueState, error) {
+	items := make(ItemsMap)
+	rows, err := s.db.Query(`SELECT ` + itemColumns + ` FROM items`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			item                   Item
+			headers                string
+			dateAdded, scheduledAt int64
+			total, downloaded      int64
+			protocol               uint8
+			scheduleState          string
+			hooks, hookRuns        string
+			extract, checksums     string
+			signature, pieces      string
+			hashes                 string
+			verifiedAt             int64
+		)
+		err := rows.Scan(
+			&item.Hash, &item.Name, &item.Url, &headers, &dateAdded, &total, &downloaded,
+			&item.DownloadLocation, &item.AbsoluteLocation, &item.ChildHash, &item.Hidden, &item.Children,
+			&item.Resumable, &protocol, &item.SSHKeyPath, &scheduledAt, &item.CronExpr,
+			&scheduleState, &item.CookieSourcePath, &item.DirectWrite, &hooks, &hookRuns,
+			&extract, &item.Category, &checksums, &item.SignatureURL, &signature,
+			&pieces, &hashes, &verifiedAt, &item.Error, &item.Speed,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := json.Unmarshal([]byte(headers), &item.Headers); err != nil {
+			return nil, nil, fmt.Errorf("item %s: headers: %w", item.Hash, err)
+		}
+		if err := unmarshalColumn(hooks, &item.Hooks); err != nil {
+			return nil, nil, fmt.Errorf("item %s: hooks: %w", item.Hash, err)
+		}
+		if err := unmarshalColumn(hookRuns, &item.HookRuns); err != nil {
+			return nil, nil, fmt.Errorf("item %s: hook runs: %w", item.Hash, err)
+		}
+		if err := unmarshalColumn(extract, &item.Extract); err != nil {
+			return nil, nil, fmt.Errorf("item %s: extract: %w", item.Hash, err)
+		}
+		if err := unmarshalColumn(checksums, &item.Checksums); err != nil {
+			return nil, nil, fmt.Errorf("item %s: checksums: %w", item.Hash, err)
+		}
+		if err := unmarshalColumn(signature, &item.Signature); err != nil {
+			return nil, nil, fmt.Errorf("item %s: signature: %w", item.Hash, err)
+		}
+		if err := unmarshalColumn(pieces, &item.Pieces); err != nil {
+			return nil, nil, fmt.Errorf("item %s: pieces: %w", item.Hash, err)
+		}
+		if err := unmarshalColumn(hashes, &item.Hashes); err != nil {
+			return nil, nil, fmt.Errorf("item %s: hashes: %w", item.Hash, err)
+		}
+		item.DateAdded = timeFromStore(dateAdded)
+		item.ScheduledAt = timeFromStore(scheduledAt)
+		item.VerifiedAt = timeFromStore(verifiedAt)
+		item.TotalSize = ContentLength(total)
+		item.Downloaded = ContentLength(downloaded)
+		item.Protocol = Protocol(protocol)
+		item.ScheduleState = ScheduleState(scheduleState)
+		item.Parts = make(map[int64]*ItemPart)
+		items[item.Hash] = &item
+	}
+	// the store has a single connection, release it before the next query
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	prows, err := s.db.Query(`SELECT item_hash, start_offset, hash, final_offset, compiled FROM parts`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer prows.Close()
+	for prows.Next() {
+		var (
+			itemHash string
+			ioff     int64
+			part     ItemPart
+		)
+		if err := prows.Scan(&itemHash, &ioff, &part.Hash, &part.FinalOffset, &part.Compiled); err != nil {
+			return nil, nil, err
+		}
+		if item, ok := items[itemHash]; ok {
+			item.Parts[ioff] = &part
+		}
+	}
+	prows.Close()
+	if err := prows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	queue, err := s.loadQueue()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.queue = queue
+	return items, queue, nil
+}
+
+// loadQueue reads the saved queue state, nil if there is none.
+func (s *itemStore) loadQueue() (*QueueState, error) {
+	var state QueueState
+	err := s.db.QueryRow(`SELECT max_concurrent, paused FROM queue_state WHERE id = 1`).
+		Scan(&state.MaxConcurrent, &state.Paused)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT hash, priority FROM queue_waiting ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var q QueuedItemState
+		if err := rows.Scan(&q.Hash, &q.Priority); err != nil {
+			return nil, err
+		}
+		state.Waiting = append(state.Waiting, q)
+	}
+	return &state, rows.Err()
+}
+
+// saveItem writes one item and its parts, along with the queue state if it
+// changed since it was last saved.
+func (s *itemStore) saveItem(item *Item, queue *QueueState) error {
+	err := s.tx(func(tx *sql.Tx) error {
+		if err := putItem(tx, item); err != nil {
+			return err
+		}
+		return s.putQueue(tx, queue)
+	})
+	if err != nil {
+		return err
+	}
+	s.queue = queue
+	return nil
+}
+
+// saveAll replaces the saved items and queue state with the given ones.
+func (s *itemStore) saveAll(items ItemsMap, queue *QueueState) error {
+	err := s.tx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM items`); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if item == nil {
+				continue
+			}
+			if err := putItem(tx, item); err != nil {
+				return err
+			}
+		}
+		s.queue = nil
+		return s.putQueue(tx, queue)
+	})
+	if err != nil {
+		return err
+	}
+	s.queue = queue
+	return nil
+}
+
+// deleteItems removes the items with the given hashes.
+func (s *itemStore) deleteItems(hashes ...string) error {
+	return s.tx(func(tx *sql.Tx) error {
+		for _, hash := range hashes {
+			if _, err := tx.Exec(`DELETE FROM items WHERE hash = ?`, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sync checkpoints the write-ahead log into the database file, making all
+// committed changes durable.
+func (s *itemStore) sync() error {
+	_, err := s.db.Exec(`PRAGMA wal_checkpoint(FULL)`)
+	return err
+}
+
+func (s *itemStore) close() error {
+	return s.db.Close()
+}
+
+// putItem upserts an item and replaces its parts.
+func putItem(tx *sql.Tx, item *Item) error {
+	headers, err := json.Marshal(item.Headers)
+	if err != nil {
+		return fmt.Errorf("item %s: headers: %w", item.Hash, err)
+	}
+	hooks, err := marshalColumn(item.Hooks, item.Hooks.IsEmpty())
+	if err != nil {
+		return fmt.Errorf("item %s: hooks: %w", item.Hash, err)
+	}
+	hookRuns, err := marshalColumn(item.HookRuns, len(item.HookRuns) == 0)
+	if err != nil {
+		return fmt.Errorf("item %s: hook runs: %w", item.Hash, err)
+	}
+	extract, err := marshalColumn(item.Extract, item.Extract == nil)
+	if err != nil {
+		return fmt.Errorf("item %s: extract: %w", item.Hash, err)
+	}
+	checksums, err := marshalColumn(item.Checksums, len(item.Checksums) == 0)
+	if err != nil {
+		return fmt.Errorf("item %s: checksums: %w", item.Hash, err)
+	}
+	signature, err := marshalColumn(item.Signature, item.Signature == nil)
+	if err != nil {
+		return fmt.Errorf("item %s: signature: %w", item.Hash, err)
+	}
+	pieces, err := marshalColumn(item.Pieces, item.Pieces == nil)
+	if err != nil {
+		return fmt.Errorf("item %s: pieces: %w", item.Hash, err)
+	}
+	hashes, err := marshalColumn(item.Hashes, len(item.Hashes) == 0)
+	if err != nil {
+		return fmt.Errorf("item %s: hashes: %w", item.Hash, err)
+	}
+	_, err = tx.Exec(upsertItemQuery,
+		item.Hash, item.Name, item.Url, string(headers), timeToStore(item.DateAdded),
+		int64(item.TotalSize), int64(item.Downloaded),
+		item.DownloadLocation, item.AbsoluteLocation, item.ChildHash, item.Hidden, item.Children,
+		item.Resumable, uint8(item.Protocol), item.SSHKeyPath, timeToStore(item.ScheduledAt), item.CronExpr,
+		string(item.ScheduleState), item.CookieSourcePath, item.DirectWrite, hooks, hookRuns,
+		extract, item.Category, checksums, item.SignatureURL, signature,
+		pieces, hashes, timeToStore(item.VerifiedAt), item.Error, item.Speed,
+	)
+	if err != nil {
+		return fmt.Errorf("item %s: %w", item.Hash, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM parts WHERE item_hash = ?`, item.Hash); err != nil {
+		return err
+	}
+	for ioff, part := range item.Parts {
+		if part == nil {
+			continue
+		}
+		_, err := tx.Exec(
+			`INSERT INTO parts (item_hash, start_offset, hash, final_offset, compiled) VALUES (?, ?, ?, ?, ?)`,
+			item.Hash, ioff, part.Hash, part.FinalOffset, part.Compiled,
+		)
+		if err != nil {
+			return fmt.Errorf("item %s: part %s: %w", item.Hash, part.Hash, err)
+		}
+	}
+	return nil
+}
+
+// putQueue writes the queue state unless it is unchanged. A nil state
+// leaves the saved one alone, as the queue may simply not be set up yet.
+func (s *itemStore) putQueue(tx *sql.Tx, queue *QueueState) error {
+	if queue == nil || reflect.DeepEqual(queue, s.queue) {
+		return nil
+	}
+	_, err := tx.Exec(
+		`INSERT OR REPLACE INTO queue_state (id, max_concurrent, paused) VALUES (1, ?, ?)`,
+		queue.MaxConcurrent, queue.Paused,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM queue_waiting`); err != nil {
+		return err
+	}
+	for i, q := range queue.Waiting {
+		_, err := tx.Exec(
+			`INSERT INTO queue_waiting (position, hash, priority) VALUES (?, ?, ?)`,
+			i, q.Hash, int(q.Priority),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importLegacy moves the downloads of a GOB encoded userdata.warp file into
+// the database and renames the file to <path>.bak, so it is only imported
+// once. A file that can't be decoded is set aside the same way.
+func (s *itemStore) importLegacy(path string) error {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := decodeLegacyUserdata(raw)
+	if err != nil {
+		log.Printf("warplib: warning: failed to decode legacy userdata, starting fresh: %v", err)
+	} else if len(data.Items) > 0 || data.QueueState != nil {
+		for hash, item := range data.Items {
+			if item == nil {
+				continue
+			}
+			// Unknown values indicate the file was created by a newer
+			// warpdl version, keep it for that version.
+			if err := ValidateProtocol(item.Protocol); err != nil {
+				return fmt.Errorf("item %s: %w", hash, err)
+			}
+		}
+		items, queue, err := s.load()
+		if err != nil {
+			return err
+		}
+		for hash, item := range data.Items {
+			items[hash] = item
+		}
+		if data.QueueState != nil {
+			queue = data.QueueState
+		}
+		if err := s.saveAll(items, queue); err != nil {
+			return fmt.Errorf("import legacy userdata: %w", err)
+		}
+		log.Printf("warplib: imported %d downloads from %s", len(data.Items), path)
+	}
+	return WarpRename(path, path+".bak")
+}
+
+// decodeLegacyUserdata decodes a GOB encoded ManagerData, falling back to
+// the older format that only held the ItemsMap.
+func decodeLegacyUserdata(raw []byte) (data ManagerData, err error) {
+	if len(raw) == 0 {
+		return data, nil
+	}
+	if err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&data); err == nil {
+		return data, nil
+	}
+	data = ManagerData{}
+	if err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&data.Items); err == io.EOF {
+		err = nil
+	}
+	return data, err
+}
+
+// marshalColumn encodes v as JSON for a TEXT column, "" if it is empty.
+func marshalColumn(v any, empty bool) (string, error) {
+	if empty {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// unmarshalColumn decodes a TEXT column written by marshalColumn into v,
+// leaving v alone if the column is empty.
+func unmarshalColumn(s string, v any) error {
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), v)
+}
+
+// timeToStore converts a time to unix nanoseconds, keeping the zero time
+// as 0 so it survives the round trip.
+func timeToStore(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func timeFromStore(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
@@ -0,0 +1,316 @@
+package warplib
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countStoredItems returns the number of item rows in the manager's database.
+func countStoredItems(t *testing.T, m *Manager) int {
+	t.Helper()
+	var n int
+	if err := m.store.db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&n); err != nil {
+		t.Fatalf("count items: %v", err)
+	}
+	return n
+}
+
+func writeLegacyUserdata(t *testing.T, data any) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := os.WriteFile(__USERDATA_FILE_NAME, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestItemStore_RoundTrip(t *testing.T) {
+	s, err := openItemStore(filepath.Join(t.TempDir(), "userdata.db"))
+	if err != nil {
+		t.Fatalf("openItemStore: %v", err)
+	}
+	defer s.close()
+
+	added := time.Date(2026, 3, 1, 12, 30, 0, 500, time.UTC)
+	in := &Item{
+		Hash:             "roundtrip",
+		Name:             "file.bin",
+		Url:              "sftp://example.com/file.bin",
+		Headers:          Headers{{Key: "X-Test", Value: "v"}},
+		DateAdded:        added,
+		TotalSize:        4096,
+		Downloaded:       1024,
+		DownloadLocation: "/tmp/dl",
+		AbsoluteLocation: "/tmp/abs",
+		ChildHash:        "child",
+		Hidden:           true,
+		Resumable:        true,
+		Protocol:         ProtoSFTP,
+		SSHKeyPath:       "/home/u/.ssh/id_ed25519",
+		ScheduledAt:      added.Add(time.Hour),
+		CronExpr:         "0 2 * * *",
+		ScheduleState:    ScheduleStateScheduled,
+		CookieSourcePath: "/tmp/cookies.sqlite",
+		DirectWrite:      true,
+		Hooks:            &Hooks{OnComplete: "notify-send done"},
+		HookRuns:         []HookRun{{Event: EventComplete, Command: "notify-send done", ExitCode: 1, Output: "no display"}},
+		Extract:          &ExtractOpts{Dir: "src", DeleteArchive: true},
+		Category:         CategoryArchives,
+		Checksums:        []ExpectedChecksum{{Algorithm: ChecksumSHA256, Value: []byte{0xde, 0xad, 0xbe, 0xef}}},
+		SignatureURL:     "https://example.com/file.bin.asc",
+		Signature:        &SignatureResult{URL: "https://example.com/file.bin.asc", Format: KeyOpenPGP, Signer: "release", KeyID: "0123ABCD", Verified: added},
+		Pieces:           &PieceHashes{Algorithm: ChecksumSHA256, Size: 2048, Hashes: [][]byte{{1}, {2}}},
+		Hashes:           []ExpectedChecksum{{Algorithm: ChecksumSHA512, Value: []byte{0xca, 0xfe}}},
+		VerifiedAt:       added.Add(time.Hour),
+		Error:            "connection reset",
+		Speed:            4 * MB,
+		Parts: map[int64]*ItemPart{
+			0:    {Hash: "p1", FinalOffset: 2047, Compiled: true},
+			2048: {Hash: "p2", FinalOffset: 4095},
+		},
+	}
+	queue := &QueueState{
+		MaxConcurrent: 2,
+		Paused:        true,
+		Waiting:       []QueuedItemState{{Hash: "b", Priority: PriorityHigh}, {Hash: "a", Priority: PriorityLow}},
+	}
+	if err := s.saveItem(in, queue); err != nil {
+		t.Fatalf("saveItem: %v", err)
+	}
+
+	items, gotQueue, err := s.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	out := items["roundtrip"]
+	if out == nil {
+		t.Fatal("item not loaded")
+	}
+	if !out.DateAdded.Equal(in.DateAdded) || !out.ScheduledAt.Equal(in.ScheduledAt) {
+		t.Errorf("times = %v, %v; want %v, %v", out.DateAdded, out.ScheduledAt, in.DateAdded, in.ScheduledAt)
+	}
+	out.DateAdded, out.ScheduledAt = in.DateAdded, in.ScheduledAt
+	if out.Name != in.Name || out.Url != in.Url || len(out.Headers) != 1 || out.Headers[0] != in.Headers[0] ||
+		out.TotalSize != in.TotalSize || out.Downloaded != in.Downloaded ||
+		out.DownloadLocation != in.DownloadLocation || out.AbsoluteLocation != in.AbsoluteLocation ||
+		out.ChildHash != in.ChildHash || !out.Hidden || out.Children || !out.Resumable ||
+		out.Protocol != in.Protocol || out.SSHKeyPath != in.SSHKeyPath || out.CronExpr != in.CronExpr ||
+		out.ScheduleState != in.ScheduleState || out.CookieSourcePath != in.CookieSourcePath || !out.DirectWrite ||
+		out.Category != in.Category {
+		t.Errorf("loaded %+v, want %+v", out, in)
+	}
+	if out.Hooks == nil || *out.Hooks != *in.Hooks || len(out.HookRuns) != 1 ||
+		out.HookRuns[0].ExitCode != 1 || out.HookRuns[0].Output != "no display" {
+		t.Errorf("hooks = %+v, runs = %+v", out.Hooks, out.HookRuns)
+	}
+	if out.Extract == nil || *out.Extract != *in.Extract {
+		t.Errorf("extract = %+v, want %+v", out.Extract, in.Extract)
+	}
+	if len(out.Checksums) != 1 || out.Checksums[0].Algorithm != ChecksumSHA256 ||
+		string(out.Checksums[0].Value) != string(in.Checksums[0].Value) {
+		t.Errorf("checksums = %+v, want %+v", out.Checksums, in.Checksums)
+	}
+	if out.SignatureURL != in.SignatureURL || out.Signature == nil || out.Signature.Signer != "release" ||
+		!out.Signature.Verified.Equal(in.Signature.Verified) {
+		t.Errorf("signature = %q, %+v", out.SignatureURL, out.Signature)
+	}
+	if out.Pieces == nil || out.Pieces.Size != 2048 || len(out.Pieces.Hashes) != 2 || out.Pieces.Hashes[1][0] != 2 {
+		t.Errorf("pieces = %+v", out.Pieces)
+	}
+	if len(out.Hashes) != 1 || out.Hashes[0].String() != in.Hashes[0].String() || !out.VerifiedAt.Equal(in.VerifiedAt) {
+		t.Errorf("hashes = %+v verified at %v", out.Hashes, out.VerifiedAt)
+	}
+	if out.Error != in.Error || out.Speed != in.Speed {
+		t.Errorf("error = %q, speed = %d", out.Error, out.Speed)
+	}
+	if len(out.Parts) != 2 || *out.Parts[0] != *in.Parts[0] || *out.Parts[2048] != *in.Parts[2048] {
+		t.Errorf("parts = %+v", out.Parts)
+	}
+	if gotQueue == nil || gotQueue.MaxConcurrent != 2 || !gotQueue.Paused ||
+		len(gotQueue.Waiting) != 2 || gotQueue.Waiting[0].Hash != "b" || gotQueue.Waiting[1].Priority != PriorityLow {
+		t.Errorf("queue = %+v", gotQueue)
+	}
+
+	// Updating an item replaces its parts.
+	in.Parts = map[int64]*ItemPart{0: {Hash: "p1", FinalOffset: 4095, Compiled: true}}
+	if err := s.saveItem(in, nil); err != nil {
+		t.Fatalf("saveItem: %v", err)
+	}
+	items, gotQueue, err = s.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if parts := items["roundtrip"].Parts; len(parts) != 1 || parts[0].FinalOffset != 4095 {
+		t.Errorf("parts after update = %+v", parts)
+	}
+	if gotQueue == nil || len(gotQueue.Waiting) != 2 {
+		t.Errorf("queue state lost when saving without one: %+v", gotQueue)
+	}
+
+	if err := s.deleteItems("roundtrip"); err != nil {
+		t.Fatalf("deleteItems: %v", err)
+	}
+	var parts int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM parts`).Scan(&parts); err != nil || parts != 0 {
+		t.Errorf("parts left after delete = %d (%v)", parts, err)
+	}
+}
+
+func TestItemStore_Migrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "userdata.db")
+	s, err := openItemStore(path)
+	if err != nil {
+		t.Fatalf("openItemStore: %v", err)
+	}
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil || version != len(storeMigrations) {
+		t.Fatalf("user_version = %d (%v), want %d", version, err, len(storeMigrations))
+	}
+	// a database written by a newer version is refused
+	if _, err := s.db.Exec(`PRAGMA user_version = 1000`); err != nil {
+		t.Fatalf("set user_version: %v", err)
+	}
+	s.close()
+	if s, err := openItemStore(path); err == nil {
+		s.close()
+		t.Fatal("expected error for a newer schema version")
+	}
+}
+
+func TestManager_UpdateItemPersistsImmediately(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	m.SetMaxConcurrentDownloads(1, nil)
+	m.queue.Add("first", PriorityNormal)
+	m.queue.Add("second", PriorityHigh)
+
+	item := newTestItem(t, "persisted")
+	item.mu = m.mu
+	m.UpdateItem(item)
+
+	// Another manager sees the change without the first one closing.
+	m2, err := InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	defer m2.Close()
+	if m2.GetItem("persisted") == nil {
+		t.Fatal("item not persisted by UpdateItem")
+	}
+	if m2.queueState == nil || len(m2.queueState.Waiting) != 1 || m2.queueState.Waiting[0].Hash != "second" {
+		t.Errorf("queue state = %+v", m2.queueState)
+	}
+}
+
+func TestInitManager_ImportsLegacyUserdata(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	item := newTestItem(t, "legacy")
+	item.Parts[0] = &ItemPart{Hash: "p1", FinalOffset: 99}
+	writeLegacyUserdata(t, ManagerData{
+		Items:      ItemsMap{item.Hash: item},
+		QueueState: &QueueState{MaxConcurrent: 3, Waiting: []QueuedItemState{{Hash: "legacy"}}},
+	})
+
+	m, err := InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	got := m.GetItem("legacy")
+	if got == nil || got.Parts[0] == nil || got.Parts[0].Hash != "p1" {
+		t.Fatalf("legacy item not imported: %+v", got)
+	}
+	if m.queueState == nil || m.queueState.MaxConcurrent != 3 {
+		t.Errorf("legacy queue state not imported: %+v", m.queueState)
+	}
+	m.Close()
+
+	if fileExists(__USERDATA_FILE_NAME) {
+		t.Error("legacy userdata still in place after import")
+	}
+	if !fileExists(__USERDATA_FILE_NAME + ".bak") {
+		t.Error("legacy userdata not kept as a backup")
+	}
+
+	m, err = InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	defer m.Close()
+	if m.GetItem("legacy") == nil {
+		t.Error("imported item not in the database")
+	}
+}
+
+func TestInitManager_ImportsOldestUserdataFormat(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	// before the queue existed, userdata.warp held only the ItemsMap
+	item := newTestItem(t, "oldest")
+	writeLegacyUserdata(t, ItemsMap{item.Hash: item})
+
+	m, err := InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	defer m.Close()
+	if m.GetItem("oldest") == nil {
+		t.Fatal("item not imported from the oldest format")
+	}
+}
+
+func TestInitManager_ImportsPrePhase2Fixture(t *testing.T) {
+	raw, err := os.ReadFile("testdata/pre_phase2_userdata.warp")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	if err := os.WriteFile(__USERDATA_FILE_NAME, raw, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	m, err := InitManager()
+	if err != nil {
+		t.Fatalf("InitManager: %v", err)
+	}
+	defer m.Close()
+	items := m.GetItems()
+	if len(items) == 0 {
+		t.Fatal("no items imported from fixture")
+	}
+	for _, item := range items {
+		if item.Protocol != ProtoHTTP {
+			t.Errorf("item %s: Protocol = %v, want ProtoHTTP", item.Hash, item.Protocol)
+		}
+	}
+}
+
+func TestInitManager_LegacyUnknownProtocol(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	item := newTestItem(t, "future")
+	item.Protocol = Protocol(99)
+	writeLegacyUserdata(t, ManagerData{Items: ItemsMap{item.Hash: item}})
+
+	if m, err := InitManager(); err == nil {
+		m.Close()
+		t.Fatal("expected error for unknown protocol")
+	}
+	if !fileExists(__USERDATA_FILE_NAME) {
+		t.Error("legacy userdata should be kept when it can't be imported")
+	}
+}
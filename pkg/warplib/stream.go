@@ -0,0 +1,335 @@
+package warplib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DEF_STREAM_WINDOW is the default amount of memory a streaming download
+// uses to fetch ahead of what the consumer has read.
+const DEF_STREAM_WINDOW = 32 * MB
+
+// streamWindow orders the blocks fetched by parallel connections into a
+// single stream. Data is kept in a ring buffer of the window size, and a
+// block is only handed out once it fits in the window, so a slow consumer
+// holds back new requests instead of letting the memory grow.
+type streamWindow struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// buf is the ring buffer, offset o is kept at buf[o%size].
+	buf  []byte
+	size int64
+	// block is the size of the ranges handed out to the connections.
+	block int64
+	total int64
+	// base is the offset of the next byte to emit.
+	base int64
+	// next is the offset of the next block to hand out.
+	next int64
+	// filled are the sorted, disjoint ranges written after base.
+	filled []streamSpan
+	err    error
+}
+
+// streamSpan is the range [start, end) of a stream.
+type streamSpan struct {
+	start, end int64
+}
+
+func newStreamWindow(total, size int64, conns int32) *streamWindow {
+	if size <= 0 {
+		size = DEF_STREAM_WINDOW
+	}
+	if conns < 1 {
+		conns = 1
+	}
+	// two blocks per connection, so a connection can start its next
+	// block while the previous one is still waiting to be emitted
+	block := size / (2 * int64(conns))
+	if block < DEF_CHUNK_SIZE {
+		block = DEF_CHUNK_SIZE
+	}
+	if size < block {
+		size = block
+	}
+	if size > total {
+		size = total
+	}
+	w := &streamWindow{
+		buf:   make([]byte, size),
+		size:  size,
+		block: block,
+		total: total,
+	}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// nextBlock hands out the next range to fetch, waiting until it fits in
+// the window. It returns false once everything has been handed out or the
+// stream failed.
+func (w *streamWindow) nextBlock() (ioff, foff int64, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.err == nil && w.next < w.total {
+		end := w.next + w.block
+		if end > w.total {
+			end = w.total
+		}
+		if end <= w.base+w.size {
+			ioff, foff = w.next, end-1
+			w.next = end
+			return ioff, foff, true
+		}
+		w.cond.Wait()
+	}
+	return 0, 0, false
+}
+
+// write stores the data of a block at its offset. Blocks never overlap and
+// are only handed out once they fit in the window, so it doesn't block.
+func (w *streamWindow) write(off int64, b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	end := off + int64(len(b))
+	if off < w.base || end > w.base+w.size {
+		return 0, fmt.Errorf("stream: write %d-%d outside of window %d-%d", off, end, w.base, w.base+w.size)
+	}
+	for src, o := b, off; len(src) > 0; {
+		n := copy(w.buf[o%w.size:], src)
+		src = src[n:]
+		o += int64(n)
+	}
+	w.addSpan(off, end)
+	w.cond.Broadcast()
+	return len(b), nil
+}
+
+// addSpan marks [start, end) as written, merging it with adjacent spans.
+func (w *streamWindow) addSpan(start, end int64) {
+	i := 0
+	for i < len(w.filled) && w.filled[i].end < start {
+		i++
+	}
+	if i < len(w.filled) && w.filled[i].start <= end {
+		if start < w.filled[i].start {
+			w.filled[i].start = start
+		}
+		if end > w.filled[i].end {
+			w.filled[i].end = end
+		}
+		// the span may now reach the next one
+		for i+1 < len(w.filled) && w.filled[i+1].start <= w.filled[i].end {
+			if w.filled[i+1].end > w.filled[i].end {
+				w.filled[i].end = w.filled[i+1].end
+			}
+			w.filled = append(w.filled[:i+1], w.filled[i+2:]...)
+		}
+		return
+	}
+	w.filled = append(w.filled, streamSpan{})
+	copy(w.filled[i+1:], w.filled[i:])
+	w.filled[i] = streamSpan{start, end}
+}
+
+// emit writes the stream to out in order until it is complete or failed.
+// A blocking out holds back the window and with it the connections.
+func (w *streamWindow) emit(out io.Writer) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.base < w.total {
+		if w.err != nil {
+			return w.err
+		}
+		if len(w.filled) == 0 || w.filled[0].start != w.base {
+			w.cond.Wait()
+			continue
+		}
+		i := w.base % w.size
+		n := w.filled[0].end - w.base
+		if i+n > w.size {
+			// up to the end of the ring, the rest comes next round
+			n = w.size - i
+		}
+		// writers never touch [base, base+n) until base moves past it
+		w.mu.Unlock()
+		_, err := out.Write(w.buf[i : i+n])
+		w.mu.Lock()
+		if err != nil {
+			w.failLocked(err)
+			return err
+		}
+		w.base += n
+		if w.filled[0].start = w.base; w.filled[0].start == w.filled[0].end {
+			w.filled = w.filled[1:]
+		}
+		w.cond.Broadcast()
+	}
+	return nil
+}
+
+// fail stops the stream with err, the first error wins.
+func (w *streamWindow) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failLocked(err)
+}
+
+func (w *streamWindow) failLocked(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+	w.cond.Broadcast()
+}
+
+// streamWriter writes the data of a part into the stream window.
+type streamWriter struct {
+	p *Part
+}
+
+func (s *streamWriter) Write(b []byte) (int, error) {
+	return s.p.stream.write(s.p.offset+s.p.getRead(), b)
+}
+
+// startStream downloads the file into d.stream, strictly in order.
+// Parallel connections fetch blocks ahead within the stream window, and
+// downloads that can't be split fall back to a single connection.
+// No part files are written and the download can't be resumed.
+func (d *Downloader) startStream() (err error) {
+	defer d.lw.Close()
+	// a stream leaves nothing to resume, drop the part directory
+	defer WarpRemoveAll(d.dlPath)
+
+	out := d.stream
+	if d.activeHasher != nil && (d.checksumConfig == nil || d.checksumConfig.Enabled) {
+		// hash while streaming, the data isn't kept anywhere to hash later
+		out = io.MultiWriter(out, d.activeHasher)
+	}
+	if partSize, _ := d.getPartSize(); partSize == -1 || !d.resumable {
+		d.Log("Streaming in a single connection...")
+		d.wg.Add(1)
+		err = d.downloadUnknownSizeFile(out)
+	} else {
+		err = d.streamParts(out)
+	}
+	if err == nil && d.ctx.Err() == nil {
+		err = d.matchChecksum()
+	}
+	if err != nil && d.IsStopped() {
+		d.Log("Download stopped")
+		d.handlers.DownloadStoppedHandler()
+		return nil
+	}
+	if err != nil {
+		d.Log("Stream failed: %v", err)
+		return err
+	}
+	d.handlers.DownloadCompleteHandler(MAIN_HASH, d.nread)
+	d.Log("Stream complete: %d bytes", d.nread)
+	return nil
+}
+
+// streamParts streams the file over d.numBaseParts connections.
+func (d *Downloader) streamParts(out io.Writer) error {
+	conns := d.numBaseParts
+	w := newStreamWindow(d.contentLength.v(), d.streamWindow, conns)
+	d.Log("Streaming over %d connections with a %s window", conns, ContentLength(w.size))
+	stopWatch := context.AfterFunc(d.ctx, func() {
+		w.fail(context.Canceled)
+	})
+	defer stopWatch()
+	for i := int32(0); i < conns; i++ {
+		d.wg.Add(1)
+		safeGo(d.l, d.wg, "stream-worker", func(r interface{}) {
+			w.fail(fmt.Errorf("panic: %v", r))
+		}, func() {
+			d.streamWorker(w)
+		})
+	}
+	err := w.emit(out)
+	if err != nil {
+		// stop the connections still fetching ahead
+		d.cancel()
+	}
+	d.wg.Wait()
+	return err
+}
+
+// streamWorker fetches blocks for the stream until there are none left.
+func (d *Downloader) streamWorker(w *streamWindow) {
+	for {
+		ioff, foff, ok := w.nextBlock()
+		if !ok {
+			return
+		}
+		p := &Part{
+			ctx:        d.ctx,
+			url:        d.url,
+			client:     d.client,
+			chunk:      int64(d.chunk),
+			hash:       newPartHash(),
+			offset:     ioff,
+			pfunc:      d.streamProgress,
+			ofunc:      func(string, int64) {},
+			l:          d.l,
+			speedLimit: d.partSpeedLimit(),
+			bandwidth:  d.bandwidth,
+			stream:     w,
+		}
+		if err := d.streamBlock(p, foff); err != nil {
+			d.handlers.ErrorHandler(p.hash, err)
+			w.fail(err)
+			return
+		}
+	}
+}
+
+// streamProgress counts the bytes of a stream block, which are done once
+// they are in the window as there's no compile step.
+func (d *Downloader) streamProgress(hash string, nread int) {
+	d.progressHandler(hash, nread)
+	atomic.AddInt64(&d.nread, int64(nread))
+}
+
+// streamBlock fetches the range of p up to foff, retrying transient errors
+// from where the previous attempt stopped.
+func (d *Downloader) streamBlock(p *Part, foff int64) error {
+	retryState := &RetryState{}
+	for {
+		body, _, err := p.download(d.headers, p.offset+p.getRead(), foff, true, d.requestTimeout)
+		if body != nil {
+			body.Close()
+		}
+		if err == nil {
+			return nil
+		}
+		if d.ctx.Err() != nil {
+			return d.ctx.Err()
+		}
+		category := ClassifyError(err)
+		if category == ErrCategoryFatal {
+			return err
+		}
+		retryState.Attempts++
+		retryState.LastError = err
+		retryState.LastAttempt = time.Now()
+		if !d.retryConfig.ShouldRetry(retryState, err) {
+			d.handlers.RetryExhaustedHandler(p.hash, retryState.Attempts, err)
+			return fmt.Errorf("%w: %v", ErrMaxRetriesExceeded, err)
+		}
+		delay := d.retryConfig.CalculateBackoff(retryState.Attempts)
+		d.Log("%s: Retry attempt %d/%d after %v (error: %s)",
+			p.hash, retryState.Attempts, d.retryConfig.MaxRetries, delay, err.Error())
+		d.handlers.RetryHandler(p.hash, retryState.Attempts, d.retryConfig.MaxRetries, delay, err)
+		if err := d.retryConfig.WaitForRetry(d.ctx, retryState, category); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package warplib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamWindow_OutOfOrderWrites(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuv")
+	w := newStreamWindow(int64(len(content)), 16, 2)
+	w.block = 4
+
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- w.emit(&out) }()
+
+	// blocks arrive out of order; the ring wraps once the first half is out
+	for _, off := range []int64{8, 4, 12, 0, 24, 16, 28, 20} {
+		for {
+			w.mu.Lock()
+			fits := off+4 <= w.base+w.size
+			w.mu.Unlock()
+			if fits {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if _, err := w.write(off, content[off:off+4]); err != nil {
+			t.Fatalf("write at %d: %v", off, err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("emitted %q, want %q", out.Bytes(), content)
+	}
+}
+
+func TestDownloader_Stream(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("streaming-data"), 100000)
+	srv := newRangeServer(t, content)
+	defer srv.Close()
+
+	var out bytes.Buffer
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: base,
+		MaxConnections:    4,
+		NumBaseParts:      4,
+		Stream:            &out,
+		StreamWindow:      256 * KB,
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("streamed %d bytes, content mismatch", out.Len())
+	}
+	if fileExists(d.GetSavePath()) {
+		t.Error("stream saved a file")
+	}
+	if dirExists(d.dlPath) {
+		t.Error("stream left its part directory behind")
+	}
+}
+
+// slowWriter lets through a limited number of bytes until released.
+type slowWriter struct {
+	written int64
+	limit   int64
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	if atomic.LoadInt64(&w.written)+int64(len(b)) > w.limit {
+		<-w.release
+	}
+	atomic.AddInt64(&w.written, int64(len(b)))
+	return w.buf.Write(b)
+}
+
+func TestDownloader_StreamBackPressure(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("back-pressure"), 200000)
+	var maxEnd int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		start, end := 0, len(content)-1
+		if rng := strings.TrimPrefix(r.Header.Get("Range"), "bytes="); rng != "" {
+			bounds := strings.SplitN(rng, "-", 2)
+			start, _ = strconv.Atoi(bounds[0])
+			if bounds[1] != "" {
+				end, _ = strconv.Atoi(bounds[1])
+			}
+			if start > 1 {
+				for {
+					cur := atomic.LoadInt64(&maxEnd)
+					if int64(end) <= cur || atomic.CompareAndSwapInt64(&maxEnd, cur, int64(end)) {
+						break
+					}
+				}
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		_, _ = w.Write(content[start : end+1])
+	}))
+	defer srv.Close()
+
+	const window = 256 * KB
+	out := &slowWriter{limit: 64 * KB, release: make(chan struct{})}
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: base,
+		MaxConnections:    4,
+		NumBaseParts:      4,
+		Stream:            out,
+		StreamWindow:      window,
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- d.Start() }()
+
+	time.Sleep(300 * time.Millisecond)
+	// the consumer is stuck at 64KB, so nothing past the window after it is fetched
+	if end := atomic.LoadInt64(&maxEnd); end >= out.limit+window {
+		t.Errorf("fetched up to %d with a consumer stuck at %d, window is %d", end, out.limit, window)
+	}
+	close(out.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !bytes.Equal(out.buf.Bytes(), content) {
+		t.Fatal("streamed content mismatch")
+	}
+}
+
+func TestDownloader_StreamUnknownSize(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("chunked"), 50000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// no Content-Length: sent chunked
+		for i := 0; i < len(content); i += 64 * 1024 {
+			end := i + 64*1024
+			if end > len(content) {
+				end = len(content)
+			}
+			_, _ = w.Write(content[i:end])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: base,
+		FileName:          "file.bin",
+		MaxConnections:    4,
+		Stream:            &out,
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("streamed %d bytes, want %d", out.Len(), len(content))
+	}
+}
+
+func TestDownloader_StreamConsumerGone(t *testing.T) {
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	content := bytes.Repeat([]byte("consumer-gone"), 200000)
+	srv := newRangeServer(t, content)
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: base,
+		MaxConnections:    4,
+		NumBaseParts:      4,
+		Stream:            pw,
+		StreamWindow:      256 * KB,
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	// like `| head -c 1000`
+	go func() {
+		io.ReadFull(pr, make([]byte, 1000))
+		pr.Close()
+	}()
+	done := make(chan error, 1)
+	go func() { done <- d.Start() }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Fatalf("Start = %v, want %v", err, io.ErrClosedPipe)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream didn't stop after the consumer went away")
+	}
+}
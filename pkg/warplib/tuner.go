@@ -0,0 +1,248 @@
+package warplib
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DEF_AUTO_START_CONNS is the connection count an auto-tuned download
+	// starts with when nothing is known about the host yet.
+	DEF_AUTO_START_CONNS = 2
+	// DEF_TUNE_INTERVAL is how long the throughput is measured at each
+	// connection count before the tuner decides on the next step.
+	DEF_TUNE_INTERVAL = 3 * time.Second
+	// tuneMinGain is the minimum throughput gain (in percent) that makes
+	// adding connections worth it.
+	tuneMinGain = 10
+	// hostConnsFileName is the file inside ConfigDir that stores the best
+	// connection count found per host.
+	hostConnsFileName = "conntune.json"
+)
+
+// hostConnsMu serializes access to the host connections file.
+var hostConnsMu sync.Mutex
+
+// connTuner finds the connection count that gives the best aggregate
+// throughput for a download. It starts small, doubles the count as long as
+// the throughput keeps improving and backs off when the server throttles
+// (429/503) or adding connections only lowers the per-connection speed.
+type connTuner struct {
+	host string
+	// ceiling is the maximum connection count the tuner may use.
+	ceiling int32
+	// limit is the connection count the download was started with,
+	// it doesn't change when the ceiling is lowered.
+	limit int32
+	// interval is the measuring period of each step.
+	interval time.Duration
+
+	// best is the connection count with the highest throughput so far
+	// and bestSpeed is that throughput in bytes per second.
+	best      int32
+	bestSpeed int64
+	// throttled is set (atomically) when a part gets a 429/503 response.
+	throttled int32
+	// warmup skips the next measurement, which covers the time new
+	// connections need to get going.
+	warmup  bool
+	settled bool
+}
+
+// initConnTuner sets up adaptive connection tuning for the download.
+// The current maxConn becomes the ceiling and the download starts with the
+// best count remembered for the host, or DEF_AUTO_START_CONNS.
+// Downloads whose connection count can't be changed live are left as is.
+func (d *Downloader) initConnTuner() {
+	if !d.resumable || d.contentLength.v() <= 0 || d.maxConn < 2 {
+		return
+	}
+	t := &connTuner{
+		host:     urlHost(d.url),
+		ceiling:  d.maxConn,
+		limit:    d.maxConn,
+		interval: DEF_TUNE_INTERVAL,
+		warmup:   true,
+	}
+	start := int32(DEF_AUTO_START_CONNS)
+	if n := loadHostConnections(t.host); n > 0 {
+		start = n
+	}
+	if start > t.ceiling {
+		start = t.ceiling
+	}
+	d.maxConn = start
+	d.tuner = t
+	d.Log("Auto connections: starting with %d (max %d) for %s", start, t.ceiling, t.host)
+}
+
+// startConnTuner runs the tuner until the download ends.
+// The returned function stops it.
+func (d *Downloader) startConnTuner() (stop func()) {
+	if d.tuner == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(d.tuner.interval)
+		defer ticker.Stop()
+		last, lastTime := atomic.LoadInt64(&d.received), time.Now()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-done:
+				return
+			case now := <-ticker.C:
+				read := atomic.LoadInt64(&d.received)
+				elapsed := now.Sub(lastTime)
+				if elapsed <= 0 {
+					continue
+				}
+				speed := (read - last) * int64(time.Second) / int64(elapsed)
+				last, lastTime = read, now
+				d.tuneStep(speed)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// tuneStep decides on the next connection count given the aggregate
+// throughput measured at the current one.
+func (d *Downloader) tuneStep(speed int64) {
+	t := d.tuner
+	conns := d.GetMaxConnections()
+
+	if atomic.SwapInt32(&t.throttled, 0) == 1 {
+		n := conns / 2
+		if n < 1 {
+			n = 1
+		}
+		// never probe the throttled count again
+		t.ceiling = n
+		t.best, t.bestSpeed = n, 0
+		d.applyTunedConnections(conns, n, "server is throttling (429/503)")
+		t.settle(d)
+		return
+	}
+	if t.settled {
+		return
+	}
+	if t.warmup {
+		t.warmup = false
+		return
+	}
+
+	if t.bestSpeed == 0 || speed*100 >= t.bestSpeed*(100+tuneMinGain) {
+		t.best, t.bestSpeed = conns, speed
+		if conns >= t.ceiling {
+			d.Log("Auto connections: reached max of %d at %s/s", conns, ContentLength(speed))
+			t.settle(d)
+			return
+		}
+		n := conns * 2
+		if n > t.ceiling {
+			n = t.ceiling
+		}
+		d.applyTunedConnections(conns, n, "throughput improved to "+ContentLength(speed).String()+"/s")
+		return
+	}
+
+	// More connections didn't pay off: each one got slower.
+	if conns > t.best {
+		d.applyTunedConnections(conns, t.best,
+			"per-connection speed fell to "+ContentLength(speed/int64(conns)).String()+"/s")
+	}
+	t.settle(d)
+}
+
+// applyTunedConnections changes the connection count and reports it.
+func (d *Downloader) applyTunedConnections(old, n int32, reason string) {
+	if old == n {
+		return
+	}
+	if err := d.SetMaxConnections(n); err != nil {
+		d.Log("Auto connections: failed to change to %d: %v", n, err)
+		return
+	}
+	d.tuner.warmup = true
+	d.Log("Auto connections: %d => %d (%s)", old, n, reason)
+	d.handlers.ConnTuneHandler(old, n, reason)
+}
+
+// settle stops probing and remembers the best count for the host.
+func (t *connTuner) settle(d *Downloader) {
+	t.settled = true
+	if err := saveHostConnections(t.host, t.best); err != nil {
+		d.Log("Auto connections: failed to save best count for %s: %v", t.host, err)
+		return
+	}
+	d.Log("Auto connections: settled on %d for %s", t.best, t.host)
+}
+
+// markThrottled records that the server answered with 429 or 503.
+func (t *connTuner) markThrottled() {
+	atomic.StoreInt32(&t.throttled, 1)
+}
+
+// urlHost returns the host name of the given url, without the port.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Hostname()
+}
+
+func hostConnsPath() string {
+	return filepath.Join(ConfigDir, hostConnsFileName)
+}
+
+// readHostConnections reads the remembered connection counts.
+// A missing or unreadable file results in an empty map.
+func readHostConnections() map[string]int32 {
+	conns := make(map[string]int32)
+	data, err := os.ReadFile(hostConnsPath())
+	if err != nil {
+		return conns
+	}
+	_ = json.Unmarshal(data, &conns)
+	return conns
+}
+
+// loadHostConnections returns the best connection count found for host
+// by an earlier auto-tuned download, or 0 if there is none.
+func loadHostConnections(host string) int32 {
+	hostConnsMu.Lock()
+	defer hostConnsMu.Unlock()
+	return readHostConnections()[host]
+}
+
+// saveHostConnections remembers n as the best connection count for host.
+func saveHostConnections(host string, n int32) error {
+	if host == "" || n < 1 {
+		return nil
+	}
+	hostConnsMu.Lock()
+	defer hostConnsMu.Unlock()
+	conns := readHostConnections()
+	if conns[host] == n {
+		return nil
+	}
+	conns[host] = n
+	data, err := json.MarshalIndent(conns, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := hostConnsPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return WarpRename(tmp, hostConnsPath())
+}
@@ -0,0 +1,258 @@
+package warplib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostConnections_SaveLoad(t *testing.T) {
+	if err := SetConfigDir(t.TempDir()); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	if n := loadHostConnections("example.com"); n != 0 {
+		t.Fatalf("loadHostConnections on empty store = %d, want 0", n)
+	}
+	if err := saveHostConnections("example.com", 6); err != nil {
+		t.Fatalf("saveHostConnections: %v", err)
+	}
+	if err := saveHostConnections("other.org:8080", 2); err != nil {
+		t.Fatalf("saveHostConnections: %v", err)
+	}
+	if n := loadHostConnections("example.com"); n != 6 {
+		t.Errorf("loadHostConnections(example.com) = %d, want 6", n)
+	}
+	if n := loadHostConnections("other.org:8080"); n != 2 {
+		t.Errorf("loadHostConnections(other.org:8080) = %d, want 2", n)
+	}
+
+	// A corrupt file is treated as empty.
+	if err := os.WriteFile(hostConnsPath(), []byte("{"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if n := loadHostConnections("example.com"); n != 0 {
+		t.Errorf("loadHostConnections on corrupt store = %d, want 0", n)
+	}
+}
+
+func TestDownloader_InitConnTuner(t *testing.T) {
+	if err := SetConfigDir(t.TempDir()); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	newDl := func(maxConn int32) *Downloader {
+		return &Downloader{
+			url:           "http://files.example.com/a.bin",
+			resumable:     true,
+			contentLength: ContentLength(100 * MB),
+			maxConn:       maxConn,
+			l:             log.New(io.Discard, "", 0),
+		}
+	}
+
+	d := newDl(16)
+	d.initConnTuner()
+	if d.tuner == nil {
+		t.Fatal("tuner not set up")
+	}
+	if d.maxConn != DEF_AUTO_START_CONNS || d.tuner.ceiling != 16 {
+		t.Errorf("maxConn=%d ceiling=%d, want %d and 16", d.maxConn, d.tuner.ceiling, DEF_AUTO_START_CONNS)
+	}
+
+	// The remembered count is used, capped at the ceiling.
+	if err := saveHostConnections("files.example.com", 12); err != nil {
+		t.Fatalf("saveHostConnections: %v", err)
+	}
+	d = newDl(16)
+	d.initConnTuner()
+	if d.maxConn != 12 {
+		t.Errorf("maxConn with remembered count = %d, want 12", d.maxConn)
+	}
+	d = newDl(8)
+	d.initConnTuner()
+	if d.maxConn != 8 {
+		t.Errorf("maxConn with lower ceiling = %d, want 8", d.maxConn)
+	}
+
+	d = newDl(16)
+	d.resumable = false
+	d.initConnTuner()
+	if d.tuner != nil || d.maxConn != 16 {
+		t.Errorf("non-resumable download should not be tuned")
+	}
+}
+
+type tuneChange struct {
+	old, new int32
+}
+
+func newTuneTestDownloader(t *testing.T, conns, ceiling int32) (*Downloader, *[]tuneChange) {
+	t.Helper()
+	if err := SetConfigDir(t.TempDir()); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	d, _ := newLiveTestDownloader(40*MB, 40*MB)
+	d.url = "http://tune.example.com/file"
+	d.maxConn = conns
+	var changes []tuneChange
+	d.handlers = &Handlers{
+		ConnTuneHandler: func(oldConns, newConns int32, _ string) {
+			changes = append(changes, tuneChange{oldConns, newConns})
+		},
+	}
+	d.handlers.setDefault(d.l)
+	d.tuner = &connTuner{host: urlHost(d.url), ceiling: ceiling, interval: time.Second}
+	return d, &changes
+}
+
+func TestDownloader_TuneStep(t *testing.T) {
+	d, changes := newTuneTestDownloader(t, 2, 8)
+
+	// Each change is followed by a warmup period that isn't measured.
+	for _, speed := range []int64{
+		100 * KB,
+		0, 190 * KB, // 90% better with 4
+		0, 200 * KB, // only 5% better with 8
+	} {
+		d.tuneStep(speed)
+	}
+
+	want := []tuneChange{{2, 4}, {4, 8}, {8, 4}}
+	if len(*changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", *changes, want)
+	}
+	for i, c := range want {
+		if (*changes)[i] != c {
+			t.Errorf("change %d = %v, want %v", i, (*changes)[i], c)
+		}
+	}
+	if !d.tuner.settled || d.GetMaxConnections() != 4 {
+		t.Errorf("settled=%v conns=%d, want settled at 4", d.tuner.settled, d.GetMaxConnections())
+	}
+	if n := loadHostConnections("tune.example.com"); n != 4 {
+		t.Errorf("remembered count = %d, want 4", n)
+	}
+
+	// Once settled, throughput changes are ignored.
+	d.tuneStep(10 * MB)
+	if len(*changes) != 3 {
+		t.Errorf("settled tuner changed connections: %v", *changes)
+	}
+}
+
+func TestDownloader_TuneStep_Ceiling(t *testing.T) {
+	d, changes := newTuneTestDownloader(t, 2, 3)
+
+	d.tuneStep(100 * KB)
+	d.tuneStep(0)
+	d.tuneStep(150 * KB)
+	if len(*changes) != 1 || (*changes)[0] != (tuneChange{2, 3}) {
+		t.Fatalf("changes = %v, want [{2 3}]", *changes)
+	}
+	if !d.tuner.settled || loadHostConnections("tune.example.com") != 3 {
+		t.Errorf("tuner should settle at the ceiling")
+	}
+}
+
+func TestDownloader_TuneStep_Throttled(t *testing.T) {
+	d, changes := newTuneTestDownloader(t, 8, 16)
+
+	d.tuner.markThrottled()
+	d.tuneStep(MB)
+	if len(*changes) != 1 || (*changes)[0] != (tuneChange{8, 4}) {
+		t.Fatalf("changes = %v, want [{8 4}]", *changes)
+	}
+	if d.tuner.ceiling != 4 || !d.tuner.settled {
+		t.Errorf("ceiling=%d settled=%v, want 4 and settled", d.tuner.ceiling, d.tuner.settled)
+	}
+
+	// Throttling again keeps backing off, even when settled.
+	d.tuner.markThrottled()
+	d.tuneStep(MB)
+	if d.GetMaxConnections() != 2 {
+		t.Errorf("conns after second throttle = %d, want 2", d.GetMaxConnections())
+	}
+	if n := loadHostConnections("tune.example.com"); n != 2 {
+		t.Errorf("remembered count = %d, want 2", n)
+	}
+}
+
+func TestPart_DownloadThrottled(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "slow down", status)
+		}))
+		p := &Part{ctx: context.Background(), client: srv.Client(), url: srv.URL}
+		_, _, err := p.download(nil, 0, 99, true, 0)
+		srv.Close()
+		if !errors.Is(err, ErrServerThrottled) {
+			t.Fatalf("status %d: err = %v, want ErrServerThrottled", status, err)
+		}
+		if c := ClassifyError(err); c != ErrCategoryThrottled {
+			t.Errorf("status %d: category = %v, want throttled", status, c)
+		}
+	}
+}
+
+func TestDownloader_AutoConnections(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	base := t.TempDir()
+	if err := SetConfigDir(base); err != nil {
+		t.Fatalf("SetConfigDir: %v", err)
+	}
+	// big enough for the running parts to be split a few times
+	content := bytes.Repeat([]byte("auto-connections"), 6*int(MB)/16)
+	srv := newDelayedRangeServer(t, content, time.Millisecond)
+	defer srv.Close()
+
+	var raised atomic.Bool
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/file.bin", &DownloaderOpts{
+		DownloadDirectory: base,
+		MaxConnections:    8,
+		MaxSegments:       32,
+		NumBaseParts:      8,
+		AutoConnections:   true,
+		Handlers: &Handlers{
+			ConnTuneHandler: func(oldConns, newConns int32, _ string) {
+				if newConns > oldConns {
+					raised.Store(true)
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	defer d.Close()
+	if d.GetMaxConnections() != DEF_AUTO_START_CONNS || d.numBaseParts != DEF_AUTO_START_CONNS {
+		t.Fatalf("conns=%d baseParts=%d, want to start with %d",
+			d.GetMaxConnections(), d.numBaseParts, DEF_AUTO_START_CONNS)
+	}
+	d.tuner.interval = 100 * time.Millisecond
+
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	got, err := os.ReadFile(d.GetSavePath())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("downloaded content mismatch")
+	}
+	if !raised.Load() {
+		t.Error("connections were not raised while downloading")
+	}
+	if n := loadHostConnections(urlHost(srv.URL)); n < DEF_AUTO_START_CONNS {
+		t.Errorf("remembered count = %d, want at least %d", n, DEF_AUTO_START_CONNS)
+	}
+}
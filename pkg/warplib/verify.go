@@ -0,0 +1,379 @@
+package warplib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// VerifyStatus is the state a verification finds the file of a completed
+// download in.
+type VerifyStatus string
+
+const (
+	// VerifyOK is a file matching its checksum at its path.
+	VerifyOK VerifyStatus = "ok"
+	// VerifyModified is a file which doesn't match its checksum anymore.
+	VerifyModified VerifyStatus = "modified"
+	// VerifyMissing is a file found neither at its path nor in the
+	// directories searched.
+	VerifyMissing VerifyStatus = "missing"
+	// VerifyMoved is a file found intact in one of the directories
+	// searched. The download is updated to point to it.
+	VerifyMoved VerifyStatus = "moved"
+	// VerifyUnrecorded is a file of a download without a checksum or
+	// piece hashes to verify it against. The checksum computed is kept
+	// from then on.
+	VerifyUnrecorded VerifyStatus = "unrecorded"
+	// VerifyFailed is a file which couldn't be read.
+	VerifyFailed VerifyStatus = "failed"
+)
+
+// verifyProgressStep is the number of bytes hashed between two calls of
+// the progress handler of a verification.
+const verifyProgressStep = 4 * MB
+
+// VerifyOpts are the options of Manager.VerifyDownloads.
+type VerifyOpts struct {
+	// SearchDirs are the directories, searched recursively, where the
+	// files missing from their path may have been moved to.
+	SearchDirs []string
+	// Redownload downloads the missing and modified files again, which
+	// needs the piece hashes of the download.
+	Redownload bool
+	// MaxConnections is the number of connections used to download the
+	// files again. If zero, DEF_MAX_CONNS is used.
+	MaxConnections int32
+	// ProgressHandler is called as the file of the download with the
+	// given hash is hashed, with the number of bytes hashed so far.
+	ProgressHandler func(hash string, hashed int64)
+	// ResultHandler is called with the result of each download once it
+	// is verified.
+	ResultHandler func(res *VerifyResult)
+}
+
+// VerifyResult is the outcome of the verification of a download.
+type VerifyResult struct {
+	// Hash is the hash of the download.
+	Hash string `json:"hash"`
+	// Name is the file name of the download.
+	Name string `json:"name"`
+	// Path is where the file was verified, its new path if it moved.
+	Path string `json:"path"`
+	// Size is the size of the download.
+	Size int64 `json:"size"`
+	// Status is the state the file was found in.
+	Status VerifyStatus `json:"status"`
+	// MovedFrom is the previous path of a moved file.
+	MovedFrom string `json:"moved_from,omitempty"`
+	// Checksum is the checksum computed from the file, as
+	// "algorithm:hex", empty if it wasn't hashed.
+	Checksum string `json:"checksum,omitempty"`
+	// Redownloaded is set when the file was downloaded again and then
+	// matched its checksum.
+	Redownloaded bool `json:"redownloaded,omitempty"`
+	// Error is why the file couldn't be verified or downloaded again.
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyDownloads rehashes the files of the completed downloads with the
+// given hashes, or of all of them if none is given, and compares them
+// with the checksums kept when they were downloaded. It blocks until all
+// of them are verified and returns their results in order.
+func (m *Manager) VerifyDownloads(client *http.Client, hashes []string, opts *VerifyOpts) ([]*VerifyResult, error) {
+	if opts == nil {
+		opts = &VerifyOpts{}
+	}
+	var items []*Item
+	if len(hashes) == 0 {
+		for _, item := range m.GetItems() {
+			if isComplete(item) {
+				items = append(items, item)
+			}
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].DateAdded.Before(items[j].DateAdded)
+		})
+	}
+	for _, hash := range hashes {
+		item := m.GetItem(hash)
+		if item == nil {
+			return nil, ErrDownloadNotFound
+		}
+		if !isComplete(item) {
+			return nil, ErrVerifyIncomplete
+		}
+		items = append(items, item)
+	}
+
+	results := make([]*VerifyResult, 0, len(items))
+	for _, item := range items {
+		res := m.verifyItem(client, item, opts)
+		if opts.ResultHandler != nil {
+			opts.ResultHandler(res)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// verifyItem verifies the file of a completed download, looking for it in
+// the search directories if it is missing and downloading it again if
+// asked to.
+func (m *Manager) verifyItem(client *http.Client, item *Item, opts *VerifyOpts) *VerifyResult {
+	item.mu.RLock()
+	path, size := item.GetAbsolutePath(), item.TotalSize.v()
+	want, pieces := item.Hashes, item.Pieces
+	if len(want) == 0 {
+		want = item.Checksums
+	}
+	if !pieces.valid(size) {
+		pieces = nil
+	}
+	res := &VerifyResult{Hash: item.Hash, Name: item.Name, Path: path, Size: size}
+	item.mu.RUnlock()
+
+	progress := func(hashed int64) {
+		if opts.ProgressHandler != nil {
+			opts.ProgressHandler(item.Hash, hashed)
+		}
+	}
+	_, err := WarpStat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		res.Status = VerifyMissing
+		if moved, sum := m.findMoved(item, want, pieces, opts.SearchDirs, progress); moved != "" {
+			res.Status, res.MovedFrom, res.Path = VerifyMoved, path, moved
+			res.Checksum = sum
+		}
+	case err != nil:
+		res.Status, res.Error = VerifyFailed, err.Error()
+	default:
+		res.Status, res.Checksum, err = verifyFile(path, size, want, pieces, progress)
+		if err != nil {
+			res.Status, res.Error = VerifyFailed, err.Error()
+		}
+	}
+
+	if opts.Redownload && (res.Status == VerifyMissing || res.Status == VerifyModified) {
+		m.redownload(client, item, want, pieces, res, opts, progress)
+	}
+
+	item.mu.Lock()
+	switch {
+	case res.Status == VerifyMoved:
+		dir := filepath.Dir(res.Path)
+		item.DownloadLocation, item.AbsoluteLocation = dir, dir
+		item.VerifiedAt = time.Now()
+	case res.Status == VerifyOK || res.Redownloaded:
+		item.VerifiedAt = time.Now()
+	case res.Status == VerifyUnrecorded:
+	default:
+		item.mu.Unlock()
+		return res
+	}
+	// the checksum of a file only checked against its pieces, or not
+	// at all, is kept from its first verification
+	if len(item.Hashes) == 0 && len(want) > 0 {
+		item.Hashes = want
+	} else if cs, err := ParseChecksum(res.Checksum); len(item.Hashes) == 0 && err == nil {
+		item.Hashes = []ExpectedChecksum{cs}
+	}
+	item.mu.Unlock()
+	m.UpdateItem(item)
+	return res
+}
+
+// verifyFile hashes the file at path with the algorithms of the wanted
+// checksums, or SHA-256 if there are none, and tells whether it matches
+// them. Without wanted checksums, the file is checked against its piece
+// hashes if it has any. The checksum returned is the strongest one
+// computed.
+func verifyFile(path string, size int64, want []ExpectedChecksum, pieces *PieceHashes, progress func(int64)) (VerifyStatus, string, error) {
+	stat, err := WarpStat(path)
+	if err != nil {
+		return "", "", err
+	}
+	if len(want) == 0 && pieces != nil {
+		if stat.Size() != size {
+			return VerifyModified, "", nil
+		}
+		sums, intact, err := hashFilePieces(path, size, pieces, progress)
+		if err != nil {
+			return "", "", err
+		}
+		if !intact {
+			return VerifyModified, sums[0].String(), nil
+		}
+		return VerifyOK, sums[0].String(), nil
+	}
+	if len(want) > 0 && stat.Size() != size {
+		return VerifyModified, "", nil
+	}
+	sums, err := hashFileSums(path, want, progress)
+	if err != nil {
+		return "", "", err
+	}
+	best := sums[0]
+	if algo := SelectBestAlgorithm(sums); algo != "" {
+		for _, cs := range sums {
+			if cs.Algorithm == algo {
+				best = cs
+			}
+		}
+	}
+	if len(want) == 0 {
+		return VerifyUnrecorded, best.String(), nil
+	}
+	if !sameSums(want, sums) {
+		return VerifyModified, best.String(), nil
+	}
+	return VerifyOK, best.String(), nil
+}
+
+// hashFileSums hashes the file at path with the algorithms of the given
+// checksums, or SHA-256 if there are none.
+func hashFileSums(path string, checksums []ExpectedChecksum, progress func(int64)) ([]ExpectedChecksum, error) {
+	algos := []ChecksumAlgorithm{ChecksumSHA256}
+	if len(checksums) > 0 {
+		algos = algos[:0]
+		for _, cs := range checksums {
+			algos = append(algos, cs.Algorithm)
+		}
+	}
+	h, err := NewMultiHasher(algos...)
+	if err != nil {
+		return nil, err
+	}
+	f, err := WarpOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, verifyProgressStep)
+	var hashed int64
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			hashed += int64(n)
+			progress(hashed)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h.Sums(), nil
+}
+
+// hashFilePieces hashes the file at path with SHA-256 and checks its
+// pieces in the same pass, reporting whether they all match.
+func hashFilePieces(path string, size int64, pieces *PieceHashes, progress func(int64)) ([]ExpectedChecksum, bool, error) {
+	h, err := NewMultiHasher(ChecksumSHA256)
+	if err != nil {
+		return nil, false, err
+	}
+	ph, err := NewHasher(pieces.Algorithm)
+	if err != nil {
+		return nil, false, err
+	}
+	f, err := WarpOpen(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	var (
+		r      = io.TeeReader(f, h)
+		buf    = make([]byte, 32*KB)
+		intact = true
+		hashed int64
+	)
+	for i, want := range pieces.Hashes {
+		ioff, foff := pieces.Range(i, size)
+		ph.Reset()
+		n, err := io.CopyBuffer(ph, io.LimitReader(r, foff-ioff+1), buf)
+		if err != nil {
+			return nil, false, err
+		}
+		if n != foff-ioff+1 || !bytes.Equal(ph.Sum(nil), want) {
+			intact = false
+		}
+		hashed += n
+		progress(hashed)
+	}
+	return h.Sums(), intact, nil
+}
+
+// sameSums reports whether every wanted checksum matches the one computed
+// with its algorithm.
+func sameSums(want, sums []ExpectedChecksum) bool {
+	for _, w := range want {
+		for _, s := range sums {
+			if s.Algorithm == w.Algorithm && !bytes.Equal(s.Value, w.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// findMoved looks for the file of a download in dirs: a file with the same
+// name and size matching its checksums or piece hashes. It returns its
+// path and checksum, empty if it wasn't found or the download has nothing
+// to recognize it by.
+func (m *Manager) findMoved(item *Item, want []ExpectedChecksum, pieces *PieceHashes, dirs []string, progress func(int64)) (string, string) {
+	if len(want) == 0 && pieces == nil {
+		return "", ""
+	}
+	item.mu.RLock()
+	name, size := item.Name, item.TotalSize.v()
+	item.mu.RUnlock()
+	var found, sum string
+	for _, dir := range dirs {
+		_ = filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+			if err != nil || e.IsDir() || e.Name() != name {
+				return nil
+			}
+			if info, err := e.Info(); err != nil || !info.Mode().IsRegular() || info.Size() != size {
+				return nil
+			}
+			if status, s, err := verifyFile(path, size, want, pieces, progress); err == nil && status == VerifyOK {
+				found, sum = path, s
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if found != "" {
+			return found, sum
+		}
+	}
+	return "", ""
+}
+
+// redownload repairs the missing or modified file of a download from its
+// piece hashes and verifies it again.
+func (m *Manager) redownload(client *http.Client, item *Item, want []ExpectedChecksum, pieces *PieceHashes, res *VerifyResult, opts *VerifyOpts, progress func(int64)) {
+	_, err := m.RepairDownload(client, item.Hash, &RepairOpts{MaxConnections: opts.MaxConnections})
+	if err != nil {
+		res.Error = err.Error()
+		return
+	}
+	status, sum, err := verifyFile(res.Path, res.Size, want, pieces, progress)
+	if err != nil {
+		res.Error = err.Error()
+		return
+	}
+	if status == VerifyModified {
+		res.Error = ErrChecksumMismatch.Error()
+		return
+	}
+	res.Checksum, res.Redownloaded = sum, true
+}
@@ -0,0 +1,115 @@
+package warplib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManagerVerifyDownloads(t *testing.T) {
+	m := newTestManager(t)
+	defer m.Close()
+	content := make([]byte, 2*MB+100)
+	rand.New(rand.NewSource(3)).Read(content)
+	srv := newRangeServer(t, content)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d, err := NewDownloader(&http.Client{}, srv.URL+"/archive.bin", &DownloaderOpts{
+		DownloadDirectory: dir,
+		FileName:          "archive.bin",
+		MaxConnections:    2,
+		Handlers:          &Handlers{},
+	})
+	if err != nil {
+		t.Fatalf("NewDownloader: %v", err)
+	}
+	if err := m.AddDownload(d, &AddDownloadOpts{AbsoluteLocation: dir}); err != nil {
+		t.Fatalf("AddDownload: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	hash := d.GetHash()
+	item := m.GetItem(hash)
+	// without an expected checksum, the file isn't hashed at completion
+	if len(item.Hashes) != 0 || item.Pieces == nil {
+		t.Fatalf("hashes = %+v, pieces %v after the download", item.Hashes, item.Pieces)
+	}
+
+	verify := func(opts *VerifyOpts) *VerifyResult {
+		t.Helper()
+		res, err := m.VerifyDownloads(&http.Client{}, []string{hash}, opts)
+		if err != nil || len(res) != 1 {
+			t.Fatalf("VerifyDownloads = %+v, %v", res, err)
+		}
+		return res[0]
+	}
+	path := d.GetSavePath()
+	modified := append([]byte{}, content...)
+	modified[MB] ^= 0xff
+	if err := os.WriteFile(path, modified, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res := verify(nil); res.Status != VerifyModified || len(item.Hashes) != 0 {
+		t.Errorf("verify(modified, pieces only) = %+v, hashes %+v", res, item.Hashes)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var hashed int64
+	res := verify(&VerifyOpts{ProgressHandler: func(h string, n int64) { hashed = n }})
+	sum := sha256.Sum256(content)
+	if len(item.Hashes) != 1 || item.Hashes[0].Algorithm != ChecksumSHA256 || !bytes.Equal(item.Hashes[0].Value, sum[:]) {
+		t.Fatalf("recorded hashes = %+v", item.Hashes)
+	}
+	if res.Status != VerifyOK || res.Checksum != item.Hashes[0].String() || hashed != int64(len(content)) || item.VerifiedAt.IsZero() {
+		t.Errorf("verify(intact) = %+v after %d bytes", res, hashed)
+	}
+
+	if err := os.WriteFile(path, modified, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res := verify(nil); res.Status != VerifyModified {
+		t.Errorf("verify(modified) = %+v", res)
+	}
+	res = verify(&VerifyOpts{Redownload: true})
+	if res.Status != VerifyModified || !res.Redownloaded || res.Error != "" {
+		t.Errorf("verify(modified, redownload) = %+v", res)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, content) {
+		t.Error("file not downloaded again")
+	}
+
+	archive := filepath.Join(t.TempDir(), "2026", "archive.bin")
+	if err := os.MkdirAll(filepath.Dir(archive), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path, archive); err != nil {
+		t.Fatal(err)
+	}
+	if res := verify(nil); res.Status != VerifyMissing {
+		t.Errorf("verify(missing) = %+v", res)
+	}
+	res = verify(&VerifyOpts{SearchDirs: []string{dir, filepath.Dir(filepath.Dir(archive))}})
+	if res.Status != VerifyMoved || res.Path != archive || res.MovedFrom != path || item.GetAbsolutePath() != archive {
+		t.Errorf("verify(moved) = %+v, item at %s", res, item.GetAbsolutePath())
+	}
+
+	item.Hashes, item.Pieces = nil, nil
+	if res := verify(nil); res.Status != VerifyUnrecorded || len(item.Hashes) != 1 || item.Hashes[0].String() != res.Checksum {
+		t.Errorf("verify(unrecorded) = %+v, hashes %+v", res, item.Hashes)
+	}
+	if all, err := m.VerifyDownloads(&http.Client{}, nil, nil); err != nil || len(all) != 1 || all[0].Status != VerifyOK {
+		t.Errorf("VerifyDownloads(all) = %+v, %v", all, err)
+	}
+	if _, err := m.VerifyDownloads(&http.Client{}, []string{"nope"}, nil); !errors.Is(err, ErrDownloadNotFound) {
+		t.Errorf("VerifyDownloads(unknown) = %v", err)
+	}
+}
@@ -20,13 +20,19 @@ func NewVMap[kT comparable, vT any]() VMap[kT, vT] {
 
 // Make initializes the internal map. Call this to reset the map or if using a zero-value VMap.
 func (vm *VMap[kT, vT]) Make() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
 	vm.kv = make(map[kT]vT)
 }
 
 // Set stores a value for the given key with write lock protection.
+// A zero-value VMap is initialized on the first Set.
 func (vm *VMap[kT, vT]) Set(key kT, val vT) {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
+	if vm.kv == nil {
+		vm.kv = make(map[kT]vT)
+	}
 	vm.kv[key] = val
 }
 
@@ -106,9 +106,10 @@ func shouldAttemptWorkSteal(completionSpeed, adjacentRemaining int64) bool {
 		adjacentRemaining > WORK_STEAL_MIN_REMAINING
 }
 
-// activePartInfo tracks runtime state of an active downloading part for work stealing.
-// This struct is used to coordinate work stealing between parts.
+// activePartInfo tracks runtime state of an active downloading part.
+// It is used to coordinate work stealing and live option changes between parts.
 type activePartInfo struct {
+	part   *Part      // The running part
 	hash   string     // Unique identifier for the part
 	offset int64      // Initial byte offset (starting position)
 	foff   *int64     // Pointer to final offset (can be reduced by work stealing)
@@ -171,27 +172,24 @@ func findBestVictimForStealing(activeParts *VMap[string, *activePartInfo]) *acti
 	return best
 }
 
-// registerActivePart registers a part for potential work stealing.
+// registerActivePart registers a part for work stealing and live option changes.
 // Called when a part starts downloading.
 func (d *Downloader) registerActivePart(part *Part, foff *int64) {
-	if !d.enableWorkStealing {
-		return
-	}
 	d.activeParts.Set(part.hash, &activePartInfo{
+		part:   part,
 		hash:   part.hash,
 		offset: part.offset,
 		foff:   foff,
 		read:   &part.read,
 	})
+	d.rebalanceSpeedLimit()
 }
 
-// unregisterActivePart removes a completed part from the work stealing pool.
+// unregisterActivePart removes a completed part from the active part pool.
 // Called when a part finishes downloading.
 func (d *Downloader) unregisterActivePart(hash string) {
-	if !d.enableWorkStealing {
-		return
-	}
 	d.activeParts.Delete(hash)
+	d.rebalanceSpeedLimit()
 }
 
 // attemptWorkSteal tries to steal work from a slow part after fast completion.
@@ -211,7 +209,7 @@ func (d *Downloader) attemptWorkSteal(stealerHash string, partSpeed int64) bool
 	}
 
 	// Check connection limit (use atomic load for thread safety)
-	if d.maxConn != 0 && atomic.LoadInt32(&d.numConn) >= d.maxConn {
+	if d.connLimitReached() {
 		d.Log("%s: work steal skipped - connection limit reached", stealerHash)
 		return false
 	}
@@ -259,6 +257,7 @@ func (d *Downloader) attemptWorkSteal(stealerHash string, partSpeed int64) bool
 
 	d.Log("%s: stealing work from %s | bytes %d-%d", stealerHash, victim.hash, stealStart, stealEnd)
 	d.handlers.WorkStealHandler(stealerHash, victim.hash, stealStart, stealEnd)
+	d.journalRange(journalResize, victim.hash, victim.offset, newVictimFoff)
 
 	// Spawn new part to handle stolen range
 	d.wg.Add(1)